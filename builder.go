@@ -0,0 +1,108 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package frugal
+
+import (
+    `fmt`
+
+    `github.com/cloudwego/frugal/internal/binary/decoder`
+    `github.com/cloudwego/frugal/iov`
+)
+
+// Decoder is a decoder with its own set of options, created by DecoderBuilder.Build.
+// It is immutable and safe for concurrent use. Call Release on it once it is no
+// longer needed.
+type Decoder = decoder.Pipeline
+
+// DecoderBuilder collects the options of a Decoder. Every method returns a new
+// builder, so a partially configured builder can be shared and extended.
+type DecoderBuilder struct {
+    cf decoder.Config
+}
+
+// NewDecoder starts building a Decoder, which behaves like DecodeObject unless
+// configured otherwise, for example:
+//
+//     dec := frugal.NewDecoder().WithLimits(1 << 20).WithZeroCopy().WithMask(1, 3).Build()
+//
+func NewDecoder() DecoderBuilder {
+    return DecoderBuilder{}
+}
+
+// WithLimits limits the memory allocated for every message to maxAllocBytes, and
+// returns a BudgetError if a message needs more, see SetMaxAllocBytes.
+func (self DecoderBuilder) WithLimits(maxAllocBytes int) DecoderBuilder {
+    if maxAllocBytes <= 0 {
+        panic(fmt.Sprintf("frugal: invalid allocation limit: %d", maxAllocBytes))
+    } else {
+        self.cf.MaxAllocBytes = maxAllocBytes
+        return self
+    }
+}
+
+// WithZeroCopy makes every string and binary field refer to the input buffer,
+// as if they were tagged with "nocopy". The buffer must not be modified as long
+// as the decoded values are in use.
+func (self DecoderBuilder) WithZeroCopy() DecoderBuilder {
+    self.cf.ZeroCopy = true
+    return self
+}
+
+// WithChecked bounds-checks every read from the input buffer, see DecodeObjectChecked.
+func (self DecoderBuilder) WithChecked() DecoderBuilder {
+    self.cf.Checked = true
+    return self
+}
+
+// WithMask only decodes the fields listed in fieldIDs of the outermost struct, all
+// the other fields are skipped, see CompilePartialDecoder.
+func (self DecoderBuilder) WithMask(fieldIDs ...int16) DecoderBuilder {
+    ids := make([]uint16, 0, len(fieldIDs))
+
+    /* convert the field IDs */
+    for _, id := range fieldIDs {
+        if id < 0 {
+            panic(fmt.Sprintf("frugal: invalid field ID %d", id))
+        } else {
+            ids = append(ids, uint16(id))
+        }
+    }
+
+    /* replace the previous mask */
+    self.cf.Fields = ids
+    return self
+}
+
+// WithSpill moves the values of iov.Blob fields that are longer than threshold
+// bytes to sink instead of copying them, so the decoded struct only holds a
+// handle to each of them, see iov.TempFileSink. Shorter values are decoded into
+// Blob.Data as usual.
+func (self DecoderBuilder) WithSpill(threshold int, sink iov.SpillSink) DecoderBuilder {
+    if threshold < 0 {
+        panic(fmt.Sprintf("frugal: invalid spill threshold: %d", threshold))
+    } else if sink == nil {
+        panic("frugal: spill sink must not be nil")
+    } else {
+        self.cf.SpillSize, self.cf.SpillSink = threshold, sink
+        return self
+    }
+}
+
+// Build creates the Decoder with the options collected so far.
+func (self DecoderBuilder) Build() *Decoder {
+    return decoder.NewPipeline(self.cf)
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package frugal
+
+import (
+    `github.com/cloudwego/frugal/internal/binary/encoder`
+    `github.com/cloudwego/frugal/iov`
+)
+
+// EncodedSizeCanonical measures the size of the canonical encoding of val, see
+// EncodeCanonical.
+func EncodedSizeCanonical(val interface{}) int {
+    return encoder.EncodedSizeCanonical(val)
+}
+
+// EncodeCanonical is like EncodeObject, but always produces the same bytes for
+// equal values, regardless of the encoding options and of how the values were
+// built, so the result can be hashed or used as a content address. The output
+// is plain Thrift Binary Protocol that any decoder accepts, and follows these
+// rules, which are part of the API and will not change across versions:
+//
+//   - Struct fields are written in ascending order of their field IDs, followed
+//     by a STOP byte.
+//   - Fields that are not optional are always written. Optional pointers are
+//     written when they are not nil, and optional scalars with a "default="
+//     value are written even if they are equal to it. IsSet methods are not used.
+//   - A nil container is written exactly like an empty one, including optional
+//     ones, which are therefore always written. Nil and empty binaries are
+//     written alike as well.
+//   - Map entries are written in ascending order of their keys, integers by
+//     value and strings byte-wise. Maps with other key types are rejected.
+//   - Set elements must already be in strictly ascending order, with false
+//     before true, integers by value, and strings and binaries byte-wise.
+//     Unsorted sets are rejected, and so are sets of other element types.
+//   - Every NaN is written as 0x7ff8000000000000, other doubles are written as
+//     is, so 0.0 and -0.0 stay distinct.
+//
+// Types are compiled separately for the canonical encoding, and the global
+// encoding options such as SetSortMapKeys or SetOmitEmptyContainers have no
+// effect on it.
+func EncodeCanonical(buf []byte, mem iov.BufferWriter, val interface{}) (int, error) {
+    return encoder.EncodeCanonical(buf, mem, val)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package frugal
+
+import (
+    `runtime`
+
+    `github.com/cloudwego/frugal/internal/binary/decoder`
+    `github.com/cloudwego/frugal/internal/binary/encoder`
+)
+
+// Backend is the code generation backend that frugal uses for the current process.
+type Backend string
+
+const (
+    // Native means the codecs are compiled into machine code.
+    Native Backend = "native"
+
+    // Emulated means the codecs are interpreted by the IR emulator, which is
+    // much slower than the native backend, but available on every platform.
+    Emulated Backend = "emulated"
+)
+
+// SupportMatrix describes what frugal supports in the current deployment environment.
+type SupportMatrix struct {
+    // Protocols are the Thrift protocols frugal can encode or decode.
+    Protocols []string
+
+    // NativeArchs are the architectures that have a native backend.
+    NativeArchs []string
+
+    // Backend is the backend in use, it is Emulated when the current
+    // architecture or Go version has no native support, or when the
+    // environment variable "FRUGAL_BACKEND" is set to "emu".
+    Backend Backend
+
+    // GOOS, GOARCH and GoVersion are the platform and runtime frugal is running on.
+    GOOS      string
+    GOARCH    string
+    GoVersion string
+
+    // GoShim is the name of the runtime layout shim selected for GoVersion,
+    // or an empty string if this Go version is not supported by the loader.
+    GoShim string
+
+    // ZeroCopy reports whether the encoder of the current Backend writes large
+    // binary and string fields to an iov.BufferWriter without copying.
+    ZeroCopy bool
+}
+
+// Capabilities reports the support matrix of frugal in the current process, so
+// that frameworks can decide whether to use frugal or fall back to other codecs.
+func Capabilities() SupportMatrix {
+    return SupportMatrix {
+        Protocols   : []string { "binary" },
+        NativeArchs : []string { "amd64" },
+        Backend     : currentBackend(),
+        GOOS        : runtime.GOOS,
+        GOARCH      : runtime.GOARCH,
+        GoVersion   : runtime.Version(),
+        GoShim      : _GoShim,
+        ZeroCopy    : encoder.ZeroCopy(),
+    }
+}
+
+func currentBackend() Backend {
+    if encoder.IsNative() && decoder.IsNative() {
+        return Native
+    } else {
+        return Emulated
+    }
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package frugal
+
+import (
+    `reflect`
+
+    `github.com/cloudwego/frugal/internal/binary/defs`
+)
+
+// Mismatch is a difference between a Go type and a Thrift IDL found by CheckIDL.
+type Mismatch = defs.Mismatch
+
+// MismatchKind is the kind of a Mismatch.
+type MismatchKind = defs.MismatchKind
+
+const (
+    // MissingField means the field is defined in IDL but not in the Go type.
+    MissingField = defs.MissingField
+
+    // UnknownField means the field is defined in the Go type but not in IDL.
+    UnknownField = defs.UnknownField
+
+    // TypeMismatch means the wire types of the field or element are different.
+    TypeMismatch = defs.TypeMismatch
+
+    // RequirednessMismatch means the field requiredness is different.
+    RequirednessMismatch = defs.RequirednessMismatch
+)
+
+// CheckIDL verifies the field IDs, wire types, requiredness and container element
+// types of vt against the struct named name in the Thrift IDL idl, including all
+// the nested structs. An empty name means the name of vt.
+//
+// Types referred from included files are looked up by their short names, so they
+// must be defined in the same idl as well.
+//
+// An empty result means vt is compatible with the IDL.
+func CheckIDL(vt reflect.Type, idl string, name string) ([]Mismatch, error) {
+    if p, err := defs.ParseIDL(idl); err != nil {
+        return nil, err
+    } else {
+        return defs.CheckIDL(vt, p, name)
+    }
+}
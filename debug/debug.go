@@ -17,9 +17,18 @@
 package debug
 
 import (
+    `encoding/json`
+    `io`
+    `os`
+    `path/filepath`
+    `reflect`
+    `time`
+
+    `github.com/cloudwego/frugal/internal/atm/pgen`
     `github.com/cloudwego/frugal/internal/binary/decoder`
     `github.com/cloudwego/frugal/internal/binary/encoder`
     `github.com/cloudwego/frugal/internal/loader`
+    `github.com/cloudwego/frugal/internal/utils`
 )
 
 // A Stats records statistics about the JIT compiler.
@@ -61,3 +70,162 @@ func GetStats() Stats {
         },
     }
 }
+
+// A CompileEvent describes the first compilation of a type.
+type CompileEvent struct {
+    Type     reflect.Type   // the type being compiled
+    Codec    string         // either "encoder" or "decoder"
+    CodeSize int            // size of the generated machine code, 0 when using the emulator
+    Duration time.Duration  // time spent on compiling and linking
+    Stack    []byte         // stack trace of the goroutine that triggered the compilation
+}
+
+// SetCompileHook installs fn to be called every time a type is compiled for the
+// first time, which can be used to spot unexpected dynamic types that cause
+// latency spikes. Passing nil removes the hook.
+//
+// The hook is called synchronously on the goroutine that triggered the
+// compilation, so it should return quickly.
+func SetCompileHook(fn func(CompileEvent)) {
+    if fn == nil {
+        utils.SetCompileHook(nil)
+    } else {
+        utils.SetCompileHook(func(ev *utils.CompileEvent) {
+            fn(CompileEvent {
+                Type     : ev.Type,
+                Codec    : ev.Kind,
+                CodeSize : ev.Size,
+                Duration : ev.Duration,
+                Stack    : ev.Stack,
+            })
+        })
+    }
+}
+
+// A DeoptEvent describes a type that has been linked again with the emulator
+// after its machine code faulted too many times, see frugal.SetDeoptThreshold.
+type DeoptEvent struct {
+    Type   reflect.Type   // the type being deoptimized
+    Codec  string         // either "encoder" or "decoder"
+    Faults int            // number of faults recovered from the machine code
+    Fault  interface{}    // the last recovered panic value
+    Symbol string         // symbol of the faulting machine code
+    Source string         // listing of the faulting machine code, see SetSourceDir
+}
+
+// SetDeoptHook installs fn to be called every time a type is deoptimized, so
+// that the faulting code can be reported. Passing nil removes the hook.
+//
+// Enable SetSourceDir beforehand to keep the IR listing of the faulting code,
+// which Source refers to.
+func SetDeoptHook(fn func(DeoptEvent)) {
+    if fn == nil {
+        utils.SetDeoptHook(nil)
+    } else {
+        utils.SetDeoptHook(func(ev *utils.DeoptEvent) {
+            fn(DeoptEvent {
+                Type   : ev.Type,
+                Codec  : ev.Kind,
+                Faults : ev.Faults,
+                Fault  : ev.Fault,
+                Symbol : ev.Symbol,
+                Source : ev.Source,
+            })
+        })
+    }
+}
+
+// An OpCoverage records how many times an IR instruction has been translated by
+// the code generator, and how many times each machine instruction sequence has
+// been selected for it.
+type OpCoverage = pgen.OpCoverage
+
+// EnableCodegenCoverage turns on or off recording of the instruction selection
+// coverage. Recording is off by default, and can also be turned on by setting
+// the `FRUGAL_CODEGEN_COVERAGE` environment variable to any non-empty value.
+//
+// Only types compiled after this call are recorded, and nothing is recorded
+// when using the emulator backend.
+func EnableCodegenCoverage(enable bool) {
+    pgen.EnableCoverage(enable)
+}
+
+// ResetCodegenCoverage discards all the recorded coverage data.
+func ResetCodegenCoverage() {
+    pgen.ResetCoverage()
+}
+
+// GetCodegenCoverage returns the coverage of every IR instruction supported by
+// the code generator, including those that were never used, sorted by name.
+func GetCodegenCoverage() []OpCoverage {
+    return pgen.GetCoverage()
+}
+
+// WriteCodegenCoverage writes the coverage report as JSON into w.
+func WriteCodegenCoverage(w io.Writer) error {
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "    ")
+    return enc.Encode(pgen.GetCoverage())
+}
+
+// EnableHardenedLoader turns on or off the hardened mode of the loader, which
+// can also be turned on by setting the `FRUGAL_HARDENED_LOADER` environment
+// variable to any non-empty value.
+//
+// In hardened mode, the machine code of every function is surrounded by
+// inaccessible guard pages, and the runtime metadata is surrounded by canary
+// values, so that memory corruption caused by code generation bugs is caught
+// close to the source. It costs two extra pages per function, and is meant for
+// qualification testing only.
+//
+// Only types compiled after this call are affected.
+func EnableHardenedLoader(enable bool) {
+    loader.SetHardened(enable)
+}
+
+// VerifyLoader checks the canaries of every function that was loaded in
+// hardened mode, and returns an error if any of them was overwritten.
+func VerifyLoader() error {
+    return loader.Verify()
+}
+
+// SetSourceDir turns on the debug info of the generated code. A pseudo-source
+// listing of the IR program is written into dir for every function when it is
+// loaded, and the machine code is mapped back to the lines of the listing, so
+// that stack traces, profiles and runtime.FuncForPC report the IR instruction
+// being executed instead of a single opaque line. Passing an empty string turns
+// it off. It can also be turned on with the `FRUGAL_DEBUG_SOURCE_DIR` environment
+// variable.
+//
+// The listings are named after the function symbols, and they are never removed.
+//
+// This is not debugger support. Only the line table in the Go runtime metadata
+// is recorded, no DWARF is emitted and nothing is registered with the GDB JIT
+// interface, so neither Delve nor GDB can set breakpoints in or step through the
+// generated code, and they symbolize its frames no better than the runtime does.
+//
+// Only types compiled after this call are affected, and nothing is written when
+// using the emulator backend.
+func SetSourceDir(dir string) error {
+    if dir == "" {
+        pgen.EnableDebugInfo(false)
+        loader.SetSourceDir("")
+        return nil
+    }
+
+    /* the recorded file names must be absolute */
+    dir, err := filepath.Abs(dir)
+    if err != nil {
+        return err
+    }
+
+    /* make sure the directory exists */
+    if err = os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+
+    /* turn on the debug info */
+    loader.SetSourceDir(dir)
+    pgen.EnableDebugInfo(true)
+    return nil
+}
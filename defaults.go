@@ -0,0 +1,38 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package frugal
+
+import (
+    `reflect`
+
+    `github.com/cloudwego/frugal/internal/binary/decoder`
+)
+
+// NewWithDefaults returns a pointer to a new value of struct type vt (or of the
+// struct vt points to), with every default applied exactly as the decoder does
+// for absent fields: `InitDefault()` is called first if the struct implements
+// it, then every "default=V" tag option is applied. Nested structs embedded by
+// value are defaulted recursively, while pointers to structs are left nil.
+//
+// It panics if vt is not a struct, or its tags cannot be resolved.
+func NewWithDefaults(vt reflect.Type) interface{} {
+    if ret, err := decoder.NewWithDefaults(vt); err != nil {
+        panic(err)
+    } else {
+        return ret
+    }
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package frugal
+
+import (
+    `fmt`
+    `reflect`
+
+    `github.com/cloudwego/frugal/internal/binary/decoder`
+    `github.com/cloudwego/frugal/internal/binary/defs`
+)
+
+// EnumValueError is returned by the decoder when enum validation is enabled and
+// an enum value is not defined by the enum type. See WithValidateEnums.
+type EnumValueError = decoder.EnumValueError
+
+// RegisterEnumValues registers the set of valid values for enum type vt, for types
+// that do not have a `KnownValues()` or `IsValid()` method.
+//
+// It must be called before vt is compiled, types that are already compiled are
+// not affected.
+func RegisterEnumValues(vt reflect.Type, values ...int64) {
+    defs.RegisterEnumValues(vt, values)
+}
+
+// RegisterIDL makes the constants and enum values defined in the Thrift IDL idl
+// available by name to the "default=V" tag option, so a field can be declared
+// with `frugal:"1,optional,i32,default=Color.RED"` or `default=MAX_RETRIES`.
+// Constants are referred to by their names, and enum values as "Enum.VALUE".
+//
+// Like RegisterEnumValues, it must be called before the types using them are
+// compiled.
+func RegisterIDL(idl string) error {
+    if p, err := defs.ParseIDL(idl); err != nil {
+        return err
+    } else {
+        defs.RegisterSymbols(p)
+        return nil
+    }
+}
+
+// RegisterIDLEnum is like RegisterEnumValues, but takes the valid values of vt
+// from the enum named name in the Thrift IDL idl. The names of the values are
+// reported by EnumValueError as well.
+func RegisterIDLEnum(vt reflect.Type, idl string, name string) error {
+    if p, err := defs.ParseIDL(idl); err != nil {
+        return err
+    } else if ev, ok := p.Enums[name]; !ok {
+        return fmt.Errorf("frugal: enum %s is not defined in IDL", name)
+    } else {
+        defs.RegisterIdlEnum(vt, ev)
+        return nil
+    }
+}
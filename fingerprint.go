@@ -0,0 +1,101 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package frugal
+
+import (
+    `encoding/binary`
+    `fmt`
+    `reflect`
+
+    `github.com/cloudwego/frugal/internal/binary/defs`
+    `github.com/cloudwego/frugal/iov`
+)
+
+// FingerprintError is returned by DecodeObjectWithFingerprint when the payload was
+// encoded from a different schema than the one of the destination type.
+type FingerprintError struct {
+    Type reflect.Type
+    Want uint32
+    Got  uint32
+}
+
+func (self FingerprintError) Error() string {
+    return fmt.Sprintf("frugal: schema fingerprint mismatch for type %s: expected %08x, got %08x", self.Type, self.Want, self.Got)
+}
+
+// Fingerprint returns the schema fingerprint of struct type vt. It covers the field
+// IDs, requiredness and wire types of vt and all the nested structs, but not the Go
+// names, so both ends only have to agree on the Thrift schema.
+func Fingerprint(vt reflect.Type) (uint32, error) {
+    return defs.Fingerprint(derefType(vt))
+}
+
+func derefType(vt reflect.Type) reflect.Type {
+    for vt.Kind() == reflect.Ptr {
+        vt = vt.Elem()
+    }
+    return vt
+}
+
+// EncodedSizeWithFingerprint measures the encoded size of val in the format written
+// by EncodeObjectWithFingerprint.
+func EncodedSizeWithFingerprint(val interface{}) int {
+    return EncodedSize(val) + 4
+}
+
+// EncodeObjectWithFingerprint is like EncodeObject, but prefixes the payload with the
+// 4-byte schema fingerprint of val, so that DecodeObjectWithFingerprint can detect
+// producers and consumers that disagree about the schema.
+func EncodeObjectWithFingerprint(buf []byte, mem iov.BufferWriter, val interface{}) (int, error) {
+    fp, err := Fingerprint(reflect.TypeOf(val))
+
+    /* check for errors */
+    if err != nil {
+        return 0, err
+    } else if len(buf) < 4 {
+        return 0, errMessageSpace
+    }
+
+    /* the fingerprint goes first */
+    binary.BigEndian.PutUint32(buf, fp)
+    ret, err := EncodeObject(buf[4:], mem, val)
+    return ret + 4, err
+}
+
+// DecodeObjectWithFingerprint decodes a payload written by EncodeObjectWithFingerprint
+// into val, and returns a FingerprintError without touching val if the fingerprint
+// does not match the schema of val.
+func DecodeObjectWithFingerprint(buf []byte, val interface{}) (int, error) {
+    vt := reflect.TypeOf(val)
+    fp, err := Fingerprint(vt)
+
+    /* check for errors */
+    if err != nil {
+        return 0, err
+    } else if len(buf) < 4 {
+        return 0, errMessageShort
+    }
+
+    /* verify the fingerprint */
+    if rv := binary.BigEndian.Uint32(buf); rv != fp {
+        return 0, FingerprintError { Type: derefType(vt), Want: fp, Got: rv }
+    }
+
+    /* decode the payload */
+    ret, err := DecodeObject(buf[4:], val)
+    return ret + 4, err
+}
@@ -19,9 +19,55 @@ package frugal
 import (
     `github.com/cloudwego/frugal/internal/binary/decoder`
     `github.com/cloudwego/frugal/internal/binary/encoder`
+    `github.com/cloudwego/frugal/internal/utils`
     `github.com/cloudwego/frugal/iov`
 )
 
+// LengthError is returned by the encoder when a string, binary or container has
+// more elements than a Thrift i32 length can represent.
+type LengthError = encoder.LengthError
+
+// CycleError is returned by the encoder when the object graph refers back to an
+// object that is still being encoded, see SetDetectCycles.
+type CycleError = encoder.CycleError
+
+// UnknownFieldError is returned by the decoder when a field that is not defined by
+// the struct is found, see WithRejectUnknownFields.
+type UnknownFieldError = decoder.UnknownFieldError
+
+// GroupError is returned by the decoder when only some of the fields that share
+// the same "group=NAME" tag option are present. Fields in a group must be either
+// all present or all absent, and can not be required.
+type GroupError = decoder.GroupError
+
+// NegativeLengthError is returned by the decoder when a string, binary or container
+// has a negative length prefix, see WithLenientLengths.
+type NegativeLengthError = decoder.NegativeLengthError
+
+// BudgetError is returned by the decoder when a message needs more memory than
+// allowed by SetMaxAllocBytes.
+type BudgetError = decoder.BudgetError
+
+// AbortError is the panic value raised by the generated encoder or decoder when
+// it finds itself in an impossible state, which indicates a bug in frugal rather
+// than a malformed message. It names the type, the field and the instruction
+// being executed, so please include it when reporting the issue.
+type AbortError = utils.AbortError
+
+// FaultError is returned instead of panicking when the generated encoder or
+// decoder of a type faults, see SetDeoptThreshold. Value is the recovered panic
+// value, usually an AbortError or a runtime.Error.
+type FaultError = utils.FaultError
+
+var (
+    // ErrTruncated is returned by DecodeObjectChecked when buf ends before the message does.
+    ErrTruncated = decoder.ErrTruncated
+
+    // ErrCorrupted is returned by DecodeObjectChecked when a length or an element count
+    // can not be satisfied by the rest of buf.
+    ErrCorrupted = decoder.ErrCorrupted
+)
+
 // EncodedSize measures the encoded size of val.
 func EncodedSize(val interface{}) int {
     return encoder.EncodedSize(val)
@@ -37,3 +83,28 @@ func EncodeObject(buf []byte, mem iov.BufferWriter, val interface{}) (int, error
 func DecodeObject(buf []byte, val interface{}) (int, error) {
     return decoder.DecodeObject(buf, val)
 }
+
+// DecodeObjectChecked is like DecodeObject, but never trusts the length prefixes
+// in buf, every read is checked against the remaining input in the generated code.
+// Errors wrap ErrTruncated or ErrCorrupted, test them with errors.Is. It is meant
+// for untrusted input and fuzzing, trusted hot paths should use DecodeObject instead.
+func DecodeObjectChecked(buf []byte, val interface{}) (int, error) {
+    return decoder.DecodeObjectChecked(buf, val)
+}
+
+// GraphStats describes the shape of a decoded message, see DecodeObjectWithStats.
+type GraphStats = decoder.GraphStats
+
+// DecodeObjectWithStats is like DecodeObject, but also reports the shape of the
+// message, which includes the fields that are skipped because they are unknown
+// to val. It walks through the message once more after decoding, so it is
+// meant for sampling rather than every request.
+func DecodeObjectWithStats(buf []byte, val interface{}) (int, GraphStats, error) {
+    if nb, err := decoder.DecodeObject(buf, val); err != nil {
+        return nb, GraphStats{}, err
+    } else if st, _, err := decoder.MeasureGraph(buf[:nb]); err != nil {
+        return nb, GraphStats{}, err
+    } else {
+        return nb, st, nil
+    }
+}
@@ -0,0 +1,304 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package frugaltest generates random values of frugal structs for property-based
+// and differential tests. Unlike generic reflection-based fuzzers, the values
+// always honor the frugal tags, so they can be encoded and decoded without
+// errors.
+package frugaltest
+
+import (
+    `fmt`
+    `math/rand`
+    `reflect`
+
+    `github.com/cloudwego/frugal/internal/binary/defs`
+)
+
+const (
+    _DefaultMaxDepth  = 4
+    _DefaultMaxLength = 8
+    _DefaultUnsetRate = 0.5
+)
+
+// GenFunc generates a random value for a specific type, the returned value must
+// be assignable to that type.
+type GenFunc func(g *Generator) interface{}
+
+// Generator generates random values according to the frugal tags:
+//
+//   - required fields are always set, optional fields are left unset randomly;
+//   - enums only take values that are known to be valid, see frugal.RegisterEnumValues;
+//   - fixed-point doubles are always representable with their scaling factor;
+//   - elements of sets are unique, and unions have exactly one field set.
+//
+// A Generator is not safe for concurrent use.
+type Generator struct {
+    MaxDepth  int       // containers and optional fields below this depth are left empty
+    MaxLength int       // maximum length of strings, binaries and containers
+    UnsetRate float64   // probability that an optional field is left unset
+
+    rnd *rand.Rand
+    fns map[reflect.Type]GenFunc
+}
+
+// NewGenerator creates a Generator with the default limits, seeded with seed.
+func NewGenerator(seed int64) *Generator {
+    return &Generator {
+        MaxDepth  : _DefaultMaxDepth,
+        MaxLength : _DefaultMaxLength,
+        UnsetRate : _DefaultUnsetRate,
+        rnd       : rand.New(rand.NewSource(seed)),
+        fns       : make(map[reflect.Type]GenFunc),
+    }
+}
+
+// Rand returns the random source of the generator, which can be used by GenFuncs.
+func (self *Generator) Rand() *rand.Rand {
+    return self.rnd
+}
+
+// Register plugs fn as the generator of type vt, which takes precedence over
+// the built-in generators. Passing nil removes it.
+func (self *Generator) Register(vt reflect.Type, fn GenFunc) {
+    if fn == nil {
+        delete(self.fns, vt)
+    } else {
+        self.fns[vt] = fn
+    }
+}
+
+// New returns a pointer to a new random value of struct type vt.
+func (self *Generator) New(vt reflect.Type) (interface{}, error) {
+    if vt.Kind() != reflect.Struct {
+        return nil, fmt.Errorf("frugaltest: only structs can be generated, not %s", vt)
+    }
+
+    /* allocate and fill the value */
+    rv := reflect.New(vt)
+    err := self.genStruct(rv.Elem(), 0)
+
+    /* check for errors */
+    if err != nil {
+        return nil, err
+    } else {
+        return rv.Interface(), nil
+    }
+}
+
+// Fill overwrites the struct v points to with random values.
+func (self *Generator) Fill(v interface{}) error {
+    rv := reflect.ValueOf(v)
+
+    /* must be a pointer to struct */
+    if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+        return fmt.Errorf("frugaltest: only pointers to structs can be filled, not %s", rv.Type())
+    }
+
+    /* reset the struct before filling */
+    rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+    return self.genStruct(rv.Elem(), 0)
+}
+
+func (self *Generator) length(d int) int {
+    if d >= self.MaxDepth || self.MaxLength <= 0 {
+        return 0
+    } else {
+        return self.rnd.Intn(self.MaxLength + 1)
+    }
+}
+
+func (self *Generator) genValue(rv reflect.Value, vt *defs.Type, d int) error {
+    if d >= defs.StackSize {
+        return fmt.Errorf("frugaltest: type nesting too deep: %s", rv.Type())
+    }
+
+    /* user-defined generators */
+    if fn, ok := self.fns[rv.Type()]; ok {
+        rv.Set(reflect.ValueOf(fn(self)))
+        return nil
+    }
+
+    /* generate according to the wire type */
+    switch vt.T {
+        case defs.T_bool    : rv.SetBool(self.rnd.Intn(2) != 0)
+        case defs.T_i8      : setInt(rv, int64(int8(self.rnd.Uint64())))
+        case defs.T_i16     : setInt(rv, int64(int16(self.rnd.Uint64())))
+        case defs.T_i32     : setInt(rv, int64(int32(self.rnd.Uint64())))
+        case defs.T_i64     : setInt(rv, int64(self.rnd.Uint64()))
+        case defs.T_double  : rv.SetFloat(self.rnd.NormFloat64() * 1e6)
+        case defs.T_fixed   : rv.SetFloat(float64(int32(self.rnd.Uint32())) / float64(vt.N))
+        case defs.T_string  : rv.SetString(self.genString(d))
+        case defs.T_binary  : rv.SetBytes(self.genBytes(d))
+        case defs.T_enum    : return self.genEnum(rv)
+        case defs.T_struct  : return self.genStruct(rv, d)
+        case defs.T_pointer : return self.genPointer(rv, vt, d)
+        case defs.T_map     : return self.genMap(rv, vt, d)
+        case defs.T_set     : return self.genSeq(rv, vt, d, true)
+        case defs.T_list    : return self.genSeq(rv, vt, d, false)
+        default             : return fmt.Errorf("frugaltest: cannot generate values of type %s", vt)
+    }
+
+    /* all done */
+    return nil
+}
+
+func (self *Generator) genString(d int) string {
+    buf := make([]byte, self.length(d))
+    for i := range buf { buf[i] = byte(' ' + self.rnd.Intn('~' - ' ' + 1)) }
+    return string(buf)
+}
+
+func (self *Generator) genBytes(d int) []byte {
+    buf := make([]byte, self.length(d))
+    self.rnd.Read(buf)
+    return buf
+}
+
+func (self *Generator) genEnum(rv reflect.Value) error {
+    fn, err := defs.GetEnumChecker(rv.Type())
+
+    /* enums without known values are plain i32 values */
+    if err != nil {
+        return err
+    } else if fn == nil {
+        setInt(rv, int64(int32(self.rnd.Uint32())))
+        return nil
+    }
+
+    /* valid values are usually small, try the positive ones first */
+    for _, n := range [...]int64 { 16, 256, 65536 } {
+        for i := 0; i < 64; i++ {
+            if v := self.rnd.Int63n(n); fn(v) {
+                setInt(rv, v)
+                return nil
+            } else if v = -v - 1; fn(v) {
+                setInt(rv, v)
+                return nil
+            }
+        }
+    }
+
+    /* cannot find any valid value */
+    return fmt.Errorf("frugaltest: cannot find any valid value for enum %s", rv.Type())
+}
+
+func (self *Generator) genStruct(rv reflect.Value, d int) error {
+    vt := rv.Type()
+    fvs, err := defs.ResolveFields(vt)
+
+    /* check for errors */
+    if err != nil {
+        return err
+    }
+
+    /* unions have exactly one field set */
+    if defs.IsUnion(vt) {
+        if len(fvs) == 0 {
+            return nil
+        } else {
+            fv := fvs[self.rnd.Intn(len(fvs))]
+            return self.genValue(rv.FieldByName(fv.Name), fv.Type, d + 1)
+        }
+    }
+
+    /* generate every field */
+    for _, fv := range fvs {
+        if !fv.IsNillable() || (d < self.MaxDepth && self.rnd.Float64() >= self.UnsetRate) {
+            if err = self.genValue(rv.FieldByName(fv.Name), fv.Type, d + 1); err != nil {
+                return err
+            }
+        }
+    }
+
+    /* all done */
+    return nil
+}
+
+func (self *Generator) genPointer(rv reflect.Value, vt *defs.Type, d int) error {
+    rv.Set(reflect.New(rv.Type().Elem()))
+    return self.genValue(rv.Elem(), vt.V, d)
+}
+
+func (self *Generator) genMap(rv reflect.Value, vt *defs.Type, d int) error {
+    n := self.length(d)
+    rv.Set(reflect.MakeMapWithSize(rv.Type(), n))
+
+    /* generate the pairs, duplicated keys are simply overwritten */
+    for i := 0; i < n; i++ {
+        key := reflect.New(rv.Type().Key()).Elem()
+        val := reflect.New(rv.Type().Elem()).Elem()
+
+        /* generate the key */
+        if err := self.genValue(key, vt.K, d + 1); err != nil {
+            return err
+        }
+
+        /* generate the value */
+        if err := self.genValue(val, vt.V, d + 1); err != nil {
+            return err
+        }
+
+        /* add to the map */
+        rv.SetMapIndex(key, val)
+    }
+
+    /* all done */
+    return nil
+}
+
+func (self *Generator) genSeq(rv reflect.Value, vt *defs.Type, d int, unique bool) error {
+    n := self.length(d)
+    rv.Set(reflect.MakeSlice(rv.Type(), 0, n))
+
+    /* generate the elements, duplicated elements of sets are retried a few times */
+    for i := 0; i < n * 4 && rv.Len() < n; i++ {
+        val := reflect.New(rv.Type().Elem()).Elem()
+
+        /* generate the element */
+        if err := self.genValue(val, vt.V, d + 1); err != nil {
+            return err
+        }
+
+        /* check for duplicates */
+        if !unique || !contains(rv, val) {
+            rv.Set(reflect.Append(rv, val))
+        }
+    }
+
+    /* all done */
+    return nil
+}
+
+func setInt(rv reflect.Value, v int64) {
+    switch rv.Kind() {
+        case reflect.Uint8  : fallthrough
+        case reflect.Uint16 : fallthrough
+        case reflect.Uint32 : fallthrough
+        case reflect.Uint64 : fallthrough
+        case reflect.Uint   : rv.SetUint(uint64(v))
+        default             : rv.SetInt(v)
+    }
+}
+
+func contains(rv reflect.Value, val reflect.Value) bool {
+    for i := 0; i < rv.Len(); i++ {
+        if reflect.DeepEqual(rv.Index(i).Interface(), val.Interface()) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package frugal
+
+import (
+    `github.com/cloudwego/frugal/internal/binary/decoder`
+)
+
+// FieldInfo describes a top-level field of an encoded struct, see InspectFields.
+type FieldInfo = decoder.FieldInfo
+
+// InspectFields scans the Thrift Binary Protocol encoded struct in buf, and
+// returns the ID, wire type and byte range of each of its top-level fields,
+// in the order they appear on the wire. buf[f.Offset:f.Offset + f.Size] is
+// the encoded value of field f.
+//
+// Field values are skipped over, not decoded or validated beyond what skipping
+// requires, and nothing is allocated except for the returned slice. It is
+// meant for making decisions from a single cheap scan, such as routing or
+// rejecting a request, before deciding whether to decode it at all.
+func InspectFields(buf []byte) ([]FieldInfo, error) {
+    return decoder.InspectFields(buf)
+}
@@ -59,6 +59,11 @@ func bool2u64(val bool) uint64 {
     }
 }
 
+func addo(x uint64, y uint64) (uint64, bool) {
+    r := x + y
+    return r, int64((x ^ r) & (y ^ r)) < 0
+}
+
 func checkptr(p unsafe.Pointer) unsafe.Pointer {
     if p != nil { _ = *(*uint8)(p) }
     return p
@@ -143,6 +148,28 @@ func (self *Emulator) Run() {
                 self.uv[p.Rz] = bool2u64(bv & (1 << (bi % 64)) != 0)
             }
 
+            /* checked add */
+            case hir.OP_addo: {
+                r, ov := addo(self.uv[p.Rx], self.uv[p.Ry])
+                self.uv[p.Rz] = r
+
+                /* branch on overflow */
+                if ov {
+                    self.pc = p.Br
+                }
+            }
+
+            /* checked add with immediate value */
+            case hir.OP_addio: {
+                r, ov := addo(self.uv[p.Rx], uint64(p.Iv))
+                self.uv[p.Ry] = r
+
+                /* branch on overflow */
+                if ov {
+                    self.pc = p.Br
+                }
+            }
+
             /* table switch */
             case hir.OP_bsw: {
                 if v = self.uv[p.Rx]; v < uint64(p.Iv) {
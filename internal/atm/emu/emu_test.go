@@ -17,11 +17,13 @@
 package emu
 
 import (
+    `errors`
     `testing`
     `unsafe`
 
     `github.com/cloudwego/frugal/internal/atm/hir`
     `github.com/davecgh/go-spew/spew`
+    `github.com/stretchr/testify/require`
 )
 
 var (
@@ -50,6 +52,19 @@ var (
     })
 )
 
+var (
+    testvfn = hir.RegisterGCall(testemu_vfunc, nil)
+)
+
+func testemu_vfunc(buf []byte, n int, vals ...string) (int, error) {
+    for _, v := range vals {
+        if n += copy(buf[n:], v); n == len(buf) {
+            return n, errors.New("buffer is full")
+        }
+    }
+    return n, nil
+}
+
 func testemu_pfunc(a string, b string, c string) (d string, e string) {
     d = a + b
     e = b + c
@@ -90,3 +105,48 @@ func TestEmu_OpCode_GCALL(t *testing.T) {
     }
     spew.Dump(*(*[2]string)(unsafe.Pointer(&val)))
 }
+
+func TestEmu_OpCode_GCALL_Proxy(t *testing.T) {
+    buf := make([]byte, 12)
+    val := []string { "aaa", "bbb", "ccc" }
+    run := func(n int) *Emulator {
+        return runEmulator(nil, func(p *hir.Builder) {
+            p.IP(&buf, hir.P0)
+            p.IP(&val, hir.P1)
+            p.LQ(hir.P0, 8, hir.R0)
+            p.LQ(hir.P0, 16, hir.R1)
+            p.LP(hir.P0, 0, hir.P0)
+            p.LQ(hir.P1, 8, hir.R3)
+            p.LQ(hir.P1, 16, hir.R4)
+            p.LP(hir.P1, 0, hir.P1)
+            p.IQ(int64(n), hir.R2)
+            p.GCALL(testvfn).A(hir.P0, hir.R0, hir.R1, hir.R2, hir.P1, hir.R3, hir.R4).R(hir.R0, hir.P0, hir.P1)
+            p.RET().R(hir.R0, hir.P0, hir.P1)
+        })
+    }
+    emu := run(0)
+    require.Equal(t, uint64(9), emu.Ru(0))
+    require.True(t, emu.Rp(1) == nil)
+    require.True(t, emu.Rp(2) == nil)
+    emu = run(6)
+    require.Equal(t, uint64(12), emu.Ru(0))
+    require.False(t, emu.Rp(1) == nil)
+    require.False(t, emu.Rp(2) == nil)
+    require.Equal(t, "aaabbbaaabbb", string(buf))
+}
+
+func TestEmu_OpCode_ADDO(t *testing.T) {
+    emu := runEmulator(func(emu *Emulator) {
+        emu.SetGr(hir.R0, 1 << 62)
+        emu.SetGr(hir.R1, 1 << 62)
+    }, func(p *hir.Builder) {
+        p.ADDIO (hir.R0, 1, hir.R2, "_overflow")
+        p.ADDO  (hir.R2, hir.R1, hir.R3, "_overflow")
+        p.RET   ().R0(hir.R2).R1(hir.R3)
+        p.Label ("_overflow")
+        p.RET   ().R0(hir.Rz).R1(hir.R3)
+    })
+    if emu.Ru(0) != 0 || emu.Ru(1) != 1 << 63 + 1 {
+        t.Fatalf("unexpected result: %d, %d", emu.Ru(0), emu.Ru(1))
+    }
+}
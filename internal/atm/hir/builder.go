@@ -30,6 +30,7 @@ const (
 
 type Builder struct {
     i     int
+    pc    int
     head  *Ir
     tail  *Ir
     refs  map[string]*Ir
@@ -107,8 +108,13 @@ func (self *Builder) At(pc int) string {
     return _LB_jump_pc + strconv.Itoa(pc)
 }
 
+func (self *Builder) Pc() int {
+    return self.pc
+}
+
 func (self *Builder) Mark(pc int) {
     self.i++
+    self.pc = pc
     self.Label(self.At(pc))
 }
 
@@ -379,6 +385,14 @@ func (self *Builder) BNEP(ps PointerRegister, pd PointerRegister, to string) *Ir
     return self.jmp(newInstr(OP_bnep).ps(ps).pd(pd), to)
 }
 
+func (self *Builder) ADDO(rx GenericRegister, ry GenericRegister, rz GenericRegister, to string) *Ir {
+    return self.jmp(newInstr(OP_addo).rx(rx).ry(ry).rz(rz), to)
+}
+
+func (self *Builder) ADDIO(rx GenericRegister, im int64, ry GenericRegister, to string) *Ir {
+    return self.jmp(newInstr(OP_addio).rx(rx).iv(im).ry(ry), to)
+}
+
 func (self *Builder) JMP(to string) *Ir {
     return self.jmp(newInstr(OP_jmp), to)
 }
@@ -54,6 +54,11 @@ func (self *CallHandle) Name() string {
     return runtime.FuncForPC(uintptr(self.Func)).Name()
 }
 
+// Emulated reports whether the call can be made by the emulator.
+func (self *CallHandle) Emulated() bool {
+    return self.proxy != nil
+}
+
 func (self *CallHandle) Call(r CallState, p *Ir) {
     self.proxy(CallContext {
         repo: r,
@@ -78,8 +83,8 @@ type CallContext struct {
     data PointerRegister
     argc uint8
     retc uint8
-    argv [8]uint8
-    retv [8]uint8
+    argv [MaxCallArgs]uint8
+    retv [MaxCallArgs]uint8
 }
 
 func (self CallContext) Au(i int) uint64 {
@@ -114,6 +119,12 @@ func (self CallContext) Rp(i int, v unsafe.Pointer) {
     }
 }
 
+func (self CallContext) Re(i int, err error) {
+    vv := (*rt.GoIface)(unsafe.Pointer(&err))
+    self.Rp(i, unsafe.Pointer(vv.Itab))
+    self.Rp(i + 1, vv.Value)
+}
+
 func (self CallContext) Itab() *rt.GoItab {
     if self.kind != ICall {
         panic("invoke: itab is not available")
@@ -134,7 +145,7 @@ func (self CallContext) Verify(args string, rets string) bool {
     return self.verifySeq(args, self.argc, self.argv) && self.verifySeq(rets, self.retc, self.retv)
 }
 
-func (self CallContext) verifySeq(s string, n uint8, v [8]uint8) bool {
+func (self CallContext) verifySeq(s string, n uint8, v [MaxCallArgs]uint8) bool {
     nb := int(n)
     ne := len(s)
 
@@ -183,7 +194,15 @@ func RegisterICall(mt rt.Method, proxy func(CallContext)) (h *CallHandle) {
     return
 }
 
+// RegisterGCall registers a Go function that can be called with `OP_gcall`.
+// If proxy is nil, the emulator proxy is derived from the function signature
+// with MakeProxy.
 func RegisterGCall(fn interface{}, proxy func(CallContext)) (h *CallHandle) {
+    if proxy == nil {
+        proxy = MakeProxy(fn)
+    }
+
+    /* register the function */
     h       = new(CallHandle)
     h.Id    = len(funcTab)
     h.Type  = GCall
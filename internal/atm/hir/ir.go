@@ -68,6 +68,8 @@ const (
     OP_bgeu                 // if (u(Rx) >= u(Ry)) Br.PC -> PC
     OP_beqp                 // if (Ps == Pd) Br.PC -> PC
     OP_bnep                 // if (Ps == Pd) Br.PC -> PC
+    OP_addo                 // Rx + Ry -> Rz, if (signed overflow) Br.PC -> PC
+    OP_addio                // Rx + Iv -> Ry, if (signed overflow) Br.PC -> PC
     OP_bsw                  // if (u(Rx) <  u(An)) Sw[u(Rx)].PC -> PC
     OP_jmp                  // Br.PC -> PC
     OP_bzero                // memset(Pd, 0, Iv)
@@ -79,6 +81,65 @@ const (
     OP_break                // trigger a debugger breakpoint
 )
 
+var _OpNames = [256]string {
+    OP_nop   : "nop",
+    OP_ip    : "ip",
+    OP_lb    : "lb",
+    OP_lw    : "lw",
+    OP_ll    : "ll",
+    OP_lq    : "lq",
+    OP_lp    : "lp",
+    OP_sb    : "sb",
+    OP_sw    : "sw",
+    OP_sl    : "sl",
+    OP_sq    : "sq",
+    OP_sp    : "sp",
+    OP_ldaq  : "ldaq",
+    OP_ldap  : "ldap",
+    OP_addp  : "addp",
+    OP_subp  : "subp",
+    OP_addpi : "addpi",
+    OP_add   : "add",
+    OP_sub   : "sub",
+    OP_bts   : "bts",
+    OP_addi  : "addi",
+    OP_muli  : "muli",
+    OP_andi  : "andi",
+    OP_xori  : "xori",
+    OP_shri  : "shri",
+    OP_bsi   : "bsi",
+    OP_swapw : "swapw",
+    OP_swapl : "swapl",
+    OP_swapq : "swapq",
+    OP_sxlq  : "sxlq",
+    OP_beq   : "beq",
+    OP_bne   : "bne",
+    OP_blt   : "blt",
+    OP_bltu  : "bltu",
+    OP_bgeu  : "bgeu",
+    OP_beqp  : "beqp",
+    OP_bnep  : "bnep",
+    OP_addo  : "addo",
+    OP_addio : "addio",
+    OP_bsw   : "bsw",
+    OP_jmp   : "jmp",
+    OP_bzero : "bzero",
+    OP_bcopy : "bcopy",
+    OP_ccall : "ccall",
+    OP_gcall : "gcall",
+    OP_icall : "icall",
+    OP_ret   : "ret",
+    OP_break : "break",
+}
+
+func (self OpCode) String() string {
+    if _OpNames[self] != "" {
+        return _OpNames[self]
+    } else {
+        return fmt.Sprintf("OpCode(%d)", self)
+    }
+}
+
 const (
     Const Constness = iota
     Volatile
@@ -89,6 +150,10 @@ const (
     Unlikely
 )
 
+const (
+    MaxCallArgs = 8
+)
+
 type Ir struct {
     Op OpCode
     Rx GenericRegister
@@ -98,8 +163,8 @@ type Ir struct {
     Pd PointerRegister
     An uint8
     Rn uint8
-    Ar [8]uint8
-    Rr [8]uint8
+    Ar [MaxCallArgs]uint8
+    Rr [MaxCallArgs]uint8
     Iv int64
     Pr unsafe.Pointer
     Br *Ir
@@ -152,6 +217,28 @@ func (self *Ir) R5(v Register) *Ir { self.Rn, self.Rr[5] = 6, v.A(); return self
 func (self *Ir) R6(v Register) *Ir { self.Rn, self.Rr[6] = 7, v.A(); return self }
 func (self *Ir) R7(v Register) *Ir { self.Rn, self.Rr[7] = 8, v.A(); return self }
 
+func (self *Ir) A(v ...Register) *Ir {
+    if len(v) > MaxCallArgs {
+        panic("too many call arguments")
+    } else {
+        return self.setArgs(&self.Ar, &self.An, v)
+    }
+}
+
+func (self *Ir) R(v ...Register) *Ir {
+    if len(v) > MaxCallArgs {
+        panic("too many call return values")
+    } else {
+        return self.setArgs(&self.Rr, &self.Rn, v)
+    }
+}
+
+func (self *Ir) setArgs(vv *[MaxCallArgs]uint8, nb *uint8, v []Register) *Ir {
+    for i, r := range v { vv[i] = r.A() }
+    *nb = uint8(len(v))
+    return self
+}
+
 func (self *Ir) Const()    *Ir { return self.constness(Const) }
 func (self *Ir) Volatile() *Ir { return self.constness(Volatile) }
 
@@ -199,7 +286,7 @@ func (self *Ir) formatCall() string {
     )
 }
 
-func (self *Ir) formatArgs(vv *[8]uint8, nb uint8) string {
+func (self *Ir) formatArgs(vv *[MaxCallArgs]uint8, nb uint8) string {
     i := uint8(0)
     ret := make([]string, nb)
 
@@ -289,6 +376,8 @@ func (self *Ir) Disassemble(refs map[*Ir]string) string {
         case OP_bgeu  : return fmt.Sprintf("bgeu    %%%s, %%%s, %s", self.Rx, self.Ry, self.formatRefs(refs, self.Br))
         case OP_beqp  : return fmt.Sprintf("beq     %%%s, %%%s, %s", self.Ps, self.Pd, self.formatRefs(refs, self.Br))
         case OP_bnep  : return fmt.Sprintf("bne     %%%s, %%%s, %s", self.Ps, self.Pd, self.formatRefs(refs, self.Br))
+        case OP_addo  : return fmt.Sprintf("addo    %%%s, %%%s, %%%s, %s", self.Rx, self.Ry, self.Rz, self.formatRefs(refs, self.Br))
+        case OP_addio : return fmt.Sprintf("addio   %%%s, $%d, %%%s, %s", self.Rx, self.Iv, self.Ry, self.formatRefs(refs, self.Br))
         case OP_bsw   : return fmt.Sprintf("bsw     %%%s, %s", self.Rx, self.formatTable(refs))
         case OP_jmp   : return fmt.Sprintf("jmp     %s", self.formatRefs(refs, self.Br))
         case OP_bzero : return fmt.Sprintf("bzero   $%d, %s", self.Iv, self.Pd)
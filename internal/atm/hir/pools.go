@@ -71,6 +71,7 @@ func allocBuilder() (p *Builder) {
 
 func resetBuilder(p *Builder) *Builder {
     p.i    = 0
+    p.pc   = 0
     p.head = nil
     p.tail = nil
     rt.MapClear(p.refs)
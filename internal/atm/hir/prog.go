@@ -33,8 +33,16 @@ func (self Program) Free() {
 }
 
 func (self Program) Disassemble() string {
+    ret, _ := self.Listing()
+    return strings.Join(ret, "\n")
+}
+
+// Listing disassembles the program line by line, and returns the lines together
+// with the index of the first line of every instruction.
+func (self Program) Listing() ([]string, map[*Ir]int) {
     ret := make([]string, 0, 64)
     ref := make(map[*Ir]string)
+    pos := make(map[*Ir]int)
 
     /* scan all the branch target */
     for p := self.Head; p != nil; p = p.Ln {
@@ -66,11 +74,12 @@ func (self Program) Disassemble() string {
         }
 
         /* indent each line */
-        for _, ln := range strings.Split(p.Disassemble(ref), "\n") {
+        for i, ln := range strings.Split(p.Disassemble(ref), "\n") {
+            if i == 0 { pos[p] = len(ret) }
             ret = append(ret, "    " + ln)
         }
     }
 
-    /* join them together */
-    return strings.Join(ret, "\n")
+    /* all done */
+    return ret, pos
 }
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package hir
+
+import (
+    `fmt`
+    `reflect`
+    `runtime`
+    `unsafe`
+)
+
+type _ProxySlot struct {
+    vt reflect.Type
+    at int
+    ds string
+}
+
+func (self _ProxySlot) word(mp unsafe.Pointer, i int) unsafe.Pointer {
+    return unsafe.Pointer(uintptr(mp) + uintptr(i) * 8)
+}
+
+func (self _ProxySlot) load(ctx CallContext) reflect.Value {
+    rv := reflect.New(self.vt).Elem()
+    mp := unsafe.Pointer(rv.UnsafeAddr())
+
+    /* scalar values are truncated to their actual width */
+    switch self.vt.Kind() {
+        case reflect.Bool    : rv.SetBool(ctx.Au(self.at) & 0xff != 0); return rv
+        case reflect.Int     : fallthrough
+        case reflect.Int8    : fallthrough
+        case reflect.Int16   : fallthrough
+        case reflect.Int32   : fallthrough
+        case reflect.Int64   : rv.SetInt(int64(ctx.Au(self.at))); return rv
+        case reflect.Uint    : fallthrough
+        case reflect.Uint8   : fallthrough
+        case reflect.Uint16  : fallthrough
+        case reflect.Uint32  : fallthrough
+        case reflect.Uint64  : fallthrough
+        case reflect.Uintptr : rv.SetUint(ctx.Au(self.at)); return rv
+    }
+
+    /* other values are copied word by word */
+    for i := 0; i < len(self.ds); i++ {
+        if self.ds[i] == '*' {
+            *(*unsafe.Pointer)(self.word(mp, i)) = ctx.Ap(self.at + i)
+        } else {
+            *(*uint64)(self.word(mp, i)) = ctx.Au(self.at + i)
+        }
+    }
+
+    /* all done */
+    return rv
+}
+
+func (self _ProxySlot) store(ctx CallContext, val reflect.Value) {
+    rv := reflect.New(self.vt).Elem()
+    mp := unsafe.Pointer(rv.UnsafeAddr())
+
+    /* scalar values are extended to the register width */
+    switch self.vt.Kind() {
+        case reflect.Bool    : ctx.Ru(self.at, bool2u64(val.Bool())); return
+        case reflect.Int     : fallthrough
+        case reflect.Int8    : fallthrough
+        case reflect.Int16   : fallthrough
+        case reflect.Int32   : fallthrough
+        case reflect.Int64   : ctx.Ru(self.at, uint64(val.Int())); return
+        case reflect.Uint    : fallthrough
+        case reflect.Uint8   : fallthrough
+        case reflect.Uint16  : fallthrough
+        case reflect.Uint32  : fallthrough
+        case reflect.Uint64  : fallthrough
+        case reflect.Uintptr : ctx.Ru(self.at, val.Uint()); return
+    }
+
+    /* other values are copied word by word */
+    rv.Set(val)
+    for i := 0; i < len(self.ds); i++ {
+        if self.ds[i] == '*' {
+            ctx.Rp(self.at + i, *(*unsafe.Pointer)(self.word(mp, i)))
+        } else {
+            ctx.Ru(self.at + i, *(*uint64)(self.word(mp, i)))
+        }
+    }
+}
+
+func bool2u64(v bool) uint64 {
+    if v {
+        return 1
+    } else {
+        return 0
+    }
+}
+
+func proxyWords(vt reflect.Type) string {
+    switch vt.Kind() {
+        case reflect.Bool          : fallthrough
+        case reflect.Int           : fallthrough
+        case reflect.Int8          : fallthrough
+        case reflect.Int16         : fallthrough
+        case reflect.Int32         : fallthrough
+        case reflect.Int64         : fallthrough
+        case reflect.Uint          : fallthrough
+        case reflect.Uint8         : fallthrough
+        case reflect.Uint16        : fallthrough
+        case reflect.Uint32        : fallthrough
+        case reflect.Uint64        : fallthrough
+        case reflect.Uintptr       : return "i"
+        case reflect.Chan          : fallthrough
+        case reflect.Func          : fallthrough
+        case reflect.Map           : fallthrough
+        case reflect.Ptr           : fallthrough
+        case reflect.UnsafePointer : return "*"
+        case reflect.Interface     : return "**"
+        case reflect.String        : return "*i"
+        case reflect.Slice         : return "*ii"
+        default                    : panic("gcall: unsupported type by automatic proxy: " + vt.String())
+    }
+}
+
+func proxyLayout(n int, at func(int) reflect.Type) (string, []_ProxySlot) {
+    ds := ""
+    vv := make([]_ProxySlot, 0, n)
+
+    /* assign register slots for every value */
+    for i := 0; i < n; i++ {
+        vt := at(i)
+        vs := proxyWords(vt)
+        vv = append(vv, _ProxySlot { vt: vt, at: len(ds), ds: vs })
+        ds += vs
+    }
+
+    /* check for register slot count */
+    if len(ds) > MaxCallArgs {
+        panic(fmt.Sprintf("gcall: too many register slots: %d > %d", len(ds), MaxCallArgs))
+    } else {
+        return ds, vv
+    }
+}
+
+// MakeProxy derives the emulator proxy of a Go function from its signature.
+// Arguments and return values are split into registers the same way as the
+// native ABI does, so a function returning `(int, error)` has three return
+// registers: the result, followed by the itab and data pointer of the error.
+//
+// Variadic functions take the variadic part as a slice, which occupies three
+// consecutive argument registers.
+func MakeProxy(fn interface{}) func(CallContext) {
+    fv := reflect.ValueOf(fn)
+    ft := fv.Type()
+
+    /* must be a function */
+    if ft.Kind() != reflect.Func {
+        panic("gcall: fn is not a function")
+    }
+
+    /* layout the arguments and return values */
+    name := runtime.FuncForPC(fv.Pointer()).Name()
+    args, av := proxyLayout(ft.NumIn(), ft.In)
+    rets, rv := proxyLayout(ft.NumOut(), ft.Out)
+
+    /* select the invoker */
+    call := fv.Call
+    if ft.IsVariadic() {
+        call = fv.CallSlice
+    }
+
+    /* the proxy function */
+    return func(ctx CallContext) {
+        if !ctx.Verify(args, rets) {
+            panic("invalid " + name + " call")
+        }
+
+        /* load every argument */
+        vals := make([]reflect.Value, len(av))
+        for i, v := range av {
+            vals[i] = v.load(ctx)
+        }
+
+        /* call the function, and store every return value */
+        for i, v := range call(vals) {
+            rv[i].store(ctx, v)
+        }
+    }
+}
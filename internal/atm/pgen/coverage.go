@@ -0,0 +1,115 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgen
+
+import (
+    `os`
+    `sort`
+    `strings`
+    `sync`
+    `sync/atomic`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+)
+
+// OpCoverage records how many times an HIR instruction has been translated, and
+// the machine instruction sequences that were selected for it.
+type OpCoverage struct {
+    Op    string         `json:"op"`
+    Count int            `json:"count"`
+    Rules map[string]int `json:"rules"`
+}
+
+type _Coverage struct {
+    ops [256]int
+    sel [256]map[string]int
+}
+
+var (
+    covKnown   [256]bool
+    covLock    = new(sync.Mutex)
+    covData    = new(_Coverage)
+    covEnabled = int32(bool2i32(os.Getenv("FRUGAL_CODEGEN_COVERAGE") != ""))
+)
+
+func bool2i32(v bool) int32 {
+    if v {
+        return 1
+    } else {
+        return 0
+    }
+}
+
+// EnableCoverage turns on or off the coverage recording of the code generator.
+func EnableCoverage(enable bool) {
+    atomic.StoreInt32(&covEnabled, bool2i32(enable))
+}
+
+func coverageEnabled() bool {
+    return atomic.LoadInt32(&covEnabled) != 0
+}
+
+func recordCoverage(op hir.OpCode, ins []string) {
+    key := strings.Join(ins, "; ")
+    covLock.Lock()
+
+    /* allocate the rule map on first use */
+    if covData.sel[op] == nil {
+        covData.sel[op] = make(map[string]int)
+    }
+
+    /* update the counters */
+    covData.ops[op]++
+    covData.sel[op][key]++
+    covLock.Unlock()
+}
+
+// GetCoverage returns the coverage of every HIR instruction that is known to the
+// code generator, including the ones that have never been translated.
+func GetCoverage() []OpCoverage {
+    covLock.Lock()
+    defer covLock.Unlock()
+
+    /* dump every known instruction */
+    ret := make([]OpCoverage, 0, len(covKnown))
+    for op, ok := range covKnown {
+        if ok {
+            ret = append(ret, OpCoverage {
+                Op    : hir.OpCode(op).String(),
+                Count : covData.ops[op],
+                Rules : copyRules(covData.sel[op]),
+            })
+        }
+    }
+
+    /* sort by name to make it stable */
+    sort.Slice(ret, func(i int, j int) bool { return ret[i].Op < ret[j].Op })
+    return ret
+}
+
+// ResetCoverage clears all the recorded coverage data.
+func ResetCoverage() {
+    covLock.Lock()
+    covData = new(_Coverage)
+    covLock.Unlock()
+}
+
+func copyRules(m map[string]int) map[string]int {
+    ret := make(map[string]int, len(m))
+    for k, v := range m { ret[k] = v }
+    return ret
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgen
+
+import (
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `golang.org/x/arch/x86/x86asm`
+)
+
+func init() {
+    for op, fn := range translators {
+        covKnown[op] = fn != nil
+    }
+}
+
+func (self *CodeGen) coverage(s hir.Program, code []byte) {
+    end := toAddress(self.halt)
+
+    /* the deferred blocks are placed right after the program */
+    if len(self.defs) != 0 {
+        end = toAddress(self.defs[0].ref)
+    }
+
+    /* every instruction ends where the next one starts */
+    for v := s.Head; v != nil; v = v.Ln {
+        if v.Op != hir.OP_nop {
+            if v.Ln == nil {
+                recordCoverage(v.Op, disasmNames(code[toAddress(self.to(v)):end]))
+            } else {
+                recordCoverage(v.Op, disasmNames(code[toAddress(self.to(v)):toAddress(self.to(v.Ln))]))
+            }
+        }
+    }
+}
+
+func disasmNames(buf []byte) []string {
+    var err error
+    var ins x86asm.Inst
+    var ret []string
+
+    /* decode the instructions one by one */
+    for len(buf) != 0 {
+        if ins, err = x86asm.Decode(buf, 64); err != nil {
+            return append(ret, "(bad)")
+        } else {
+            ret, buf = append(ret, ins.Op.String()), buf[ins.Len:]
+        }
+    }
+
+    /* all done */
+    return ret
+}
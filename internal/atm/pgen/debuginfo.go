@@ -0,0 +1,36 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgen
+
+import (
+    `os`
+    `sync/atomic`
+)
+
+var (
+    dbgEnabled = int32(bool2i32(os.Getenv("FRUGAL_DEBUG_SOURCE_DIR") != ""))
+)
+
+// EnableDebugInfo turns on or off the generation of line tables, which map the
+// machine code back to a pseudo-source listing of the HIR program.
+func EnableDebugInfo(enable bool) {
+    atomic.StoreInt32(&dbgEnabled, bool2i32(enable))
+}
+
+func debugInfoEnabled() bool {
+    return atomic.LoadInt32(&dbgEnabled) != 0
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgen
+
+import (
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+func (self *CodeGen) debugInfo(s hir.Program, size uintptr) ([]string, []rt.Line) {
+    pc := uintptr(0)
+    ln, pos := s.Listing()
+
+    /* line 1 is the prologue, and the listing starts from line 2 */
+    ret := make([]rt.Line, 0, len(pos) + 2)
+    src := make([]string, 0, len(ln) + 2)
+    src = append(src, "; prologue")
+    src = append(src, ln...)
+    src = append(src, "; epilogue and out-of-line blocks")
+
+    /* the deferred blocks are placed right after the program */
+    lp := 1
+    end := toAddress(self.halt)
+
+    /* find the end of the program */
+    if len(self.defs) != 0 {
+        end = toAddress(self.defs[0].ref)
+    }
+
+    /* every instruction starts a new line, empty ones are merged into the next one */
+    for v := s.Head; v != nil; v = v.Ln {
+        if at := toAddress(self.to(v)); at > pc {
+            ret = append(ret, rt.Line { Ln: lp, Nb: at - pc })
+            pc = at
+        }
+        lp = pos[v] + 2
+    }
+
+    /* the last instruction */
+    if end > pc {
+        ret = append(ret, rt.Line { Ln: lp, Nb: end - pc })
+        pc = end
+    }
+
+    /* everything else */
+    if size > pc {
+        ret = append(ret, rt.Line { Ln: len(src), Nb: size - pc })
+    }
+
+    /* all done */
+    return src, ret
+}
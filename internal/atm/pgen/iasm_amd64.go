@@ -72,6 +72,10 @@ func isInt32(v int64) bool {
     return v >= math.MinInt32 && v <= math.MaxInt32
 }
 
+func isUint32(v int64) bool {
+    return v >= 0 && v <= math.MaxUint32
+}
+
 func isReg64(v x86_64.Register) (ok bool) {
     _, ok = v.(x86_64.Register64)
     return
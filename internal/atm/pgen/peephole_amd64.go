@@ -0,0 +1,245 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package pgen
+
+import (
+    `os`
+    `sync/atomic`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+)
+
+/** Peephole Optimizer
+ *
+ *  The translators emit HIR one opcode at a time, so the final instruction stream
+ *  often contains redundancies across opcode boundaries, such as moving a register
+ *  to itself, adding zero, or reloading a value that was just stored. These are
+ *  removed with a table of rewrite rules right before machine code generation.
+ *
+ *  Each rule looks at an instruction `q`, and `p`, the last instruction before `q`
+ *  that reaches `q` with the same state (only conditional branches are allowed in
+ *  between), or nil if there is no such instruction. `q` is never a branch target.
+ *  A rule may rewrite `q` in-place, and returns true to remove `q`. `p` can only be
+ *  rewritten when it is directly before `q`, otherwise the branches in between
+ *  would observe the rewritten value.
+ */
+
+type _PeepholeRule struct {
+    name string
+    rule func(p *hir.Ir, q *hir.Ir) bool
+}
+
+var peepholeRules = [...]_PeepholeRule {
+    { name: "identity-op"    , rule: peepholeIdentityOp    },
+    { name: "self-move"      , rule: peepholeSelfMove      },
+    { name: "fold-addi"      , rule: peepholeFoldAddi      },
+    { name: "fold-addpi"     , rule: peepholeFoldAddpi     },
+    { name: "store-load"     , rule: peepholeStoreLoad     },
+    { name: "redundant-load" , rule: peepholeRedundantLoad },
+}
+
+var (
+    phEnabled = int32(bool2i32(os.Getenv("FRUGAL_NO_PEEPHOLE") == ""))
+)
+
+// EnablePeephole turns on or off the peephole optimizer.
+func EnablePeephole(enable bool) {
+    atomic.StoreInt32(&phEnabled, bool2i32(enable))
+}
+
+func peepholeEnabled() bool {
+    return atomic.LoadInt32(&phEnabled) != 0
+}
+
+/* muli $1, andi $-1, xori $0, shri $0 --> addi $0 */
+func peepholeIdentityOp(_ *hir.Ir, q *hir.Ir) bool {
+    switch q.Op {
+        case hir.OP_muli : if q.Iv !=  1 { return false }
+        case hir.OP_andi : if q.Iv != -1 { return false }
+        case hir.OP_xori : if q.Iv !=  0 { return false }
+        case hir.OP_shri : if q.Iv !=  0 { return false }
+        default          : return false
+    }
+    q.Op, q.Iv = hir.OP_addi, 0
+    return false
+}
+
+/* add %r, %z, %r; addi %r, $0, %r; addp %p, %z, %p; addpi %p, $0, %p --> (removed) */
+func peepholeSelfMove(_ *hir.Ir, q *hir.Ir) bool {
+    switch q.Op {
+        case hir.OP_add   : return q.Rx == q.Rz && q.Ry == hir.Rz
+        case hir.OP_sub   : return q.Rx == q.Rz && q.Ry == hir.Rz
+        case hir.OP_addi  : return q.Rx == q.Ry && q.Iv == 0
+        case hir.OP_addp  : return q.Ps == q.Pd && q.Rx == hir.Rz
+        case hir.OP_subp  : return q.Ps == q.Pd && q.Rx == hir.Rz
+        case hir.OP_addpi : return q.Ps == q.Pd && q.Iv == 0
+        default           : return false
+    }
+}
+
+/* addi %r, $a, %r; addi %r, $b, %r --> addi %r, $(a + b), %r */
+func peepholeFoldAddi(p *hir.Ir, q *hir.Ir) bool {
+    if p == nil || p.Ln != q || p.Op != hir.OP_addi || q.Op != hir.OP_addi {
+        return false
+    } else if p.Rx != p.Ry || q.Rx != q.Ry || p.Ry != q.Rx || p.Ry == hir.Rz {
+        return false
+    } else if !isInt32(p.Iv + q.Iv) {
+        return false
+    } else {
+        p.Iv += q.Iv
+        return true
+    }
+}
+
+/* addpi %p, $a, %p; addpi %p, $b, %p --> addpi %p, $(a + b), %p */
+func peepholeFoldAddpi(p *hir.Ir, q *hir.Ir) bool {
+    if p == nil || p.Ln != q || p.Op != hir.OP_addpi || q.Op != hir.OP_addpi {
+        return false
+    } else if p.Ps != p.Pd || q.Ps != q.Pd || p.Pd != q.Ps || p.Pd == hir.Pn {
+        return false
+    } else if !isInt32(p.Iv + q.Iv) {
+        return false
+    } else {
+        p.Iv += q.Iv
+        return true
+    }
+}
+
+/* sq %r0, n(%p); lq n(%p), %r1 --> sq %r0, n(%p); addi %r0, $0, %r1
+ * sp %p0, n(%p); lp n(%p), %p1 --> sp %p0, n(%p); addpi %p0, $0, %p1 */
+func peepholeStoreLoad(p *hir.Ir, q *hir.Ir) bool {
+    switch {
+        default: {
+            return false
+        }
+
+        /* 64-bit integers */
+        case p != nil && p.Op == hir.OP_sq && q.Op == hir.OP_lq && p.Pd == q.Ps && p.Iv == q.Iv: {
+            q.Op, q.Ry, q.Rx, q.Iv = hir.OP_addi, q.Rx, p.Rx, 0
+            return q.Rx == q.Ry
+        }
+
+        /* pointers */
+        case p != nil && p.Op == hir.OP_sp && q.Op == hir.OP_lp && p.Pd == q.Ps && p.Iv == q.Iv: {
+            q.Op, q.Ps, q.Iv = hir.OP_addpi, p.Ps, 0
+            return q.Ps == q.Pd
+        }
+    }
+}
+
+/* lx n(%p), %r; lx n(%p), %r --> lx n(%p), %r */
+func peepholeRedundantLoad(p *hir.Ir, q *hir.Ir) bool {
+    if p == nil || p.Op != q.Op || p.Ps != q.Ps || p.Iv != q.Iv {
+        return false
+    }
+
+    /* check for load instructions */
+    switch q.Op {
+        case hir.OP_lb : return p.Rx == q.Rx
+        case hir.OP_lw : return p.Rx == q.Rx
+        case hir.OP_ll : return p.Rx == q.Rx
+        case hir.OP_lq : return p.Rx == q.Rx
+        case hir.OP_lp : return p.Pd == q.Pd && p.Pd != p.Ps
+        default        : return false
+    }
+}
+
+func peepholeTargets(s hir.Program) map[*hir.Ir]bool {
+    ret := make(map[*hir.Ir]bool)
+
+    /* mark every branch target */
+    for v := s.Head; v != nil; v = v.Ln {
+        if v.IsBranch() {
+            if v.Op != hir.OP_bsw {
+                ret[v.Br] = true
+            } else {
+                for _, lb := range v.Switch() {
+                    ret[lb] = true
+                }
+            }
+        }
+    }
+
+    /* all done */
+    return ret
+}
+
+func peepholeIsCondBranch(v *hir.Ir) bool {
+    switch v.Op {
+        case hir.OP_beq  : fallthrough
+        case hir.OP_bne  : fallthrough
+        case hir.OP_blt  : fallthrough
+        case hir.OP_bltu : fallthrough
+        case hir.OP_bgeu : fallthrough
+        case hir.OP_beqp : fallthrough
+        case hir.OP_bnep : return true
+        default          : return false
+    }
+}
+
+func peepholeUpdate(p *hir.Ir, q *hir.Ir) *hir.Ir {
+    if peepholeIsCondBranch(q) {
+        return p
+    } else if q.IsBranch() || q.Op == hir.OP_ret {
+        return nil
+    } else {
+        return q
+    }
+}
+
+func peepholeApply(p *hir.Ir, q *hir.Ir) bool {
+    for _, r := range peepholeRules {
+        if r.rule(p, q) {
+            return true
+        }
+    }
+    return false
+}
+
+func peepholeSweep(s hir.Program, tab map[*hir.Ir]bool) (n int) {
+    var q *hir.Ir
+    var v = s.Head
+    var p = peepholeUpdate(nil, v)
+
+    /* scan every instruction after the first one */
+    for v.Ln != nil {
+        if q = v.Ln; tab[q] {
+            p, v = peepholeUpdate(nil, q), q
+        } else if peepholeApply(p, q) {
+            v.Ln, n = q.Ln, n + 1
+            q.Free()
+        } else {
+            p, v = peepholeUpdate(p, q), q
+        }
+    }
+
+    /* all done */
+    return
+}
+
+// Peephole applies the peephole rules to s in-place until nothing changes, and
+// returns the number of instructions that were removed. The first instruction
+// is never removed.
+func Peephole(s hir.Program) (n int) {
+    if s.Head != nil {
+        for tab, m := peepholeTargets(s), -1; m != 0; n += m {
+            m = peepholeSweep(s, tab)
+        }
+    }
+    return
+}
@@ -83,19 +83,19 @@ func (self *CodeGen) internalUnspillArgs(p *x86_64.Program) {
 /** Reserved Register Management **/
 
 func (self *CodeGen) abiSaveReserved(p *x86_64.Program) {
-    for rr := range self.ctxt.regr {
+    for _, rr := range self.ctxt.rseq {
         p.MOVQ(rr, self.ctxt.rslot(rr))
     }
 }
 
 func (self *CodeGen) abiLoadReserved(p *x86_64.Program) {
-    for rr := range self.ctxt.regr {
+    for _, rr := range self.ctxt.rseq {
         p.MOVQ(self.ctxt.rslot(rr), rr)
     }
 }
 
 func (self *CodeGen) abiSpillReserved(p *x86_64.Program) {
-    for rr := range self.ctxt.regr {
+    for _, rr := range self.ctxt.rseq {
         if lr := self.rindex(rr); lr != nil {
             p.MOVQ(rr, self.ctxt.slot(lr))
         }
@@ -103,7 +103,7 @@ func (self *CodeGen) abiSpillReserved(p *x86_64.Program) {
 }
 
 func (self *CodeGen) abiRestoreReserved(p *x86_64.Program) {
-    for rr := range self.ctxt.regr {
+    for _, rr := range self.ctxt.rseq {
         if lr := self.rindex(rr); lr != nil {
             p.MOVQ(self.ctxt.slot(lr), rr)
         }
@@ -461,10 +461,10 @@ func (self *CodeGen) internalCallFunction(p *x86_64.Program, v *hir.Ir, this hir
         }
     }
 
-    /* store all the stack-based return values */
-    for rr, mem := range rm {
-        if mem != -1 {
-            p.MOVQ(Ptr(RSP, mem), self.r(rr))
+    /* store all the stack-based return values, in the order of return values */
+    for i := range fv.Rets {
+        if mem, ok := rm[ri2reg(v.Rr[i])]; ok && mem != -1 {
+            p.MOVQ(Ptr(RSP, mem), self.r(ri2reg(v.Rr[i])))
         }
     }
 }
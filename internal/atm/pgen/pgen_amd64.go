@@ -98,6 +98,7 @@ type _FrameInfo struct {
     desc *abi.FunctionLayout
     regi map[hir.Register]int32
     regr map[x86_64.Register64]int32
+    rseq []x86_64.Register64
 }
 
 func (self *_FrameInfo) regc() int {
@@ -195,6 +196,15 @@ func newContext(proto interface{}) (ret _FrameInfo) {
     ret.regr = abi.ABI.Reserved()
     ret.desc = abi.ABI.LayoutFunc(-1, vt)
     ret.regi = make(map[hir.Register]int32)
+    ret.rseq = make([]x86_64.Register64, len(ret.regr))
+
+    /* reserved registers are saved and restored in the order of their slots,
+     * iterating over the map directly makes the generated code vary between runs */
+    for rr, i := range ret.regr {
+        ret.rseq[i] = rr
+    }
+
+    /* all done */
     return
 }
 
@@ -254,6 +264,8 @@ var _OperandMask = [256]Operands {
     hir.OP_bgeu  : Orx | Ory,
     hir.OP_beqp  : Ops | Opd,
     hir.OP_bnep  : Ops | Opd,
+    hir.OP_addo  : Orx | Ory | Owz,
+    hir.OP_addio : Orx | Owy,
     hir.OP_bsw   : Orx,
     hir.OP_jmp   : Ojmp,
     hir.OP_bzero : Opd,
@@ -297,6 +309,11 @@ func (self *CodeGen) Generate(s hir.Program, sp uintptr) *Func {
     h := 0
     p := self.arch.CreateProgram()
 
+    /* remove the redundant instructions */
+    if peepholeEnabled() {
+        Peephole(s)
+    }
+
     /* find the halting points */
     for v := s.Head; h < 2 && v != nil; v = v.Ln {
         if v.Op == hir.OP_ret {
@@ -350,7 +367,7 @@ func (self *CodeGen) Generate(s hir.Program, sp uintptr) *Func {
     self.abiPrologue(p)
 
     /* clear all the pointer registers */
-    for lr := range self.regs {
+    for _, lr := range self.ctxt.regs {
         if lr.A() & hir.ArgPointer != 0 {
             self.clr(p, lr)
         }
@@ -420,6 +437,16 @@ func (self *CodeGen) Generate(s hir.Program, sp uintptr) *Func {
         },
     }
 
+    /* record the selected instructions */
+    if coverageEnabled() {
+        self.coverage(s, code)
+    }
+
+    /* map the code back to the program */
+    if debugInfoEnabled() {
+        ret.Frame.Source, ret.Frame.LineTab = self.debugInfo(s, uintptr(len(code)))
+    }
+
     /* free the assembler */
     p.Free()
     return ret
@@ -434,10 +461,10 @@ func (self *CodeGen) later(ref *x86_64.Label, def func(*x86_64.Program)) {
 
 func (self *CodeGen) translate(p *x86_64.Program, v *hir.Ir) {
     if p.Link(self.to(v)); v.Op != hir.OP_nop {
-        if fp := translators[v.Op]; fp != nil {
-            fp(self, p, v)
-        } else {
+        if fp := translators[v.Op]; fp == nil {
             panic("pgen: invalid instruction: " + v.Disassemble(nil))
+        } else {
+            fp(self, p, v)
         }
     }
 }
@@ -639,6 +666,8 @@ var translators = [256]func(*CodeGen, *x86_64.Program, *hir.Ir) {
     hir.OP_bgeu  : (*CodeGen).translate_OP_bgeu,
     hir.OP_beqp  : (*CodeGen).translate_OP_beqp,
     hir.OP_bnep  : (*CodeGen).translate_OP_bnep,
+    hir.OP_addo  : (*CodeGen).translate_OP_addo,
+    hir.OP_addio : (*CodeGen).translate_OP_addio,
     hir.OP_bsw   : (*CodeGen).translate_OP_bsw,
     hir.OP_jmp   : (*CodeGen).translate_OP_jmp,
     hir.OP_bzero : (*CodeGen).translate_OP_bzero,
@@ -900,7 +929,7 @@ func (self *CodeGen) translate_OP_addi(p *x86_64.Program, v *hir.Ir) {
         } else {
             if v.Iv == 0 {
                 self.clr(p, v.Ry)
-            } else if !isInt32(v.Iv) {
+            } else if !isUint32(v.Iv) {
                 p.MOVQ(v.Iv, self.r(v.Ry))
             } else {
                 p.MOVL(v.Iv, x86_64.Register32(self.r(v.Ry)))
@@ -1000,7 +1029,7 @@ func (self *CodeGen) translate_OP_xori(p *x86_64.Program, v *hir.Ir) {
         } else {
             if v.Iv == 0 {
                 self.clr(p, v.Ry)
-            } else if !isInt32(v.Iv) {
+            } else if !isUint32(v.Iv) {
                 p.MOVQ(v.Iv, self.r(v.Ry))
             } else {
                 p.MOVL(v.Iv, x86_64.Register32(self.r(v.Ry)))
@@ -1165,6 +1194,65 @@ func (self *CodeGen) translate_OP_bnep(p *x86_64.Program, v *hir.Ir) {
     }
 }
 
+func (self *CodeGen) translate_OP_addo(p *x86_64.Program, v *hir.Ir) {
+    z := RAX
+
+    /* adding zero never overflows */
+    if v.Rx == hir.Rz || v.Ry == hir.Rz {
+        self.translate_OP_add(p, v)
+        return
+    }
+
+    /* the result may be discarded, but the flags are still needed */
+    if v.Rz != hir.Rz {
+        z = self.r(v.Rz)
+    }
+
+    /* add to the result register directly if possible */
+    if x := self.r(v.Rx); v.Ry == v.Rz {
+        p.ADDQ(x, z)
+    } else if x == z {
+        p.ADDQ(self.r(v.Ry), z)
+    } else {
+        p.MOVQ(x, z)
+        p.ADDQ(self.r(v.Ry), z)
+    }
+
+    /* branch on overflow */
+    p.JO(self.to(v.Br))
+}
+
+func (self *CodeGen) translate_OP_addio(p *x86_64.Program, v *hir.Ir) {
+    z := RAX
+
+    /* adding to zero, or adding zero never overflows */
+    if v.Rx == hir.Rz || v.Iv == 0 {
+        self.translate_OP_addi(p, v)
+        return
+    }
+
+    /* the result may be discarded, but the flags are still needed */
+    if v.Ry != hir.Rz {
+        z = self.r(v.Ry)
+    }
+
+    /* large immediate values need to be loaded into RAX first */
+    if x := self.r(v.Rx); isInt32(v.Iv) {
+        if x != z { p.MOVQ(x, z) }
+        p.ADDQ(v.Iv, z)
+    } else if z == RAX {
+        p.MOVQ(v.Iv, RAX)
+        p.ADDQ(x, RAX)
+    } else {
+        p.MOVQ(v.Iv, RAX)
+        if x != z { p.MOVQ(x, z) }
+        p.ADDQ(RAX, z)
+    }
+
+    /* branch on overflow */
+    p.JO(self.to(v.Br))
+}
+
 func (self *CodeGen) translate_OP_bsw(p *x86_64.Program, v *hir.Ir) {
     nsw := v.Iv
     tab := v.Switch()
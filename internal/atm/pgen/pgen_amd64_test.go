@@ -231,3 +231,111 @@ func TestPGen_FunctionCall(t *testing.T) {
     require.Equal(t, 746, y)
     require.Equal(t, 20211206, z)
 }
+
+func TestPGen_Coverage(t *testing.T) {
+    EnableCoverage(true)
+    defer EnableCoverage(false)
+    ResetCoverage()
+    p := hir.CreateBuilder()
+    p.LDAQ(0, hir.R0)
+    p.ADDI(hir.R0, 1, hir.R1)
+    p.RET().R0(hir.R1)
+    CreateCodeGen((func(int) int)(nil)).Generate(p.Build(), 0)
+    cov := make(map[string]OpCoverage)
+    for _, v := range GetCoverage() {
+        cov[v.Op] = v
+    }
+    spew.Dump(cov["addi"])
+    require.Equal(t, 1, cov["ldaq"].Count)
+    require.Equal(t, 1, cov["addi"].Count)
+    require.Len(t, cov["addi"].Rules, 1)
+    require.Contains(t, cov, "muli")
+    require.Zero(t, cov["muli"].Count)
+}
+
+func debuginfotestfn() int {
+    _, _, ln, _ := runtime.Caller(1)
+    return ln
+}
+
+func TestPGen_DebugInfo(t *testing.T) {
+    EnableDebugInfo(true)
+    defer EnableDebugInfo(false)
+    h := hir.RegisterGCall(debuginfotestfn, nil)
+    p := hir.CreateBuilder()
+    p.LDAQ(0, hir.R0)
+    p.ADDI(hir.R0, 1, hir.R1)
+    p.GCALL(h).R0(hir.R2)
+    p.RET().R0(hir.R2)
+    r := CreateCodeGen((func(int) int)(nil)).Generate(p.Build(), 0)
+    spew.Dump(r.Frame.LineTab)
+    require.Equal(t, "; prologue", r.Frame.Source[0])
+    require.Equal(t, "; epilogue and out-of-line blocks", r.Frame.Source[len(r.Frame.Source) - 1])
+    nb := uintptr(0)
+    for _, v := range r.Frame.LineTab { nb += v.Nb }
+    require.Equal(t, uintptr(len(r.Code)), nb)
+    v := loader.Loader(r.Code).Load("_test_debuginfo", r.Frame)
+    ln := (*(*func(int) int)(unsafe.Pointer(&v)))(0)
+    require.Contains(t, r.Frame.Source[ln - 1], "gcall")
+}
+
+func TestPGen_Peephole(t *testing.T) {
+    p := hir.CreateBuilder()
+    p.LDAP  (0, hir.P0)
+    p.LDAQ  (1, hir.R0)
+    p.MULI  (hir.R0, 1, hir.R0)
+    p.ADDI  (hir.R0, 8, hir.R0)
+    p.ADDI  (hir.R0, -8, hir.R0)
+    p.ADDPI (hir.P0, 16, hir.P0)
+    p.ADDPI (hir.P0, 0, hir.P0)
+    p.SQ    (hir.R0, hir.P0, 8)
+    p.LQ    (hir.P0, 8, hir.R1)
+    p.LP    (hir.P0, 0, hir.P1)
+    p.BEQP  (hir.P1, hir.Pn, "_done")
+    p.LP    (hir.P0, 0, hir.P1)
+    p.Label ("_done")
+    p.LP    (hir.P0, 0, hir.P1)
+    p.RET   ().R0(hir.R1)
+    s := p.Build()
+    require.Equal(t, 5, Peephole(s))
+    require.Equal(t, strings.Join([]string {
+        "    ldap    $0, %p0",
+        "    ldaq    $1, %r0",
+        "    addpi   %p0, $16, %p0",
+        "    sq      %r0, 8(%p0)",
+        "    addi    %r0, $0, %r1",
+        "    lp      0(%p0), %p1",
+        "    beq     %p1, %nil, L_0",
+        "L_0:",
+        "    lp      0(%p0), %p1",
+        "    ret     {%r1}",
+    }, "\n"), s.Disassemble())
+}
+
+func TestPGen_PeepholeBranch(t *testing.T) {
+    p := hir.CreateBuilder()
+    p.LDAQ  (0, hir.R0)
+    p.ADDI  (hir.R0, 1, hir.R0)
+    p.BNE   (hir.R0, hir.Rz, "_done")
+    p.ADDI  (hir.R0, 2, hir.R0)
+    p.LDAP  (1, hir.P0)
+    p.ADDPI (hir.P0, 8, hir.P0)
+    p.BEQP  (hir.P0, hir.Pn, "_done")
+    p.ADDPI (hir.P0, 8, hir.P0)
+    p.Label ("_done")
+    p.RET   ().R0(hir.R0)
+    s := p.Build()
+    require.Equal(t, 0, Peephole(s))
+    require.Equal(t, strings.Join([]string {
+        "    ldaq    $0, %r0",
+        "    addi    %r0, $1, %r0",
+        "    bne     %r0, %z, L_0",
+        "    addi    %r0, $2, %r0",
+        "    ldap    $1, %p0",
+        "    addpi   %p0, $8, %p0",
+        "    beq     %p0, %nil, L_0",
+        "    addpi   %p0, $8, %p0",
+        "L_0:",
+        "    ret     {%r0}",
+    }, "\n"), s.Disassemble())
+}
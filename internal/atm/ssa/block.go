@@ -530,3 +530,59 @@ func (self *BasicBlock) termCondition(p *hir.Ir, t *BasicBlock, f *BasicBlock) {
     self.Ins = append(self.Ins, ins)
     self.Term = &IrSwitch { V: Tr(0), Ln: to, Br: map[int32]*IrBranch { 0: br } }
 }
+
+func (self *BasicBlock) termOverflow(p *hir.Ir, t *BasicBlock, f *BasicBlock) {
+    var rx Reg
+    var ry Reg
+    var rz Reg
+
+    /* check for OpCode */
+    switch p.Op {
+        case hir.OP_addo  : rx, ry, rz = Rv(p.Rx), Rv(p.Ry), Rv(p.Rz)
+        case hir.OP_addio : rx, ry, rz = Rv(p.Rx), Tr(1), Rv(p.Ry)
+        default            : panic("invalid branch: " + p.Disassemble(nil))
+    }
+
+    /* load the immediate value if any */
+    if p.Op == hir.OP_addio {
+        self.Ins = append(self.Ins, &IrConstInt { R: Tr(1), V: p.Iv })
+    }
+
+    /* signed overflow happens when the result has a different sign from both operands,
+     * which is ((x ^ (x + y)) & (y ^ (x + y))) < 0 */
+    self.Ins = append(
+        self.Ins,
+        &IrBinaryExpr { R: Tr(2), X: rx, Y: ry, Op: IrOpAdd },
+        &IrBinaryExpr { R: Tr(3), X: rx, Y: Tr(2), Op: IrOpXor },
+        &IrBinaryExpr { R: Tr(4), X: ry, Y: Tr(2), Op: IrOpXor },
+        &IrBinaryExpr { R: Tr(3), X: Tr(3), Y: Tr(4), Op: IrOpAnd },
+        &IrBinaryExpr { R: rz, X: Tr(2), Y: Rz, Op: IrOpAdd },
+    )
+
+    /* construct the instruction */
+    ins := &IrBinaryExpr {
+        R  : Tr(0),
+        X  : Tr(3),
+        Y  : Rz,
+        Op : IrCmpLt,
+    }
+
+    /* add predecessors */
+    t.addPred(self)
+    f.addPred(self)
+
+    /* create branch targets */
+    to := IrUnlikely(t)
+    br := IrUnlikely(f)
+
+    /* assign the correct likeliness */
+    if p.Likeliness() == hir.Likely {
+        to.Likeliness = Likely
+    } else {
+        br.Likeliness = Likely
+    }
+
+    /* attach to the block */
+    self.Ins = append(self.Ins, ins)
+    self.Term = &IrSwitch { V: Tr(0), Ln: to, Br: map[int32]*IrBranch { 0: br } }
+}
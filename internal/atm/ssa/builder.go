@@ -139,10 +139,12 @@ func (self *_GraphBuilder) block(cfg *CFG, p *hir.Ir, bb *BasicBlock) {
 
     /* add terminators */
     switch p.Op {
-        case hir.OP_bsw : self.termbsw(cfg, p, bb)
-        case hir.OP_ret : bb.termReturn(p)
-        case hir.OP_jmp : bb.termBranch(self.branch(cfg, p.Br))
-        default         : bb.termCondition(p, self.branch(cfg, p.Br), self.branch(cfg, p.Ln))
+        case hir.OP_bsw    : self.termbsw(cfg, p, bb)
+        case hir.OP_ret    : bb.termReturn(p)
+        case hir.OP_jmp    : bb.termBranch(self.branch(cfg, p.Br))
+        case hir.OP_addo  : bb.termOverflow(p, self.branch(cfg, p.Br), self.branch(cfg, p.Ln))
+        case hir.OP_addio : bb.termOverflow(p, self.branch(cfg, p.Br), self.branch(cfg, p.Ln))
+        default            : bb.termCondition(p, self.branch(cfg, p.Br), self.branch(cfg, p.Ln))
     }
 }
 
@@ -33,7 +33,13 @@ func makemap(t *rt.GoMapType, hint int, h *rt.GoMap) *rt.GoMap
 //goland:noinspection GoUnusedParameter
 func mallocgc(size uintptr, typ *rt.GoType, needzero bool) unsafe.Pointer
 
+//go:noescape
+//go:linkname mapclear runtime.mapclear
+//goland:noinspection GoUnusedParameter
+func mapclear(t *rt.GoMapType, h *rt.GoMap)
+
 var (
     F_makemap  = hir.RegisterGCall(makemap, emu_gcall_makemap)
+    F_mapclear = hir.RegisterGCall(mapclear, emu_gcall_mapclear)
     F_mallocgc = hir.RegisterGCall(mallocgc, emu_gcall_mallocgc)
 )
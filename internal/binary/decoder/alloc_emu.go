@@ -31,6 +31,14 @@ func emu_gcall_makemap(ctx hir.CallContext) {
     }
 }
 
+func emu_gcall_mapclear(ctx hir.CallContext) {
+    if !ctx.Verify("**", "") {
+        panic("invalid mapclear call")
+    } else {
+        mapclear((*rt.GoMapType)(ctx.Ap(0)), (*rt.GoMap)(ctx.Ap(1)))
+    }
+}
+
 func emu_gcall_mallocgc(ctx hir.CallContext) {
     if !ctx.Verify("i*i", "*") {
         panic("invalid mallocgc call")
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package decoder
+
+import (
+    `fmt`
+    `math`
+    `sync/atomic`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/opts`
+)
+
+// BudgetError is returned when decoding a single message would allocate more
+// memory than allowed by the allocation budget.
+type BudgetError struct {
+    Size   int
+    Remain int
+}
+
+func (self BudgetError) Error() string {
+    return fmt.Sprintf("frugal: allocation budget exceeded: %d bytes requested, %d bytes remaining", self.Size, self.Remain)
+}
+
+//go:nosplit
+func error_budget(n int, r int) error {
+    return BudgetError { Size: n, Remain: r }
+}
+
+var (
+    F_error_budget = hir.RegisterGCall(error_budget, nil)
+)
+
+func allocBudget() uint64 {
+    if nb := atomic.LoadInt64(&opts.MaxAllocBytes); nb == 0 {
+        return math.MaxUint64
+    } else {
+        return uint64(nb)
+    }
+}
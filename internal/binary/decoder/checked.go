@@ -0,0 +1,143 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package decoder
+
+import (
+    `fmt`
+    `runtime`
+    `sync/atomic`
+    `time`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/opts`
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
+)
+
+var (
+    // ErrTruncated is returned by the checked decoder when the input ends
+    // before the message does.
+    ErrTruncated = fmt.Errorf("frugal: truncated input")
+
+    // ErrCorrupted is returned by the checked decoder when a length prefix or
+    // an element count can never be satisfied by the rest of the input.
+    ErrCorrupted = fmt.Errorf("frugal: corrupted input")
+)
+
+//go:nosplit
+func error_truncated(n int) error {
+    return fmt.Errorf("%w: %d bytes short", ErrTruncated, n)
+}
+
+//go:nosplit
+func error_corrupted(n int, r int) error {
+    return fmt.Errorf("%w: %d elements declared, but only %d bytes left", ErrCorrupted, n, r)
+}
+
+var (
+    F_error_truncated = hir.RegisterGCall(error_truncated, nil)
+    F_error_corrupted = hir.RegisterGCall(error_corrupted, nil)
+)
+
+var (
+    checkedCache = utils.CreateProgramCache()
+)
+
+var _CheckedOps = [256]OpCode {
+    OP_size        : OP_size_chk,
+    OP_str         : OP_str_chk,
+    OP_str_nocopy  : OP_str_nocopy_chk,
+    OP_bin         : OP_bin_chk,
+    OP_bin_reuse   : OP_bin_reuse_chk,
+    OP_bin_nocopy  : OP_bin_nocopy_chk,
+    OP_bin_spill   : OP_bin_spill_chk,
+    OP_ctr_load    : OP_ctr_load_chk,
+    OP_map_set_str : OP_map_set_str_chk,
+    OP_defer       : OP_defer_chk,
+}
+
+// Harden replaces every instruction that reads from the input buffer with its
+// bounds-checked variant. Length prefixes and element counts are validated
+// against the remaining input instead of the total buffer size, and deferred
+// types are decoded with the checked programs as well.
+func Harden(p Program) Program {
+    fl := opts.Flag(0)
+
+    /* replace the instructions */
+    for i, v := range p {
+        if op := _CheckedOps[v.Op]; op != 0 {
+            p[i].Op, fl = op, opts.F_Checked
+        }
+    }
+
+    /* count the program as checked */
+    opts.RecordFlags(opts.F_Checked, fl)
+    return p
+}
+
+func decode_chk(vt *rt.GoType, buf unsafe.Pointer, nb int, i int, p unsafe.Pointer, rs *RuntimeState, st int) (int, error) {
+    if pp, err := resolveChecked(vt); err != nil {
+        return 0, err
+    } else {
+        ret, err := pp.fn(buf, nb, i, p, rs, st)
+        runtime.KeepAlive(pp)
+        return ret, err
+    }
+}
+
+func resolveChecked(vt *rt.GoType) (*_Codec, error) {
+    if val := checkedCache.Get(vt); val != nil {
+        atomic.AddUint64(&HitCount, 1)
+        return val.(*_Codec), nil
+    }
+
+    /* the checked programs are compiled separately from the fast ones */
+    atomic.AddUint64(&MissCount, 1)
+    val, err := checkedCache.Compute(vt, compileChecked)
+
+    /* check for errors */
+    if err != nil {
+        return nil, err
+    }
+
+    /* the type is compiled, by this goroutine or another one */
+    return val.(*_Codec), nil
+}
+
+func compileChecked(vt *rt.GoType) (interface{}, error) {
+    ts := time.Now()
+    pp, err := CreateCompiler().CompileAndFree(vt.Pack())
+
+    /* check for compilation errors */
+    if err != nil {
+        return nil, err
+    }
+
+    /* harden, translate and link the program */
+    ret, nb := linkProgram(vt, Harden(pp))
+    emitCompileEvent(vt, nb, ts)
+    return ret, nil
+}
+
+// DecodeObjectChecked is like DecodeObject, but every read from buf is checked
+// against the remaining input, so malformed input is reported as ErrTruncated
+// or ErrCorrupted instead of being read past the end of buf.
+func DecodeObjectChecked(buf []byte, val interface{}) (int, error) {
+    return decodeObject(buf, val, decode_chk)
+}
@@ -28,6 +28,7 @@ import (
     `github.com/cloudwego/frugal/internal/opts`
     `github.com/cloudwego/frugal/internal/rt`
     `github.com/cloudwego/frugal/internal/utils`
+    `github.com/cloudwego/frugal/iov`
 )
 
 type Instr struct {
@@ -39,6 +40,7 @@ type Instr struct {
     Sw *int
     Vt *rt.GoType
     Fn unsafe.Pointer
+    Ab bool
 }
 
 func (self Instr) stab() string {
@@ -82,22 +84,31 @@ func (self Instr) IntSeq() (p []int) {
 func (self Instr) Disassemble() string {
     switch self.Op {
         case OP_int               : fallthrough
+        case OP_fixed             : fallthrough
         case OP_size              : fallthrough
+        case OP_size_chk          : fallthrough
         case OP_seek              : fallthrough
+        case OP_yield             : fallthrough
         case OP_struct_mark_tag   : return fmt.Sprintf("%-18s%d", self.Op, self.Iv)
         case OP_type              : return fmt.Sprintf("%-18s%d", self.Op, self.Tx)
         case OP_deref             : fallthrough
         case OP_map_alloc         : fallthrough
+        case OP_map_reuse         : fallthrough
+        case OP_map_init          : fallthrough
         case OP_map_set_i8        : fallthrough
         case OP_map_set_i16       : fallthrough
         case OP_map_set_i32       : fallthrough
         case OP_map_set_i64       : fallthrough
         case OP_map_set_str       : fallthrough
+        case OP_map_set_str_chk   : fallthrough
         case OP_map_set_enum      : fallthrough
         case OP_map_set_pointer   : fallthrough
         case OP_list_alloc        : fallthrough
+        case OP_struct_unknown    : fallthrough
         case OP_construct         : fallthrough
+        case OP_defer_chk         : fallthrough
         case OP_defer             : return fmt.Sprintf("%-18s%s", self.Op, self.Vt)
+        case OP_length_check      : return fmt.Sprintf("%-18s%s, %d", self.Op, self.Vt, self.Id)
         case OP_ctr_is_zero       : fallthrough
         case OP_struct_is_stop    : fallthrough
         case OP_goto              : return fmt.Sprintf("%-18sL_%d", self.Op, self.To)
@@ -105,7 +116,15 @@ func (self Instr) Disassemble() string {
         case OP_struct_require    : return fmt.Sprintf("%-18s%s", self.Op, self.rtab())
         case OP_struct_switch     : return fmt.Sprintf("%-18s%s", self.Op, self.stab())
         case OP_struct_check_type : return fmt.Sprintf("%-18s%d, L_%d", self.Op, self.Tx, self.To)
+        case OP_struct_union      : return fmt.Sprintf("%-18s%s, %d", self.Op, self.Vt, self.Id)
+        case OP_struct_group      : return fmt.Sprintf("%-18s%s, %d, %s", self.Op, self.Vt, self.Id, self.rtab())
+        case OP_enum_check        : return fmt.Sprintf("%-18s*%p [%s]", self.Op, self.Fn, (*_EnumCheck)(self.Fn).et)
         case OP_initialize        : return fmt.Sprintf("%-18s*%p [%s]", self.Op, self.Fn, rt.FuncName(self.Fn))
+        case OP_bin_spill         : fallthrough
+        case OP_bin_spill_chk     : return fmt.Sprintf("%-18s%d, *%p", self.Op, self.Iv, self.Fn)
+        case OP_default_int       : return fmt.Sprintf("%-18s%d, *%p", self.Op, self.Iv, self.Fn)
+        case OP_default_str       : return fmt.Sprintf("%-18s%q", self.Op, *(*string)(self.Fn))
+        case OP_default_bin       : return fmt.Sprintf("%-18s%q", self.Op, *(*[]byte)(self.Fn))
         default                   : return self.Op.String()
     }
 }
@@ -141,16 +160,21 @@ func (self Program) use(n int) {
     }
 }
 
-func (self *Program) ins(iv Instr)                             { *self = append(*self, iv) }
-func (self *Program) add(op OpCode)                            { self.ins(mkins(op, 0, 0, 0, 0, nil, nil, nil)) }
-func (self *Program) jmp(op OpCode, to int)                    { self.ins(mkins(op, 0, 0, to, 0, nil, nil, nil)) }
-func (self *Program) i64(op OpCode, iv int64)                  { self.ins(mkins(op, 0, 0, 0, iv, nil, nil, nil)) }
-func (self *Program) tab(op OpCode, tv []int)                  { self.ins(mkins(op, 0, 0, 0, 0, tv, nil, nil)) }
-func (self *Program) tag(op OpCode, vt defs.Tag)               { self.ins(mkins(op, vt, 0, 0, 0, nil, nil, nil)) }
-func (self *Program) rtt(op OpCode, vt reflect.Type)           { self.ins(mkins(op, 0, 0, 0, 0, nil, vt, nil)) }
-func (self *Program) jsr(op OpCode, fn unsafe.Pointer)         { self.ins(mkins(op, 0, 0, 0, 0, nil, nil, fn)) }
-func (self *Program) jcc(op OpCode, vt defs.Tag, to int)       { self.ins(mkins(op, vt, 0, to, 0, nil, nil, nil)) }
-func (self *Program) req(op OpCode, vt reflect.Type, fv []int) { self.ins(mkins(op, 0, 0, 0, 0, fv, vt, nil)) }
+func (self *Program) ins(iv Instr)                              { *self = append(*self, iv) }
+func (self *Program) add(op OpCode)                             { self.ins(mkins(op, 0, 0, 0, 0, nil, nil, nil)) }
+func (self *Program) jmp(op OpCode, to int)                     { self.ins(mkins(op, 0, 0, to, 0, nil, nil, nil)) }
+func (self *Program) i64(op OpCode, iv int64)                   { self.ins(mkins(op, 0, 0, 0, iv, nil, nil, nil)) }
+func (self *Program) tab(op OpCode, tv []int)                   { self.ins(mkins(op, 0, 0, 0, 0, tv, nil, nil)) }
+func (self *Program) tag(op OpCode, vt defs.Tag)                { self.ins(mkins(op, vt, 0, 0, 0, nil, nil, nil)) }
+func (self *Program) rtt(op OpCode, vt reflect.Type)            { self.ins(mkins(op, 0, 0, 0, 0, nil, vt, nil)) }
+func (self *Program) jsr(op OpCode, fn unsafe.Pointer)          { self.ins(mkins(op, 0, 0, 0, 0, nil, nil, fn)) }
+func (self *Program) dfv(op OpCode, n int64, vp unsafe.Pointer) { self.ins(mkins(op, 0, 0, 0, n, nil, nil, vp)) }
+func (self *Program) jcc(op OpCode, vt defs.Tag, to int)        { self.ins(mkins(op, vt, 0, to, 0, nil, nil, nil)) }
+func (self *Program) fid(op OpCode, vt reflect.Type, id uint16) { self.ins(mkins(op, 0, id, 0, 0, nil, vt, nil)) }
+func (self *Program) req(op OpCode, vt reflect.Type, fv []int)  { self.ins(mkins(op, 0, 0, 0, 0, fv, vt, nil)) }
+func (self *Program) grp(op OpCode, vt reflect.Type, id int, fv []int) { self.ins(mkins(op, 0, uint16(id), 0, 0, fv, vt, nil)) }
+func (self *Program) pop(fv _EnumField)                         { self.ins(Instr { Op: OP_drop_state, Id: fv.id, Vt: fv.vt }) }
+func (self *Program) lck(fv _EnumField)                         { self.ins(Instr { Op: OP_length_check, Id: fv.id, Vt: fv.vt }) }
 
 func (self Program) Free() {
     freeProgram(self)
@@ -203,6 +227,12 @@ func (self Program) Disassemble() string {
 
 type Compiler struct {
     o opts.Options
+    f _EnumField
+    x map[uint16]bool
+    z bool
+    n int
+    s *iov.SpillSink
+    u opts.Flag
     t map[reflect.Type]bool
     d map[reflect.Type]struct{}
 }
@@ -252,9 +282,10 @@ func (self *Compiler) compileRec(p *Program, sp int, vt *defs.Type) {
         case defs.T_i32    : p.i64(OP_size, 4); p.i64(OP_int, 4)
         case defs.T_i64    : p.i64(OP_size, 8); p.i64(OP_int, 8)
         case defs.T_double : p.i64(OP_size, 8); p.i64(OP_int, 8)
-        case defs.T_string : p.i64(OP_size, 4); p.add(OP_str)
-        case defs.T_binary : p.i64(OP_size, 4); p.add(OP_bin)
-        case defs.T_enum   : p.i64(OP_size, 4); p.add(OP_enum)
+        case defs.T_string : p.i64(OP_size, 4); self.compileLength(p); p.add(OP_str)
+        case defs.T_binary : p.i64(OP_size, 4); self.compileLength(p); self.compileBin(p, vt)
+        case defs.T_enum   : p.i64(OP_size, 4); self.compileEnum(p, vt); p.add(OP_enum)
+        case defs.T_fixed  : p.i64(OP_size, 8); p.i64(OP_fixed, vt.N)
         case defs.T_struct : self.compileStruct  (p, sp, vt)
         case defs.T_map    : self.compileMap     (p, sp, vt)
         case defs.T_set    : self.compileSetList (p, sp, vt.V)
@@ -263,12 +294,41 @@ func (self *Compiler) compileRec(p *Program, sp int, vt *defs.Type) {
     }
 }
 
+func (self *Compiler) compileEnum(p *Program, vt *defs.Type) {
+    var err error
+    var ck defs.EnumChecker
+
+    /* enum validation is not enabled */
+    if !self.o.ValidateEnums {
+        return
+    }
+
+    /* find the enum checker */
+    if ck, err = defs.GetEnumChecker(vt.S); err != nil {
+        panic(err)
+    }
+
+    /* check the value before storing it if the type has defined its values */
+    if ck != nil {
+        self.u |= opts.F_ValidateEnums
+        p.jsr(OP_enum_check, unsafe.Pointer(addEnumCheck(rt.UnpackType(vt.S), self.f, ck)))
+    }
+}
+
+func (self *Compiler) compileLength(p *Program) {
+    if !self.o.LenientLengths {
+        p.lck(self.f)
+    } else {
+        self.u |= opts.F_LenientLengths
+    }
+}
+
 func (self *Compiler) compilePtr(p *Program, sp int, vt *defs.Type) {
     p.use(sp)
     p.add(OP_make_state)
     p.rtt(OP_deref, vt.V.S)
     self.compileOne(p, sp + 1, vt.V)
-    p.add(OP_drop_state)
+    p.pop(self.f)
 }
 
 func (self *Compiler) compileMap(p *Program, sp int, vt *defs.Type) {
@@ -277,17 +337,40 @@ func (self *Compiler) compileMap(p *Program, sp int, vt *defs.Type) {
     p.tag(OP_type, vt.K.Tag())
     p.tag(OP_type, vt.V.Tag())
     p.add(OP_make_state)
+    self.compileLength(p)
     p.add(OP_ctr_load)
-    p.rtt(OP_map_alloc, vt.S)
+    self.compileMapAlloc(p, vt)
     i := p.pc()
     p.add(OP_ctr_is_zero)
     self.compileKey(p, sp + 1, vt)
     self.compileOne(p, sp + 1, vt.V)
     p.add(OP_ctr_decr)
+    self.compileYield(p)
     p.jmp(OP_goto, i)
     p.pin(i)
     p.add(OP_map_close)
-    p.add(OP_drop_state)
+    p.pop(self.f)
+}
+
+func (self *Compiler) compileMapAlloc(p *Program, vt *defs.Type) {
+    if self.o.ReuseMemory {
+        self.u |= opts.F_ReuseMemory
+        p.rtt(OP_map_reuse, vt.S)
+    } else {
+        p.rtt(OP_map_alloc, vt.S)
+    }
+}
+
+func (self *Compiler) compileBin(p *Program, vt *defs.Type) {
+    if self.s != nil && vt.S == defs.BlobType {
+        self.u |= opts.F_Spill
+        p.dfv(OP_bin_spill, int64(self.n), unsafe.Pointer(self.s))
+    } else if self.o.ReuseMemory {
+        self.u |= opts.F_ReuseMemory
+        p.add(OP_bin_reuse)
+    } else {
+        p.add(OP_bin)
+    }
 }
 
 func (self *Compiler) compileKey(p *Program, sp int, vt *defs.Type) {
@@ -298,9 +381,9 @@ func (self *Compiler) compileKey(p *Program, sp int, vt *defs.Type) {
         case defs.T_i16     : p.i64(OP_size, 2); p.rtt(OP_map_set_i16, vt.S)
         case defs.T_i32     : p.i64(OP_size, 4); p.rtt(OP_map_set_i32, vt.S)
         case defs.T_i64     : p.i64(OP_size, 8); p.rtt(OP_map_set_i64, vt.S)
-        case defs.T_binary  : p.i64(OP_size, 4); p.rtt(OP_map_set_str, vt.S)
-        case defs.T_string  : p.i64(OP_size, 4); p.rtt(OP_map_set_str, vt.S)
-        case defs.T_enum    : p.i64(OP_size, 4); p.rtt(OP_map_set_enum, vt.S)
+        case defs.T_binary  : p.i64(OP_size, 4); self.compileLength(p); p.rtt(OP_map_set_str, vt.S)
+        case defs.T_string  : p.i64(OP_size, 4); self.compileLength(p); p.rtt(OP_map_set_str, vt.S)
+        case defs.T_enum    : p.i64(OP_size, 4); self.compileEnum(p, vt.K); p.rtt(OP_map_set_enum, vt.S)
         case defs.T_pointer : self.compileKeyPtr(p, sp, vt)
         default             : panic("unreachable")
     }
@@ -315,12 +398,14 @@ func (self *Compiler) compileNoCopy(p *Program, sp int, vt *defs.Type) {
         /* simple strings */
         case vt.T == defs.T_string: {
             p.i64(OP_size, 4)
+            self.compileLength(p)
             p.add(OP_str_nocopy)
         }
 
         /* simple binaries */
         case vt.T == defs.T_binary: {
             p.i64(OP_size, 4)
+            self.compileLength(p)
             p.add(OP_bin_nocopy)
         }
 
@@ -330,8 +415,9 @@ func (self *Compiler) compileNoCopy(p *Program, sp int, vt *defs.Type) {
             p.add(OP_make_state)
             p.rtt(OP_deref, vt.V.S)
             p.i64(OP_size, 4)
+            self.compileLength(p)
             p.add(OP_str_nocopy)
-            p.add(OP_drop_state)
+            p.pop(self.f)
         }
 
         /* binary pointers */
@@ -340,8 +426,9 @@ func (self *Compiler) compileNoCopy(p *Program, sp int, vt *defs.Type) {
             p.add(OP_make_state)
             p.rtt(OP_deref, vt.V.S)
             p.i64(OP_size, 4)
+            self.compileLength(p)
             p.add(OP_bin_nocopy)
-            p.add(OP_drop_state)
+            p.pop(self.f)
         }
     }
 }
@@ -366,13 +453,30 @@ func (self *Compiler) compileStruct(p *Program, sp int, vt *defs.Type) {
     var err error
     var req []int
     var fvs []defs.Field
+    var grp []_FieldGroup
     var ifn unsafe.Pointer
+    var uni = defs.IsUnion(vt.S)
 
     /* resolve the fields */
     if fvs, err = defs.ResolveFields(vt.S); err != nil {
         panic(err)
     }
 
+    /* groups are indexed across all the fields */
+    grp = fieldGroups(fvs)
+    gsz := len(fvs)
+
+    /* only the projected fields of the outermost struct are decoded */
+    if self.x != nil {
+        self.u |= opts.F_Mask
+        fvs, self.x = self.project(vt, fvs), nil
+    }
+
+    /* groups that are not entirely projected can not be checked */
+    if len(fvs) != gsz {
+        grp = projectGroups(grp, fvs)
+    }
+
     /* empty struct */
     if len(fvs) == 0 {
         p.add(OP_struct_ignore)
@@ -389,6 +493,13 @@ func (self *Compiler) compileStruct(p *Program, sp int, vt *defs.Type) {
         p.jsr(OP_initialize, ifn)
     }
 
+    /* apply the default values declared with the "default" option */
+    for _, fv := range fvs {
+        if fv.Opts & defs.HasDefault != 0 {
+            self.compileDefault(p, fv)
+        }
+    }
+
     /* find the maximum field IDs */
     for _, fv := range fvs {
         if fid = utils.MaxInt(fid, int(fv.ID)); fv.Spec == defs.Required {
@@ -396,13 +507,23 @@ func (self *Compiler) compileStruct(p *Program, sp int, vt *defs.Type) {
         }
     }
 
+    /* fields in groups are tracked in the same bitmap */
+    bits := append([]int(nil), req...)
+    grps := groupMembers(grp)
+
+    /* add the group members */
+    for id := range grps {
+        bits = append(bits, id)
+    }
+
     /* save the current state */
     p.use(sp)
     p.add(OP_make_state)
 
     /* allocate bitmap for required fields, if needed */
-    if sort.Ints(req); len(req) != 0 {
-        p.tab(OP_struct_bitmap, req)
+    if sort.Ints(req); len(bits) != 0 {
+        sort.Ints(bits)
+        p.tab(OP_struct_bitmap, bits)
     }
 
     /* switch jump buffer */
@@ -421,8 +542,20 @@ func (self *Compiler) compileStruct(p *Program, sp int, vt *defs.Type) {
     p.add(OP_struct_is_stop)
     p.i64(OP_size, 2)
     p.tab(OP_struct_switch, s)
+
+    /* unknown fields fall through the switch, fields with mismatched types are still skipped */
+    if self.o.RejectUnknown {
+        self.u |= opts.F_RejectUnknown
+        p.rtt(OP_struct_unknown, vt.S)
+    }
+
+    /* skip the field, the skipped bytes are only counted when someone is listening */
     k := p.pc()
-    p.add(OP_struct_skip)
+    if !self.o.SkipStats {
+        p.add(OP_struct_skip)
+    } else {
+        p.i64(OP_struct_skip, 1)
+    }
     p.jmp(OP_goto, i)
 
     /* assemble every field */
@@ -430,17 +563,32 @@ func (self *Compiler) compileStruct(p *Program, sp int, vt *defs.Type) {
         s[fv.ID] = p.pc()
         p.jcc(OP_struct_check_type, fv.Type.Tag(), k)
 
+        /* only one field of a union can be set at a time */
+        if uni {
+            p.fid(OP_struct_union, vt.S, fv.ID)
+        }
+
         /* mark the field as seen, if needed */
-        if fv.Spec == defs.Required {
+        if fv.Spec == defs.Required || grps[int(fv.ID)] {
             p.i64(OP_struct_mark_tag, int64(fv.ID))
         }
 
-        /* seek to the field */
+        /* seek to the field, and remember it for error reporting */
         off := int64(fv.F)
         p.i64(OP_seek, off)
+        fp := self.f
+        self.f = _EnumField { rt.UnpackType(vt.S), fv.ID }
+
+        /* check for no-copy strings, either tagged or from the zero-copy mode */
+        nc := fv.Opts & defs.NoCopy != 0 || self.z && fv.Type.Tag() == defs.T_string
+
+        /* remember if it is only because of the zero-copy mode */
+        if nc && fv.Opts & defs.NoCopy == 0 {
+            self.u |= opts.F_ZeroCopy
+        }
 
-        /* check for no-copy strings */
-        if fv.Opts & defs.NoCopy == 0 {
+        /* compile the field */
+        if !nc {
             self.compileOne(p, sp + 1, fv.Type)
         } else if fv.Type.Tag() == defs.T_string {
             self.compileNoCopy(p, sp + 1, fv.Type)
@@ -449,19 +597,80 @@ func (self *Compiler) compileStruct(p *Program, sp int, vt *defs.Type) {
         }
 
         /* seek back to the beginning */
+        self.f = fp
         p.i64(OP_seek, -off)
         p.jmp(OP_goto, i)
     }
 
-    /* no required fields */
-    if p.pin(j); len(req) == 0 {
-        p.add(OP_drop_state)
+    /* containers that are not present are left as nil by default */
+    if p.pin(j); self.o.NonNilEmpty {
+        self.u |= opts.F_NonNilEmpty
+        self.compileNonNil(p, fvs)
+    }
+
+    /* no required fields or groups */
+    if len(bits) == 0 {
+        p.pop(self.f)
         return
     }
 
-    /* check all the required fields */
+    /* check all the field groups */
+    for _, gv := range grp {
+        p.grp(OP_struct_group, vt.S, gv.gid, gv.ids)
+    }
+
+    /* check all the required fields, this also frees the bitmap */
     p.req(OP_struct_require, vt.S, req)
-    p.add(OP_drop_state)
+    p.pop(self.f)
+}
+
+func (self *Compiler) compileDefault(p *Program, fv defs.Field) {
+    vp := unsafe.Pointer(fv.Default.UnsafeAddr())
+    p.i64(OP_seek, int64(fv.F))
+
+    /* strings and binaries carry pointers, scalars are copied as-is */
+    switch fv.Type.T {
+        case defs.T_string : p.dfv(OP_default_str, 0, vp)
+        case defs.T_binary : p.dfv(OP_default_bin, 0, vp)
+        default            : p.dfv(OP_default_int, int64(fv.Type.S.Size()), vp)
+    }
+
+    /* seek back to the beginning */
+    p.i64(OP_seek, -int64(fv.F))
+}
+
+func (self *Compiler) project(vt *defs.Type, fvs []defs.Field) []defs.Field {
+    ret := make([]defs.Field, 0, len(self.x))
+    idx := make(map[uint16]bool, len(self.x))
+
+    /* keep only the selected fields */
+    for _, fv := range fvs {
+        if idx[fv.ID] = true; self.x[fv.ID] {
+            ret = append(ret, fv)
+        }
+    }
+
+    /* every selected field must exist */
+    for id := range self.x {
+        if !idx[id] {
+            panic(fmt.Errorf("frugal: field %d is not defined in %s", id, vt.S))
+        }
+    }
+
+    /* all done */
+    return ret
+}
+
+func (self *Compiler) compileNonNil(p *Program, fvs []defs.Field) {
+    for _, fv := range fvs {
+        if fv.Spec != defs.Optional {
+            switch fv.Type.T {
+                case defs.T_map  : p.i64(OP_seek, int64(fv.F)); p.rtt(OP_map_init, fv.Type.S); p.i64(OP_seek, -int64(fv.F))
+                case defs.T_set  : p.i64(OP_seek, int64(fv.F)); p.add(OP_list_init); p.i64(OP_seek, -int64(fv.F))
+                case defs.T_list : p.i64(OP_seek, int64(fv.F)); p.add(OP_list_init); p.i64(OP_seek, -int64(fv.F))
+            }
+        }
+    }
 }
 
 func (self *Compiler) compileSetList(p *Program, sp int, et *defs.Type) {
@@ -469,6 +678,7 @@ func (self *Compiler) compileSetList(p *Program, sp int, et *defs.Type) {
     p.i64(OP_size, 5)
     p.tag(OP_type, et.Tag())
     p.add(OP_make_state)
+    self.compileLength(p)
     p.add(OP_ctr_load)
     p.rtt(OP_list_alloc, et.S)
     i := p.pc()
@@ -476,13 +686,43 @@ func (self *Compiler) compileSetList(p *Program, sp int, et *defs.Type) {
     j := p.pc()
     self.compileOne(p, sp + 1, et)
     p.add(OP_ctr_decr)
+    self.compileYield(p)
     k := p.pc()
     p.add(OP_ctr_is_zero)
     p.i64(OP_seek, int64(et.S.Size()))
     p.jmp(OP_goto, j)
     p.pin(i)
     p.pin(k)
-    p.add(OP_drop_state)
+    p.pop(self.f)
+}
+
+func (self *Compiler) compileYield(p *Program) {
+    if self.o.YieldInterval != 0 {
+        self.u |= opts.F_YieldInterval
+        p.i64(OP_yield, int64(self.o.YieldInterval))
+    }
+}
+
+func (self *Compiler) flags() opts.Flag {
+    ret := self.o.Flags() & opts.DecoderFlags
+
+    /* the modes that are not part of the options */
+    if self.z {
+        ret |= opts.F_ZeroCopy
+    }
+
+    /* only the outermost struct is projected */
+    if self.x != nil {
+        ret |= opts.F_Mask
+    }
+
+    /* large binaries are spilled */
+    if self.s != nil {
+        ret |= opts.F_Spill
+    }
+
+    /* all done */
+    return ret
 }
 
 func (self *Compiler) Free() {
@@ -494,6 +734,35 @@ func (self *Compiler) Apply(o opts.Options) *Compiler {
     return self
 }
 
+// Project restricts the outermost struct to the fields in ids, all the other
+// fields are skipped as if they were unknown.
+func (self *Compiler) Project(ids []uint16) *Compiler {
+    self.x = make(map[uint16]bool, len(ids))
+
+    /* build the field set */
+    for _, id := range ids {
+        self.x[id] = true
+    }
+
+    /* all done */
+    return self
+}
+
+// ZeroCopy decodes every string and binary field as if it was tagged with
+// "nocopy", which makes them refer to the input buffer.
+func (self *Compiler) ZeroCopy() *Compiler {
+    self.z = true
+    return self
+}
+
+// Spill moves the values of iov.Blob fields that are longer than nb bytes to
+// the sink, which must be kept alive as long as the program.
+func (self *Compiler) Spill(nb int, sink *iov.SpillSink) *Compiler {
+    self.n = nb
+    self.s = sink
+    return self
+}
+
 func (self *Compiler) Compile(vt reflect.Type) (_ Program, err error) {
     ret := newProgram()
     vtp := (*defs.Type)(nil)
@@ -507,10 +776,24 @@ func (self *Compiler) Compile(vt reflect.Type) (_ Program, err error) {
     defer self.rescue(&err)
     defer vtp.Free()
 
-    /* compile the actual type */
+    /* the flags must be taken before compiling, the projection is consumed by the outermost struct */
+    fl := self.flags()
     self.compileOne(&ret, 0, vtp)
-    ret.add(OP_halt)
-    return Optimize(ret), nil
+    ret.rtt(OP_halt, vt)
+
+    /* count the flags of this program */
+    opts.RecordFlags(fl, self.u)
+    ret = Optimize(ret)
+
+    /* only the programs compiled with a budget charge their allocations */
+    if self.o.AllocBudget {
+        for i := range ret {
+            ret[i].Ab = true
+        }
+    }
+
+    /* all done */
+    return ret, nil
 }
 
 func (self *Compiler) CompileAndFree(vt reflect.Type) (ret Program, err error) {
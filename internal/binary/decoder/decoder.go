@@ -18,7 +18,9 @@ package decoder
 
 import (
     `reflect`
+    `runtime`
     `sync/atomic`
+    `time`
     `unsafe`
 
     `github.com/cloudwego/frugal/internal/opts`
@@ -35,32 +37,66 @@ type Decoder func (
     st  int,
 ) (int, error)
 
+type DecodeFunc func (
+    vt  *rt.GoType,
+    buf unsafe.Pointer,
+    nb  int,
+    i   int,
+    p   unsafe.Pointer,
+    rs  *RuntimeState,
+    st  int,
+) (int, error)
+
 var (
-    HitCount  uint64 = 0
-    MissCount uint64 = 0
-    TypeCount uint64 = 0
+    HitCount    uint64 = 0
+    MissCount   uint64 = 0
+    TypeCount   uint64 = 0
+    ErrorCount  uint64 = 0
+    EmuCount    uint64 = 0
+    CompileTime uint64 = 0
 )
 
 var (
     programCache = utils.CreateProgramCache()
 )
 
+// _Codec is a linked program. The code is freed by the garbage collector once
+// the codec is unreachable, so callers must keep the codec alive with
+// runtime.KeepAlive until the program returns.
+type _Codec struct {
+    fn Decoder
+}
+
+func newCodec(fn Decoder, free func()) *_Codec {
+    ret := &_Codec { fn: fn }
+
+    /* free the code lazily, calling the program requires no synchronization this way */
+    if free != nil {
+        runtime.SetFinalizer(ret, func(*_Codec) { free() })
+    }
+
+    /* all done */
+    return ret
+}
+
 func decode(vt *rt.GoType, buf unsafe.Pointer, nb int, i int, p unsafe.Pointer, rs *RuntimeState, st int) (int, error) {
-    if dec, err := resolve(vt); err != nil {
+    if pp, err := resolve(vt); err != nil {
         return 0, err
     } else {
-        return dec(buf, nb, i, p, rs, st)
+        ret, err := pp.call(vt, buf, nb, i, p, rs, st)
+        runtime.KeepAlive(pp)
+        return ret, err
     }
 }
 
-func resolve(vt *rt.GoType) (Decoder, error) {
+func resolve(vt *rt.GoType) (*_Codec, error) {
     var err error
     var val interface{}
 
     /* fast-path: type is cached */
     if val = programCache.Get(vt); val != nil {
         atomic.AddUint64(&HitCount, 1)
-        return val.(Decoder), nil
+        return val.(*_Codec), nil
     }
 
     /* record the cache miss, and compile the type */
@@ -72,21 +108,28 @@ func resolve(vt *rt.GoType) (Decoder, error) {
         return nil, err
     }
 
-    /* record the successful compilation */
-    atomic.AddUint64(&TypeCount, 1)
-    return val.(Decoder), nil
+    /* the type is compiled, by this goroutine or another one */
+    return val.(*_Codec), nil
 }
 
 func compile(vt *rt.GoType) (interface{}, error) {
-    if pp, err := CreateCompiler().CompileAndFree(vt.Pack()); err != nil {
+    ts := time.Now()
+    pp, err := CreateCompiler().CompileAndFree(vt.Pack())
+
+    /* check for compilation errors */
+    if err != nil {
         return nil, err
-    } else {
-        return Link(Translate(pp)), nil
     }
+
+    /* translate and link the program */
+    ret, nb := linkProgram(vt, pp)
+    emitCompileEvent(vt, nb, ts)
+    return ret, nil
 }
 
 func mkcompile(ty map[reflect.Type]struct{}, opts opts.Options) func(*rt.GoType) (interface{}, error) {
     return func(vt *rt.GoType) (interface{}, error) {
+        ts := time.Now()
         cc := CreateCompiler()
         pp, err := cc.Apply(opts).Compile(vt.Pack())
 
@@ -95,15 +138,30 @@ func mkcompile(ty map[reflect.Type]struct{}, opts opts.Options) func(*rt.GoType)
             ty[t] = struct{}{}
         }
 
-        /* translate and link the program */
+        /* check for compilation errors */
         if err != nil {
             return nil, err
-        } else {
-            return Link(Translate(pp)), nil
         }
+
+        /* translate and link the program */
+        ret, nb := linkProgram(vt, pp)
+        emitCompileEvent(vt, nb, ts)
+        return ret, nil
     }
 }
 
+func emitCompileEvent(vt *rt.GoType, nb int, ts time.Time) {
+    dt := time.Since(ts)
+    atomic.AddUint64(&TypeCount, 1)
+    atomic.AddUint64(&CompileTime, uint64(dt))
+    utils.EmitCompileEvent("decoder", vt, nb, dt)
+}
+
+func emitErrorEvent(err error) {
+    atomic.AddUint64(&ErrorCount, 1)
+    utils.EmitErrorEvent("decoder", err)
+}
+
 type DecodeError struct {
     vt *rt.GoType
 }
@@ -136,18 +194,36 @@ func Pretouch(vt *rt.GoType, opts opts.Options) (map[reflect.Type]struct{}, erro
         return nil, err
     }
 
-    /* add the type count */
-    atomic.AddUint64(&TypeCount, 1)
+    /* all done */
     return ret, nil
 }
 
-func DecodeObject(buf []byte, val interface{}) (ret int, err error) {
+func Pin(vt *rt.GoType) {
+    programCache.Pin(vt)
+}
+
+func Release(vt *rt.GoType) {
+    programCache.Remove(vt)
+    checkedCache.Remove(vt)
+}
+
+func DecodeObject(buf []byte, val interface{}) (int, error) {
+    return decodeObject(buf, val, decode)
+}
+
+func decodeObject(buf []byte, val interface{}, fn DecodeFunc) (int, error) {
+    return decodeObjectBudget(buf, val, fn, allocBudget())
+}
+
+func decodeObjectBudget(buf []byte, val interface{}, fn DecodeFunc, ab uint64) (ret int, err error) {
     vv := rt.UnpackEface(val)
     vt := vv.Type
 
     /* check for nil interface */
     if vt == nil || vv.Value == nil || vt.Kind() != reflect.Ptr {
-        return 0, DecodeError { vt }
+        err = DecodeError { vt }
+        emitErrorEvent(err)
+        return 0, err
     }
 
     /* create a new runtime state */
@@ -155,8 +231,21 @@ func DecodeObject(buf []byte, val interface{}) (ret int, err error) {
     st := newRuntimeState()
     sl := (*rt.GoSlice)(unsafe.Pointer(&buf))
 
+    /* the allocation budget is shared by the entire message */
+    st.Ab = ^ab
+
     /* call the encoder, and return the runtime state into pool */
-    ret, err = decode(et, sl.Ptr, sl.Len, 0, vv.Value, st, 0)
+    ret, err = fn(et, sl.Ptr, sl.Len, 0, vv.Value, st, 0)
+    sb := int(st.Sb)
     freeRuntimeState(st)
+
+    /* record the error if any */
+    if err != nil {
+        emitErrorEvent(err)
+    } else {
+        utils.EmitDecodeEvent(et, ret, sb)
+    }
+
+    /* all done */
     return
 }
@@ -17,10 +17,19 @@
 package decoder
 
 import (
+    `bytes`
+    `math`
+    `reflect`
+    `sync`
     `testing`
+    `time`
     `unsafe`
 
+    `github.com/cloudwego/frugal/internal/binary/defs`
+    `github.com/cloudwego/frugal/internal/opts`
     `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
+    `github.com/cloudwego/frugal/iov`
     `github.com/davecgh/go-spew/spew`
     `github.com/stretchr/testify/require`
 )
@@ -168,3 +177,901 @@ func TestDecoder_NoCopyString(t *testing.T) {
     println("v.F: nocopy =", &(*v.F)[0])
     spew.Dump(v)
 }
+
+type TestFixedPoint struct {
+    A float64  `frugal:"1,default,double,scale=100"`
+    B *float64 `frugal:"2,optional,double,scale=10000"`
+}
+
+func TestDecoder_FixedPoint(t *testing.T) {
+    var v TestFixedPoint
+    rs := new(RuntimeState)
+    buf := []byte {
+        0x0a, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0xd2,
+        0x0a, 0x00, 0x02, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe,
+        0x00,
+    }
+    sl := (*rt.GoSlice)(unsafe.Pointer(&buf))
+    pos, err := decode(rt.UnpackEface(v).Type, sl.Ptr, sl.Len, 0, unsafe.Pointer(&v), rs, 0)
+    require.NoError(t, err)
+    require.Equal(t, len(buf), pos)
+    require.Equal(t, TestFixedPoint{A: 12.34, B: &(&struct{ x float64 }{-0.0002}).x}, v)
+}
+
+type TestUnion struct {
+    A *int64        `frugal:"1,optional,i64"`
+    B map[int8]int8 `frugal:"2,optional,map<i8:i8>"`
+    C []int32       `frugal:"3,optional,list<i32>"`
+}
+
+func (self *TestUnion) CountSetFieldsTestUnion() int {
+    return 0
+}
+
+func TestDecoder_Union(t *testing.T) {
+    v := TestUnion{B: map[int8]int8{1: 2}, C: []int32{3}}
+    rs := new(RuntimeState)
+    buf := []byte {
+        0x0a, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07,
+        0x00,
+    }
+    sl := (*rt.GoSlice)(unsafe.Pointer(&buf))
+    pos, err := decode(rt.UnpackEface(v).Type, sl.Ptr, sl.Len, 0, unsafe.Pointer(&v), rs, 0)
+    require.NoError(t, err)
+    require.Equal(t, len(buf), pos)
+    require.Equal(t, TestUnion{A: &(&struct{ x int64 }{7}).x}, v)
+}
+
+type (
+    TestEnumColor int64
+    TestEnumFlags int64
+)
+
+func (self TestEnumColor) IsValid() bool {
+    return self >= 0 && self <= 2
+}
+
+type TestValidateEnums struct {
+    A TestEnumColor   `frugal:"1,default,TestEnumColor"`
+    B []TestEnumFlags `frugal:"2,default,list<TestEnumFlags>"`
+}
+
+func TestDecoder_ValidateEnums(t *testing.T) {
+    var v TestValidateEnums
+    o := opts.GetDefaultOptions()
+    o.ValidateEnums = true
+    defs.RegisterEnumValues(reflect.TypeOf(TestEnumFlags(0)), []int64{1, 2, 4})
+    _, err := Pretouch(rt.UnpackType(reflect.TypeOf(v)), o)
+    require.NoError(t, err)
+    buf := []byte {
+        0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02,
+        0x0f, 0x00, 0x02, 0x08, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01,
+        0x00,
+    }
+    _, err = DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, TestValidateEnums{A: 2, B: []TestEnumFlags{4, 1}}, v)
+    buf[6] = 3
+    _, err = DecodeObject(buf, &v)
+    require.Equal(t, EnumValueError {
+        Type  : reflect.TypeOf(v),
+        Enum  : reflect.TypeOf(TestEnumColor(0)),
+        Field : "A",
+        Value : 3,
+    }, err)
+    buf[6], buf[18] = 2, 3
+    _, err = DecodeObject(buf, &v)
+    require.EqualError(t, err, "frugal: invalid value 3 for enum decoder.TestEnumFlags in field decoder.TestValidateEnums.B")
+}
+
+type (
+    TestEnumLevel int64
+)
+
+type TestValidateIdlEnums struct {
+    A TestEnumLevel `frugal:"1,default,TestEnumLevel"`
+}
+
+func TestDecoder_ValidateIdlEnums(t *testing.T) {
+    var v TestValidateIdlEnums
+    o := opts.GetDefaultOptions()
+    o.ValidateEnums = true
+    idl, err := defs.ParseIDL("enum TestEnumLevel { LOW = 1, HIGH = 3, MID = 2 }")
+    require.NoError(t, err)
+    defs.RegisterIdlEnum(reflect.TypeOf(TestEnumLevel(0)), idl.Enums["TestEnumLevel"])
+    _, err = Pretouch(rt.UnpackType(reflect.TypeOf(v)), o)
+    require.NoError(t, err)
+    buf := []byte { 0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 0x00 }
+    _, err = DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, TestEnumLevel(3), v.A)
+    buf[6] = 4
+    _, err = DecodeObject(buf, &v)
+    require.EqualError(t, err, "frugal: invalid value 4 for enum decoder.TestEnumLevel in field decoder.TestValidateIdlEnums.A, expecting one of LOW = 1, MID = 2, HIGH = 3")
+}
+
+type (
+    TestEnumShape int64
+)
+
+type TestFlagStats struct {
+    A TestEnumShape `frugal:"1,default,TestEnumShape"`
+    B string        `frugal:"2,default,string"`
+    C string        `frugal:"3,default,string,nocopy"`
+}
+
+func getFlagStats(name string) opts.FlagStats {
+    for _, v := range opts.GetFlagStats() {
+        if v.Name == name {
+            return v
+        }
+    }
+    panic("no such flag: " + name)
+}
+
+func TestDecoder_FlagStats(t *testing.T) {
+    o := opts.GetDefaultOptions()
+    o.ValidateEnums = true
+    o.SortMapKeys = true
+    v0, z0, s0 := getFlagStats("ValidateEnums"), getFlagStats("ZeroCopy"), getFlagStats("SortMapKeys")
+    _, err := CreateCompiler().Apply(o).ZeroCopy().CompileAndFree(reflect.TypeOf(TestFlagStats{}))
+    require.NoError(t, err)
+    v1, z1, s1 := getFlagStats("ValidateEnums"), getFlagStats("ZeroCopy"), getFlagStats("SortMapKeys")
+    require.Equal(t, opts.FlagStats { Name: "ValidateEnums", Used: v0.Used, Enabled: v0.Enabled + 1 }, v1)
+    require.Equal(t, opts.FlagStats { Name: "ZeroCopy", Used: z0.Used + 1, Enabled: z0.Enabled + 1 }, z1)
+    require.Equal(t, s0, s1)
+}
+
+type TestReuseMemory struct {
+    A []byte           `frugal:"1,default,binary"`
+    B map[string]int32 `frugal:"2,default,map<string:i32>"`
+    C []byte           `frugal:"3,default,binary"`
+}
+
+func TestDecoder_ReuseMemory(t *testing.T) {
+    var v TestReuseMemory
+    o := opts.GetDefaultOptions()
+    o.ReuseMemory = true
+    _, err := Pretouch(rt.UnpackType(reflect.TypeOf(v)), o)
+    require.NoError(t, err)
+    buf := []byte {
+        0x0b, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 'a', 'b', 'c',
+        0x0d, 0x00, 0x02, 0x0b, 0x08, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 'x', 0x00, 0x00, 0x00, 0x07,
+        0x0b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00,
+        0x00,
+    }
+    a := make([]byte, 0, 8)
+    m := map[string]int32{"y": 1, "z": 2}
+    v.A, v.B = a, m
+    _, err = DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, TestReuseMemory{A: []byte("abc"), B: map[string]int32{"x": 7}, C: []byte{}}, v)
+    require.Equal(t, []byte("abc"), a[:3])
+    require.Equal(t, map[string]int32{"x": 7}, m)
+    require.Equal(t, 8, cap(v.A))
+    v.A = make([]byte, 0, 2)
+    _, err = DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, []byte("abc"), v.A)
+    require.Equal(t, 3, cap(v.A))
+}
+
+type TestNonNilContainers struct {
+    A []int32          `frugal:"1,default,list<i32>"`
+    B map[string]int32 `frugal:"2,required,map<string:i32>"`
+    C []string         `frugal:"3,optional,list<string>"`
+    D []string         `frugal:"4,default,set<string>"`
+}
+
+func TestDecoder_NonNilContainers(t *testing.T) {
+    var v TestNonNilContainers
+    o := opts.GetDefaultOptions()
+    o.NonNilEmpty = true
+    _, err := Pretouch(rt.UnpackType(reflect.TypeOf(v)), o)
+    require.NoError(t, err)
+    buf := []byte {
+        0x0d, 0x00, 0x02, 0x0b, 0x08, 0x00, 0x00, 0x00, 0x00,
+        0x00,
+    }
+    _, err = DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.NotNil(t, v.A)
+    require.NotNil(t, v.B)
+    require.Nil(t, v.C)
+    require.NotNil(t, v.D)
+    require.Equal(t, TestNonNilContainers{A: []int32{}, B: map[string]int32{}, D: []string{}}, v)
+}
+
+type TestYielding struct {
+    A []int64          `frugal:"1,default,list<i64>"`
+    B map[int32]string `frugal:"2,default,map<i32:string>"`
+}
+
+func TestDecoder_Yield(t *testing.T) {
+    var v TestYielding
+    var n int
+    o := opts.GetDefaultOptions()
+    o.YieldInterval = 64
+    _, err := Pretouch(rt.UnpackType(reflect.TypeOf(v)), o)
+    require.NoError(t, err)
+    old := SetYieldFunc(func() { n++ })
+    defer SetYieldFunc(old)
+    buf := []byte { 0x0f, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x01, 0x00 }
+    buf = append(buf, make([]byte, 256 * 8)...)
+    buf = append(buf, 0x0d, 0x00, 0x02, 0x08, 0x0b, 0x00, 0x00, 0x00, 0x10)
+    for i := 0; i < 16; i++ {
+        buf = append(buf, 0x00, 0x00, 0x00, byte(i), 0x00, 0x00, 0x00, 0x00)
+    }
+    buf = append(buf, 0x00)
+    _, err = DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Len(t, v.A, 256)
+    require.Len(t, v.B, 16)
+    require.Equal(t, 34, n)
+}
+
+func TestDecoder_YieldConcurrent(t *testing.T) {
+    var wg sync.WaitGroup
+    o := opts.GetDefaultOptions()
+    o.YieldInterval = 64
+    _, err := Pretouch(rt.UnpackType(reflect.TypeOf(TestYielding{})), o)
+    require.NoError(t, err)
+    buf := []byte { 0x0f, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x01, 0x00 }
+    buf = append(buf, make([]byte, 256 * 8)...)
+    buf = append(buf, 0x00)
+    for i := 0; i < 4; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 100; j++ {
+                var v TestYielding
+                _, err := DecodeObject(buf, &v)
+                require.NoError(t, err)
+            }
+        }()
+    }
+    for i := 0; i < 100; i++ {
+        SetYieldFunc(func() {})
+        SetYieldFunc(nil)
+    }
+    wg.Wait()
+}
+
+type testStatsHook struct {
+    types  []reflect.Type
+    errors []error
+    sizes  [][2]int
+}
+
+func (self *testStatsHook) OnCompile(kind string, vt reflect.Type, _ int, _ time.Duration) {
+    if kind == "decoder" {
+        self.types = append(self.types, vt)
+    }
+}
+
+func (self *testStatsHook) OnError(kind string, err error) {
+    if kind == "decoder" {
+        self.errors = append(self.errors, err)
+    }
+}
+
+func (self *testStatsHook) OnDecode(_ reflect.Type, size int, skipped int) {
+    self.sizes = append(self.sizes, [2]int { size, skipped })
+}
+
+type TestStats struct {
+    A int32 `frugal:"1,required,i32"`
+}
+
+func TestDecoder_Stats(t *testing.T) {
+    var v TestStats
+    hook := new(testStatsHook)
+    utils.SetStatsHook(hook)
+    defer utils.SetStatsHook(nil)
+    nt, ne, dt := TypeCount, ErrorCount, CompileTime
+    _, err := DecodeObject([]byte { 0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00 }, &v)
+    require.NoError(t, err)
+    require.Equal(t, nt + 1, TypeCount)
+    require.Equal(t, ne, ErrorCount)
+    require.Greater(t, CompileTime, dt)
+    require.Equal(t, []reflect.Type { reflect.TypeOf(v) }, hook.types)
+    _, err = DecodeObject([]byte { 0x00 }, &v)
+    require.Error(t, err)
+    _, err = DecodeObject(nil, v)
+    require.Equal(t, DecodeError { rt.UnpackType(reflect.TypeOf(v)) }, err)
+    require.Equal(t, ne + 2, ErrorCount)
+    require.Len(t, hook.errors, 2)
+}
+
+type TestSkipped struct {
+    A int32      `frugal:"1,default,i32"`
+    B *TestStats `frugal:"2,optional,TestStats"`
+}
+
+func TestDecoder_SkippedBytes(t *testing.T) {
+    var v TestSkipped
+    hook := new(testStatsHook)
+    utils.SetStatsHook(hook)
+    defer utils.SetStatsHook(nil)
+    buf := []byte {
+        0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+        0x0b, 0x00, 0x07, 0x00, 0x00, 0x00, 0x03, 'f', 'o', 'o',
+        0x0c, 0x00, 0x02, 0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x06, 0x00, 0x09, 0x00, 0x01, 0x00,
+        0x00,
+    }
+    _, err := DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, [][2]int { { len(buf), 15 } }, hook.sizes)
+}
+
+type TestSkippedUncounted struct {
+    A int32 `frugal:"1,default,i32"`
+}
+
+func TestDecoder_SkippedBytesUncounted(t *testing.T) {
+    var v TestSkippedUncounted
+    buf := []byte { 0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x08, 0x00, 0x02, 0x00, 0x00, 0x00, 0x02, 0x00 }
+    _, err := DecodeObject(buf, &v)
+    require.NoError(t, err)
+    hook := new(testStatsHook)
+    utils.SetStatsHook(hook)
+    defer utils.SetStatsHook(nil)
+    _, err = DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, [][2]int { { len(buf), 0 } }, hook.sizes)
+}
+
+type TestAllocBudget struct {
+    A []int64 `frugal:"1,default,list<i64>"`
+    B []byte  `frugal:"2,default,binary"`
+}
+
+func TestDecoder_AllocBudget(t *testing.T) {
+    var v TestAllocBudget
+    buf := []byte {
+        0x0f, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x00, 0x02,
+        0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+        0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+        0x0b, 0x00, 0x02, 0x00, 0x00, 0x00, 0x04, 0x01, 0x02, 0x03, 0x04,
+        0x00,
+    }
+    nb := opts.MaxAllocBytes
+    defer func() { opts.MaxAllocBytes = nb }()
+    opts.MaxAllocBytes = 19
+    _, err := DecodeObject(buf, &v)
+    require.Equal(t, BudgetError { Size: 4, Remain: 3 }, err)
+    opts.MaxAllocBytes = 0
+    _, err = DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, TestAllocBudget { A: []int64 { 1, 2 }, B: []byte { 1, 2, 3, 4 } }, v)
+    opts.MaxAllocBytes = 1 << 20
+    buf[4] = 0x7f
+    _, err = DecodeObject(buf, &v)
+    require.Equal(t, BudgetError { Size: 0x7f000002 * 8, Remain: 1 << 20 }, err)
+}
+
+type TestAllocNoBudget struct {
+    A []byte `frugal:"1,default,binary"`
+}
+
+func TestDecoder_AllocNoBudget(t *testing.T) {
+    var v TestAllocNoBudget
+    buf := []byte { 0x0b, 0x00, 0x01, 0x00, 0x00, 0x00, 0x04, 0x01, 0x02, 0x03, 0x04, 0x00 }
+    nb := opts.MaxAllocBytes
+    defer func() { opts.MaxAllocBytes = nb }()
+    opts.MaxAllocBytes = 0
+    _, err := DecodeObject(buf, &v)
+    require.NoError(t, err)
+    opts.MaxAllocBytes = 1
+    _, err = DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, TestAllocNoBudget { A: []byte { 1, 2, 3, 4 } }, v)
+    Release(rt.UnpackType(reflect.TypeOf(v)))
+    _, err = DecodeObject(buf, &v)
+    require.Equal(t, BudgetError { Size: 4, Remain: 1 }, err)
+}
+
+func TestDecoder_MeasureGraph(t *testing.T) {
+    buf := []byte {
+        0x0f, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x00, 0x02,         // field 1: list<i64>
+        0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+        0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+        0x0d, 0x00, 0x02, 0x0b, 0x0c, 0x00, 0x00, 0x00, 0x01,   // field 2: map<string:struct>
+        0x00, 0x00, 0x00, 0x01, 0x61,
+        0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 0x00,
+        0x00,
+    }
+    st, nb, err := MeasureGraph(buf)
+    require.NoError(t, err)
+    require.Equal(t, len(buf), nb)
+    require.Equal(t, GraphStats {
+        Structs       : 2,
+        Fields        : 3,
+        Lists         : 1,
+        Maps          : 1,
+        Elements      : 3,
+        MaxDepth      : 3,
+        ScalarBytes   : 20,
+        StringBytes   : 1,
+        OverheadBytes : len(buf) - 21,
+    }, st)
+    _, _, err = MeasureGraph(buf[:30])
+    require.EqualError(t, err, "frugal: unexpected EOF: 3 bytes short")
+    _, _, err = MeasureGraph([]byte { 0x05, 0x00, 0x01 })
+    require.EqualError(t, err, "frugal: invalid type tag: 5")
+    _, _, err = MeasureGraph(bytes.Repeat([]byte { 0x0c, 0x00, 0x01 }, defs.StackSize))
+    require.EqualError(t, err, "frugal: value nesting too deep")
+}
+
+type TestCheckedItem struct {
+    X int32 `frugal:"1,default,i32"`
+}
+
+type TestChecked struct {
+    A []int64                     `frugal:"1,default,list<i64>"`
+    B map[string]*TestCheckedItem `frugal:"2,default,map<string:TestCheckedItem>"`
+    C string                      `frugal:"3,default,string"`
+}
+
+func TestDecoder_Checked(t *testing.T) {
+    buf := []byte {
+        0x0f, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x00, 0x02,
+        0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+        0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+        0x0d, 0x00, 0x02, 0x0b, 0x0c, 0x00, 0x00, 0x00, 0x01,
+        0x00, 0x00, 0x00, 0x01, 0x61,
+        0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 0x00,
+        0x0b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x03, 0x66, 0x6f, 0x6f,
+        0x00,
+    }
+    var v TestChecked
+    nb, err := DecodeObjectChecked(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, len(buf), nb)
+    require.Equal(t, TestChecked {
+        A: []int64 { 1, 2 },
+        B: map[string]*TestCheckedItem { "a": { X: 5 } },
+        C: "foo",
+    }, v)
+    for i := 0; i < len(buf); i++ {
+        var r TestChecked
+        _, err = DecodeObjectChecked(append([]byte(nil), buf[:i]...), &r)
+        require.Error(t, err, "prefix %d", i)
+        require.Regexp(t, "^frugal: (truncated|corrupted) input: ", err.Error())
+    }
+    mem := append([]byte(nil), buf...)
+    mem[4] = 0x7f
+    _, err = DecodeObjectChecked(mem, &v)
+    require.ErrorIs(t, err, ErrCorrupted)
+    mem = append([]byte(nil), buf...)
+    mem[50] = 0x04
+    _, err = DecodeObjectChecked(mem, &v)
+    require.ErrorIs(t, err, ErrTruncated)
+}
+
+type TestPartialItem struct {
+    X int32 `frugal:"1,default,i32"`
+}
+
+type TestPartial struct {
+    A int64            `frugal:"1,default,i64"`
+    B []string         `frugal:"2,required,list<string>"`
+    C *TestPartialItem `frugal:"3,default,TestPartialItem"`
+    D string           `frugal:"4,default,string"`
+}
+
+func TestDecoder_Partial(t *testing.T) {
+    buf := []byte {
+        0x0a, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+        0x0f, 0x00, 0x02, 0x0b, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x61,
+        0x0c, 0x00, 0x03, 0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 0x00,
+        0x0b, 0x00, 0x04, 0x00, 0x00, 0x00, 0x03, 0x66, 0x6f, 0x6f,
+        0x00,
+    }
+    dec, err := CompilePartial(reflect.TypeOf(TestPartial{}), []uint16 { 1, 3 })
+    require.NoError(t, err)
+    defer dec.Release()
+    var v TestPartial
+    nb, err := dec.Decode(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, len(buf), nb)
+    require.Equal(t, TestPartial { A: 1, C: &TestPartialItem { X: 5 } }, v)
+    _, err = dec.Decode(buf, &TestPartialItem{})
+    require.Error(t, err)
+    _, err = CompilePartial(reflect.TypeOf(TestPartial{}), []uint16 { 5 })
+    require.EqualError(t, err, "frugal: field 5 is not defined in decoder.TestPartial")
+    mem := append(append([]byte(nil), buf[:11]...), 0x00)
+    _, err = dec.Decode(mem, &TestPartial{})
+    require.NoError(t, err)
+    _, err = DecodeObject(mem, &TestPartial{})
+    require.EqualError(t, err, "frugal: missing required field 2 for type decoder.TestPartial")
+}
+
+type TestTagDefault struct {
+    A int32   `frugal:"1,optional,i32,default=7"`
+    B string  `frugal:"2,optional,string,default=\"hi there\""`
+    C []byte  `frugal:"3,optional,binary,default=xyz"`
+    D float64 `frugal:"4,default,double,default=1.5"`
+    E bool    `frugal:"5,optional,bool,default=true"`
+    F int8    `frugal:"6,optional,i8,default=-3"`
+}
+
+func TestDecoder_TagDefault(t *testing.T) {
+    var v TestTagDefault
+    var w TestTagDefault
+    _, err := DecodeObject([]byte { 0x00 }, &v)
+    require.NoError(t, err)
+    require.Equal(t, TestTagDefault { A: 7, B: "hi there", C: []byte("xyz"), D: 1.5, E: true, F: -3 }, v)
+    _, err = DecodeObject([]byte { 0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00 }, &w)
+    require.NoError(t, err)
+    require.Equal(t, TestTagDefault { A: 2, B: "hi there", C: []byte("xyz"), D: 1.5, E: true, F: -3 }, w)
+    v.C[0] = 'a'
+    require.Equal(t, []byte("xyz"), w.C)
+}
+
+type TestRecursiveNode struct {
+    V    int64                `frugal:"1,default,i64"`
+    Next *TestRecursiveNode   `frugal:"2,optional,TestRecursiveNode"`
+    Kids []*TestRecursiveNode `frugal:"3,default,list<TestRecursiveNode>"`
+}
+
+func TestDecoder_RecursiveTypes(t *testing.T) {
+    var v TestRecursiveNode
+    buf := []byte {
+        0x0a, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+        0x0c, 0x00, 0x02,
+        0x0a, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00,
+        0x0f, 0x00, 0x03, 0x0c, 0x00, 0x00, 0x00, 0x01,
+        0x0a, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x00,
+        0x00,
+    }
+    nb, err := DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, len(buf), nb)
+    require.Equal(t, TestRecursiveNode {
+        V    : 2,
+        Next : &TestRecursiveNode { V: 1 },
+        Kids : []*TestRecursiveNode { { V: 3 } },
+    }, v)
+}
+
+type TestRejectUnknown struct {
+    A int32  `frugal:"1,default,i32"`
+    B string `frugal:"2,default,string"`
+}
+
+func TestDecoder_RejectUnknown(t *testing.T) {
+    var v TestRejectUnknown
+    buf := []byte {
+        0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x7b,
+        0x0b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 'x',
+        0x00,
+    }
+    _, err := DecodeObject(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, TestRejectUnknown{A: 123}, v)
+    type TestRejectUnknownStrict TestRejectUnknown
+    var w TestRejectUnknownStrict
+    o := opts.GetDefaultOptions()
+    o.RejectUnknown = true
+    _, err = Pretouch(rt.UnpackType(reflect.TypeOf(w)), o)
+    require.NoError(t, err)
+    _, err = DecodeObject(buf, &w)
+    require.Equal(t, UnknownFieldError {
+        Type     : reflect.TypeOf(w),
+        ID       : 3,
+        WireType : 11,
+    }, err)
+    buf[7] = 0x08
+    buf[9] = 0x02
+    buf[14] = 0x00
+    buf = buf[:15]
+    _, err = DecodeObject(buf, &w)
+    require.NoError(t, err)
+    require.Equal(t, TestRejectUnknownStrict{A: 123}, w)
+}
+
+type TestNestedDefault struct {
+    X TestTagDefault  `frugal:"1,default,TestTagDefault"`
+    Y *TestTagDefault `frugal:"2,optional,TestTagDefault"`
+    Z int64           `frugal:"3,required,i64,default=42"`
+}
+
+func TestDecoder_NewWithDefaults(t *testing.T) {
+    var v TestTagDefault
+    _, err := DecodeObject([]byte { 0x00 }, &v)
+    require.NoError(t, err)
+    p, err := NewWithDefaults(reflect.TypeOf(v))
+    require.NoError(t, err)
+    require.Equal(t, &v, p)
+    q, err := NewWithDefaults(reflect.TypeOf(&v))
+    require.NoError(t, err)
+    p.(*TestTagDefault).C[0] = 'a'
+    require.Equal(t, []byte("xyz"), q.(*TestTagDefault).C)
+    w, err := NewWithDefaults(reflect.TypeOf(TestNestedDefault{}))
+    require.NoError(t, err)
+    require.Equal(t, &TestNestedDefault { X: v, Z: 42 }, w)
+    _, err = NewWithDefaults(reflect.TypeOf(0))
+    require.EqualError(t, err, "frugal: defaults are only applicable to structs, not int")
+}
+
+type TestPipelineInner struct {
+    S string `frugal:"1,default,string"`
+}
+
+type TestPipeline struct {
+    A string            `frugal:"1,default,string"`
+    B []byte            `frugal:"2,default,binary"`
+    C TestPipelineInner `frugal:"3,default,TestPipelineInner"`
+    D int64             `frugal:"4,default,i64"`
+}
+
+func TestDecoder_Pipeline(t *testing.T) {
+    buf := []byte {
+        0x0b, 0, 1, 0, 0, 0, 1, 'a',
+        0x0b, 0, 2, 0, 0, 0, 1, 'b',
+        0x0c, 0, 3, 0x0b, 0, 1, 0, 0, 0, 1, 'c', 0x00,
+        0x0a, 0, 4, 0, 0, 0, 0, 0, 0, 0, 4,
+        0x00,
+    }
+    var v TestPipeline
+    zc := NewPipeline(Config { ZeroCopy: true })
+    defer zc.Release()
+    nb, err := zc.Decode(buf, &v)
+    require.NoError(t, err)
+    require.Equal(t, len(buf), nb)
+    require.Equal(t, TestPipeline { A: "a", B: []byte("b"), C: TestPipelineInner { S: "c" }, D: 4 }, v)
+    require.Equal(t, unsafe.Pointer(&buf[7]), (*rt.GoString)(unsafe.Pointer(&v.A)).Ptr)
+    require.Equal(t, unsafe.Pointer(&buf[15]), unsafe.Pointer(&v.B[0]))
+    require.Equal(t, unsafe.Pointer(&buf[26]), (*rt.GoString)(unsafe.Pointer(&v.C.S)).Ptr)
+    var p TestPipeline
+    pm := NewPipeline(Config { Fields: []uint16 { 4 } })
+    defer pm.Release()
+    nb, err = pm.Decode(buf, &p)
+    require.NoError(t, err)
+    require.Equal(t, len(buf), nb)
+    require.Equal(t, TestPipeline { D: 4 }, p)
+    _, err = NewPipeline(Config { MaxAllocBytes: 1 }).Decode(buf, &p)
+    require.IsType(t, BudgetError{}, err)
+}
+
+type TestSpill struct {
+    A iov.Blob  `frugal:"1,default,binary"`
+    B iov.Blob  `frugal:"2,default,binary"`
+    C []byte    `frugal:"3,default,binary"`
+    D *iov.Blob `frugal:"4,optional,binary"`
+}
+
+type testSpillSink struct {
+    n int
+}
+
+func (self *testSpillSink) Spill(buf []byte) (iov.SpillHandle, error) {
+    self.n += len(buf)
+    return iov.TempFileSink("").Spill(buf)
+}
+
+func TestDecoder_Spill(t *testing.T) {
+    buf := []byte {
+        0x0b, 0, 1, 0, 0, 0, 2, 'a', 'b',
+        0x0b, 0, 2, 0, 0, 0, 4, 'c', 'd', 'e', 'f',
+        0x0b, 0, 3, 0, 0, 0, 4, 'g', 'h', 'i', 'j',
+        0x0b, 0, 4, 0, 0, 0, 3, 'k', 'l', 'm',
+        0x00,
+    }
+    var v TestSpill
+    sk := new(testSpillSink)
+    for _, cf := range []Config { { SpillSize: 2, SpillSink: sk }, { SpillSize: 2, SpillSink: sk, Checked: true } } {
+        pp := NewPipeline(cf)
+        nb, err := pp.Decode(buf, &v)
+        pp.Release()
+        require.NoError(t, err)
+        require.Equal(t, len(buf), nb)
+        require.Equal(t, iov.Blob { Data: []byte("ab") }, v.A)
+        require.Nil(t, v.B.Data)
+        require.EqualValues(t, 4, v.B.Len())
+        require.Equal(t, []byte("ghij"), v.C)
+        require.NoError(t, v.B.Load())
+        require.NoError(t, v.D.Load())
+        require.Equal(t, iov.Blob { Data: []byte("cdef") }, v.B)
+        require.Equal(t, &iov.Blob { Data: []byte("klm") }, v.D)
+    }
+    require.Equal(t, 14, sk.n)
+    var p TestSpill
+    _, err := DecodeObject(buf, &p)
+    require.NoError(t, err)
+    require.Equal(t, []byte("cdef"), p.B.Data)
+    require.Nil(t, p.B.Spilled)
+}
+
+type (
+    TestSharedA struct {
+        A int16  `frugal:"1,default,i16"`
+        B string `frugal:"2,default,string"`
+    }
+    TestSharedB TestSharedA
+)
+
+func TestDecoder_SharedCode(t *testing.T) {
+    var a TestSharedA
+    var b TestSharedB
+    ns := SharedCount
+    buf := []byte{0x06, 0x00, 0x01, 0, 1, 0x0b, 0x00, 0x02, 0, 0, 0, 3, 'f', 'o', 'o', 0}
+    _, err := DecodeObject(buf, &a)
+    require.NoError(t, err)
+    _, err = DecodeObject(buf, &b)
+    require.NoError(t, err)
+    require.Equal(t, ns + 1, SharedCount)
+    Release(rt.UnpackType(reflect.TypeOf(a)))
+    b = TestSharedB{}
+    _, err = DecodeObject(buf, &b)
+    require.NoError(t, err)
+    require.Equal(t, TestSharedA{A: 1, B: "foo"}, a)
+    require.Equal(t, TestSharedB{A: 1, B: "foo"}, b)
+}
+
+func TestDecoder_InspectFields(t *testing.T) {
+    buf := []byte {
+        0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x2a,
+        0x0b, 0x00, 0x05, 0x00, 0x00, 0x00, 0x03, 'f', 'o', 'o',
+        0x0f, 0xff, 0xfe, 0x0c, 0x00, 0x00, 0x00, 0x01, 0x06, 0x00, 0x01, 0x12, 0x34, 0x00,
+        0x00,
+    }
+    fv, err := InspectFields(buf)
+    require.NoError(t, err)
+    require.Equal(t, []FieldInfo {
+        { ID:  1, Type: 0x08, Offset:  3, Size:  4 },
+        { ID:  5, Type: 0x0b, Offset: 10, Size:  7 },
+        { ID: -2, Type: 0x0f, Offset: 20, Size: 11 },
+    }, fv)
+    _, err = InspectFields(buf[:len(buf) - 1])
+    require.Error(t, err)
+    _, err = InspectFields(buf[:25])
+    require.Error(t, err)
+    _, err = InspectFields([]byte{0x01, 0x00, 0x01})
+    require.Error(t, err)
+}
+
+type TestFieldGroups struct {
+    A int32   `frugal:"1,default,i32"`
+    B *string `frugal:"2,optional,string,group=addr"`
+    C *int32  `frugal:"3,optional,i32,group=addr"`
+    D *int32  `frugal:"70,optional,i32,group=addr"`
+    E *int32  `frugal:"4,optional,i32,group=geo"`
+    F *int32  `frugal:"5,optional,i32,group=geo"`
+}
+
+func TestDecoder_FieldGroups(t *testing.T) {
+    var v TestFieldGroups
+    b := []byte { 0x0b, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 'x' }
+    c := []byte { 0x08, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01 }
+    d := []byte { 0x08, 0x00, 0x46, 0x00, 0x00, 0x00, 0x01 }
+    e := []byte { 0x08, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01 }
+    f := []byte { 0x08, 0x00, 0x05, 0x00, 0x00, 0x00, 0x01 }
+    msg := func(fv ...[]byte) (ret []byte) {
+        for _, b := range fv {
+            ret = append(ret, b...)
+        }
+        return append(ret, 0x00)
+    }
+    _, err := DecodeObject(msg(), &v)
+    require.NoError(t, err)
+    _, err = DecodeObject(msg(e, b, c, d, f), &v)
+    require.NoError(t, err)
+    _, err = DecodeObject(msg(b, d), &v)
+    require.Equal(t, GroupError { Type: reflect.TypeOf(v), Group: "addr", Missing: []uint16 { 3 } }, err)
+    _, err = DecodeObject(msg(d), &v)
+    require.EqualError(t, err, `frugal: incomplete field group "addr" for type decoder.TestFieldGroups, missing fields 2, 3`)
+    _, err = DecodeObject(msg(b, c), &v)
+    require.Equal(t, GroupError { Type: reflect.TypeOf(v), Group: "addr", Missing: []uint16 { 70 } }, err)
+    _, err = DecodeObject(msg(b, c, d, f), &v)
+    require.Equal(t, GroupError { Type: reflect.TypeOf(v), Group: "geo", Missing: []uint16 { 4 } }, err)
+}
+
+type TestNegativeLength struct {
+    A string          `frugal:"1,default,string"`
+    B []int32         `frugal:"2,default,list<i32>"`
+    C map[string]bool `frugal:"3,default,map<string:bool>"`
+    D int32           `frugal:"4,default,i32"`
+}
+
+type TestLenientLength struct {
+    A string          `frugal:"1,default,string"`
+    B []int32         `frugal:"2,default,list<i32>"`
+    C map[string]bool `frugal:"3,default,map<string:bool>"`
+    D int32           `frugal:"4,default,i32"`
+}
+
+func TestDecoder_NegativeLength(t *testing.T) {
+    var v TestNegativeLength
+    a := []byte { 0x0b, 0x00, 0x01, 0xff, 0xff, 0xff, 0xff }
+    b := []byte { 0x0f, 0x00, 0x02, 0x08, 0xff, 0xff, 0xff, 0xfe }
+    c := []byte { 0x0d, 0x00, 0x03, 0x0b, 0x02, 0x00, 0x00, 0x00, 0x01, 0x80, 0x00, 0x00, 0x00, 0x01 }
+    d := []byte { 0x08, 0x00, 0x04, 0x00, 0x00, 0x00, 0x07 }
+    msg := func(fv ...[]byte) (ret []byte) {
+        for _, b := range fv {
+            ret = append(ret, b...)
+        }
+        return append(ret, 0x00)
+    }
+    _, err := DecodeObject(msg(d, a), &v)
+    require.Equal(t, NegativeLengthError { Type: reflect.TypeOf(v), Field: "A", Offset: 10, Length: -1 }, err)
+    _, err = DecodeObject(msg(b), &v)
+    require.EqualError(t, err, "frugal: negative length -2 at offset 4 in field decoder.TestNegativeLength.B")
+    _, err = DecodeObject(msg(c), &v)
+    require.Equal(t, NegativeLengthError { Type: reflect.TypeOf(v), Field: "C", Offset: 9, Length: math.MinInt32 }, err)
+    _, err = DecodeObjectChecked(msg(a), &v)
+    require.Equal(t, NegativeLengthError { Type: reflect.TypeOf(v), Field: "A", Offset: 3, Length: -1 }, err)
+    var r TestLenientLength
+    o := opts.GetDefaultOptions()
+    o.LenientLengths = true
+    _, err = Pretouch(rt.UnpackType(reflect.TypeOf(r)), o)
+    require.NoError(t, err)
+    _, err = DecodeObject(msg(a, b, d), &r)
+    require.NoError(t, err)
+    require.Equal(t, TestLenientLength { B: []int32 {}, D: 7 }, r)
+}
+
+type testLogger struct {
+    sync.Mutex
+    lv []utils.LogLevel
+    ms []string
+}
+
+func (self *testLogger) Log(level utils.LogLevel, msg string, _ ...interface{}) {
+    self.Lock()
+    self.lv = append(self.lv, level)
+    self.ms = append(self.ms, msg)
+    self.Unlock()
+}
+
+func (self *testLogger) get(level utils.LogLevel) (ret []string) {
+    self.Lock()
+    defer self.Unlock()
+    for i, lv := range self.lv {
+        if lv == level {
+            ret = append(ret, self.ms[i])
+        }
+    }
+    return
+}
+
+type TestDeopt struct {
+    A int32 `frugal:"1,default,i32"`
+}
+
+func TestDecoder_Deopt(t *testing.T) {
+    var v TestDeopt
+    var ev []*utils.DeoptEvent
+    vt := rt.UnpackType(reflect.TypeOf(v))
+    buf := []byte { 0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x07, 0x00 }
+    lg := new(testLogger)
+    nt := opts.DeoptThreshold
+    ol := utils.SetLogger(lg)
+    opts.DeoptThreshold = 2
+    utils.SetDeoptHook(func(e *utils.DeoptEvent) { ev = append(ev, e) })
+    defer func() { opts.DeoptThreshold = nt; utils.SetDeoptHook(nil); utils.SetLogger(ol); Release(vt) }()
+    _, err := programCache.Compute(vt, func(*rt.GoType) (interface{}, error) {
+        return newCodec(func(unsafe.Pointer, int, int, unsafe.Pointer, *RuntimeState, int) (int, error) {
+            panic(utils.EAbort(vt.Pack(), 1, 0, utils.AbortUnderflow))
+        }, nil), nil
+    })
+    require.NoError(t, err)
+    for i := 0; i < 2; i++ {
+        _, err = DecodeObject(buf, &v)
+        require.ErrorAs(t, err, new(utils.AbortError))
+        require.EqualError(t, err, "frugal: decoder of decoder.TestDeopt faulted: frugal: state stack underflow at pc 0 of decoder.TestDeopt, field 1")
+    }
+    if IsNative() {
+        require.Len(t, ev, 1)
+        require.Equal(t, reflect.TypeOf(v), ev[0].Type)
+        require.Equal(t, []string { "deoptimizing to the emulator after repeated faults" }, lg.get(utils.LevelWarn))
+        require.Equal(t, 2, ev[0].Faults)
+        require.Nil(t, programCache.Get(vt))
+        ne := EmuCount
+        _, err = DecodeObject(buf, &v)
+        require.NoError(t, err)
+        require.Equal(t, TestDeopt { A: 7 }, v)
+        require.Equal(t, ne + 1, EmuCount)
+    }
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+    `fmt`
+    `reflect`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/binary/defs`
+)
+
+// NewWithDefaults allocates a new value of struct type vt, and applies the same
+// defaults as the decoder does to a struct without any fields on the wire: the
+// `InitDefault()` method is called first, then the "default" tag options are
+// applied. Nested structs that are embedded by value are defaulted recursively,
+// pointers to structs are left as nil.
+//
+// vt can be either a struct or a pointer to struct, the returned value is always
+// a pointer to the struct.
+func NewWithDefaults(vt reflect.Type) (interface{}, error) {
+    if vt.Kind() == reflect.Ptr {
+        vt = vt.Elem()
+    }
+
+    /* only structs have defaults */
+    if vt.Kind() != reflect.Struct {
+        return nil, fmt.Errorf("frugal: defaults are only applicable to structs, not %s", vt)
+    }
+
+    /* allocate and apply the defaults */
+    rv := reflect.New(vt)
+    err := applyDefaults(vt, unsafe.Pointer(rv.Pointer()))
+
+    /* check for errors */
+    if err != nil {
+        return nil, err
+    } else {
+        return rv.Interface(), nil
+    }
+}
+
+func applyDefaults(vt reflect.Type, vp unsafe.Pointer) error {
+    var err error
+    var ifn unsafe.Pointer
+    var fvs []defs.Field
+
+    /* resolve the fields */
+    if fvs, err = defs.ResolveFields(vt); err != nil {
+        return err
+    }
+
+    /* find the default initializer */
+    if ifn, err = defs.GetDefaultInitializer(vt); err != nil {
+        return err
+    }
+
+    /* call the initializer if any */
+    if ifn != nil {
+        reflect.NewAt(vt, vp).Interface().(defs.DefaultInitializer).InitDefault()
+    }
+
+    /* apply the "default" options, and the defaults of nested structs */
+    for _, fv := range fvs {
+        fp := unsafe.Pointer(uintptr(vp) + uintptr(fv.F))
+        ft := fv.Type
+
+        /* binaries are copied, so the defaults are never shared */
+        if fv.Opts & defs.HasDefault != 0 {
+            if ft.T != defs.T_binary {
+                reflect.NewAt(fv.Default.Type(), fp).Elem().Set(fv.Default)
+            } else {
+                reflect.NewAt(fv.Default.Type(), fp).Elem().SetBytes(append([]byte{}, fv.Default.Bytes()...))
+            }
+        }
+
+        /* structs embedded by value */
+        if ft.T == defs.T_struct {
+            if err = applyDefaults(ft.S, fp); err != nil {
+                return err
+            }
+        }
+    }
+
+    /* all done */
+    return nil
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/opts`
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
+)
+
+var (
+    deoptTable = utils.CreateDeoptTable("decoder")
+)
+
+func (self *_Codec) call(vt *rt.GoType, buf unsafe.Pointer, nb int, i int, p unsafe.Pointer, rs *RuntimeState, st int) (int, error) {
+    if opts.DeoptThreshold == 0 {
+        return self.fn(buf, nb, i, p, rs, st)
+    } else {
+        return self.guard(vt, buf, nb, i, p, rs, st)
+    }
+}
+
+func (self *_Codec) guard(vt *rt.GoType, buf unsafe.Pointer, nb int, i int, p unsafe.Pointer, rs *RuntimeState, st int) (ret int, err error) {
+    defer self.rescue(vt, &err)
+    return self.fn(buf, nb, i, p, rs, st)
+}
+
+func (self *_Codec) rescue(vt *rt.GoType, ep *error) {
+    if val := recover(); val != nil {
+        if !utils.IsFault(val) {
+            panic(val)
+        }
+
+        /* keep serving with an error */
+        *ep = utils.FaultError {
+            Kind  : "decoder",
+            Type  : vt.Pack(),
+            Value : val,
+        }
+
+        /* drop the native code once it faulted too many times, it will be linked
+         * again with the emulator the next time this type is used */
+        if IsNative() && deoptTable.Fault(vt, codeOf(self.fn), val, opts.DeoptThreshold) {
+            programCache.Remove(vt)
+        }
+    }
+}
+
+func codeOf(fn Decoder) unsafe.Pointer {
+    return **(**unsafe.Pointer)(unsafe.Pointer(&fn))
+}
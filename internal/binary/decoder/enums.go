@@ -0,0 +1,146 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+    `fmt`
+    `reflect`
+    `sort`
+    `strings`
+    `sync`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/binary/defs`
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+// EnumValueError is returned when an enum field holds a value that is not
+// defined by the enum type. Names holds the names of the valid values if they
+// were registered from an IDL.
+type EnumValueError struct {
+    Type  reflect.Type
+    Enum  reflect.Type
+    Field string
+    Value int64
+    Names map[int64]string
+}
+
+func (self EnumValueError) Error() string {
+    if self.Type == nil {
+        return fmt.Sprintf("frugal: invalid value %d for enum %s%s", self.Value, self.Enum, self.expecting())
+    } else {
+        return fmt.Sprintf("frugal: invalid value %d for enum %s in field %s.%s%s", self.Value, self.Enum, self.Type, self.Field, self.expecting())
+    }
+}
+
+func (self EnumValueError) expecting() string {
+    vs := make([]int64, 0, len(self.Names))
+    ns := make([]string, 0, len(self.Names))
+
+    /* no names were registered */
+    if len(self.Names) == 0 {
+        return ""
+    }
+
+    /* list the values in order */
+    for v := range self.Names {
+        vs = append(vs, v)
+    }
+
+    /* format every value with its name */
+    sort.Slice(vs, func(i int, j int) bool { return vs[i] < vs[j] })
+    for _, v := range vs {
+        ns = append(ns, fmt.Sprintf("%s = %d", self.Names[v], v))
+    }
+
+    /* join them together */
+    return ", expecting one of " + strings.Join(ns, ", ")
+}
+
+type _EnumField struct {
+    vt *rt.GoType
+    id uint16
+}
+
+type _EnumCheck struct {
+    et *rt.GoType
+    fv _EnumField
+    fn defs.EnumChecker
+}
+
+// enumCheckIndex also keeps the checks alive, since the compiled programs refer
+// to them by pointers that are invisible to the GC.
+var (
+    enumCheckLock  = new(sync.Mutex)
+    enumCheckIndex = make(map[[2]_EnumField]*_EnumCheck)
+)
+
+func addEnumCheck(et *rt.GoType, fv _EnumField, fn defs.EnumChecker) *_EnumCheck {
+    var ok bool
+    var ret *_EnumCheck
+
+    /* the enum type and its location identifies a check */
+    key := [2]_EnumField { { vt: et }, fv }
+    enumCheckLock.Lock()
+
+    /* add a new check if not exists */
+    if ret, ok = enumCheckIndex[key]; !ok {
+        ret = &_EnumCheck { et, fv, fn }
+        enumCheckIndex[key] = ret
+    }
+
+    /* all done */
+    enumCheckLock.Unlock()
+    return ret
+}
+
+func fieldName(vt *rt.GoType, id uint16) string {
+    if fvs, err := defs.ResolveFields(vt.Pack()); err == nil {
+        for _, fv := range fvs {
+            if fv.ID == id {
+                return fv.Name
+            }
+        }
+    }
+
+    /* should not happen, use the field ID instead */
+    return fmt.Sprintf("<field %d>", id)
+}
+
+func check_enum(ec *_EnumCheck, v int64) error {
+    if ec.fn(v) {
+        return nil
+    }
+
+    /* not a struct field */
+    if ec.fv.vt == nil {
+        return EnumValueError { Enum: ec.et.Pack(), Value: v, Names: defs.GetEnumNames(ec.et.Pack()) }
+    }
+
+    /* construct the error */
+    return EnumValueError {
+        Type  : ec.fv.vt.Pack(),
+        Enum  : ec.et.Pack(),
+        Field : fieldName(ec.fv.vt, ec.fv.id),
+        Value : v,
+        Names : defs.GetEnumNames(ec.et.Pack()),
+    }
+}
+
+var (
+    F_check_enum = hir.RegisterGCall(check_enum, emu_gcall_check_enum)
+)
@@ -22,6 +22,7 @@ import (
 
     `github.com/cloudwego/frugal/internal/atm/hir`
     `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
 )
 
 //go:nosplit
@@ -49,7 +50,13 @@ func error_missing(t *rt.GoType, i int, m uint64) error {
     return fmt.Errorf("frugal: missing required field %d for type %s", i * 64 + bits.TrailingZeros64(m), t)
 }
 
+//go:nosplit
+func abort(t *rt.GoType, id int, pc int, why int) {
+    panic(utils.EAbort(t.Pack(), id, pc, why))
+}
+
 var (
+    F_abort         = hir.RegisterGCall(abort, nil)
     F_error_eof     = hir.RegisterGCall(error_eof, emu_gcall_error_eof)
     F_error_skip    = hir.RegisterGCall(error_skip, emu_gcall_error_skip)
     F_error_type    = hir.RegisterGCall(error_type, emu_gcall_error_type)
@@ -17,23 +17,15 @@
 package decoder
 
 import (
-    `unsafe`
-
     `github.com/cloudwego/frugal/internal/atm/hir`
     `github.com/cloudwego/frugal/internal/rt`
 )
 
-func emu_seterr(ctx hir.CallContext, i int, err error) {
-    vv := (*rt.GoIface)(unsafe.Pointer(&err))
-    ctx.Rp(i, unsafe.Pointer(vv.Itab))
-    ctx.Rp(i + 1, vv.Value)
-}
-
 func emu_gcall_error_eof(ctx hir.CallContext) {
     if !ctx.Verify("i", "**") {
         panic("invalid error_eof call")
     } else {
-        emu_seterr(ctx, 0, error_eof(int(ctx.Au(0))))
+        ctx.Re(0, error_eof(int(ctx.Au(0))))
     }
 }
 
@@ -41,7 +33,7 @@ func emu_gcall_error_skip(ctx hir.CallContext) {
     if !ctx.Verify("i", "**") {
         panic("invalid error_skip call")
     } else {
-        emu_seterr(ctx, 0, error_skip(int(ctx.Au(0))))
+        ctx.Re(0, error_skip(int(ctx.Au(0))))
     }
 }
 
@@ -49,7 +41,7 @@ func emu_gcall_error_type(ctx hir.CallContext) {
     if !ctx.Verify("ii", "**") {
         panic("invalid error_type call")
     } else {
-        emu_seterr(ctx, 0, error_type(uint8(ctx.Au(0)), uint8(ctx.Au(1))))
+        ctx.Re(0, error_type(uint8(ctx.Au(0)), uint8(ctx.Au(1))))
     }
 }
 
@@ -57,6 +49,6 @@ func emu_gcall_error_missing(ctx hir.CallContext) {
     if !ctx.Verify("*ii", "**") {
         panic("invalid error_skip call")
     } else {
-        emu_seterr(ctx, 0, error_missing((*rt.GoType)(ctx.Ap(0)), int(ctx.Au(1)), ctx.Au(2)))
+        ctx.Re(0, error_missing((*rt.GoType)(ctx.Ap(0)), int(ctx.Au(1)), ctx.Au(2)))
     }
 }
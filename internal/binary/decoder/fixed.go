@@ -0,0 +1,31 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+    `math`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+)
+
+func fixedtof64(v int64, scale int64) uint64 {
+    return math.Float64bits(float64(v) / float64(scale))
+}
+
+var (
+    F_fixedtof64 = hir.RegisterGCall(fixedtof64, emu_gcall_fixedtof64)
+)
@@ -0,0 +1,240 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package decoder
+
+import (
+    `encoding/binary`
+    `fmt`
+
+    `github.com/cloudwego/frugal/internal/binary/defs`
+)
+
+// GraphStats describes the shape of the object graph in an encoded message.
+// Every byte of the message is accounted in exactly one of ScalarBytes,
+// StringBytes or OverheadBytes.
+type GraphStats struct {
+    Structs       int   // number of structs, including the top-level one
+    Fields        int   // number of struct fields
+    Lists         int   // number of lists and sets
+    Maps          int   // number of maps
+    Elements      int   // number of list or set elements and map pairs
+    MaxDepth      int   // maximum nesting level, the top-level struct is at level 1
+    ScalarBytes   int   // bytes of bool, integer and double values
+    StringBytes   int   // bytes of string and binary contents
+    OverheadBytes int   // bytes of field headers, stop bytes, container headers and length prefixes
+}
+
+type _GraphWalker struct {
+    buf []byte
+    pos int
+    arg int
+    st  GraphStats
+}
+
+func (self *_GraphWalker) need(n int) int {
+    if len(self.buf) - self.pos >= n {
+        return 0
+    } else {
+        self.arg = n - len(self.buf) + self.pos
+        return EEOF
+    }
+}
+
+func (self *_GraphWalker) u8() (defs.Tag, int) {
+    if rc := self.need(1); rc != 0 {
+        return 0, rc
+    } else {
+        self.pos++
+        self.st.OverheadBytes++
+        return defs.Tag(self.buf[self.pos - 1]), 0
+    }
+}
+
+func (self *_GraphWalker) u32() (int, int) {
+    if rc := self.need(4); rc != 0 {
+        return 0, rc
+    } else {
+        self.pos += 4
+        self.st.OverheadBytes += 4
+        return int(binary.BigEndian.Uint32(self.buf[self.pos - 4:])), 0
+    }
+}
+
+func (self *_GraphWalker) value(vt defs.Tag, sp int) int {
+    if nb := _SkipSizeFixed[vt]; nb != 0 {
+        if rc := self.need(nb); rc != 0 {
+            return rc
+        } else {
+            self.pos += nb
+            self.st.ScalarBytes += nb
+            return 0
+        }
+    }
+
+    /* nested values */
+    if sp >= defs.StackSize {
+        return ESTACK
+    } else if sp > self.st.MaxDepth {
+        self.st.MaxDepth = sp
+    }
+
+    /* composite values */
+    switch vt {
+        default            : self.arg = int(vt); return ETAG
+        case defs.T_string : return self.str()
+        case defs.T_struct : return self.structure(sp)
+        case defs.T_map    : return self.dict(sp)
+        case defs.T_set    : return self.list(sp)
+        case defs.T_list   : return self.list(sp)
+    }
+}
+
+func (self *_GraphWalker) str() int {
+    nb, rc := self.u32()
+    if rc != 0 {
+        return rc
+    } else if rc = self.need(nb); rc != 0 {
+        return rc
+    }
+
+    /* add the string contents */
+    self.pos += nb
+    self.st.StringBytes += nb
+    return 0
+}
+
+func (self *_GraphWalker) structure(sp int) int {
+    self.st.Structs++
+
+    /* run until the stop byte */
+    for {
+        vt, rc := self.u8()
+        if rc != 0 {
+            return rc
+        } else if vt == 0 {
+            return 0
+        }
+
+        /* skip the field id */
+        if rc = self.need(2); rc != 0 {
+            return rc
+        }
+
+        /* add the field */
+        self.pos += 2
+        self.st.Fields++
+        self.st.OverheadBytes += 2
+
+        /* walk the field value */
+        if rc = self.value(vt, sp + 1); rc != 0 {
+            return rc
+        }
+    }
+}
+
+func (self *_GraphWalker) list(sp int) int {
+    var rc int
+    var nb int
+    var et defs.Tag
+
+    /* element type and count */
+    if et, rc = self.u8(); rc != 0 {
+        return rc
+    } else if nb, rc = self.u32(); rc != 0 {
+        return rc
+    }
+
+    /* add every element */
+    self.st.Lists++
+    self.st.Elements += nb
+
+    /* fast-path for primitive elements */
+    if es := _SkipSizeFixed[et]; es != 0 {
+        if rc = self.need(es * nb); rc != 0 {
+            return rc
+        } else {
+            self.pos += es * nb
+            self.st.ScalarBytes += es * nb
+            return 0
+        }
+    }
+
+    /* walk through the elements */
+    for i := 0; i < nb; i++ {
+        if rc = self.value(et, sp + 1); rc != 0 {
+            return rc
+        }
+    }
+
+    /* all done */
+    return 0
+}
+
+func (self *_GraphWalker) dict(sp int) int {
+    var rc int
+    var nb int
+    var kt defs.Tag
+    var vt defs.Tag
+
+    /* key type, value type and count */
+    if kt, rc = self.u8(); rc != 0 {
+        return rc
+    } else if vt, rc = self.u8(); rc != 0 {
+        return rc
+    } else if nb, rc = self.u32(); rc != 0 {
+        return rc
+    }
+
+    /* add every pair */
+    self.st.Maps++
+    self.st.Elements += nb
+
+    /* walk through the pairs */
+    for i := 0; i < nb; i++ {
+        if rc = self.value(kt, sp + 1); rc != 0 {
+            return rc
+        } else if rc = self.value(vt, sp + 1); rc != 0 {
+            return rc
+        }
+    }
+
+    /* all done */
+    return 0
+}
+
+func (self *_GraphWalker) error(rc int) error {
+    switch rc {
+        case EEOF   : return fmt.Errorf("frugal: unexpected EOF: %d bytes short", self.arg)
+        case ETAG   : return fmt.Errorf("frugal: invalid type tag: %d", self.arg)
+        case ESTACK : return fmt.Errorf("frugal: value nesting too deep")
+        default     : return fmt.Errorf("frugal: unknown error: %d", rc)
+    }
+}
+
+// MeasureGraph walks through the struct encoded at the beginning of buf, and
+// returns the shape of its object graph, and the size of the struct in bytes.
+func MeasureGraph(buf []byte) (GraphStats, int, error) {
+    gw := _GraphWalker { buf: buf }
+
+    /* walk the top-level struct */
+    if rc := gw.value(defs.T_struct, 1); rc != 0 {
+        return GraphStats{}, 0, gw.error(rc)
+    } else {
+        return gw.st, gw.pos, nil
+    }
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package decoder
+
+import (
+    `fmt`
+    `reflect`
+    `sort`
+    `strconv`
+    `strings`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/binary/defs`
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+// GroupError is returned when some, but not all of the fields in a field group
+// are present.
+type GroupError struct {
+    Type    reflect.Type
+    Group   string
+    Missing []uint16
+}
+
+func (self GroupError) Error() string {
+    ids := make([]string, len(self.Missing))
+
+    /* format the missing field IDs */
+    for i, id := range self.Missing {
+        ids[i] = strconv.Itoa(int(id))
+    }
+
+    /* singular or plural */
+    if len(ids) == 1 {
+        return fmt.Sprintf("frugal: incomplete field group %q for type %s, missing field %s", self.Group, self.Type, ids[0])
+    } else {
+        return fmt.Sprintf("frugal: incomplete field group %q for type %s, missing fields %s", self.Group, self.Type, strings.Join(ids, ", "))
+    }
+}
+
+type _FieldGroup struct {
+    gid  int
+    name string
+    ids  []int
+}
+
+// fieldGroups collects the field groups declared with the "group" option,
+// ordered by group names.
+func fieldGroups(fvs []defs.Field) []_FieldGroup {
+    var ret []_FieldGroup
+    var idx map[string]int
+
+    /* add every field to its group */
+    for _, fv := range fvs {
+        if fv.Group != "" {
+            if i, ok := idx[fv.Group]; ok {
+                ret[i].ids = append(ret[i].ids, int(fv.ID))
+            } else {
+                if idx == nil {
+                    idx = make(map[string]int)
+                }
+                idx[fv.Group] = len(ret)
+                ret = append(ret, _FieldGroup { name: fv.Group, ids: []int { int(fv.ID) } })
+            }
+        }
+    }
+
+    /* the group index must not depend on the order of fields */
+    sort.Slice(ret, func(i int, j int) bool { return ret[i].name < ret[j].name })
+
+    /* assign the group index */
+    for i := range ret {
+        ret[i].gid = i
+    }
+
+    /* all done */
+    return ret
+}
+
+// projectGroups keeps only the groups that are entirely within fvs.
+func projectGroups(grp []_FieldGroup, fvs []defs.Field) []_FieldGroup {
+    ret := grp[:0:0]
+    idx := make(map[int]bool, len(fvs))
+
+    /* mark all the fields */
+    for _, fv := range fvs {
+        idx[int(fv.ID)] = true
+    }
+
+    /* check every group */
+    for _, gv := range grp {
+        if containsAll(idx, gv.ids) {
+            ret = append(ret, gv)
+        }
+    }
+
+    /* all done */
+    return ret
+}
+
+func containsAll(idx map[int]bool, ids []int) bool {
+    for _, id := range ids {
+        if !idx[id] {
+            return false
+        }
+    }
+    return true
+}
+
+func groupMembers(grp []_FieldGroup) map[int]bool {
+    ret := make(map[int]bool)
+
+    /* add every member of every group */
+    for _, gv := range grp {
+        for _, id := range gv.ids {
+            ret[id] = true
+        }
+    }
+
+    /* all done */
+    return ret
+}
+
+func error_group(vt *rt.GoType, gid int, fm *FieldBitmap) error {
+    fvs, err := defs.ResolveFields(vt.Pack())
+    ret := GroupError { Type: vt.Pack() }
+
+    /* this never fails since the struct is already compiled */
+    if err != nil {
+        panic(err)
+    }
+
+    /* find all the missing fields of the group */
+    gv := fieldGroups(fvs)[gid]
+    ret.Group = gv.name
+
+    /* check every field */
+    for _, id := range gv.ids {
+        if fm[id / 64] & (1 << (id % 64)) == 0 {
+            ret.Missing = append(ret.Missing, uint16(id))
+        }
+    }
+
+    /* all done */
+    return ret
+}
+
+var (
+    F_error_group = hir.RegisterGCall(error_group, nil)
+)
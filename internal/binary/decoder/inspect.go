@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package decoder
+
+import (
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/binary/defs`
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+// FieldInfo describes a top-level field found by InspectFields.
+type FieldInfo struct {
+    ID     int16    // field ID
+    Type   uint8    // wire type of the field
+    Offset int      // offset of the field value in buf, right after the 3-byte field header
+    Size   int      // size of the field value in bytes
+}
+
+// InspectFields scans the struct at the beginning of buf, and returns its
+// top-level fields in the order they appear, without decoding any of them.
+func InspectFields(buf []byte) ([]FieldInfo, error) {
+    rs := newRuntimeState()
+    defer freeRuntimeState(rs)
+    return inspectFields(make([]FieldInfo, 0, 16), (*_skipbuf_t)(&rs.Sk), buf)
+}
+
+func inspectFields(ret []FieldInfo, st *_skipbuf_t, buf []byte) ([]FieldInfo, error) {
+    sl := (*rt.GoSlice)(unsafe.Pointer(&buf))
+    nb := len(buf)
+
+    /* scan until the end of struct */
+    for i := 0;; {
+        var rv int
+        var vt defs.Tag
+
+        /* must have at least 1 byte */
+        if i >= nb {
+            return nil, error_eof(1)
+        }
+
+        /* check for end of struct */
+        if vt = defs.Tag(buf[i]); vt == 0 {
+            return ret, nil
+        }
+
+        /* check for tag value */
+        if !vt.IsWireTag() {
+            return nil, error_skip(ETAG)
+        }
+
+        /* must have the entire field header */
+        if i + 3 > nb {
+            return nil, error_eof(i + 3 - nb)
+        }
+
+        /* skip over the field value, the skipper does not touch anything beyond the buffer */
+        id := int16(buf[i + 1]) << 8 | int16(buf[i + 2])
+        fp := i + 3
+
+        /* check for skipping errors */
+        if rv = do_skip(st, unsafe.Pointer(uintptr(sl.Ptr) + uintptr(fp)), nb - fp, vt); rv < 0 {
+            return nil, error_skip(rv)
+        }
+
+        /* add the field */
+        i = fp + rv
+        ret = append(ret, FieldInfo { ID: id, Type: uint8(vt), Offset: fp, Size: rv })
+    }
+}
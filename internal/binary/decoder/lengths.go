@@ -0,0 +1,63 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+    `fmt`
+    `reflect`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+// NegativeLengthError is returned when a string, binary or container has a negative
+// length prefix. Offset is the position of the prefix in the input buffer.
+type NegativeLengthError struct {
+    Type   reflect.Type
+    Field  string
+    Offset int
+    Length int32
+}
+
+func (self NegativeLengthError) Error() string {
+    if self.Type == nil {
+        return fmt.Sprintf("frugal: negative length %d at offset %d", self.Length, self.Offset)
+    } else {
+        return fmt.Sprintf("frugal: negative length %d at offset %d in field %s.%s", self.Length, self.Offset, self.Type, self.Field)
+    }
+}
+
+func error_length(vt *rt.GoType, id int, i int, n int) error {
+    ret := NegativeLengthError {
+        Offset: i,
+        Length: int32(uint32(n)),
+    }
+
+    /* not within a struct field */
+    if vt == nil {
+        return ret
+    }
+
+    /* add the field location */
+    ret.Type = vt.Pack()
+    ret.Field = fieldName(vt, uint16(id))
+    return ret
+}
+
+var (
+    F_error_length = hir.RegisterGCall(error_length, nil)
+)
@@ -17,31 +17,60 @@
 package decoder
 
 import (
+    `runtime`
+    `sync`
+    `sync/atomic`
+
     `github.com/cloudwego/frugal/internal/atm/hir`
     `github.com/cloudwego/frugal/internal/utils`
 )
 
 type Linker interface {
-    Link(p hir.Program) Decoder
+    Link(p hir.Program) (Decoder, int)
+    Unlink(fn Decoder)
 }
 
 var (
-    linker   Linker
-    F_decode *hir.CallHandle
+    linker       Linker
+    emuOnce      sync.Once
+    F_decode     *hir.CallHandle
+    F_decode_chk *hir.CallHandle
 )
 
 func init() {
-    F_decode = hir.RegisterGCall(decode, emu_gcall_decode)
+    F_decode     = hir.RegisterGCall(decode, emu_gcall_decode)
+    F_decode_chk = hir.RegisterGCall(decode_chk, emu_gcall_decode_chk)
 }
 
-func Link(p hir.Program) Decoder {
+func Link(p hir.Program) (Decoder, int) {
     if linker == nil || utils.ForceEmulator {
-        return link_emu(p)
+        emuOnce.Do(warnEmulator)
+        atomic.AddUint64(&EmuCount, 1)
+        return link_emu(p), 0
     } else {
         return linker.Link(p)
     }
 }
 
+func Unlink(fn Decoder) {
+    if IsNative() {
+        linker.Unlink(fn)
+    }
+}
+
+// IsNative reports whether the native linker is used instead of the emulator.
+func IsNative() bool {
+    return linker != nil && !utils.ForceEmulator
+}
+
+func warnEmulator() {
+    if utils.ForceEmulator {
+        utils.Log(utils.LevelInfo, "using the emulator backend as requested by FRUGAL_BACKEND", "codec", "decoder")
+    } else {
+        utils.Log(utils.LevelWarn, "native backend is not available, falling back to the emulator", "codec", "decoder", "goarch", runtime.GOARCH)
+    }
+}
+
 func SetLinker(v Linker) {
     linker = v
 }
@@ -36,8 +36,12 @@ func init() {
     SetLinker(new(LinkerAMD64))
 }
 
-func (LinkerAMD64) Link(p hir.Program) Decoder {
+func (LinkerAMD64) Link(p hir.Program) (Decoder, int) {
     fn := pgen.CreateCodeGen((Decoder)(nil)).Generate(p, _NativeStackSize)
     fp := loader.Loader(fn.Code).Load("decoder", fn.Frame)
-    return *(*Decoder)(unsafe.Pointer(&fp))
+    return *(*Decoder)(unsafe.Pointer(&fp)), len(fn.Code)
+}
+
+func (LinkerAMD64) Unlink(fn Decoder) {
+    loader.Unload(*(*loader.Function)(unsafe.Pointer(&fn)))
 }
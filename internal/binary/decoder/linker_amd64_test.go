@@ -0,0 +1,57 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package decoder
+
+import (
+    `reflect`
+    `testing`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/atm/pgen`
+    `github.com/stretchr/testify/require`
+)
+
+func countInstr(p hir.Program) (n int) {
+    for v := p.Head; v != nil; v = v.Ln { n++ }
+    return
+}
+
+func TestLinker_Peephole(t *testing.T) {
+    p, err := CreateCompiler().Compile(reflect.TypeOf(TranslatorTestStruct{}))
+    require.NoError(t, err)
+    pgen.EnablePeephole(false)
+    f0 := pgen.CreateCodeGen((Decoder)(nil)).Generate(Translate(p), 0)
+    pgen.EnablePeephole(true)
+    f1 := pgen.CreateCodeGen((Decoder)(nil)).Generate(Translate(p), 0)
+    tr := Translate(p)
+    n0 := countInstr(tr)
+    nr := pgen.Peephole(tr)
+    require.Equal(t, n0 - nr, countInstr(tr))
+    require.GreaterOrEqual(t, nr, 0)
+    require.LessOrEqual(t, len(f1.Code), len(f0.Code))
+    t.Logf("hir: %d -> %d instructions, code: %d -> %d bytes", n0, n0 - nr, len(f0.Code), len(f1.Code))
+}
+
+func TestLinker_Deterministic(t *testing.T) {
+    p, err := CreateCompiler().Compile(reflect.TypeOf(TranslatorTestStruct{}))
+    require.NoError(t, err)
+    f0 := pgen.CreateCodeGen((Decoder)(nil)).Generate(Translate(p), 0)
+    for i := 0; i < 16; i++ {
+        require.Equal(t, f0.Code, pgen.CreateCodeGen((Decoder)(nil)).Generate(Translate(p), 0).Code)
+    }
+}
@@ -43,8 +43,8 @@ func link_emu(prog hir.Program) Decoder {
     }
 }
 
-func emu_decode(ctx hir.CallContext) (int, error) {
-    return decode(
+func emu_decode(ctx hir.CallContext, fn DecodeFunc) (int, error) {
+    return fn(
         (*rt.GoType)(ctx.Ap(0)),
         ctx.Ap(1),
         int(ctx.Au(2)),
@@ -58,7 +58,7 @@ func emu_decode(ctx hir.CallContext) (int, error) {
 func emu_mkreturn(ctx hir.CallContext) func(int, error) {
     return func(ret int, err error) {
         ctx.Ru(0, uint64(ret))
-        emu_seterr(ctx, 1, err)
+        ctx.Re(1, err)
     }
 }
 
@@ -66,6 +66,14 @@ func emu_gcall_decode(ctx hir.CallContext) {
     if !ctx.Verify("**ii**i", "i**") {
         panic("invalid decode call")
     } else {
-        emu_mkreturn(ctx)(emu_decode(ctx))
+        emu_mkreturn(ctx)(emu_decode(ctx, decode))
+    }
+}
+
+func emu_gcall_decode_chk(ctx hir.CallContext) {
+    if !ctx.Verify("**ii**i", "i**") {
+        panic("invalid decode_chk call")
+    } else {
+        emu_mkreturn(ctx)(emu_decode(ctx, decode_chk))
     }
 }
\ No newline at end of file
@@ -27,8 +27,13 @@ const (
     OP_str
     OP_str_nocopy
     OP_bin
+    OP_bin_reuse
     OP_bin_nocopy
+    OP_bin_spill
     OP_enum
+    OP_enum_check
+    OP_length_check
+    OP_fixed
     OP_size
     OP_type
     OP_seek
@@ -37,6 +42,8 @@ const (
     OP_ctr_decr
     OP_ctr_is_zero
     OP_map_alloc
+    OP_map_reuse
+    OP_map_init
     OP_map_close
     OP_map_set_i8
     OP_map_set_i16
@@ -46,7 +53,9 @@ const (
     OP_map_set_enum
     OP_map_set_pointer
     OP_list_alloc
+    OP_list_init
     OP_struct_skip
+    OP_struct_unknown
     OP_struct_ignore
     OP_struct_bitmap
     OP_struct_switch
@@ -55,13 +64,29 @@ const (
     OP_struct_mark_tag
     OP_struct_read_type
     OP_struct_check_type
+    OP_struct_union
+    OP_struct_group
     OP_make_state
     OP_drop_state
     OP_construct
     OP_initialize
+    OP_default_int
+    OP_default_str
+    OP_default_bin
     OP_defer
+    OP_yield
     OP_goto
     OP_halt
+    OP_size_chk
+    OP_str_chk
+    OP_str_nocopy_chk
+    OP_bin_chk
+    OP_bin_reuse_chk
+    OP_bin_nocopy_chk
+    OP_bin_spill_chk
+    OP_ctr_load_chk
+    OP_map_set_str_chk
+    OP_defer_chk
 )
 
 var _OpNames = [256]string {
@@ -69,8 +94,13 @@ var _OpNames = [256]string {
     OP_str               : "str",
     OP_str_nocopy        : "str_nocopy",
     OP_bin               : "bin",
+    OP_bin_reuse         : "bin_reuse",
     OP_bin_nocopy        : "bin_nocopy",
+    OP_bin_spill         : "bin_spill",
     OP_enum              : "enum",
+    OP_enum_check        : "enum_check",
+    OP_length_check      : "length_check",
+    OP_fixed             : "fixed",
     OP_size              : "size",
     OP_type              : "type",
     OP_seek              : "seek",
@@ -79,6 +109,8 @@ var _OpNames = [256]string {
     OP_ctr_decr          : "ctr_decr",
     OP_ctr_is_zero       : "ctr_is_zero",
     OP_map_alloc         : "map_alloc",
+    OP_map_reuse         : "map_reuse",
+    OP_map_init          : "map_init",
     OP_map_close         : "map_close",
     OP_map_set_i8        : "map_set_i8",
     OP_map_set_i16       : "map_set_i16",
@@ -88,7 +120,9 @@ var _OpNames = [256]string {
     OP_map_set_enum      : "map_set_enum",
     OP_map_set_pointer   : "map_set_pointer",
     OP_list_alloc        : "list_alloc",
+    OP_list_init         : "list_init",
     OP_struct_skip       : "struct_skip",
+    OP_struct_unknown    : "struct_unknown",
     OP_struct_ignore     : "struct_ignore",
     OP_struct_bitmap     : "struct_bitmap",
     OP_struct_switch     : "struct_switch",
@@ -97,13 +131,29 @@ var _OpNames = [256]string {
     OP_struct_mark_tag   : "struct_mark_tag",
     OP_struct_read_type  : "struct_read_type",
     OP_struct_check_type : "struct_check_type",
+    OP_struct_union      : "struct_union",
+    OP_struct_group      : "struct_group",
     OP_make_state        : "make_state",
     OP_drop_state        : "drop_state",
     OP_construct         : "construct",
     OP_initialize        : "initialize",
+    OP_default_int       : "default_int",
+    OP_default_str       : "default_str",
+    OP_default_bin       : "default_bin",
     OP_defer             : "defer",
+    OP_yield             : "yield",
     OP_goto              : "goto",
     OP_halt              : "halt",
+    OP_size_chk          : "size_chk",
+    OP_str_chk           : "str_chk",
+    OP_str_nocopy_chk    : "str_nocopy_chk",
+    OP_bin_chk           : "bin_chk",
+    OP_bin_reuse_chk     : "bin_reuse_chk",
+    OP_bin_nocopy_chk    : "bin_nocopy_chk",
+    OP_bin_spill_chk     : "bin_spill_chk",
+    OP_ctr_load_chk      : "ctr_load_chk",
+    OP_map_set_str_chk   : "map_set_str_chk",
+    OP_defer_chk         : "defer_chk",
 }
 
 var _OpBranches = [256]bool {
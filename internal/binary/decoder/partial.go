@@ -0,0 +1,92 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package decoder
+
+import (
+    `fmt`
+    `reflect`
+    `runtime`
+    `sync/atomic`
+    `time`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/opts`
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+// PartialDecoder decodes a projection of a struct: only the selected fields are
+// decoded, and all the other fields are skipped without any allocation, as if
+// they were unknown to the struct.
+type PartialDecoder struct {
+    vt *rt.GoType
+    cc unsafe.Pointer
+}
+
+// CompilePartial compiles a PartialDecoder for struct type vt which decodes
+// only the fields in ids. Nested structs are always decoded as a whole.
+func CompilePartial(vt reflect.Type, ids []uint16) (*PartialDecoder, error) {
+    if vt.Kind() != reflect.Struct {
+        return nil, fmt.Errorf("frugal: partial decoding is only applicable to structs, not %s", vt)
+    }
+
+    /* the skipped fields are unknown to the projection, they must not be rejected */
+    op := opts.GetDefaultOptions()
+    op.RejectUnknown = false
+    ts := time.Now()
+
+    /* compile the projected program */
+    pp, err := CreateCompiler().Apply(op).Project(ids).CompileAndFree(vt)
+
+    /* check for compilation errors */
+    if err != nil {
+        return nil, err
+    }
+
+    /* translate and link the program */
+    cc, nb := linkProgram(rt.UnpackType(vt), pp)
+    emitCompileEvent(rt.UnpackType(vt), nb, ts)
+    return &PartialDecoder { vt: rt.UnpackType(reflect.PtrTo(vt)), cc: unsafe.Pointer(cc) }, nil
+}
+
+func (self *PartialDecoder) decode(_ *rt.GoType, buf unsafe.Pointer, nb int, i int, p unsafe.Pointer, rs *RuntimeState, st int) (int, error) {
+    if cc := (*_Codec)(atomic.LoadPointer(&self.cc)); cc == nil {
+        return 0, fmt.Errorf("frugal: partial decoder of %s has been released", rt.PtrElem(self.vt))
+    } else {
+        ret, err := cc.fn(buf, nb, i, p, rs, st)
+        runtime.KeepAlive(cc)
+        return ret, err
+    }
+}
+
+// Decode deserializes the selected fields in buf into val, which must be a
+// pointer to the struct this decoder is compiled for.
+func (self *PartialDecoder) Decode(buf []byte, val interface{}) (int, error) {
+    if vt := rt.UnpackEface(val).Type; vt != nil && vt != self.vt {
+        err := fmt.Errorf("frugal: partial decoder of %s can not decode into %s", rt.PtrElem(self.vt), vt)
+        emitErrorEvent(err)
+        return 0, err
+    } else {
+        return decodeObject(buf, val, self.decode)
+    }
+}
+
+// Release drops the generated code, it is freed once the in-flight calls
+// return. The decoder can not be used afterwards.
+func (self *PartialDecoder) Release() {
+    atomic.StorePointer(&self.cc, nil)
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+    `fmt`
+    `runtime`
+    `sync/atomic`
+    `time`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/opts`
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
+    `github.com/cloudwego/frugal/iov`
+)
+
+// Config is the set of options of a Pipeline, they are fixed once the Pipeline
+// is created.
+type Config struct {
+    MaxAllocBytes int       // allocation budget of every message, 0 means the global budget
+    ZeroCopy      bool      // strings and binaries refer to the input buffer instead of being copied
+    Checked       bool      // every read from the input buffer is bounds-checked
+    Fields        []uint16  // only decode these fields of the outermost struct, nil means all
+    SpillSize     int            // iov.Blob values longer than this are moved to SpillSink
+    SpillSink     iov.SpillSink  // where to move large iov.Blob values, nil means never
+}
+
+// Pipeline is a decoder with its own set of options. It is safe for concurrent use.
+//
+// Programs are compiled separately from the shared ones only when the options
+// change the generated code, that is ZeroCopy, Fields, SpillSink or MaxAllocBytes.
+// Nested structs are inlined into these programs as deep as possible. Recursive
+// types, which can not be inlined, are decoded with the shared programs, so
+// neither ZeroCopy nor spilling apply to them, and they are only charged to the
+// budget if the shared programs were compiled with SetMaxAllocBytes.
+type Pipeline struct {
+    cf Config
+    ab uint64
+    fn DecodeFunc
+    pc unsafe.Pointer
+}
+
+// NewPipeline creates a Pipeline with the options in cf.
+func NewPipeline(cf Config) *Pipeline {
+    ret := &Pipeline {
+        cf: cf,
+        ab: allocBudget(),
+        fn: decode,
+    }
+
+    /* the allocation budget */
+    if cf.MaxAllocBytes > 0 {
+        ret.ab = uint64(cf.MaxAllocBytes)
+    }
+
+    /* use the shared programs if possible */
+    switch {
+        case cf.ZeroCopy || cf.Fields != nil || cf.SpillSink != nil || cf.MaxAllocBytes > 0 : ret.fn, ret.pc = ret.decode, unsafe.Pointer(utils.CreateProgramCache())
+        case cf.Checked                                                                     : ret.fn = decode_chk
+    }
+
+    /* all done */
+    return ret
+}
+
+func (self *Pipeline) decode(vt *rt.GoType, buf unsafe.Pointer, nb int, i int, p unsafe.Pointer, rs *RuntimeState, st int) (int, error) {
+    if pc := (*utils.ProgramCache)(atomic.LoadPointer(&self.pc)); pc == nil {
+        return 0, fmt.Errorf("frugal: decoder of %s has been released", vt)
+    } else if pp, err := pc.Compute(vt, self.compile); err != nil {
+        return 0, err
+    } else {
+        ret, err := pp.(*_Codec).fn(buf, nb, i, p, rs, st)
+        runtime.KeepAlive(pp)
+        return ret, err
+    }
+}
+
+func (self *Pipeline) compile(vt *rt.GoType) (interface{}, error) {
+    ts := time.Now()
+    op := opts.GetDefaultOptions()
+    cc := CreateCompiler()
+
+    /* inline everything, so the options apply to nested structs as well */
+    op.MaxInlineDepth = 0
+    op.MaxInlineILSize = 0
+
+    /* charge the allocations if this Pipeline has its own budget */
+    if self.cf.MaxAllocBytes > 0 {
+        op.AllocBudget = true
+    }
+
+    /* the skipped fields are unknown to the projection, they must not be rejected */
+    if self.cf.Fields != nil {
+        cc.Project(self.cf.Fields)
+        op.RejectUnknown = false
+    }
+
+    /* strings and binaries refer to the input buffer */
+    if self.cf.ZeroCopy {
+        cc.ZeroCopy()
+    }
+
+    /* the programs are only reachable from this Pipeline, which keeps the sink alive */
+    if self.cf.SpillSink != nil {
+        cc.Spill(self.cf.SpillSize, &self.cf.SpillSink)
+    }
+
+    /* compile the program */
+    pp, err := cc.Apply(op).CompileAndFree(vt.Pack())
+
+    /* check for compilation errors */
+    if err != nil {
+        return nil, err
+    }
+
+    /* harden the program if needed */
+    if self.cf.Checked {
+        pp = Harden(pp)
+    }
+
+    /* translate and link the program */
+    ret, nb := linkProgram(vt, pp)
+    emitCompileEvent(vt, nb, ts)
+    return ret, nil
+}
+
+// Decode deserializes buf into val with the options of this Pipeline.
+func (self *Pipeline) Decode(buf []byte, val interface{}) (int, error) {
+    return decodeObjectBudget(buf, val, self.fn, self.ab)
+}
+
+// Release drops the programs compiled for this Pipeline, they are freed once
+// the in-flight calls return. It can not be used afterwards if it has any.
+func (self *Pipeline) Release() {
+    atomic.StorePointer(&self.pc, nil)
+}
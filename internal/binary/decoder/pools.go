@@ -67,6 +67,12 @@ func allocCompiler() *Compiler {
 
 func resetCompiler(p *Compiler) *Compiler {
     p.o = opts.GetDefaultOptions()
+    p.f = _EnumField{}
+    p.x = nil
+    p.z = false
+    p.n = 0
+    p.s = nil
+    p.u = 0
     rt.MapClear(p.t)
     rt.MapClear(p.d)
     return p
@@ -118,6 +124,9 @@ func newRuntimeState() *RuntimeState {
 }
 
 func freeRuntimeState(p *RuntimeState) {
+    p.Yp = 0
+    p.Ab = 0
+    p.Sb = 0
     runtimeStatePool.Put(p)
 }
 
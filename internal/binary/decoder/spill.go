@@ -0,0 +1,38 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/iov`
+)
+
+func bin_spill(sk *iov.SpillSink, buf unsafe.Pointer, nb int, vp *iov.Blob) error {
+    if hd, err := (*sk).Spill(rt.BytesFrom(buf, nb, nb)); err != nil {
+        return err
+    } else {
+        vp.Data, vp.Spilled = nil, hd
+        return nil
+    }
+}
+
+var (
+    F_bin_spill = hir.RegisterGCall(bin_spill, nil)
+)
@@ -34,6 +34,9 @@ const (
     SkOffset = int64(unsafe.Offsetof(RuntimeState{}.Sk))
     PrOffset = int64(unsafe.Offsetof(RuntimeState{}.Pr))
     IvOffset = int64(unsafe.Offsetof(RuntimeState{}.Iv))
+    YpOffset = int64(unsafe.Offsetof(RuntimeState{}.Yp))
+    AbOffset = int64(unsafe.Offsetof(RuntimeState{}.Ab))
+    SbOffset = int64(unsafe.Offsetof(RuntimeState{}.Sb))
 )
 
 const (
@@ -60,4 +63,7 @@ type RuntimeState struct {
     Sk [defs.StackSize]SkipItem     // Skip buffer, used for non-recursive skipping
     Pr unsafe.Pointer               // Pointer spill space, used for non-fast string or pointer map access.
     Iv uint64                       // Integer spill space, used for non-fast string map access.
+    Yp uint64                       // Input cursor of the last yield, used for cooperative yielding.
+    Ab uint64                       // Complement of the remaining allocation budget in bytes, so that zero means unlimited.
+    Sb uint64                       // Bytes of the unknown fields that were skipped, including the field headers.
 }
@@ -18,11 +18,14 @@ package decoder
 
 import (
     `fmt`
+    `math`
     `reflect`
+    `strconv`
 
     `github.com/cloudwego/frugal/internal/atm/hir`
     `github.com/cloudwego/frugal/internal/binary/defs`
     `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
 )
 
 /** Function Prototype
@@ -73,13 +76,18 @@ const (
 )
 
 const (
-    LB_eof      = "_eof"
-    LB_halt     = "_halt"
-    LB_type     = "_type"
-    LB_skip     = "_skip"
-    LB_error    = "_error"
-    LB_missing  = "_missing"
-    LB_overflow = "_overflow"
+    LB_abort     = "_abort_"
+    LB_eof       = "_eof"
+    LB_halt      = "_halt"
+    LB_type      = "_type"
+    LB_skip      = "_skip"
+    LB_error     = "_error"
+    LB_missing   = "_missing"
+    LB_group     = "_group"
+    LB_overflow  = "_overflow"
+    LB_budget    = "_budget"
+    LB_truncated = "_truncated"
+    LB_corrupted = "_corrupted"
 )
 
 var (
@@ -99,6 +107,7 @@ func Translate(s Program) hir.Program {
     program  (p, s)
     epilogue (p)
     errors   (p)
+    aborts   (p, s)
     return p.Build()
 }
 
@@ -124,6 +133,27 @@ func errors(p *hir.Builder) {
       R0    (ET).
       R1    (EP)
     p.JMP   (LB_error)
+    p.Label (LB_budget)
+    p.GCALL (F_error_budget).
+      A0    (TR).
+      A1    (UR).
+      R0    (ET).
+      R1    (EP)
+    p.JMP   (LB_error)
+    p.Label (LB_truncated)
+    p.SUB   (TR, UR, TR)
+    p.GCALL (F_error_truncated).
+      A0    (TR).
+      R0    (ET).
+      R1    (EP)
+    p.JMP   (LB_error)
+    p.Label (LB_corrupted)
+    p.GCALL (F_error_corrupted).
+      A0    (TR).
+      A1    (UR).
+      R0    (ET).
+      R1    (EP)
+    p.JMP   (LB_error)
     p.Label (LB_missing)
     p.GCALL (F_error_missing).
       A0    (ET).
@@ -132,6 +162,14 @@ func errors(p *hir.Builder) {
       R0    (ET).
       R1    (EP)
     p.JMP   (LB_error)
+    p.Label (LB_group)
+    p.GCALL (F_error_group).
+      A0    (ET).
+      A1    (UR).
+      A2    (TP).
+      R0    (ET).
+      R1    (EP)
+    p.JMP   (LB_error)
     p.Label (LB_overflow)
     p.IP    (&_E_overflow, TP)
     p.LP    (TP, 0, ET)
@@ -139,6 +177,49 @@ func errors(p *hir.Builder) {
     p.JMP   (LB_error)
 }
 
+func aborts(p *hir.Builder, s Program) {
+    var vt *rt.GoType
+
+    /* find the type this program was compiled for */
+    for _, v := range s {
+        if v.Op == OP_halt {
+            vt = v.Vt
+        }
+    }
+
+    /* one out-of-line abort stub for each checked instruction */
+    for i, v := range s {
+        ty := v.Vt
+        id := int(v.Id)
+        ec := utils.AbortUnderflow
+
+        /* only drop_state and halt are checked */
+        switch v.Op {
+            case OP_drop_state : break
+            case OP_halt       : id, ec = -1, utils.AbortUnbalanced
+            default            : continue
+        }
+
+        /* instructions outside of any field belong to the program type */
+        if ty == nil {
+            ty, id = vt, -1
+        }
+
+        /* abort never returns, the jump only terminates the block */
+        p.Label (LB_abort + strconv.Itoa(i))
+        p.IP    (ty, TP)
+        p.IQ    (int64(id), TR)
+        p.IQ    (int64(i), UR)
+        p.IQ    (int64(ec), TG)
+        p.GCALL (F_abort).
+          A0    (TP).
+          A1    (TR).
+          A2    (UR).
+          A3    (TG)
+        p.JMP   (LB_halt)
+    }
+}
+
 func program(p *hir.Builder, s Program) {
     for i, v := range s {
         p.Mark(i)
@@ -172,8 +253,13 @@ var translators = [256]func(*hir.Builder, Instr) {
     OP_str               : translate_OP_str,
     OP_str_nocopy        : translate_OP_str_nocopy,
     OP_bin               : translate_OP_bin,
+    OP_bin_reuse         : translate_OP_bin_reuse,
     OP_bin_nocopy        : translate_OP_bin_nocopy,
+    OP_bin_spill         : translate_OP_bin_spill,
     OP_enum              : translate_OP_enum,
+    OP_enum_check        : translate_OP_enum_check,
+    OP_length_check      : translate_OP_length_check,
+    OP_fixed             : translate_OP_fixed,
     OP_size              : translate_OP_size,
     OP_type              : translate_OP_type,
     OP_seek              : translate_OP_seek,
@@ -182,6 +268,8 @@ var translators = [256]func(*hir.Builder, Instr) {
     OP_ctr_decr          : translate_OP_ctr_decr,
     OP_ctr_is_zero       : translate_OP_ctr_is_zero,
     OP_map_alloc         : translate_OP_map_alloc,
+    OP_map_reuse         : translate_OP_map_reuse,
+    OP_map_init          : translate_OP_map_init,
     OP_map_close         : translate_OP_map_close,
     OP_map_set_i8        : translate_OP_map_set_i8,
     OP_map_set_i16       : translate_OP_map_set_i16,
@@ -191,7 +279,9 @@ var translators = [256]func(*hir.Builder, Instr) {
     OP_map_set_enum      : translate_OP_map_set_enum,
     OP_map_set_pointer   : translate_OP_map_set_pointer,
     OP_list_alloc        : translate_OP_list_alloc,
+    OP_list_init         : translate_OP_list_init,
     OP_struct_skip       : translate_OP_struct_skip,
+    OP_struct_unknown    : translate_OP_struct_unknown,
     OP_struct_ignore     : translate_OP_struct_ignore,
     OP_struct_bitmap     : translate_OP_struct_bitmap,
     OP_struct_switch     : translate_OP_struct_switch,
@@ -200,13 +290,29 @@ var translators = [256]func(*hir.Builder, Instr) {
     OP_struct_mark_tag   : translate_OP_struct_mark_tag,
     OP_struct_read_type  : translate_OP_struct_read_type,
     OP_struct_check_type : translate_OP_struct_check_type,
+    OP_struct_union      : translate_OP_struct_union,
+    OP_struct_group      : translate_OP_struct_group,
     OP_make_state        : translate_OP_make_state,
     OP_drop_state        : translate_OP_drop_state,
     OP_construct         : translate_OP_construct,
     OP_initialize        : translate_OP_initialize,
+    OP_default_int       : translate_OP_default_int,
+    OP_default_str       : translate_OP_default_str,
+    OP_default_bin       : translate_OP_default_bin,
     OP_defer             : translate_OP_defer,
+    OP_yield             : translate_OP_yield,
     OP_goto              : translate_OP_goto,
     OP_halt              : translate_OP_halt,
+    OP_size_chk          : translate_OP_size_chk,
+    OP_str_chk           : translate_OP_str_chk,
+    OP_str_nocopy_chk    : translate_OP_str_nocopy_chk,
+    OP_bin_chk           : translate_OP_bin_chk,
+    OP_bin_reuse_chk     : translate_OP_bin_reuse_chk,
+    OP_bin_nocopy_chk    : translate_OP_bin_nocopy_chk,
+    OP_bin_spill_chk     : translate_OP_bin_spill_chk,
+    OP_ctr_load_chk      : translate_OP_ctr_load_chk,
+    OP_map_set_str_chk   : translate_OP_map_set_str_chk,
+    OP_defer_chk         : translate_OP_defer_chk,
 }
 
 func translate_OP_int(p *hir.Builder, v Instr) {
@@ -219,15 +325,17 @@ func translate_OP_int(p *hir.Builder, v Instr) {
     }
 }
 
-func translate_OP_str(p *hir.Builder, _ Instr) {
+func translate_OP_str(p *hir.Builder, v Instr) {
     p.SP    (hir.Pn, WP, 0)
     p.ADDP  (IP, IC, EP)
     p.ADDI  (IC, 4, IC)
     p.LL    (EP, 0, TR)
     p.SWAPL (TR, TR)
+    translate_length(p, "_length_{n}")
     p.LDAQ  (ARG_nb, UR)
     p.BLTU  (UR, TR, LB_eof)
     p.BEQ   (TR, hir.Rz, "_empty_{n}")
+    translate_charge(p, v)
     p.ADDPI (EP, 4, EP)
     p.ADD   (IC, TR, IC)
     p.GCALL (F_slicebytetostring).
@@ -246,16 +354,18 @@ func translate_OP_str_nocopy(p *hir.Builder, _ Instr) {
     translate_OP_binstr_nocopy(p)
 }
 
-func translate_OP_bin(p *hir.Builder, _ Instr) {
+func translate_OP_bin(p *hir.Builder, v Instr) {
     p.IP    (&_V_zerovalue, TP)
     p.SP    (TP, WP, 0)
     p.ADDP  (IP, IC, EP)
     p.ADDI  (IC, 4, IC)
     p.LL    (EP, 0, TR)
     p.SWAPL (TR, TR)
+    translate_length(p, "_length_{n}")
     p.LDAQ  (ARG_nb, UR)
     p.BLTU  (UR, TR, LB_eof)
     p.BEQ   (TR, hir.Rz, "_empty_{n}")
+    translate_charge(p, v)
     p.ADDPI (EP, 4, EP)
     p.ADD   (IC, TR, IC)
     p.IP    (_T_byte, TP)
@@ -271,6 +381,45 @@ func translate_OP_bin(p *hir.Builder, _ Instr) {
     p.SQ    (TR, WP, 16)
 }
 
+func translate_OP_bin_reuse(p *hir.Builder, v Instr) {
+    p.ADDP  (IP, IC, EP)
+    p.ADDI  (IC, 4, IC)
+    p.LL    (EP, 0, TR)
+    p.SWAPL (TR, TR)
+    translate_length(p, "_length_{n}")
+    p.LDAQ  (ARG_nb, UR)
+    p.BLTU  (UR, TR, LB_eof)
+    p.BEQ   (TR, hir.Rz, "_empty_{n}")
+    p.ADDPI (EP, 4, EP)
+    p.ADD   (IC, TR, IC)
+    p.LQ    (WP, 16, UR)
+    p.BLTU  (UR, TR, "_alloc_{n}")
+    p.LP    (WP, 0, TP)
+    p.BCOPY (EP, TR, TP)
+    p.SQ    (TR, WP, 8)
+    p.JMP   ("_done_{n}")
+    p.Label ("_alloc_{n}")
+    translate_charge(p, v)
+    p.IP    (_T_byte, TP)
+    p.GCALL (F_mallocgc).
+      A0    (TR).
+      A1    (TP).
+      A2    (hir.Rz).
+      R0    (TP)
+    p.BCOPY (EP, TR, TP)
+    p.SP    (TP, WP, 0)
+    p.SQ    (TR, WP, 8)
+    p.SQ    (TR, WP, 16)
+    p.JMP   ("_done_{n}")
+    p.Label ("_empty_{n}")
+    p.SQ    (hir.Rz, WP, 8)
+    p.LP    (WP, 0, TP)
+    p.BNEP  (TP, hir.Pn, "_done_{n}")
+    p.IP    (&_V_zerovalue, TP)
+    p.SP    (TP, WP, 0)
+    p.Label ("_done_{n}")
+}
+
 func translate_OP_bin_nocopy(p *hir.Builder, _ Instr) {
     p.IP    (&_V_zerovalue, TP)
     p.SP    (TP, WP, 0)
@@ -278,11 +427,41 @@ func translate_OP_bin_nocopy(p *hir.Builder, _ Instr) {
     p.SQ    (TR, WP, 16)
 }
 
+func translate_OP_bin_spill(p *hir.Builder, v Instr) {
+    p.ADDP  (IP, IC, EP)
+    p.LL    (EP, 0, TR)
+    p.SWAPL (TR, TR)
+    translate_length(p, "_length_spill_{n}")
+    p.IQ    (v.Iv, UR)
+    p.BLTU  (UR, TR, "_spill_{n}")
+    p.SP    (hir.Pn, WP, defs.BlobHandleOffset)
+    p.SP    (hir.Pn, WP, defs.BlobHandleOffset + 8)
+    translate_OP_bin(p, v)
+    p.JMP   ("_done_{n}")
+    p.Label ("_spill_{n}")
+    p.LDAQ  (ARG_nb, UR)
+    p.BLTU  (UR, TR, LB_eof)
+    p.ADDPI (EP, 4, EP)
+    p.ADDI  (IC, 4, IC)
+    p.ADD   (IC, TR, IC)
+    p.IP    (v.Fn, TP)
+    p.GCALL (F_bin_spill).
+      A0    (TP).
+      A1    (EP).
+      A2    (TR).
+      A3    (WP).
+      R0    (ET).
+      R1    (EP)
+    p.BNEP  (ET, hir.Pn, LB_error)
+    p.Label ("_done_{n}")
+}
+
 func translate_OP_binstr_nocopy(p *hir.Builder) {
     p.ADDP  (IP, IC, EP)
     p.ADDI  (IC, 4, IC)
     p.LL    (EP, 0, TR)
     p.SWAPL (TR, TR)
+    translate_length(p, "_length_{n}")
     p.LDAQ  (ARG_nb, UR)
     p.BLTU  (UR, TR, LB_eof)
     p.BEQ   (TR, hir.Rz, "_empty_{n}")
@@ -302,6 +481,52 @@ func translate_OP_enum(p *hir.Builder, _ Instr) {
     p.ADDI  (IC, 4, IC)
 }
 
+func translate_OP_enum_check(p *hir.Builder, v Instr) {
+    p.ADDP  (IP, IC, EP)
+    p.LL    (EP, 0, TR)
+    p.SWAPL (TR, TR)
+    p.SXLQ  (TR, TR)
+    p.IP    (v.Fn, TP)
+    p.GCALL (F_check_enum).
+      A0    (TP).
+      A1    (TR).
+      R0    (ET).
+      R1    (EP)
+    p.BNEP  (ET, hir.Pn, LB_error)
+}
+
+func translate_OP_length_check(p *hir.Builder, v Instr) {
+    p.ADDP  (IP, IC, EP)
+    p.LL    (EP, 0, TR)
+    p.SWAPL (TR, TR)
+    p.IQ    (math.MaxInt32, UR)
+    p.BGEU  (UR, TR, "_done_{n}")
+    p.IP    (v.Vt, ET)
+    p.IQ    (int64(v.Id), UR)
+    p.GCALL (F_error_length).
+      A0    (ET).
+      A1    (UR).
+      A2    (IC).
+      A3    (TR).
+      R0    (ET).
+      R1    (EP)
+    p.JMP   (LB_error)
+    p.Label ("_done_{n}")
+}
+
+func translate_OP_fixed(p *hir.Builder, v Instr) {
+    p.ADDP  (IP, IC, EP)
+    p.LQ    (EP, 0, TR)
+    p.SWAPQ (TR, TR)
+    p.IQ    (v.Iv, UR)
+    p.GCALL (F_fixedtof64).
+      A0    (TR).
+      A1    (UR).
+      R0    (TR)
+    p.SQ    (TR, WP, 0)
+    p.ADDI  (IC, 8, IC)
+}
+
 func translate_OP_size(p *hir.Builder, v Instr) {
     p.IQ    (v.Iv, TR)
     p.LDAQ  (ARG_nb, UR)
@@ -323,9 +548,10 @@ func translate_OP_seek(p *hir.Builder, v Instr) {
 func translate_OP_deref(p *hir.Builder, v Instr) {
     p.LQ    (WP, 0, TR)
     p.BNE   (TR, hir.Rz, "_skip_{n}")
+    p.IQ    (int64(v.Vt.Size), TR)
+    translate_charge(p, v)
     p.IB    (1, UR)
     p.IP    (v.Vt, TP)
-    p.IQ    (int64(v.Vt.Size), TR)
     p.GCALL (F_mallocgc).
       A0    (TR).
       A1    (TP).
@@ -336,11 +562,35 @@ func translate_OP_deref(p *hir.Builder, v Instr) {
     p.LP    (WP, 0, WP)
 }
 
+func translate_charge(p *hir.Builder, v Instr) {
+    if !v.Ab {
+        return
+    }
+
+    /* charge TR bytes to the allocation budget */
+    p.LQ    (RS, AbOffset, UR)
+    p.XORI  (UR, -1, UR)
+    p.BLTU  (UR, TR, LB_budget)
+    p.SUB   (UR, TR, UR)
+    p.XORI  (UR, -1, UR)
+    p.SQ    (UR, RS, AbOffset)
+}
+
+/* negative lengths are rejected by a preceding `length_check` unless
+ * the lenient mode is enabled, in which case they are decoded as zero */
+func translate_length(p *hir.Builder, lb string) {
+    p.IQ    (math.MaxInt32, UR)
+    p.BGEU  (UR, TR, lb)
+    p.MOV   (hir.Rz, TR)
+    p.Label (lb)
+}
+
 func translate_OP_ctr_load(p *hir.Builder, _ Instr) {
     p.ADDP  (IP, IC, EP)
     p.ADDI  (IC, 4, IC)
     p.LL    (EP, 0, TR)
     p.SWAPL (TR, TR)
+    translate_length(p, "_length_{n}")
     p.ADDP  (RS, ST, TP)
     p.SQ    (TR, TP, NbOffset)
 }
@@ -359,8 +609,18 @@ func translate_OP_ctr_is_zero(p *hir.Builder, v Instr) {
 }
 
 func translate_OP_map_alloc(p *hir.Builder, v Instr) {
+    mt := rt.MapType(v.Vt)
     p.ADDP  (RS, ST, TP)
     p.LQ    (TP, NbOffset, TR)
+
+    /* the budget is charged with the size of all the entries */
+    if v.Ab {
+        p.MULI  (TR, int64(mt.Key.Size + mt.Elem.Size), TR)
+        translate_charge(p, v)
+        p.LQ    (TP, NbOffset, TR)
+    }
+
+    /* allocate the map */
     p.IP    (v.Vt, ET)
     p.GCALL (F_makemap).
       A0    (ET).
@@ -372,6 +632,35 @@ func translate_OP_map_alloc(p *hir.Builder, v Instr) {
     p.SP    (TP, EP, MpOffset)
 }
 
+func translate_OP_map_reuse(p *hir.Builder, v Instr) {
+    p.LP    (WP, 0, TP)
+    p.BEQP  (TP, hir.Pn, "_alloc_{n}")
+    p.IP    (v.Vt, ET)
+    p.GCALL (F_mapclear).
+      A0    (ET).
+      A1    (TP)
+    p.LP    (WP, 0, TP)
+    p.ADDP  (RS, ST, EP)
+    p.SP    (TP, EP, MpOffset)
+    p.JMP   ("_done_{n}")
+    p.Label ("_alloc_{n}")
+    translate_OP_map_alloc(p, v)
+    p.Label ("_done_{n}")
+}
+
+func translate_OP_map_init(p *hir.Builder, v Instr) {
+    p.LP    (WP, 0, TP)
+    p.BNEP  (TP, hir.Pn, "_done_{n}")
+    p.IP    (v.Vt, ET)
+    p.GCALL (F_makemap).
+      A0    (ET).
+      A1    (hir.Rz).
+      A2    (hir.Pn).
+      R0    (TP)
+    p.SP    (TP, WP, 0)
+    p.Label ("_done_{n}")
+}
+
 func translate_OP_map_close(p *hir.Builder, _ Instr) {
     p.ADDP  (RS, ST, TP)
     p.SP    (hir.Pn, TP, MpOffset)
@@ -500,6 +789,7 @@ func translate_OP_map_set_str_fast(p *hir.Builder, v Instr) {
     p.ADDI  (IC, 4, IC)
     p.LL    (EP, 0, TR)
     p.SWAPL (TR, TR)
+    translate_length(p, "_length_{n}")
     p.LDAQ  (ARG_nb, UR)
     p.BLTU  (UR, TR, LB_eof)
     p.MOVP  (hir.Pn, EP)
@@ -529,6 +819,7 @@ func translate_OP_map_set_str_safe(p *hir.Builder, v Instr) {
     p.ADDI  (IC, 4, IC)
     p.LL    (ET, 0, TR)
     p.SWAPL (TR, TR)
+    translate_length(p, "_length_{n}")
     p.LDAQ  (ARG_nb, UR)
     p.BLTU  (UR, TR, LB_eof)
     p.SQ    (TR, RS, IvOffset)
@@ -645,9 +936,10 @@ func translate_OP_list_alloc(p *hir.Builder, v Instr) {
     p.Label ("_alloc_{n}")
     p.BGEU  (UR, TR, "_done_{n}")
     p.SQ    (TR, WP, 16)
+    p.MULI  (TR, int64(v.Vt.Size), TR)
+    translate_charge(p, v)
     p.IB    (1, UR)
     p.IP    (v.Vt, TP)
-    p.MULI  (TR, int64(v.Vt.Size), TR)
     p.GCALL (F_mallocgc).
       A0    (TR).
       A1    (TP).
@@ -658,7 +950,15 @@ func translate_OP_list_alloc(p *hir.Builder, v Instr) {
     p.LP    (WP, 0, WP)
 }
 
-func translate_OP_struct_skip(p *hir.Builder, _ Instr) {
+func translate_OP_list_init(p *hir.Builder, _ Instr) {
+    p.LP    (WP, 0, TP)
+    p.BNEP  (TP, hir.Pn, "_done_{n}")
+    p.IP    (&_V_zerovalue, TP)
+    p.SP    (TP, WP, 0)
+    p.Label ("_done_{n}")
+}
+
+func translate_OP_struct_skip(p *hir.Builder, v Instr) {
     p.ADDPI (RS, SkOffset, TP)
     p.LDAQ  (ARG_nb, TR)
     p.SUB   (TR, IC, TR)
@@ -671,6 +971,25 @@ func translate_OP_struct_skip(p *hir.Builder, _ Instr) {
       R0    (TR)
     p.BLT   (TR, hir.Rz, LB_skip)
     p.ADD   (IC, TR, IC)
+
+    /* count the skipped bytes if enabled */
+    if v.Iv != 0 {
+        p.LQ    (RS, SbOffset, UR)
+        p.ADD   (UR, TR, UR)
+        p.ADDI  (UR, 3, UR)
+        p.SQ    (UR, RS, SbOffset)
+    }
+}
+
+func translate_OP_struct_unknown(p *hir.Builder, v Instr) {
+    p.IP    (v.Vt, TP)
+    p.GCALL (F_error_unknown).
+      A0    (TP).
+      A1    (TR).
+      A2    (TG).
+      R0    (ET).
+      R1    (EP)
+    p.JMP   (LB_error)
 }
 
 func translate_OP_struct_ignore(p *hir.Builder, _ Instr) {
@@ -791,6 +1110,87 @@ func translate_OP_struct_check_type(p *hir.Builder, v Instr) {
     p.BNE   (TG, TR, p.At(v.To))
 }
 
+func translate_OP_struct_union(p *hir.Builder, v Instr) {
+    var err error
+    var fvs []defs.Field
+
+    /* resolve the fields, this never fails since the struct is already compiled */
+    if fvs, err = defs.ResolveFields(v.Vt.Pack()); err != nil {
+        panic(err)
+    }
+
+    /* clear every other field that might have been set */
+    for _, fv := range fvs {
+        if fv.ID != v.Id && fv.IsNillable() {
+            switch fv.Type.T {
+                case defs.T_map     : p.SP(hir.Pn, WP, int64(fv.F))
+                case defs.T_pointer : p.SP(hir.Pn, WP, int64(fv.F))
+                default             : p.SP(hir.Pn, WP, int64(fv.F)); p.SQ(hir.Rz, WP, int64(fv.F) + 8); p.SQ(hir.Rz, WP, int64(fv.F) + 16)
+            }
+        }
+    }
+}
+
+func translate_OP_struct_group(p *hir.Builder, v Instr) {
+    var wv []int64
+    var bv []int64
+
+    buf := newFieldBitmap()
+    buf.Clear()
+
+    /* add all the bits */
+    for _, i := range v.IntSeq() {
+        buf.Append(i)
+    }
+
+    /* collect the words with bits */
+    for i := int64(0); i < MaxBitmap; i++ {
+        if buf[i] != 0 {
+            wv = append(wv, i)
+            bv = append(bv, buf[i])
+        }
+    }
+
+    /* release the buffer */
+    buf.Clear()
+    buf.Free()
+
+    /* load the bitmap, and the arguments in case of errors */
+    p.ADDP  (RS, ST, EP)
+    p.LP    (EP, FmOffset, TP)
+    p.IP    (v.Vt, ET)
+    p.IQ    (int64(v.Id), UR)
+
+    /* the first word decides whether the group is present or absent */
+    p.LQ    (TP, wv[0] * 8, TR)
+    p.ANDI  (TR, bv[0], TR)
+    p.BEQ   (TR, hir.Rz, "_absent_{n}")
+    p.XORI  (TR, bv[0], TR)
+    p.BNE   (TR, hir.Rz, LB_group)
+
+    /* present, all the other bits must be set */
+    for i := 1; i < len(wv); i++ {
+        p.LQ    (TP, wv[i] * 8, TR)
+        p.ANDI  (TR, bv[i], TR)
+        p.XORI  (TR, bv[i], TR)
+        p.BNE   (TR, hir.Rz, LB_group)
+    }
+
+    /* absent, all the other bits must be cleared */
+    p.JMP   ("_done_{n}")
+    p.Label ("_absent_{n}")
+
+    /* check the other words */
+    for i := 1; i < len(wv); i++ {
+        p.LQ    (TP, wv[i] * 8, TR)
+        p.ANDI  (TR, bv[i], TR)
+        p.BNE   (TR, hir.Rz, LB_group)
+    }
+
+    /* all done */
+    p.Label ("_done_{n}")
+}
+
 func translate_OP_make_state(p *hir.Builder, _ Instr) {
     p.IQ    (StateMax, TR)
     p.BGEU  (ST, TR, LB_overflow)
@@ -801,15 +1201,18 @@ func translate_OP_make_state(p *hir.Builder, _ Instr) {
 
 func translate_OP_drop_state(p *hir.Builder, _ Instr) {
     p.SUBI  (ST, StateSize, ST)
+    p.LDAQ  (ARG_st, TR)
+    p.BLT   (ST, TR, LB_abort + strconv.Itoa(p.Pc()))
     p.ADDP  (RS, ST, TP)
     p.LP    (TP, WpOffset, WP)
     p.SP    (hir.Pn, TP, WpOffset)
 }
 
 func translate_OP_construct(p *hir.Builder, v Instr) {
+    p.IQ    (int64(v.Vt.Size), TR)
+    translate_charge(p, v)
     p.IB    (1, UR)
     p.IP    (v.Vt, TP)
-    p.IQ    (int64(v.Vt.Size), TR)
     p.GCALL (F_mallocgc).
       A0    (TR).
       A1    (TP).
@@ -822,10 +1225,55 @@ func translate_OP_initialize(p *hir.Builder, v Instr) {
       A0    (WP)
 }
 
+func translate_OP_default_int(p *hir.Builder, v Instr) {
+    p.IP    ((*byte)(v.Fn), TP)
+    switch v.Iv {
+        case 1  : p.LB(TP, 0, TR); p.SB(TR, WP, 0)
+        case 2  : p.LW(TP, 0, TR); p.SW(TR, WP, 0)
+        case 4  : p.LL(TP, 0, TR); p.SL(TR, WP, 0)
+        case 8  : p.LQ(TP, 0, TR); p.SQ(TR, WP, 0)
+        default : panic("can only copy 1, 2, 4 or 8 bytes at a time")
+    }
+}
+
+func translate_OP_default_str(p *hir.Builder, v Instr) {
+    p.IP    ((*string)(v.Fn), TP)
+    p.LP    (TP, 0, EP)
+    p.SP    (EP, WP, 0)
+    p.LQ    (TP, 8, TR)
+    p.SQ    (TR, WP, 8)
+}
+
+func translate_OP_default_bin(p *hir.Builder, v Instr) {
+    p.IP    (&_V_zerovalue, TP)
+    p.SP    (TP, WP, 0)
+    p.IP    ((*[]byte)(v.Fn), EP)
+    p.LQ    (EP, 8, TR)
+    p.BEQ   (TR, hir.Rz, "_empty_{n}")
+    translate_charge(p, v)
+    p.IP    (_T_byte, TP)
+    p.GCALL (F_mallocgc).
+      A0    (TR).
+      A1    (TP).
+      A2    (hir.Rz).
+      R0    (TP)
+    p.IP    ((*[]byte)(v.Fn), EP)
+    p.LP    (EP, 0, EP)
+    p.BCOPY (EP, TR, TP)
+    p.SP    (TP, WP, 0)
+    p.Label ("_empty_{n}")
+    p.SQ    (TR, WP, 8)
+    p.SQ    (TR, WP, 16)
+}
+
 func translate_OP_defer(p *hir.Builder, v Instr) {
+    translate_defer(p, v, F_decode)
+}
+
+func translate_defer(p *hir.Builder, v Instr, fn *hir.CallHandle) {
     p.IP    (v.Vt, TP)
     p.LDAQ  (ARG_nb, TR)
-    p.GCALL (F_decode).
+    p.GCALL (fn).
       A0    (TP).
       A1    (IP).
       A2    (TR).
@@ -839,10 +1287,87 @@ func translate_OP_defer(p *hir.Builder, v Instr) {
     p.BNEP  (ET, hir.Pn, LB_error)
 }
 
+func translate_OP_yield(p *hir.Builder, v Instr) {
+    p.LQ    (RS, YpOffset, TR)
+    p.SUB   (IC, TR, TR)
+    p.IQ    (v.Iv, UR)
+    p.BLTU  (TR, UR, "_done_{n}")
+    p.SQ    (IC, RS, YpOffset)
+    p.GCALL (F_yield)
+    p.Label ("_done_{n}")
+}
+
 func translate_OP_goto(p *hir.Builder, v Instr) {
     p.JMP   (p.At(v.To))
 }
 
 func translate_OP_halt(p *hir.Builder, _ Instr) {
+    p.LDAQ  (ARG_st, TR)
+    p.BNE   (ST, TR, LB_abort + strconv.Itoa(p.Pc()))
     p.JMP   (LB_halt)
 }
+
+func translate_OP_size_chk(p *hir.Builder, v Instr) {
+    p.ADDI  (IC, v.Iv, TR)
+    p.LDAQ  (ARG_nb, UR)
+    p.BLTU  (UR, TR, LB_truncated)
+}
+
+func translate_OP_str_chk(p *hir.Builder, v Instr) {
+    translate_check_length(p)
+    translate_OP_str(p, v)
+}
+
+func translate_OP_str_nocopy_chk(p *hir.Builder, v Instr) {
+    translate_check_length(p)
+    translate_OP_str_nocopy(p, v)
+}
+
+func translate_OP_bin_chk(p *hir.Builder, v Instr) {
+    translate_check_length(p)
+    translate_OP_bin(p, v)
+}
+
+func translate_OP_bin_reuse_chk(p *hir.Builder, v Instr) {
+    translate_check_length(p)
+    translate_OP_bin_reuse(p, v)
+}
+
+func translate_OP_bin_nocopy_chk(p *hir.Builder, v Instr) {
+    translate_check_length(p)
+    translate_OP_bin_nocopy(p, v)
+}
+
+func translate_OP_bin_spill_chk(p *hir.Builder, v Instr) {
+    translate_check_length(p)
+    translate_OP_bin_spill(p, v)
+}
+
+func translate_OP_map_set_str_chk(p *hir.Builder, v Instr) {
+    translate_check_length(p)
+    translate_OP_map_set_str(p, v)
+}
+
+func translate_OP_ctr_load_chk(p *hir.Builder, v Instr) {
+    translate_OP_ctr_load(p, v)
+    p.LDAQ  (ARG_nb, UR)
+    p.SUB   (UR, IC, UR)
+    p.BLTU  (UR, TR, LB_corrupted)
+}
+
+func translate_OP_defer_chk(p *hir.Builder, v Instr) {
+    translate_defer(p, v, F_decode_chk)
+}
+
+/* the length prefix must have been checked by a preceding `size 4`, so
+ * the remaining bytes after the prefix never goes below zero */
+func translate_check_length(p *hir.Builder) {
+    p.ADDP  (IP, IC, EP)
+    p.LL    (EP, 0, TR)
+    p.SWAPL (TR, TR)
+    translate_length(p, "_length_chk_{n}")
+    p.LDAQ  (ARG_nb, UR)
+    p.SUB   (UR, IC, UR)
+    p.SUBI  (UR, 4, UR)
+    p.BLTU  (UR, TR, LB_truncated)
+}
@@ -20,6 +20,8 @@ import (
     `reflect`
     `testing`
 
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
     `github.com/stretchr/testify/require`
 )
 
@@ -52,3 +54,35 @@ func TestTranslator_NoCopyString(t *testing.T) {
     tr := Translate(p)
     println(tr.Disassemble())
 }
+
+func runAbortProgram(p Program) (ret interface{}) {
+    fn, _ := Link(Translate(p))
+    defer func() { ret = recover() }()
+    _, _ = fn(nil, 0, 0, nil, new(RuntimeState), 0)
+    return
+}
+
+func TestTranslator_Abort(t *testing.T) {
+    vt := rt.UnpackType(reflect.TypeOf(TranslatorTestStruct{}))
+    ev := runAbortProgram(Program {
+        { Op: OP_drop_state, Id: 9, Vt: vt },
+        { Op: OP_halt, Vt: vt },
+    })
+    require.Equal(t, utils.AbortError {
+        Type   : vt.Pack(),
+        Field  : 9,
+        PC     : 0,
+        Reason : "state stack underflow",
+    }, ev)
+    ev = runAbortProgram(Program {
+        { Op: OP_make_state },
+        { Op: OP_halt, Vt: vt },
+    })
+    require.Equal(t, utils.AbortError {
+        Type   : vt.Pack(),
+        Field  : -1,
+        PC     : 1,
+        Reason : "state stack not empty on return",
+    }, ev)
+    require.EqualError(t, ev.(error), "frugal: state stack not empty on return at pc 1 of decoder.TranslatorTestStruct")
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package decoder
+
+import (
+    `fmt`
+    `reflect`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+// UnknownFieldError is returned when unknown fields are rejected, and a field
+// that is not defined by the struct is found.
+type UnknownFieldError struct {
+    Type     reflect.Type
+    ID       uint16
+    WireType uint8
+}
+
+func (self UnknownFieldError) Error() string {
+    return fmt.Sprintf("frugal: unknown field %d of wire type %d for type %s", self.ID, self.WireType, self.Type)
+}
+
+//go:nosplit
+func error_unknown(vt *rt.GoType, id int, tag int) error {
+    return UnknownFieldError {
+        Type     : vt.Pack(),
+        ID       : uint16(id),
+        WireType : uint8(tag),
+    }
+}
+
+var (
+    F_error_unknown = hir.RegisterGCall(error_unknown, nil)
+)
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package decoder
+
+import (
+    `runtime`
+    `sync`
+    `sync/atomic`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+)
+
+var (
+    yieldfn atomic.Value
+    yieldmu sync.Mutex
+    F_yield = hir.RegisterGCall(yield, emu_gcall_yield)
+)
+
+func init() {
+    yieldfn.Store(runtime.Gosched)
+}
+
+func yield() {
+    yieldfn.Load().(func())()
+}
+
+// SetYieldFunc replaces the function called when the decoder yields, and
+// returns the old one. A nil fn restores runtime.Gosched. It is safe to call
+// while other goroutines are decoding.
+func SetYieldFunc(fn func()) func() {
+    if fn == nil {
+        fn = runtime.Gosched
+    }
+
+    /* swapping needs Go 1.17, so serialize the writers instead */
+    yieldmu.Lock()
+    defer yieldmu.Unlock()
+
+    /* replace the yield function */
+    old := yieldfn.Load().(func())
+    yieldfn.Store(fn)
+    return old
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package defs
+
+import (
+    `fmt`
+    `reflect`
+)
+
+type MismatchKind uint8
+
+const (
+    MissingField MismatchKind = iota
+    UnknownField
+    TypeMismatch
+    RequirednessMismatch
+)
+
+func (self MismatchKind) String() string {
+    switch self {
+        case MissingField         : return "missing field"
+        case UnknownField         : return "unknown field"
+        case TypeMismatch         : return "type mismatch"
+        case RequirednessMismatch : return "requiredness mismatch"
+        default                   : return fmt.Sprintf("MismatchKind(%d)", self)
+    }
+}
+
+// Mismatch describes a single difference between a Go type and the IDL. Path is
+// the Go struct name and the field name, followed by ".key", ".value" or ".elem"
+// for the container elements. Missing fields have no Go name, so the IDL name of
+// the field is used. Expected is taken from the IDL, Actual from the Go type.
+type Mismatch struct {
+    Kind     MismatchKind
+    Path     string
+    ID       uint16
+    Expected string
+    Actual   string
+}
+
+func (self Mismatch) String() string {
+    switch self.Kind {
+        case MissingField : return fmt.Sprintf("%s (%d): missing field, expected %s", self.Path, self.ID, self.Expected)
+        case UnknownField : return fmt.Sprintf("%s (%d): unknown field of type %s", self.Path, self.ID, self.Actual)
+        default           : return fmt.Sprintf("%s (%d): %s, expected %s, got %s", self.Path, self.ID, self.Kind, self.Expected, self.Actual)
+    }
+}
+
+type _IdlPair struct {
+    vt reflect.Type
+    st *IdlStruct
+}
+
+type _IdlChecker struct {
+    idl *IDL
+    ret []Mismatch
+    vis map[_IdlPair]bool
+}
+
+// CheckIDL checks vt against the struct named name in idl, all the nested structs
+// are checked as well. An empty name means the name of vt.
+func CheckIDL(vt reflect.Type, idl *IDL, name string) ([]Mismatch, error) {
+    if vt.Kind() == reflect.Ptr {
+        vt = vt.Elem()
+    }
+
+    /* must be a struct */
+    if vt.Kind() != reflect.Struct {
+        return nil, fmt.Errorf("%s is not a struct", vt)
+    }
+
+    /* use the type name by default */
+    if name == "" {
+        name = vt.Name()
+    }
+
+    /* find the struct in IDL */
+    st, ok := idl.Structs[name]
+    if !ok {
+        return nil, fmt.Errorf("struct %s is not defined in IDL", name)
+    }
+
+    /* check the struct recursively */
+    cc := &_IdlChecker { idl: idl, vis: make(map[_IdlPair]bool) }
+    err := cc.checkStruct(vt, st)
+    return cc.ret, err
+}
+
+func (self *_IdlChecker) add(kind MismatchKind, path string, id uint16, expected string, actual string) {
+    self.ret = append(self.ret, Mismatch {
+        Kind     : kind,
+        Path     : path,
+        ID       : id,
+        Expected : expected,
+        Actual   : actual,
+    })
+}
+
+func (self *_IdlChecker) checkStruct(vt reflect.Type, st *IdlStruct) error {
+    var err error
+    var fv []Field
+
+    /* check every pair only once */
+    if pk := (_IdlPair { vt, st }); self.vis[pk] {
+        return nil
+    } else {
+        self.vis[pk] = true
+    }
+
+    /* resolve all the fields */
+    if fv, err = ResolveFields(vt); err != nil {
+        return err
+    }
+
+    /* index the fields by ID */
+    ids := make(map[uint16]*Field, len(fv))
+    for i := range fv {
+        ids[fv[i].ID] = &fv[i]
+    }
+
+    /* check every field in IDL */
+    for _, ft := range st.Fields {
+        if f, ok := ids[ft.ID]; !ok {
+            self.add(MissingField, vt.Name() + "." + ft.Name, ft.ID, ft.Type.String(), "")
+        } else if err = self.checkField(vt.Name() + "." + f.Name, f, ft); err != nil {
+            return err
+        } else {
+            delete(ids, ft.ID)
+        }
+    }
+
+    /* the remaining fields are not defined in IDL */
+    for _, f := range fv {
+        if _, ok := ids[f.ID]; ok {
+            self.add(UnknownField, vt.Name() + "." + f.Name, f.ID, "", f.Type.String())
+        }
+    }
+
+    /* all done */
+    return nil
+}
+
+func (self *_IdlChecker) checkField(path string, f *Field, ft IdlField) error {
+    if f.Spec != ft.Spec {
+        self.add(RequirednessMismatch, path, f.ID, ft.Spec.String(), f.Spec.String())
+    }
+    return self.checkType(path, f.ID, f.Type, ft.Type)
+}
+
+func (self *_IdlChecker) checkType(path string, id uint16, vt *Type, tv *IdlType) error {
+    if vt.T == T_pointer {
+        vt = vt.V
+    }
+
+    /* compare the wire types */
+    if vt.Tag() != tv.Tag() {
+        self.add(TypeMismatch, path, id, tv.String(), vt.String())
+        return nil
+    }
+
+    /* check the container elements and nested structs */
+    switch vt.T {
+        case T_map    : return self.checkMap(path, id, vt, tv)
+        case T_set    : return self.checkType(path + ".elem", id, vt.V, tv.V)
+        case T_list   : return self.checkType(path + ".elem", id, vt.V, tv.V)
+        case T_struct : return self.checkStruct(vt.S, self.idl.Structs[tv.Name])
+        default       : return nil
+    }
+}
+
+func (self *_IdlChecker) checkMap(path string, id uint16, vt *Type, tv *IdlType) error {
+    if err := self.checkType(path + ".key", id, vt.K, tv.K); err != nil {
+        return err
+    } else {
+        return self.checkType(path + ".value", id, vt.V, tv.V)
+    }
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package defs
+
+import (
+    `reflect`
+    `testing`
+
+    `github.com/stretchr/testify/require`
+)
+
+const testCompatIDL = `
+namespace go test // comment
+
+include "base.thrift"
+
+typedef i64 Timestamp
+typedef list<CompatInner> InnerList
+
+enum CompatEnum {
+    A = 1,
+    B = 2 (doc = "b")
+}
+
+/* block
+   comment */
+struct CompatInner {
+    1: required string Name
+    2: optional binary Data
+}
+
+struct CompatOuter {
+    1: required i32 ID = 10,
+    2: optional Timestamp Time;
+    3: CompatEnum Enum
+    4: InnerList Inners (go.tag = "x")
+    5: map<string, CompatInner> Named = {}
+    6: set<i16> Flags
+    7: optional base.Base Base
+}
+
+struct Base {
+    1: string Msg
+}
+
+service CompatService {
+    CompatOuter Get(1: i32 id)
+}
+`
+
+type CompatEnum int64
+
+type CompatInner struct {
+    Name string `frugal:"1,required,string"`
+    Data []byte `frugal:"2,optional,binary"`
+}
+
+type CompatBase struct {
+    Msg string `frugal:"1,default,string"`
+}
+
+type CompatOuter struct {
+    ID     int32                   `frugal:"1,required,i32"`
+    Time   *int64                  `frugal:"2,optional,i64"`
+    Enum   CompatEnum              `frugal:"3,default,CompatEnum"`
+    Inners []*CompatInner          `frugal:"4,default,list<CompatInner>"`
+    Named  map[string]*CompatInner `frugal:"5,default,map<string:CompatInner>"`
+    Flags  []int16                 `frugal:"6,default,set<i16>"`
+    Base   *CompatBase             `frugal:"7,optional,CompatBase"`
+}
+
+type CompatInnerBad struct {
+    Name string `frugal:"1,default,string"`
+    Data []byte `frugal:"3,optional,binary"`
+}
+
+type CompatOuterBad struct {
+    ID     int64                      `frugal:"1,required,i64"`
+    Inners []*CompatInnerBad          `frugal:"4,default,list<CompatInnerBad>"`
+    Named  map[int32]*CompatInnerBad  `frugal:"5,default,map<i32:CompatInnerBad>"`
+    Flags  []int16                    `frugal:"6,default,list<i16>"`
+}
+
+func TestCompat_ParseIDL(t *testing.T) {
+    idl, err := ParseIDL(testCompatIDL)
+    require.NoError(t, err)
+    require.Len(t, idl.Structs, 3)
+    st := idl.Structs["CompatOuter"]
+    require.Len(t, st.Fields, 7)
+    require.Equal(t, "i64", st.Fields[1].Type.String())
+    require.Equal(t, Optional, st.Fields[1].Spec)
+    require.Equal(t, T_enum, st.Fields[2].Type.T)
+    require.Equal(t, "list<CompatInner>", st.Fields[3].Type.String())
+    require.Equal(t, "map<string:CompatInner>", st.Fields[4].Type.String())
+    require.Equal(t, "Base", st.Fields[6].Type.String())
+    _, err = ParseIDL("struct X { 1: Y y }")
+    require.EqualError(t, err, "cannot resolve type of field X.y: undefined type Y")
+    _, err = ParseIDL("struct X { i32 y }")
+    require.Error(t, err)
+}
+
+func TestCompat_ParseIDLConsts(t *testing.T) {
+    idl, err := ParseIDL(`
+        enum E { A, B = 5, C (x = "y"); D }
+        const i32 N = 10
+        const string S = 'str';
+        const list<E> L = [E.A, E.B]
+    `)
+    require.NoError(t, err)
+    require.Equal(t, []IdlEnumValue {{ "A", 0 }, { "B", 5 }, { "C", 6 }, { "D", 7 }}, idl.Enums["E"].Values)
+    require.Len(t, idl.Consts, 3)
+    require.Equal(t, "10", idl.Consts["N"].Value)
+    require.Equal(t, "'str'", idl.Consts["S"].Value)
+    require.Equal(t, "list<E>", idl.Consts["L"].Type.String())
+    _, err = ParseIDL("const i32 N = 1\nconst i32 N = 2")
+    require.Error(t, err)
+    _, err = ParseIDL("enum E { A }\nenum E { B }")
+    require.Error(t, err)
+}
+
+func TestCompat_CheckIDL(t *testing.T) {
+    idl, err := ParseIDL(testCompatIDL)
+    require.NoError(t, err)
+    ret, err := CheckIDL(reflect.TypeOf(CompatOuter{}), idl, "")
+    require.NoError(t, err)
+    require.Empty(t, ret)
+    ret, err = CheckIDL(reflect.TypeOf(&CompatOuterBad{}), idl, "CompatOuter")
+    require.NoError(t, err)
+    require.Equal(t, []Mismatch {
+        { Kind: TypeMismatch, Path: "CompatOuterBad.ID", ID: 1, Expected: "i32", Actual: "i64" },
+        { Kind: MissingField, Path: "CompatOuterBad.Time", ID: 2, Expected: "i64" },
+        { Kind: MissingField, Path: "CompatOuterBad.Enum", ID: 3, Expected: "CompatEnum" },
+        { Kind: RequirednessMismatch, Path: "CompatInnerBad.Name", ID: 1, Expected: "required", Actual: "default" },
+        { Kind: MissingField, Path: "CompatInnerBad.Data", ID: 2, Expected: "binary" },
+        { Kind: UnknownField, Path: "CompatInnerBad.Data", ID: 3, Actual: "binary" },
+        { Kind: TypeMismatch, Path: "CompatOuterBad.Named.key", ID: 5, Expected: "string", Actual: "i32" },
+        { Kind: TypeMismatch, Path: "CompatOuterBad.Flags", ID: 6, Expected: "set<i16>", Actual: "list<i16>" },
+        { Kind: MissingField, Path: "CompatOuterBad.Base", ID: 7, Expected: "Base" },
+    }, ret)
+}
@@ -19,6 +19,8 @@ package defs
 import (
     `fmt`
     `reflect`
+    `strconv`
+    `strings`
     `unsafe`
 )
 
@@ -51,3 +53,53 @@ func GetDefaultInitializer(vt reflect.Type) (unsafe.Pointer, error) {
         return *(*[2]*unsafe.Pointer)(unsafe.Pointer(&mt.Func))[1], nil
     }
 }
+
+func parseDefault(vt reflect.Type, pt *Type, sv string) (reflect.Value, error) {
+    var ex error
+    var iv int64
+    var fv float64
+    var bv bool
+
+    /* blobs may not hold the value in memory */
+    if vt == BlobType {
+        return reflect.Value{}, fmt.Errorf(`"default" is not applicable to %s`, vt)
+    }
+
+    /* values are kept in addressable memory, so the decoder can refer to them */
+    sv = strings.TrimSpace(sv)
+    rv := reflect.New(vt).Elem()
+
+    /* names of registered constants and enum values, see RegisterSymbols */
+    if sv != "" && isident0(sv[0]) {
+        if lv, ok := resolveSymbol(sv); ok {
+            sv = lv
+        }
+    }
+
+    /* strings can be quoted to keep the spaces */
+    if pt.T == T_string || pt.T == T_binary {
+        if len(sv) >= 2 && sv[0] == '"' && sv[len(sv) - 1] == '"' {
+            if sv, ex = strconv.Unquote(sv); ex != nil {
+                return rv, ex
+            }
+        }
+    }
+
+    /* parse the value according to it's type */
+    switch pt.T {
+        case T_bool   : bv, ex = strconv.ParseBool(sv)      ; rv.SetBool(bv)
+        case T_i8     : iv, ex = strconv.ParseInt(sv, 0, 8) ; rv.SetInt(iv)
+        case T_i16    : iv, ex = strconv.ParseInt(sv, 0, 16); rv.SetInt(iv)
+        case T_i32    : iv, ex = strconv.ParseInt(sv, 0, 32); rv.SetInt(iv)
+        case T_i64    : iv, ex = strconv.ParseInt(sv, 0, 64); rv.SetInt(iv)
+        case T_enum   : iv, ex = strconv.ParseInt(sv, 0, 32); rv.SetInt(iv)
+        case T_double : fv, ex = strconv.ParseFloat(sv, 64) ; rv.SetFloat(fv)
+        case T_fixed  : fv, ex = strconv.ParseFloat(sv, 64) ; rv.SetFloat(fv)
+        case T_string : rv.SetString(sv)
+        case T_binary : rv.SetBytes([]byte(sv))
+        default       : ex = fmt.Errorf(`"default" is only applicable to scalar, "string" and "binary" types, not %s`, pt)
+    }
+
+    /* all done */
+    return rv, ex
+}
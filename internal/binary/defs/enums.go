@@ -0,0 +1,174 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package defs
+
+import (
+    `fmt`
+    `reflect`
+    `sync`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+type EnumChecker func(v int64) bool
+
+type EnumValidator interface {
+    IsValid() bool
+}
+
+var (
+    enumLock   = new(sync.RWMutex)
+    enumNames  = make(map[reflect.Type]map[int64]string)
+    enumValues = make(map[reflect.Type]map[int64]struct{})
+)
+
+var (
+    enumValidatorType = reflect.TypeOf((*EnumValidator)(nil)).Elem()
+)
+
+func RegisterEnumValues(vt reflect.Type, values []int64) {
+    mv := make(map[int64]struct{}, len(values))
+
+    /* build the value set */
+    for _, v := range values {
+        mv[v] = struct{}{}
+    }
+
+    /* update the registry, the values are no longer named */
+    enumLock.Lock()
+    enumValues[vt] = mv
+    delete(enumNames, vt)
+    enumLock.Unlock()
+}
+
+// RegisterIdlEnum registers the values of ev as the valid values of enum type
+// vt, along with their names.
+func RegisterIdlEnum(vt reflect.Type, ev *IdlEnum) {
+    mn := make(map[int64]string, len(ev.Values))
+    mv := make(map[int64]struct{}, len(ev.Values))
+
+    /* build the value set and names */
+    for _, v := range ev.Values {
+        mn[v.Value] = v.Name
+        mv[v.Value] = struct{}{}
+    }
+
+    /* update the registry */
+    enumLock.Lock()
+    enumNames[vt] = mn
+    enumValues[vt] = mv
+    enumLock.Unlock()
+}
+
+// GetEnumNames returns the names of the values of enum type vt registered with
+// RegisterIdlEnum, or nil if there are none.
+func GetEnumNames(vt reflect.Type) map[int64]string {
+    enumLock.RLock()
+    defer enumLock.RUnlock()
+    return enumNames[vt]
+}
+
+// GetEnumChecker finds the valid values of enum type vt, from either the values
+// registered with RegisterEnumValues, a `KnownValues()` method that returns a
+// slice of integers, or an `IsValid() bool` method, in that order.
+//
+// A nil checker is returned if vt does not define any of them.
+func GetEnumChecker(vt reflect.Type) (EnumChecker, error) {
+    enumLock.RLock()
+    mv, ok := enumValues[vt]
+    enumLock.RUnlock()
+
+    /* registered enum descriptor */
+    if ok {
+        return mkEnumSetChecker(mv), nil
+    }
+
+    /* must be an integer type */
+    switch vt.Kind() {
+        case reflect.Int   : break
+        case reflect.Int8  : break
+        case reflect.Int16 : break
+        case reflect.Int32 : break
+        case reflect.Int64 : break
+        default            : return nil, fmt.Errorf("enum must be an integer type: %s", vt)
+    }
+
+    /* check for the list of known values */
+    if fn := reflect.New(vt).MethodByName("KnownValues"); fn.IsValid() {
+        return getKnownValues(vt, fn)
+    }
+
+    /* otherwise ask the value itself */
+    if reflect.PtrTo(vt).Implements(enumValidatorType) {
+        return mkEnumValidatorChecker(vt), nil
+    } else {
+        return nil, nil
+    }
+}
+
+func getKnownValues(vt reflect.Type, fn reflect.Value) (EnumChecker, error) {
+    ft := fn.Type()
+    mv := make(map[int64]struct{})
+
+    /* check the method signature */
+    if ft.NumIn() != 0 || ft.NumOut() != 1 || ft.Out(0).Kind() != reflect.Slice {
+        return nil, fmt.Errorf("invalid implementation of `KnownValues()`: %s", ft)
+    }
+
+    /* the values must be integers */
+    switch ft.Out(0).Elem().Kind() {
+        case reflect.Int   : break
+        case reflect.Int8  : break
+        case reflect.Int16 : break
+        case reflect.Int32 : break
+        case reflect.Int64 : break
+        default            : return nil, fmt.Errorf("`KnownValues()` must return a slice of integers: %s", ft)
+    }
+
+    /* build the value set */
+    for i, rv := 0, fn.Call(nil)[0]; i < rv.Len(); i++ {
+        mv[rv.Index(i).Int()] = struct{}{}
+    }
+
+    /* construct the checker */
+    return mkEnumSetChecker(mv), nil
+}
+
+// mkEnumValidatorChecker calls IsValid on a pointer to the value on the stack,
+// which works for all the integer enum types, since the lower bytes come first
+// on every supported architecture. The itab is looked up only once here, so no
+// values are allocated while checking.
+func mkEnumValidatorChecker(vt reflect.Type) EnumChecker {
+    ev := reflect.New(vt).Interface().(EnumValidator)
+    it := (*rt.GoIface)(unsafe.Pointer(&ev)).Itab
+
+    /* IsValid must not keep the pointer */
+    return func(v int64) bool {
+        var iv EnumValidator
+        (*rt.GoIface)(unsafe.Pointer(&iv)).Itab = it
+        (*rt.GoIface)(unsafe.Pointer(&iv)).Value = rt.NoEscape(unsafe.Pointer(&v))
+        return iv.IsValid()
+    }
+}
+
+func mkEnumSetChecker(mv map[int64]struct{}) EnumChecker {
+    return func(v int64) bool {
+        _, ok := mv[v]
+        return ok
+    }
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package defs
+
+import (
+    `reflect`
+    `testing`
+
+    `github.com/stretchr/testify/require`
+)
+
+type (
+    TestValidInt8  int8
+    TestValidInt64 int64
+)
+
+func (self TestValidInt8) IsValid() bool {
+    return self >= -1 && self <= 1
+}
+
+func (self *TestValidInt64) IsValid() bool {
+    return *self == 1 << 40
+}
+
+func TestEnums_Validator(t *testing.T) {
+    c8, err := GetEnumChecker(reflect.TypeOf(TestValidInt8(0)))
+    require.NoError(t, err)
+    c64, err := GetEnumChecker(reflect.TypeOf(TestValidInt64(0)))
+    require.NoError(t, err)
+    require.True(t, c8(-1))
+    require.True(t, c8(1))
+    require.False(t, c8(2))
+    require.True(t, c64(1 << 40))
+    require.False(t, c64(1))
+    require.Zero(t, testing.AllocsPerRun(100, func() { c8(1); c64(1 << 40) }))
+}
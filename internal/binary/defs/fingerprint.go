@@ -0,0 +1,153 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package defs
+
+import (
+    `fmt`
+    `hash/fnv`
+    `reflect`
+    `strconv`
+    `strings`
+    `sync`
+)
+
+var (
+    fingerprintLock  = new(sync.RWMutex)
+    fingerprintCache = make(map[reflect.Type]uint32)
+)
+
+// Fingerprint hashes the wire schema of struct type vt, which consists of the field
+// IDs, requiredness and wire types of vt and all the nested structs. Go names are
+// not part of the schema, neither are the differences that are invisible on the wire,
+// such as string and binary, or enums and i32.
+func Fingerprint(vt reflect.Type) (uint32, error) {
+    var ok bool
+    var fp uint32
+
+    /* attempt to find in cache */
+    fingerprintLock.RLock()
+    fp, ok = fingerprintCache[vt]
+    fingerprintLock.RUnlock()
+
+    /* check if it exists */
+    if ok {
+        return fp, nil
+    }
+
+    /* must be a struct */
+    if vt.Kind() != reflect.Struct {
+        return 0, fmt.Errorf("frugal: fingerprint of non-struct type %s", vt)
+    }
+
+    /* build the descriptor */
+    sb := new(strings.Builder)
+    ex := describeStruct(sb, vt, nil)
+
+    /* check for errors */
+    if ex != nil {
+        return 0, ex
+    }
+
+    /* hash the descriptor */
+    hf := fnv.New32a()
+    _, _ = hf.Write([]byte(sb.String()))
+    fp = hf.Sum32()
+
+    /* update cache */
+    fingerprintLock.Lock()
+    fingerprintCache[vt] = fp
+    fingerprintLock.Unlock()
+    return fp, nil
+}
+
+func describeStruct(sb *strings.Builder, vt reflect.Type, path []reflect.Type) error {
+    var ex error
+    var fv []Field
+
+    /* recursive structs refer back to the enclosing level */
+    for i, t := range path {
+        if t == vt {
+            sb.WriteString("^" + strconv.Itoa(len(path) - i))
+            return nil
+        }
+    }
+
+    /* resolve the fields */
+    if fv, ex = ResolveFields(vt); ex != nil {
+        return ex
+    }
+
+    /* describe every field, which are sorted by ID */
+    sb.WriteByte('{')
+    path = append(path, vt)
+
+    /* field ID, requiredness and type */
+    for _, f := range fv {
+        sb.WriteString(strconv.Itoa(int(f.ID)))
+        sb.WriteByte(':')
+        sb.WriteString(f.Spec.String())
+        sb.WriteByte(':')
+
+        /* the field type */
+        if ex = describeType(sb, f.Type, path); ex != nil {
+            return ex
+        }
+
+        /* field delimiter */
+        sb.WriteByte(';')
+    }
+
+    /* all done */
+    sb.WriteByte('}')
+    return nil
+}
+
+func describeType(sb *strings.Builder, vt *Type, path []reflect.Type) error {
+    switch vt.T {
+        case T_pointer : return describeType(sb, vt.V, path)
+        case T_struct  : return describeStruct(sb, vt.S, path)
+    }
+
+    /* the wire type */
+    sb.WriteString(strconv.Itoa(int(vt.Tag())))
+
+    /* container elements */
+    switch vt.T {
+        case T_map  : sb.WriteByte('<'); return describePair(sb, vt, path)
+        case T_set  : sb.WriteByte('<'); return describeElem(sb, vt.V, path)
+        case T_list : sb.WriteByte('<'); return describeElem(sb, vt.V, path)
+        default     : return nil
+    }
+}
+
+func describePair(sb *strings.Builder, vt *Type, path []reflect.Type) error {
+    if ex := describeType(sb, vt.K, path); ex != nil {
+        return ex
+    } else {
+        sb.WriteByte(',')
+        return describeElem(sb, vt.V, path)
+    }
+}
+
+func describeElem(sb *strings.Builder, vt *Type, path []reflect.Type) error {
+    if ex := describeType(sb, vt, path); ex != nil {
+        return ex
+    } else {
+        sb.WriteByte('>')
+        return nil
+    }
+}
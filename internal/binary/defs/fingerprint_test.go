@@ -0,0 +1,55 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package defs
+
+import (
+    `reflect`
+    `testing`
+
+    `github.com/stretchr/testify/require`
+)
+
+type TestFingerprintA struct {
+    X int32             `frugal:"1,default,i32"`
+    N *TestFingerprintA `frugal:"2,optional,TestFingerprintA"`
+    S []string          `frugal:"3,default,list<string>"`
+}
+
+type TestFingerprintB struct {
+    Y int32             `frugal:"1,default,i32"`
+    M *TestFingerprintB `frugal:"2,optional,TestFingerprintB"`
+    S [][]byte          `frugal:"3,default,list<binary>"`
+}
+
+type TestFingerprintC struct {
+    X int32             `frugal:"1,required,i32"`
+    N *TestFingerprintC `frugal:"2,optional,TestFingerprintC"`
+    S []string          `frugal:"3,default,list<string>"`
+}
+
+func TestFingerprint_WireSchema(t *testing.T) {
+    a, err := Fingerprint(reflect.TypeOf(TestFingerprintA{}))
+    require.NoError(t, err)
+    b, err := Fingerprint(reflect.TypeOf(TestFingerprintB{}))
+    require.NoError(t, err)
+    c, err := Fingerprint(reflect.TypeOf(TestFingerprintC{}))
+    require.NoError(t, err)
+    require.Equal(t, a, b)
+    require.NotEqual(t, a, c)
+    _, err = Fingerprint(reflect.TypeOf(0))
+    require.Error(t, err)
+}
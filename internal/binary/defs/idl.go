@@ -0,0 +1,696 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package defs
+
+import (
+    `fmt`
+    `strconv`
+    `strings`
+
+    `github.com/cloudwego/frugal/internal/utils`
+)
+
+// IdlType is a type parsed from a Thrift IDL. T_enum and T_binary are used for
+// enums and binaries, and names of structs or enums are kept in Name.
+type IdlType struct {
+    T    Tag
+    Name string
+    K    *IdlType
+    V    *IdlType
+}
+
+func (self *IdlType) Tag() Tag {
+    return (&Type { T: self.T }).Tag()
+}
+
+func (self *IdlType) String() string {
+    switch self.T {
+        case T_map    : return fmt.Sprintf("map<%s:%s>", self.K.String(), self.V.String())
+        case T_set    : return fmt.Sprintf("set<%s>", self.V.String())
+        case T_list   : return fmt.Sprintf("list<%s>", self.V.String())
+        case T_struct : return self.Name
+        case T_enum   : return self.Name
+        case T_i8     : return "i8"
+        default       : return keywordTab[self.T]
+    }
+}
+
+type IdlField struct {
+    ID   uint16
+    Name string
+    Type *IdlType
+    Spec Requiredness
+}
+
+type IdlStruct struct {
+    Name   string
+    Fields []IdlField
+}
+
+type IdlEnumValue struct {
+    Name  string
+    Value int64
+}
+
+type IdlEnum struct {
+    Name   string
+    Values []IdlEnumValue
+}
+
+// IdlConst is a constant defined by a Thrift IDL, Value is the literal as it is
+// written in the IDL, which may refer to other constants or enum values.
+type IdlConst struct {
+    Name  string
+    Type  *IdlType
+    Value string
+}
+
+// IDL holds the structs (including unions and exceptions), enums and constants
+// defined by a Thrift IDL file, with all the typedefs and enums resolved.
+type IDL struct {
+    Enums   map[string]*IdlEnum
+    Consts  map[string]*IdlConst
+    Structs map[string]*IdlStruct
+}
+
+// idlBaseType looks up the base types in the keywords of the type tags, which
+// are the same as the base types of IDL, except for "struct" and "map".
+func idlBaseType(tk string) (Tag, bool) {
+    for i, kw := range keywordTab {
+        if tag := Tag(i); tag != T_struct && tag != T_map {
+            for _, v := range strings.Fields(kw) {
+                if v == tk {
+                    return tag, true
+                }
+            }
+        }
+    }
+    return 0, false
+}
+
+type _IdlParser struct {
+    i   int
+    src string
+    tds map[string]*IdlType
+    ret *IDL
+}
+
+// ParseIDL parses the Thrift IDL in src. Only the definitions are checked,
+// services are skipped over, and constant values are kept as they are written.
+func ParseIDL(src string) (*IDL, error) {
+    p := &_IdlParser {
+        src: src,
+        tds: make(map[string]*IdlType),
+        ret: &IDL {
+            Enums   : make(map[string]*IdlEnum),
+            Consts  : make(map[string]*IdlConst),
+            Structs : make(map[string]*IdlStruct),
+        },
+    }
+
+    /* parse the whole document */
+    if err := p.parse(); err != nil {
+        return nil, err
+    }
+
+    /* resolve all the named types */
+    for _, st := range p.ret.Structs {
+        for _, fv := range st.Fields {
+            if err := p.resolve(fv.Type, 0); err != nil {
+                return nil, fmt.Errorf("cannot resolve type of field %s.%s: %w", st.Name, fv.Name, err)
+            }
+        }
+    }
+
+    /* resolve the types of constants */
+    for _, cv := range p.ret.Consts {
+        if err := p.resolve(cv.Type, 0); err != nil {
+            return nil, fmt.Errorf("cannot resolve type of constant %s: %w", cv.Name, err)
+        }
+    }
+
+    /* all done */
+    return p.ret, nil
+}
+
+func (self *_IdlParser) skipSpaces() {
+    for self.i < len(self.src) {
+        switch c := self.src[self.i]; {
+            case c == ' ' || c == '\t' || c == '\r' || c == '\n': {
+                self.i++
+            }
+
+            /* line comments */
+            case c == '#' || strings.HasPrefix(self.src[self.i:], "//"): {
+                if p := strings.IndexByte(self.src[self.i:], '\n'); p < 0 {
+                    self.i = len(self.src)
+                } else {
+                    self.i += p + 1
+                }
+            }
+
+            /* block comments */
+            case strings.HasPrefix(self.src[self.i:], "/*"): {
+                if p := strings.Index(self.src[self.i + 2:], "*/"); p < 0 {
+                    self.i = len(self.src)
+                } else {
+                    self.i += p + 4
+                }
+            }
+
+            /* not a space */
+            default: {
+                return
+            }
+        }
+    }
+}
+
+func (self *_IdlParser) next() (string, error) {
+    self.skipSpaces()
+    p := self.i
+    n := len(self.src)
+
+    /* check for EOF */
+    if p == n {
+        return "", nil
+    }
+
+    /* check the first character */
+    switch c := self.src[p]; {
+        case isident0(c): {
+            for p++; p < n && (isident(self.src[p]) || self.src[p] == '.'); p++ {}
+        }
+
+        /* numbers */
+        case c >= '0' && c <= '9' || (c == '-' || c == '+') && p + 1 < n && self.src[p + 1] >= '0' && self.src[p + 1] <= '9': {
+            for p++; p < n && (isident(self.src[p]) || self.src[p] == '.'); p++ {}
+        }
+
+        /* string literals */
+        case c == '"' || c == '\'': {
+            if q := strings.IndexByte(self.src[p + 1:], c); q < 0 {
+                return "", utils.ESyntax(p, self.src, "unterminated string literal")
+            } else {
+                p += q + 2
+            }
+        }
+
+        /* other single-character tokens */
+        default: {
+            p++
+        }
+    }
+
+    /* slice the token */
+    tk := self.src[self.i:p]
+    self.i = p
+    return tk, nil
+}
+
+func (self *_IdlParser) peek() (string, error) {
+    i := self.i
+    tk, err := self.next()
+    self.i = i
+    return tk, err
+}
+
+func (self *_IdlParser) expect(tk string) error {
+    if tv, err := self.next(); err != nil {
+        return err
+    } else if tv != tk {
+        return utils.ESyntax(self.i - len(tv), self.src, fmt.Sprintf("'%s' expected", tk))
+    } else {
+        return nil
+    }
+}
+
+func (self *_IdlParser) ident() (string, error) {
+    if tk, err := self.next(); err != nil {
+        return "", err
+    } else if tk == "" || !isident0(tk[0]) {
+        return "", utils.ESyntax(self.i - len(tk), self.src, "identifier expected")
+    } else {
+        return tk, nil
+    }
+}
+
+func (self *_IdlParser) skip(n int) error {
+    for ; n > 0; n-- {
+        if tk, err := self.next(); err != nil {
+            return err
+        } else if tk == "" {
+            return utils.ESyntax(self.i, self.src, "unexpected EOF")
+        }
+    }
+    return nil
+}
+
+func (self *_IdlParser) skipSeparator() error {
+    if tk, err := self.peek(); err != nil {
+        return err
+    } else if tk == "," || tk == ";" {
+        _, err = self.next()
+        return err
+    } else {
+        return nil
+    }
+}
+
+func (self *_IdlParser) skipBalanced(open string, close string) error {
+    for nb := 1; nb != 0; {
+        if tk, err := self.next(); err != nil {
+            return err
+        } else if tk == "" {
+            return utils.ESyntax(self.i, self.src, "unexpected EOF")
+        } else if tk == open {
+            nb++
+        } else if tk == close {
+            nb--
+        }
+    }
+    return nil
+}
+
+func (self *_IdlParser) skipAnnotations() error {
+    if tk, err := self.peek(); err != nil || tk != "(" {
+        return err
+    } else if _, err = self.next(); err != nil {
+        return err
+    } else {
+        return self.skipBalanced("(", ")")
+    }
+}
+
+func (self *_IdlParser) skipValue() error {
+    if tk, err := self.next(); err != nil {
+        return err
+    } else if tk == "[" {
+        return self.skipBalanced("[", "]")
+    } else if tk == "{" {
+        return self.skipBalanced("{", "}")
+    } else if tk == "" {
+        return utils.ESyntax(self.i, self.src, "unexpected EOF")
+    } else {
+        return nil
+    }
+}
+
+func (self *_IdlParser) parse() error {
+    for {
+        tk, err := self.next()
+        if err != nil {
+            return err
+        }
+
+        /* check for definitions */
+        switch tk {
+            case ""            : return nil
+            case ";", ","      : break
+            case "include"     : err = self.skip(1)
+            case "cpp_include" : err = self.skip(1)
+            case "namespace"   : err = self.skip(2)
+            case "const"       : err = self.parseConst()
+            case "typedef"     : err = self.parseTypedef()
+            case "enum"        : err = self.parseEnum()
+            case "senum"       : err = self.parseSkipped()
+            case "service"     : err = self.parseSkipped()
+            case "struct"      : err = self.parseStruct()
+            case "union"       : err = self.parseStruct()
+            case "exception"   : err = self.parseStruct()
+            default            : err = utils.ESyntax(self.i - len(tk), self.src, "definition expected")
+        }
+
+        /* check for errors */
+        if err != nil {
+            return err
+        }
+    }
+}
+
+func (self *_IdlParser) parseConst() error {
+    var err error
+    var cv IdlConst
+
+    /* constant type and name */
+    if cv.Type, err = self.parseType(); err != nil {
+        return err
+    } else if cv.Name, err = self.ident(); err != nil {
+        return err
+    } else if err = self.expect("="); err != nil {
+        return err
+    }
+
+    /* keep the literal as it is */
+    self.skipSpaces()
+    p := self.i
+
+    /* skip over the value */
+    if err = self.skipValue(); err != nil {
+        return err
+    }
+
+    /* check for duplicates */
+    if _, ok := self.ret.Consts[cv.Name]; ok {
+        return fmt.Errorf("duplicated definition of %s", cv.Name)
+    }
+
+    /* add to constants */
+    cv.Value = self.src[p:self.i]
+    self.ret.Consts[cv.Name] = &cv
+    return self.skipSeparator()
+}
+
+func (self *_IdlParser) parseTypedef() error {
+    var err error
+    var tn string
+    var tv *IdlType
+
+    /* parse the type and name */
+    if tv, err = self.parseType(); err != nil {
+        return err
+    } else if tn, err = self.ident(); err != nil {
+        return err
+    }
+
+    /* add to typedefs */
+    self.tds[tn] = tv
+    return self.skipAnnotations()
+}
+
+func (self *_IdlParser) parseEnum() error {
+    var err error
+    var tn string
+
+    /* enum name */
+    if tn, err = self.ident(); err != nil {
+        return err
+    } else if err = self.expect("{"); err != nil {
+        return err
+    }
+
+    /* check for duplicates */
+    if _, ok := self.ret.Enums[tn]; ok {
+        return fmt.Errorf("duplicated definition of %s", tn)
+    }
+
+    /* parse all the values */
+    ev := &IdlEnum { Name: tn }
+    if err = self.parseEnumValues(ev); err != nil {
+        return err
+    }
+
+    /* add to enums */
+    self.ret.Enums[tn] = ev
+    return self.skipAnnotations()
+}
+
+func (self *_IdlParser) parseEnumValues(ev *IdlEnum) error {
+    var err error
+    var tk string
+    var iv int64
+
+    /* values without explicit numbers follow the previous one */
+    for {
+        var vn string
+        var vv int64
+
+        /* check for the end of enum */
+        if tk, err = self.peek(); err != nil {
+            return err
+        } else if tk == "}" {
+            _, err = self.next()
+            return err
+        }
+
+        /* value name */
+        if vn, err = self.ident(); err != nil {
+            return err
+        } else if tk, err = self.peek(); err != nil {
+            return err
+        }
+
+        /* explicit value number */
+        if tk != "=" {
+            vv = iv
+        } else if _, err = self.next(); err != nil {
+            return err
+        } else if tk, err = self.next(); err != nil {
+            return err
+        } else if vv, err = strconv.ParseInt(tk, 0, 32); err != nil {
+            return utils.ESyntax(self.i - len(tk), self.src, "enum value expected")
+        }
+
+        /* value annotations and separator */
+        if err = self.skipAnnotations(); err != nil {
+            return err
+        } else if err = self.skipSeparator(); err != nil {
+            return err
+        }
+
+        /* add to values */
+        iv = vv + 1
+        ev.Values = append(ev.Values, IdlEnumValue { Name: vn, Value: vv })
+    }
+}
+
+func (self *_IdlParser) parseSkipped() error {
+    for {
+        if tk, err := self.next(); err != nil {
+            return err
+        } else if tk == "" {
+            return utils.ESyntax(self.i, self.src, "unexpected EOF")
+        } else if tk == "{" {
+            break
+        }
+    }
+    if err := self.skipBalanced("{", "}"); err != nil {
+        return err
+    } else {
+        return self.skipAnnotations()
+    }
+}
+
+func (self *_IdlParser) parseStruct() error {
+    var err error
+    var tk string
+    var st IdlStruct
+
+    /* struct name */
+    if st.Name, err = self.ident(); err != nil {
+        return err
+    } else if err = self.expect("{"); err != nil {
+        return err
+    }
+
+    /* check for duplicates */
+    if _, ok := self.ret.Structs[st.Name]; ok {
+        return fmt.Errorf("duplicated definition of %s", st.Name)
+    }
+
+    /* parse all the fields */
+    for {
+        if tk, err = self.peek(); err != nil {
+            return err
+        } else if tk == "}" {
+            break
+        } else if err = self.parseField(&st); err != nil {
+            return err
+        }
+    }
+
+    /* add to structs */
+    if _, err = self.next(); err != nil {
+        return err
+    }
+
+    /* struct annotations */
+    self.ret.Structs[st.Name] = &st
+    return self.skipAnnotations()
+}
+
+func (self *_IdlParser) parseField(st *IdlStruct) error {
+    var id uint64
+    var err error
+    var tk string
+    var fv IdlField
+
+    /* field ID, implicit field IDs are not supported */
+    if tk, err = self.next(); err != nil {
+        return err
+    } else if id, err = strconv.ParseUint(tk, 0, 16); err != nil {
+        return utils.ESyntax(self.i - len(tk), self.src, "field ID expected")
+    } else if err = self.expect(":"); err != nil {
+        return err
+    }
+
+    /* check for duplicates */
+    for _, f := range st.Fields {
+        if f.ID == uint16(id) {
+            return fmt.Errorf("duplicated field ID %d in %s", id, st.Name)
+        }
+    }
+
+    /* field requiredness */
+    if tk, err = self.peek(); err != nil {
+        return err
+    }
+
+    /* consume the requiredness keyword if any */
+    switch tk {
+        case "required" : fv.Spec = Required
+        case "optional" : fv.Spec = Optional
+    }
+
+    /* skip the keyword */
+    if fv.Spec != Default {
+        if _, err = self.next(); err != nil {
+            return err
+        }
+    }
+
+    /* field type and name */
+    if fv.Type, err = self.parseType(); err != nil {
+        return err
+    } else if fv.Name, err = self.ident(); err != nil {
+        return err
+    }
+
+    /* default values are not checked */
+    if tk, err = self.peek(); err != nil {
+        return err
+    } else if tk == "=" {
+        if _, err = self.next(); err != nil {
+            return err
+        } else if err = self.skipValue(); err != nil {
+            return err
+        }
+    }
+
+    /* field annotations and separator */
+    if err = self.skipAnnotations(); err != nil {
+        return err
+    } else if err = self.skipSeparator(); err != nil {
+        return err
+    }
+
+    /* add to fields */
+    fv.ID = uint16(id)
+    st.Fields = append(st.Fields, fv)
+    return nil
+}
+
+func (self *_IdlParser) parseType() (*IdlType, error) {
+    var err error
+    var tk string
+    var tv *IdlType
+
+    /* read the type name */
+    if tk, err = self.ident(); err != nil {
+        return nil, err
+    }
+
+    /* check for base types */
+    if tag, ok := idlBaseType(tk); ok {
+        return &IdlType { T: tag }, self.skipAnnotations()
+    }
+
+    /* check for container types */
+    switch tk {
+        case "map"  : tv = &IdlType { T: T_map }
+        case "set"  : tv = &IdlType { T: T_set }
+        case "list" : tv = &IdlType { T: T_list }
+        default     : return &IdlType { Name: tk }, nil
+    }
+
+    /* container begin */
+    if err = self.expect("<"); err != nil {
+        return nil, err
+    }
+
+    /* map keys */
+    if tv.T == T_map {
+        if tv.K, err = self.parseType(); err != nil {
+            return nil, err
+        } else if err = self.expect(","); err != nil {
+            return nil, err
+        }
+    }
+
+    /* container elements */
+    if tv.V, err = self.parseType(); err != nil {
+        return nil, err
+    } else if err = self.expect(">"); err != nil {
+        return nil, err
+    } else {
+        return tv, self.skipAnnotations()
+    }
+}
+
+func (self *_IdlParser) lookup(name string) (*IdlType, bool) {
+    if tv, ok := self.tds[name]; ok {
+        return tv, true
+    } else if _, ok = self.ret.Enums[name]; ok {
+        return &IdlType { T: T_enum, Name: name }, true
+    } else if _, ok = self.ret.Structs[name]; ok {
+        return &IdlType { T: T_struct, Name: name }, true
+    } else {
+        return nil, false
+    }
+}
+
+func (self *_IdlParser) resolve(tv *IdlType, depth int) error {
+    var ok bool
+    var rt *IdlType
+
+    /* resolve the map keys */
+    if tv.T == T_map {
+        if err := self.resolve(tv.K, depth); err != nil {
+            return err
+        }
+    }
+
+    /* resolve the container elements */
+    if tv.T == T_map || tv.T == T_set || tv.T == T_list {
+        return self.resolve(tv.V, depth)
+    }
+
+    /* check for named types */
+    if tv.T != 0 {
+        return nil
+    } else if depth > 64 {
+        return fmt.Errorf("typedef of %s is too deep", tv.Name)
+    }
+
+    /* types from included files are referred by their short names */
+    if rt, ok = self.lookup(tv.Name); !ok {
+        if p := strings.LastIndexByte(tv.Name, '.'); p < 0 {
+            return fmt.Errorf("undefined type %s", tv.Name)
+        } else if rt, ok = self.lookup(tv.Name[p + 1:]); !ok {
+            return fmt.Errorf("undefined type %s", tv.Name)
+        }
+    }
+
+    /* resolve typedefs recursively */
+    if err := self.resolve(rt, depth + 1); err != nil {
+        return err
+    }
+
+    /* update the type */
+    *tv = *rt
+    return nil
+}
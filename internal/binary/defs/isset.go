@@ -0,0 +1,49 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package defs
+
+import (
+    `fmt`
+    `reflect`
+    `unsafe`
+)
+
+var (
+    boolType = reflect.TypeOf(false)
+)
+
+// GetIsSetMethod finds the `IsSet<Field>() bool` method that apache thrift
+// generates for optional fields of struct vt, and returns its entry point.
+//
+// A nil pointer is returned if vt does not define such method.
+func GetIsSetMethod(vt reflect.Type, field string) (unsafe.Pointer, error) {
+    var ok bool
+    var mt reflect.Method
+
+    /* find the method on the pointer type */
+    if mt, ok = reflect.PtrTo(vt).MethodByName("IsSet" + field); !ok {
+        return nil, nil
+    }
+
+    /* check the method signature */
+    if mt.Type.NumIn() != 1 || mt.Type.NumOut() != 1 || mt.Type.Out(0) != boolType {
+        return nil, fmt.Errorf("invalid implementation of `IsSet%s() bool`: %s", field, mt.Type)
+    } else {
+        return *(*[2]*unsafe.Pointer)(unsafe.Pointer(&mt.Func))[1], nil
+    }
+}
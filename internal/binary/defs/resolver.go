@@ -33,6 +33,7 @@ type (
 
 const (
     NoCopy Options = 1 << iota
+    HasDefault
 )
 
 const (
@@ -50,6 +51,11 @@ func (self Options) String() string {
         ret = append(ret, "nocopy")
     }
 
+    /* check for "default=V" option */
+    if self & HasDefault != 0 {
+        ret = append(ret, "default")
+    }
+
     /* join them together */
     return fmt.Sprintf(
         "{%s}",
@@ -69,9 +75,11 @@ func (self Requiredness) String() string {
 type Field struct {
     F       int
     ID      uint16
+    Name    string
     Type    *Type
     Opts    Options
     Spec    Requiredness
+    Group   string
     Default reflect.Value
 }
 
@@ -135,6 +143,7 @@ func doResolveFields(vt reflect.Type) ([]Field, error) {
         var pt *Type
         var id uint64
         var tv string
+        var gv string
         var fv Options
         var ft []string
         var rx Requiredness
@@ -195,13 +204,13 @@ func doResolveFields(vt reflect.Type) ([]Field, error) {
 
         /* scan for the options */
         for _, opt := range ft {
-            switch opt {
+            switch {
                 default: {
                     return nil, fmt.Errorf("invalid option: %s", opt)
                 }
 
                 /* "nocopy" option enables zero-copy string decoding */
-                case "nocopy": {
+                case opt == "nocopy": {
                     if pt.Tag() != T_string {
                         return nil, fmt.Errorf(`"nocopy" is only applicable to "string" and "binary" types, not %s`, pt)
                     } else if fv & NoCopy != 0 {
@@ -210,11 +219,40 @@ func doResolveFields(vt reflect.Type) ([]Field, error) {
                         fv |= NoCopy
                     }
                 }
+
+                /* "default=V" option declares the IDL default value of this field */
+                case strings.HasPrefix(opt, "default="): {
+                    if fv & HasDefault != 0 {
+                        return nil, fmt.Errorf(`duplicated option "default" for field %s.%s`, vt, sf.Name)
+                    } else if rv, err = parseDefault(sf.Type, pt, opt[8:]); err != nil {
+                        return nil, fmt.Errorf("invalid default value for field %s.%s: %w", vt, sf.Name, err)
+                    } else {
+                        fv |= HasDefault
+                    }
+                }
+
+                /* "group=NAME" option makes the field present or absent together with the rest of the group */
+                case strings.HasPrefix(opt, "group="): {
+                    if gv != "" {
+                        return nil, fmt.Errorf(`duplicated option "group" for field %s.%s`, vt, sf.Name)
+                    } else if gv = strings.TrimSpace(opt[6:]); gv == "" {
+                        return nil, fmt.Errorf("empty group name for field %s.%s", vt, sf.Name)
+                    } else if rx == Required {
+                        return nil, fmt.Errorf(`"group" is not applicable to required field %s.%s`, vt, sf.Name)
+                    }
+                }
+
+                /* "scale=N" option transfers a float64 field as an i64 fixed-point value */
+                case strings.HasPrefix(opt, "scale="): {
+                    if err = parseScale(pt, opt[6:]); err != nil {
+                        return nil, fmt.Errorf("invalid scale for field %s.%s: %w", vt, sf.Name, err)
+                    }
+                }
             }
         }
 
-        /* get the default value if any */
-        if mem.IsValid() {
+        /* get the default value if any, the "default" option takes precedence */
+        if mem.IsValid() && fv & HasDefault == 0 {
             rv = mem.FieldByIndex(sf.Index)
         }
 
@@ -222,14 +260,47 @@ func doResolveFields(vt reflect.Type) ([]Field, error) {
         ret = append(ret, Field {
             F       : int(sf.Offset),
             ID      : uint16(id),
+            Name    : sf.Name,
             Type    : pt,
             Opts    : fv,
             Spec    : rx,
+            Group   : gv,
             Default : rv,
         })
     }
 
-    /* sort the field by ID */
+    /* sort the field by ID, and apply the rewriters */
     sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
-    return ret, nil
+    return rewriteFields(vt, ret)
+}
+
+func parseScale(pt *Type, sv string) error {
+    var ex error
+    var nb int64
+
+    /* fixed-point values can be optional */
+    if pt.T == T_pointer {
+        pt = pt.V
+    }
+
+    /* only applicable to "double" fields */
+    if pt.T != T_double {
+        if pt.T == T_fixed {
+            return fmt.Errorf(`duplicated option "scale"`)
+        } else {
+            return fmt.Errorf(`"scale" is only applicable to "double" types, not %s`, pt)
+        }
+    }
+
+    /* parse the scaling factor */
+    if nb, ex = strconv.ParseInt(strings.TrimSpace(sv), 10, 64); ex != nil {
+        return ex
+    } else if nb <= 0 {
+        return fmt.Errorf("scaling factor must be positive: %d", nb)
+    }
+
+    /* convert to fixed-point type */
+    pt.T = T_fixed
+    pt.N = nb
+    return nil
 }
@@ -40,3 +40,77 @@ func TestResolver_StringOptions(t *testing.T) {
     spew.Config.DisablePointerMethods = true
     spew.Dump(ret)
 }
+
+type TestTagDefaultFields struct {
+    A int16 `frugal:"1,optional,i16,default=5"`
+    B int16 `frugal:"2,optional,i16"`
+}
+
+type InvalidDefaultFields struct {
+    A *int32 `frugal:"1,optional,i32,default=1"`
+}
+
+func TestResolver_DefaultOption(t *testing.T) {
+    ret, err := ResolveFields(reflect.TypeOf(TestTagDefaultFields{}))
+    require.NoError(t, err)
+    require.Equal(t, HasDefault, ret[0].Opts)
+    require.Equal(t, int64(5), ret[0].Default.Int())
+    require.False(t, ret[1].Default.IsValid())
+    _, err = ResolveFields(reflect.TypeOf(InvalidDefaultFields{}))
+    require.Error(t, err)
+}
+
+type SymbolDefaultFields struct {
+    A SymbolEnum `frugal:"1,optional,SymbolEnum,default=SymbolEnum.Y"`
+    B int32      `frugal:"2,optional,i32,default=SYM_ALIAS"`
+    C string     `frugal:"3,optional,string,default=SYM_STR"`
+}
+
+type SymbolEnum int64
+
+type UndefinedSymbolFields struct {
+    A int32 `frugal:"1,optional,i32,default=SYM_UNDEFINED"`
+}
+
+func TestResolver_DefaultSymbols(t *testing.T) {
+    idl, err := ParseIDL(`
+        enum SymbolEnum { X = 1, Y }
+        const i32 SYM_NUM = 7
+        const i32 SYM_ALIAS = SYM_NUM
+        const string SYM_STR = 'abc'
+    `)
+    require.NoError(t, err)
+    RegisterSymbols(idl)
+    ret, err := ResolveFields(reflect.TypeOf(SymbolDefaultFields{}))
+    require.NoError(t, err)
+    require.Equal(t, int64(2), ret[0].Default.Int())
+    require.Equal(t, int64(7), ret[1].Default.Int())
+    require.Equal(t, "abc", ret[2].Default.String())
+    _, err = ResolveFields(reflect.TypeOf(UndefinedSymbolFields{}))
+    require.Error(t, err)
+}
+
+type TestRewriteFields struct {
+    A string `frugal:"1,default,string"`
+    B int32  `frugal:"2,default,i32"`
+    C string `frugal:"3,optional,string"`
+}
+
+func TestResolver_Rewriter(t *testing.T) {
+    vt := reflect.TypeOf(TestRewriteFields{})
+    RegisterRewriter(func(rt reflect.Type, fv []Field) ([]Field, error) {
+        if rt != vt {
+            return fv, nil
+        }
+        fv[0].ID = 9
+        fv[2].Opts |= NoCopy
+        return []Field { fv[0], fv[2] }, nil
+    })
+    ret, err := ResolveFields(vt)
+    require.NoError(t, err)
+    require.Len(t, ret, 2)
+    require.Equal(t, "C", ret[0].Name)
+    require.Equal(t, NoCopy, ret[0].Opts)
+    require.Equal(t, "A", ret[1].Name)
+    require.Equal(t, uint16(9), ret[1].ID)
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package defs
+
+import (
+    `fmt`
+    `reflect`
+    `sort`
+)
+
+// Rewriter changes the resolved fields of struct type vt, and returns the
+// fields to compile. It is invoked before the fields are cached, so it runs
+// at most once for each struct type.
+type Rewriter func(vt reflect.Type, fv []Field) ([]Field, error)
+
+var (
+    rewriterList []Rewriter
+)
+
+// RegisterRewriter adds rw to the rewriters of resolved fields. Rewriters are
+// invoked in the order they are registered, and only apply to the struct types
+// that are resolved afterwards.
+func RegisterRewriter(rw Rewriter) {
+    fieldsLock.Lock()
+    rewriterList = append(rewriterList, rw)
+    fieldsLock.Unlock()
+}
+
+// rewriteFields applies the rewriters to fv, it must be called with fieldsLock held.
+func rewriteFields(vt reflect.Type, fv []Field) ([]Field, error) {
+    var err error
+    var rw  Rewriter
+
+    /* fast path, no rewriters */
+    if len(rewriterList) == 0 {
+        return fv, nil
+    }
+
+    /* invoke every rewriter */
+    for _, rw = range rewriterList {
+        if fv, err = rw(vt, fv); err != nil {
+            return nil, fmt.Errorf("cannot rewrite fields of %s: %w", vt, err)
+        }
+    }
+
+    /* the field IDs may have been changed */
+    sort.Slice(fv, func(i, j int) bool { return fv[i].ID < fv[j].ID })
+
+    /* check for duplicates */
+    for i := 1; i < len(fv); i++ {
+        if fv[i].ID == fv[i - 1].ID {
+            return nil, fmt.Errorf("duplicated field ID %d for field %s.%s after rewriting", fv[i].ID, vt, fv[i].Name)
+        }
+    }
+
+    /* all done */
+    return fv, nil
+}
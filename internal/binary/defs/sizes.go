@@ -25,39 +25,38 @@ const (
     StackSize = 1024
 )
 
-func GetSize(vt reflect.Type) int {
-    switch vt.Kind() {
-        case reflect.Bool    : return 1
-        case reflect.Int     : return IntSize
-        case reflect.Int8    : return 1
-        case reflect.Int16   : return 2
-        case reflect.Int32   : return 4
-        case reflect.Int64   : return measureInt64(vt)
-        case reflect.Float64 : return 8
-        case reflect.Map     : return -1
-        case reflect.Ptr     : return -1
-        case reflect.Slice   : return -1
-        case reflect.String  : return -1
-        case reflect.Struct  : return measureStruct(vt)
-        default              : panic("unsupported type by Thrift")
-    }
-}
-
-func measureInt64(vt reflect.Type) int {
-    if vt == i64type {
-        return 8
-    } else {
-        return 4
+// GetSize returns the encoded size of vt if it is a constant, or -1 otherwise.
+// The size is derived from the resolved Thrift type rather than the Go type, so
+// named types are measured the same way they are encoded.
+func GetSize(vt *Type) int {
+    switch vt.T {
+        case T_bool   : return 1
+        case T_i8     : return 1
+        case T_i16    : return 2
+        case T_i32    : return 4
+        case T_enum   : return 4
+        case T_i64    : return 8
+        case T_double : return 8
+        case T_fixed  : return 8
+        case T_struct : return measureStruct(vt.S)
+        default       : return -1
     }
 }
 
 func measureStruct(vt reflect.Type) int {
     var fs int
     var rs int
+    var fv []Field
+    var ex error
+
+    /* resolve the fields */
+    if fv, ex = ResolveFields(vt); ex != nil {
+        return -1
+    }
 
-    /* measure each field, plus the 3-byte field header */
-    for i := 0; i < vt.NumField(); i++ {
-        if fs = GetSize(vt.Field(i).Type); fs > 0 {
+    /* measure each field, plus the 3-byte field header, optional fields may be omitted */
+    for _, f := range fv {
+        if fs = GetSize(f.Type); fs > 0 && f.Spec != Optional {
             rs += fs + 3
         } else {
             return -1
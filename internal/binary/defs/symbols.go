@@ -0,0 +1,82 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package defs
+
+import (
+    `strconv`
+    `strings`
+    `sync`
+)
+
+const (
+    _MaxSymbolDepth = 64
+)
+
+var (
+    symbolLock = new(sync.RWMutex)
+    symbolTab  = make(map[string]string)
+)
+
+// RegisterSymbols makes the constants and enum values defined by idl available
+// to the "default=V" option by name. Constants are referred to by their names,
+// and enum values as "Enum.VALUE". Later definitions replace earlier ones.
+func RegisterSymbols(idl *IDL) {
+    symbolLock.Lock()
+    defer symbolLock.Unlock()
+
+    /* constants keep their literals */
+    for _, cv := range idl.Consts {
+        symbolTab[cv.Name] = cv.Value
+    }
+
+    /* enum values are numbers */
+    for _, ev := range idl.Enums {
+        for _, v := range ev.Values {
+            symbolTab[ev.Name + "." + v.Name] = strconv.FormatInt(v.Value, 10)
+        }
+    }
+}
+
+// resolveSymbol finds the literal of the constant or enum value named by sv,
+// following constants that refer to other symbols.
+func resolveSymbol(sv string) (string, bool) {
+    ok := false
+    lv := sv
+
+    /* constants may refer to each other */
+    symbolLock.RLock()
+    defer symbolLock.RUnlock()
+
+    /* follow the references, but not forever */
+    for i := 0; i <= _MaxSymbolDepth; i++ {
+        if lv, ok = symbolTab[sv]; !ok || i == _MaxSymbolDepth {
+            return "", false
+        } else if lv == "" || !isident0(lv[0]) || lv == "true" || lv == "false" {
+            break
+        } else {
+            sv = lv
+        }
+    }
+
+    /* single-quoted strings are valid in Thrift but not in Go */
+    if len(lv) >= 2 && lv[0] == '\'' && lv[len(lv) - 1] == '\'' {
+        lv = `"` + strings.ReplaceAll(lv[1:len(lv) - 1], `"`, `\"`) + `"`
+    }
+
+    /* all done */
+    return lv, true
+}
@@ -22,8 +22,10 @@ import (
     `strings`
     `sync`
     `unicode`
+    `unsafe`
 
     `github.com/cloudwego/frugal/internal/utils`
+    `github.com/cloudwego/frugal/iov`
 )
 
 type Tag uint8
@@ -43,6 +45,7 @@ const (
     T_enum    Tag = 0x80
     T_binary  Tag = 0x81
     T_pointer Tag = 0x82
+    T_fixed   Tag = 0x83
 )
 
 var wireTags = [256]bool {
@@ -76,6 +79,13 @@ var (
     i64type = reflect.TypeOf(int64(0))
 )
 
+// BlobType is the type of iov.Blob, which is a binary that can be spilled by the
+// decoder, BlobHandleOffset is the offset of the handle of a spilled value.
+var (
+    BlobType         = reflect.TypeOf(iov.Blob{})
+    BlobHandleOffset = int64(unsafe.Offsetof(iov.Blob{}.Spilled))
+)
+
 func T_int() Tag {
     switch IntSize {
         case 4  : return T_i32
@@ -90,6 +100,7 @@ func (self Tag) IsWireTag() bool {
 
 type Type struct {
     T Tag
+    N int64
     K *Type
     V *Type
     S reflect.Type
@@ -116,6 +127,7 @@ func (self *Type) Tag() Tag {
     switch self.T {
         case T_enum    : return T_i32
         case T_binary  : return T_string
+        case T_fixed   : return T_i64
         case T_pointer : return self.V.Tag()
         default        : return self.T
     }
@@ -140,6 +152,7 @@ func (self *Type) String() string {
         case T_list    : return fmt.Sprintf("list<%s>", self.V.String())
         case T_enum    : return "enum"
         case T_binary  : return "binary"
+        case T_fixed   : return fmt.Sprintf("fixed(%d)", self.N)
         case T_pointer : return "*" + self.V.String()
         default        : return fmt.Sprintf("Type(Tag(%d))", self.T)
     }
@@ -174,6 +187,7 @@ func (self *Type) IsSimpleType() bool {
         case T_i64     : return true
         case T_string  : return true
         case T_enum    : return true
+        case T_fixed   : return true
         default        : return false
     }
 }
@@ -279,6 +293,11 @@ func doParseType(vt reflect.Type, def string, i *int, allowPtrs bool) (*Type, er
         default              : return nil, utils.EType(vt, "unsupported type")
     }
 
+    /* blobs are binaries, despite being structs */
+    if vt == BlobType {
+        tag = T_binary
+    }
+
     /* it's a slice, check for byte slice */
     if tag == 0 {
         if et := vt.Elem(); utils.IsByteType(et) {
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package defs
+
+import (
+    `reflect`
+)
+
+// IsUnion checks if vt is a Thrift union. Generated code for unions always
+// comes with a `CountSetFields<Name>() int` method, which is used as the marker.
+//
+// Frugal tags only describe fields and there is no place for a struct-level
+// option, while the method is emitted by thriftgo (and Kitex) for unions and
+// nothing else, so existing generated code is recognized without any changes.
+// Hand-written types can be made unions by defining the same method.
+func IsUnion(vt reflect.Type) bool {
+    if vt.Kind() != reflect.Struct || vt.Name() == "" {
+        return false
+    } else if mt, ok := reflect.PtrTo(vt).MethodByName("CountSetFields" + vt.Name()); !ok {
+        return false
+    } else {
+        return mt.Type.NumIn() == 1 && mt.Type.NumOut() == 1 && mt.Type.Out(0).Kind() == reflect.Int
+    }
+}
+
+// IsNillable checks if the field may be left unset, which is represented by a nil
+// value. A union must have exactly one field that is not nil, any non-nillable
+// fields are always considered as set.
+func (self Field) IsNillable() bool {
+    switch self.Type.T {
+        case T_map     : fallthrough
+        case T_set     : fallthrough
+        case T_list    : fallthrough
+        case T_pointer : return self.Spec == Optional
+        default        : return false
+    }
+}
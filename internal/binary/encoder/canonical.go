@@ -0,0 +1,134 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package encoder
+
+import (
+    `bytes`
+    `fmt`
+    `reflect`
+    `runtime`
+    `sync/atomic`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
+    `github.com/cloudwego/frugal/iov`
+)
+
+const (
+    _F64_NaN     = 0x7ff8000000000000   // the only NaN in canonical encoding
+    _F64_NaN_min = 0x7ff0000000000001   // smallest magnitude of NaNs
+)
+
+var (
+    canonicalCache = utils.CreateProgramCache()
+)
+
+var (
+    F_unsorted     = hir.RegisterGCall(unsorted, nil)
+    F_encode_canon *hir.CallHandle
+)
+
+func init() {
+    F_encode_canon = hir.RegisterGCall(encode_canon, emu_gcall_encode_canon)
+}
+
+func lessBool(p unsafe.Pointer, q unsafe.Pointer) bool  { return !*(*bool)(p) && *(*bool)(q) }
+func lessBytes(p unsafe.Pointer, q unsafe.Pointer) bool { return bytes.Compare(*(*[]byte)(p), *(*[]byte)(q)) < 0 }
+
+func elemLessFunc(vt *rt.GoType) func(unsafe.Pointer, unsafe.Pointer) bool {
+    switch vt.Kind() {
+        case reflect.Bool  : return lessBool
+        case reflect.Slice : return lessBytes
+        default            : return keyLessFunc(vt)
+    }
+}
+
+func isSortableElem(vt reflect.Type) bool {
+    switch vt.Kind() {
+        case reflect.Bool  : return true
+        case reflect.Slice : return vt.Elem().Kind() == reflect.Uint8
+        default            : return isSortableKey(vt)
+    }
+}
+
+func unsorted(vt *rt.GoType, p unsafe.Pointer, nb int) bool {
+    fn := elemLessFunc(vt)
+    sz := vt.Size
+
+    /* every element must be strictly greater than the previous one */
+    for i := 1; i < nb; i++ {
+        if !fn(unsafe.Pointer(uintptr(p) + uintptr(i - 1) * sz), unsafe.Pointer(uintptr(p) + uintptr(i) * sz)) {
+            return true
+        }
+    }
+
+    /* all done */
+    return false
+}
+
+func encode_canon(vt *rt.GoType, buf unsafe.Pointer, len int, mem iov.BufferWriter, p unsafe.Pointer, rs *RuntimeState, st int) (int, error) {
+    if pp, err := resolveCanonical(vt); err != nil {
+        return -1, err
+    } else {
+        ret, err := pp.fn(buf, len, mem, p, rs, st)
+        runtime.KeepAlive(pp)
+        return ret, err
+    }
+}
+
+func resolveCanonical(vt *rt.GoType) (*_Codec, error) {
+    if val := canonicalCache.Get(vt); val != nil {
+        atomic.AddUint64(&HitCount, 1)
+        return val.(*_Codec), nil
+    }
+
+    /* the canonical programs are compiled separately from the default ones */
+    atomic.AddUint64(&MissCount, 1)
+    val, err := canonicalCache.Compute(vt, compileCanonical)
+
+    /* check for errors */
+    if err != nil {
+        return nil, err
+    }
+
+    /* the type is compiled, by this goroutine or another one */
+    return val.(*_Codec), nil
+}
+
+func compileCanonical(vt *rt.GoType) (interface{}, error) {
+    return compileWith(CreateCompiler().Canonical(), vt)
+}
+
+// EncodedSizeCanonical is like EncodedSize, but measures the canonical encoding.
+func EncodedSizeCanonical(val interface{}) int {
+    if ret, err := EncodeCanonical(nil, nil, val); err != nil {
+        panic(fmt.Errorf("frugal: cannot measure encoded size: %w", err))
+    } else {
+        return ret
+    }
+}
+
+// EncodeCanonical is like EncodeObject, but encodes val with the canonical profile.
+func EncodeCanonical(buf []byte, mem iov.BufferWriter, val interface{}) (ret int, err error) {
+    if ret, err = encodeObject(buf, mem, val, encode_canon); err != nil {
+        emitErrorEvent(err)
+    }
+    return
+}
@@ -65,32 +65,39 @@ func (self Instr) Quad(i int64) int64 {
 
 func (self Instr) Disassemble() string {
     switch self.Op {
-        case OP_size_check    : fallthrough
-        case OP_size_const    : fallthrough
-        case OP_size_map      : fallthrough
-        case OP_seek          : fallthrough
-        case OP_sint          : fallthrough
-        case OP_length        : return fmt.Sprintf("%-18s%d", self.Op, self.Iv)
-        case OP_size_dyn      : fallthrough
-        case OP_memcpy_be     : return fmt.Sprintf("%-18s%d, %d", self.Op, self.Uv, self.Iv)
-        case OP_size_defer    : fallthrough
-        case OP_defer         : fallthrough
-        case OP_map_begin     : fallthrough
-        case OP_unique        : return fmt.Sprintf("%-18s%s", self.Op, self.Vt())
-        case OP_byte          : return fmt.Sprintf("%-18s0x%02x", self.Op, self.Iv)
-        case OP_word          : return fmt.Sprintf("%-18s0x%04x", self.Op, self.Iv)
-        case OP_long          : return fmt.Sprintf("%-18s0x%08x", self.Op, self.Iv)
-        case OP_quad          : return fmt.Sprintf("%-18s0x%016x", self.Op, self.Iv)
-        case OP_map_if_next   : fallthrough
-        case OP_map_if_empty  : fallthrough
-        case OP_list_if_next  : fallthrough
-        case OP_list_if_empty : fallthrough
-        case OP_goto          : fallthrough
-        case OP_if_nil        : fallthrough
-        case OP_if_hasbuf     : return fmt.Sprintf("%-18sL_%d", self.Op, self.To)
-        case OP_if_eq_imm     : return fmt.Sprintf("%-18s%d:%d, L_%d", self.Op, self.Iv, self.Uv, self.To)
-        case OP_if_eq_str     : return fmt.Sprintf("%-18s%q, L_%d", self.Op, self.Str(), self.To)
-        default               : return self.Op.String()
+        case OP_size_check       : fallthrough
+        case OP_size_const       : fallthrough
+        case OP_size_map         : fallthrough
+        case OP_seek             : fallthrough
+        case OP_sint             : fallthrough
+        case OP_fixed            : fallthrough
+        case OP_length           : return fmt.Sprintf("%-18s%d", self.Op, self.Iv)
+        case OP_size_dyn         : fallthrough
+        case OP_memcpy_be        : return fmt.Sprintf("%-18s%d, %d", self.Op, self.Uv, self.Iv)
+        case OP_size_defer       : fallthrough
+        case OP_size_defer_canon : fallthrough
+        case OP_defer            : fallthrough
+        case OP_defer_canon      : fallthrough
+        case OP_map_begin        : fallthrough
+        case OP_map_begin_sorted : fallthrough
+        case OP_unique           : fallthrough
+        case OP_sorted           : fallthrough
+        case OP_union            : return fmt.Sprintf("%-18s%s", self.Op, self.Vt())
+        case OP_byte             : return fmt.Sprintf("%-18s0x%02x", self.Op, self.Iv)
+        case OP_word             : return fmt.Sprintf("%-18s0x%04x", self.Op, self.Iv)
+        case OP_long             : return fmt.Sprintf("%-18s0x%08x", self.Op, self.Iv)
+        case OP_quad             : return fmt.Sprintf("%-18s0x%016x", self.Op, self.Iv)
+        case OP_map_if_next      : fallthrough
+        case OP_map_if_empty     : fallthrough
+        case OP_list_if_next     : fallthrough
+        case OP_list_if_empty    : fallthrough
+        case OP_goto             : fallthrough
+        case OP_if_nil           : fallthrough
+        case OP_if_hasbuf        : return fmt.Sprintf("%-18sL_%d", self.Op, self.To)
+        case OP_if_eq_imm        : return fmt.Sprintf("%-18s%d:%d, L_%d", self.Op, self.Iv, self.Uv, self.To)
+        case OP_if_eq_str        : return fmt.Sprintf("%-18s%q, L_%d", self.Op, self.Str(), self.To)
+        case OP_if_unset         : return fmt.Sprintf("%-18s*%p [%s], L_%d", self.Op, self.Pr, rt.FuncName(self.Pr), self.To)
+        default                  : return self.Op.String()
     }
 }
 
@@ -110,6 +117,8 @@ func (self *Program) i64(op OpCode, iv int64)           { self.ins(Instr { Op: o
 func (self *Program) str(op OpCode, sv string)          { self.ins(Instr { Op: op, Iv: int64(len(sv)), Pr: rt.StringPtr(sv) }) }
 func (self *Program) rtt(op OpCode, vt reflect.Type)    { self.ins(Instr { Op: op, Pr: unsafe.Pointer(rt.UnpackType(vt)) }) }
 func (self *Program) dyn(op OpCode, uv int32, iv int64) { self.ins(Instr { Op: op, Uv: uv, Iv: iv }) }
+func (self *Program) jsr(op OpCode, fn unsafe.Pointer)  { self.ins(Instr { Op: op, Pr: fn }) }
+func (self *Program) pop(fv _Field)                     { self.ins(Instr { Op: OP_drop_state, Uv: int32(fv.id), Pr: unsafe.Pointer(fv.vt) }) }
 
 func (self Program) Free() {
     freeProgram(self)
@@ -144,8 +153,16 @@ func (self Program) Disassemble() string {
     }
 }
 
+type _Field struct {
+    vt *rt.GoType
+    id uint16
+}
+
 type Compiler struct {
+    f _Field
+    c bool
     o opts.Options
+    u opts.Flag
     t map[reflect.Type]bool
 }
 
@@ -172,6 +189,18 @@ func (self *Compiler) Apply(o opts.Options) *Compiler {
     return self
 }
 
+// Canonical compiles the programs with the canonical profile, see EncodeCanonical.
+// It overrides the options that have an effect on the output, so it must be
+// called after Apply.
+func (self *Compiler) Canonical() *Compiler {
+    self.c = true
+    self.o.SortMapKeys = true
+    self.o.NilAsEmpty = true
+    self.o.OmitEmpty = false
+    self.o.IsSetMethods = false
+    return self
+}
+
 func (self *Compiler) Compile(vt reflect.Type) (_ Program, err error) {
     ret := newProgram()
     vtp := (*defs.Type)(nil)
@@ -188,20 +217,60 @@ func (self *Compiler) Compile(vt reflect.Type) (_ Program, err error) {
     /* object measuring */
     i := ret.pc()
     ret.add(OP_if_hasbuf)
-    resetCompiler(self).measure(&ret, 0, vtp, ret.pc())
+    rt.MapClear(self.t)
+    self.measure(&ret, 0, vtp, ret.pc())
 
     /* object encoding */
     j := ret.pc()
     ret.add(OP_goto)
     ret.pin(i)
-    resetCompiler(self).compile(&ret, 0, vtp, ret.pc())
+    rt.MapClear(self.t)
+    self.compile(&ret, 0, vtp, ret.pc())
 
     /* halt the program */
     ret.pin(j)
-    ret.add(OP_halt)
+    ret.rtt(OP_halt, vt)
+
+    /* count the flags of this program */
+    opts.RecordFlags(self.o.Flags() & opts.EncoderFlags, self.u)
     return Optimize(ret), nil
 }
 
+func (self *Compiler) isSetMethod(vt *defs.Type, fv defs.Field) unsafe.Pointer {
+    if !self.o.IsSetMethods || fv.Spec != defs.Optional {
+        return nil
+    } else if fp, err := defs.GetIsSetMethod(vt.S, fv.Name); err != nil {
+        panic(err)
+    } else if fp == nil {
+        return nil
+    } else {
+        self.u |= opts.F_IsSetMethods
+        return fp
+    }
+}
+
+func (self *Compiler) skipIterable(p *Program, vt *defs.Type) []int {
+    i := p.pc()
+
+    /* only nil containers are omitted by default */
+    if !self.o.OmitEmpty {
+        p.add(OP_if_nil)
+        return []int { i }
+    }
+
+    /* nil slices also have zero length */
+    self.u |= opts.F_OmitEmpty
+    if vt.T != defs.T_map {
+        p.add(OP_list_if_empty)
+        return []int { i }
+    }
+
+    /* maps must be checked for nil before checking the length */
+    p.add(OP_if_nil)
+    p.add(OP_map_if_empty)
+    return []int { i, i + 1 }
+}
+
 func (self *Compiler) CompileAndFree(vt reflect.Type) (ret Program, err error) {
     ret, err = self.Compile(vt)
     self.Free()
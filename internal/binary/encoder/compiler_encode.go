@@ -17,10 +17,14 @@
 package encoder
 
 import (
+    `fmt`
     `math`
+    `reflect`
 
     `github.com/cloudwego/frugal/internal/atm/abi`
     `github.com/cloudwego/frugal/internal/binary/defs`
+    `github.com/cloudwego/frugal/internal/opts`
+    `github.com/cloudwego/frugal/internal/rt`
 )
 
 func (self *Compiler) compile(p *Program, sp int, vt *defs.Type, startpc int) {
@@ -35,7 +39,7 @@ func (self *Compiler) compile(p *Program, sp int, vt *defs.Type, startpc int) {
 
     /* check for loops */
     if self.t[rt] || !self.o.CanInline(sp, (p.pc() - startpc) * 2) {
-        p.rtt(OP_defer, rt)
+        self.compileDefer(p, rt)
         return
     }
 
@@ -46,6 +50,11 @@ func (self *Compiler) compile(p *Program, sp int, vt *defs.Type, startpc int) {
 }
 
 func (self *Compiler) compileOne(p *Program, sp int, vt *defs.Type, startpc int) {
+    if vt.S == defs.BlobType {
+        p.add(OP_spill_check)
+    }
+
+    /* encode the value */
     switch vt.T {
         case defs.T_bool    : p.i64(OP_size_check, 1); p.i64(OP_sint, 1)
         case defs.T_i8      : p.i64(OP_size_check, 1); p.i64(OP_sint, 1)
@@ -53,7 +62,8 @@ func (self *Compiler) compileOne(p *Program, sp int, vt *defs.Type, startpc int)
         case defs.T_i32     : p.i64(OP_size_check, 4); p.i64(OP_sint, 4)
         case defs.T_i64     : p.i64(OP_size_check, 8); p.i64(OP_sint, 8)
         case defs.T_enum    : p.i64(OP_size_check, 4); p.i64(OP_sint, 4)
-        case defs.T_double  : p.i64(OP_size_check, 8); p.i64(OP_sint, 8)
+        case defs.T_double  : p.i64(OP_size_check, 8); self.compileDouble(p)
+        case defs.T_fixed   : p.i64(OP_size_check, 8); p.i64(OP_fixed, vt.N)
         case defs.T_string  : p.i64(OP_size_check, 4); p.i64(OP_length, abi.PtrSize); p.dyn(OP_memcpy_be, abi.PtrSize, 1)
         case defs.T_binary  : p.i64(OP_size_check, 4); p.i64(OP_length, abi.PtrSize); p.dyn(OP_memcpy_be, abi.PtrSize, 1)
         case defs.T_map     : self.compileMap(p, sp, vt, startpc)
@@ -65,6 +75,22 @@ func (self *Compiler) compileOne(p *Program, sp int, vt *defs.Type, startpc int)
     }
 }
 
+func (self *Compiler) compileDefer(p *Program, vt reflect.Type) {
+    if self.c {
+        p.rtt(OP_defer_canon, vt)
+    } else {
+        p.rtt(OP_defer, vt)
+    }
+}
+
+func (self *Compiler) compileDouble(p *Program) {
+    if self.c {
+        p.add(OP_double)
+    } else {
+        p.i64(OP_sint, 8)
+    }
+}
+
 func (self *Compiler) compilePtr(p *Program, sp int, vt *defs.Type, startpc int) {
     i := p.pc()
     p.tag(sp)
@@ -72,7 +98,7 @@ func (self *Compiler) compilePtr(p *Program, sp int, vt *defs.Type, startpc int)
     p.add(OP_make_state)
     p.add(OP_deref)
     self.compile(p, sp + 1, vt.V, startpc)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     p.pin(i)
 }
 
@@ -80,6 +106,11 @@ func (self *Compiler) compileMap(p *Program, sp int, vt *defs.Type, startpc int)
     kt := vt.K
     et := vt.V
 
+    /* maps are encoded in the order of their keys */
+    if self.c && !isSortableKey(kt.S) {
+        panic(fmt.Errorf("frugal: keys of %s have no canonical order", vt.S))
+    }
+
     /* 6-byte map header */
     p.tag(sp)
     p.i64(OP_size_check, 6)
@@ -95,15 +126,32 @@ func (self *Compiler) compileMap(p *Program, sp int, vt *defs.Type, startpc int)
     j := p.pc()
     p.add(OP_map_if_empty)
     p.add(OP_make_state)
-    p.rtt(OP_map_begin, vt.S)
+
+    /* sort the keys if required */
+    if self.o.SortMapKeys && isSortableKey(kt.S) {
+        self.u |= opts.F_SortMapKeys
+        p.rtt(OP_map_begin_sorted, vt.S)
+    } else {
+        p.rtt(OP_map_begin, vt.S)
+    }
+
+    /* encode every key-value pair */
     k := p.pc()
     p.add(OP_map_key)
     self.compileItem(p, sp + 1, kt, startpc)
     p.add(OP_map_value)
     self.compileItem(p, sp + 1, et, startpc)
-    p.add(OP_map_next)
+
+    /* move to the next pair */
+    if self.o.SortMapKeys && isSortableKey(kt.S) {
+        p.add(OP_map_next_sorted)
+    } else {
+        p.add(OP_map_next)
+    }
+
+    /* loop until all pairs are encoded */
     p.jmp(OP_map_if_next, k)
-    p.add(OP_drop_state)
+    p.pop(self.f)
 
     /* encode the length for nil maps */
     r := p.pc()
@@ -138,11 +186,25 @@ func (self *Compiler) compileSeq(p *Program, sp int, vt *defs.Type, startpc int,
         case defs.T_double : nb = 8
     }
 
+    /* canonical doubles must be checked one by one */
+    if self.c && et.T == defs.T_double {
+        nb = -1
+    }
+
     /* check for uniqueness if needed */
     if verifyUnique {
         p.rtt(OP_unique, et.S)
     }
 
+    /* canonical sets must be sorted by the caller */
+    if verifyUnique && self.c {
+        if !isSortableElem(et.S) {
+            panic(fmt.Errorf("frugal: elements of %s have no canonical order", vt.S))
+        } else {
+            p.rtt(OP_sorted, et.S)
+        }
+    }
+
     /* check if this is the special case */
     if nb != -1 {
         p.dyn(OP_memcpy_be, abi.PtrSize, int64(nb))
@@ -163,7 +225,7 @@ func (self *Compiler) compileSeq(p *Program, sp int, vt *defs.Type, startpc int,
     self.compileItem(p, sp + 1, et, startpc)
     p.add(OP_list_decr)
     p.jmp(OP_list_if_next, r)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     p.pin(i)
     p.pin(j)
 }
@@ -190,7 +252,7 @@ func (self *Compiler) compileItem(p *Program, sp int, vt *defs.Type, startpc int
     p.add(OP_make_state)
     p.add(OP_deref)
     self.compile(p, sp + 1, elem, startpc)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     j := p.pc()
     p.add(OP_goto)
     p.pin(i)
@@ -208,12 +270,34 @@ func (self *Compiler) compileStruct(p *Program, sp int, vt *defs.Type, startpc i
         panic(err)
     }
 
+    /* unions must have exactly one field set */
+    if defs.IsUnion(vt.S) {
+        p.rtt(OP_union, vt.S)
+    }
+
     /* compile every field */
     for _, fv := range fvs {
+        i := p.pc()
         p.tag(sp)
+
+        /* skip the field if its IsSet method reports unset */
+        fp := self.isSetMethod(vt, fv)
+        if fp != nil {
+            p.jsr(OP_if_unset, fp)
+        }
+
+        /* encode the field */
+        fr := self.f
+        self.f = _Field { rt.UnpackType(vt.S), fv.ID }
         p.i64(OP_seek, int64(fv.F))
         self.compileStructField(p, sp + 1, fv, startpc)
         p.i64(OP_seek, -int64(fv.F))
+        self.f = fr
+
+        /* pin the skip branch */
+        if fp != nil {
+            p.pin(i)
+        }
     }
 
     /* add the STOP field */
@@ -236,8 +320,9 @@ func (self *Compiler) compileStructField(p *Program, sp int, fv defs.Field, star
         case defs.T_i64    : fallthrough
         case defs.T_string : fallthrough
         case defs.T_enum   : fallthrough
+        case defs.T_fixed  : fallthrough
         case defs.T_binary : {
-            if fv.Default.IsValid() && fv.Spec == defs.Optional {
+            if fv.Default.IsValid() && fv.Spec == defs.Optional && !self.c {
                 self.compileStructDefault(p, sp, fv, startpc)
             } else {
                 self.compileStructRequired(p, sp, fv, startpc)
@@ -287,6 +372,7 @@ func (self *Compiler) compileStructDefault(p *Program, sp int, fv defs.Field, st
         case defs.T_i64    : p.dyn(OP_if_eq_imm, 8, fv.Default.Int())
         case defs.T_string : p.str(OP_if_eq_str, fv.Default.String())
         case defs.T_enum   : p.dyn(OP_if_eq_imm, 4, fv.Default.Int())
+        case defs.T_fixed  : p.dyn(OP_if_eq_imm, 8, int64(math.Float64bits(fv.Default.Float())))
         case defs.T_binary : p.str(OP_if_eq_str, mem2str(fv.Default.Bytes()))
         default            : panic("unreachable")
     }
@@ -304,7 +390,7 @@ func (self *Compiler) compileStructPointer(p *Program, sp int, fv defs.Field, st
     p.add(OP_make_state)
     p.add(OP_deref)
     self.compile(p, sp + 1, fv.Type.V, startpc)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     j := p.pc()
     p.add(OP_goto)
     p.pin(i)
@@ -314,11 +400,21 @@ func (self *Compiler) compileStructPointer(p *Program, sp int, fv defs.Field, st
 }
 
 func (self *Compiler) compileStructIterable(p *Program, sp int, fv defs.Field, startpc int) {
-    i := p.pc()
-    p.add(OP_if_nil)
+    if !self.o.OmitEmpty && self.o.NilAsEmpty {
+        self.u |= opts.F_NilAsEmpty
+        self.compileStructRequired(p, sp, fv, startpc)
+        return
+    }
+
+    /* skip nil or empty containers */
+    pc := self.skipIterable(p, fv.Type)
     self.compileStructFieldBegin(p, fv, 3)
     self.compile(p, sp, fv.Type, startpc)
-    p.pin(i)
+
+    /* pin all the branches */
+    for _, i := range pc {
+        p.pin(i)
+    }
 }
 
 func (self *Compiler) compileStructOptional(p *Program, sp int, fv defs.Field, startpc int) {
@@ -328,7 +424,7 @@ func (self *Compiler) compileStructOptional(p *Program, sp int, fv defs.Field, s
     p.add(OP_make_state)
     p.add(OP_deref)
     self.compile(p, sp + 1, fv.Type.V, startpc)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     p.pin(i)
 }
 
@@ -18,11 +18,22 @@ package encoder
 
 import (
     `math`
+    `reflect`
 
     `github.com/cloudwego/frugal/internal/atm/abi`
     `github.com/cloudwego/frugal/internal/binary/defs`
+    `github.com/cloudwego/frugal/internal/opts`
+    `github.com/cloudwego/frugal/internal/rt`
 )
 
+func (self *Compiler) measureDefer(p *Program, vt reflect.Type) {
+    if self.c {
+        p.rtt(OP_size_defer_canon, vt)
+    } else {
+        p.rtt(OP_size_defer, vt)
+    }
+}
+
 func (self *Compiler) measure(p *Program, sp int, vt *defs.Type, startpc int) {
     rt := vt.S
     tt := vt.T
@@ -35,7 +46,7 @@ func (self *Compiler) measure(p *Program, sp int, vt *defs.Type, startpc int) {
 
     /* check for loops with inlining depth limit */
     if self.t[rt] || !self.o.CanInline(sp, (p.pc() - startpc) * 2) {
-        p.rtt(OP_size_defer, rt)
+        self.measureDefer(p, rt)
         return
     }
 
@@ -54,6 +65,7 @@ func (self *Compiler) measureOne(p *Program, sp int, vt *defs.Type, startpc int)
         case defs.T_i64     : p.i64(OP_size_const, 8)
         case defs.T_enum    : p.i64(OP_size_const, 4)
         case defs.T_double  : p.i64(OP_size_const, 8)
+        case defs.T_fixed   : p.i64(OP_size_const, 8)
         case defs.T_string  : p.i64(OP_size_const, 4); p.dyn(OP_size_dyn, abi.PtrSize, 1)
         case defs.T_binary  : p.i64(OP_size_const, 4); p.dyn(OP_size_dyn, abi.PtrSize, 1)
         case defs.T_map     : self.measureMap(p, sp, vt, startpc)
@@ -72,13 +84,13 @@ func (self *Compiler) measurePtr(p *Program, sp int, vt *defs.Type, startpc int)
     p.add(OP_make_state)
     p.add(OP_deref)
     self.measure(p, sp + 1, vt.V, startpc)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     p.pin(i)
 }
 
 func (self *Compiler) measureMap(p *Program, sp int, vt *defs.Type, startpc int) {
-    nk := defs.GetSize(vt.K.S)
-    nv := defs.GetSize(vt.V.S)
+    nk := defs.GetSize(vt.K)
+    nv := defs.GetSize(vt.V)
 
     /* 6-byte map header */
     p.tag(sp)
@@ -121,14 +133,14 @@ func (self *Compiler) measureMap(p *Program, sp int, vt *defs.Type, startpc int)
     /* move to the next state */
     p.add(OP_map_next)
     p.jmp(OP_map_if_next, k)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     p.pin(i)
     p.pin(j)
 }
 
 func (self *Compiler) measureSeq(p *Program, sp int, vt *defs.Type, startpc int) {
     et := vt.V
-    nb := defs.GetSize(et.S)
+    nb := defs.GetSize(et)
 
     /* 5-byte list or set header */
     p.tag(sp)
@@ -158,7 +170,7 @@ func (self *Compiler) measureSeq(p *Program, sp int, vt *defs.Type, startpc int)
     self.measureItem(p, sp + 1, et, startpc)
     p.add(OP_list_decr)
     p.jmp(OP_list_if_next, r)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     p.pin(i)
     p.pin(j)
 }
@@ -185,7 +197,7 @@ func (self *Compiler) measureItem(p *Program, sp int, vt *defs.Type, startpc int
     p.add(OP_make_state)
     p.add(OP_deref)
     self.measure(p, sp + 1, elem, startpc)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     j := p.pc()
     p.add(OP_goto)
     p.pin(i)
@@ -198,7 +210,7 @@ func (self *Compiler) measureStruct(p *Program, sp int, vt *defs.Type, startpc i
     var fvs []defs.Field
 
     /* struct is trivially measuable */
-    if nb := defs.GetSize(vt.S); nb > 0 {
+    if nb := defs.GetSize(vt); nb > 0 {
         p.i64(OP_size_const, int64(nb))
         return
     }
@@ -220,9 +232,26 @@ func (self *Compiler) measureStruct(p *Program, sp int, vt *defs.Type, startpc i
 
     /* measure every field */
     for _, fv := range fvs {
+        i := p.pc()
+        fp := self.isSetMethod(vt, fv)
+
+        /* skip the field if its IsSet method reports unset */
+        if fp != nil {
+            p.jsr(OP_if_unset, fp)
+        }
+
+        /* measure the field */
+        fr := self.f
+        self.f = _Field { rt.UnpackType(vt.S), fv.ID }
         p.i64(OP_seek, int64(fv.F))
         self.measureField(p, sp + 1, fv, startpc)
         p.i64(OP_seek, -int64(fv.F))
+        self.f = fr
+
+        /* pin the skip branch */
+        if fp != nil {
+            p.pin(i)
+        }
     }
 }
 
@@ -241,8 +270,9 @@ func (self *Compiler) measureField(p *Program, sp int, fv defs.Field, startpc in
         case defs.T_i64    : fallthrough
         case defs.T_string : fallthrough
         case defs.T_enum   : fallthrough
+        case defs.T_fixed  : fallthrough
         case defs.T_binary : {
-            if fv.Default.IsValid() && fv.Spec == defs.Optional {
+            if fv.Default.IsValid() && fv.Spec == defs.Optional && !self.c {
                 self.measureStructDefault(p, sp, fv, startpc)
             } else {
                 self.measureStructRequired(p, sp, fv, startpc)
@@ -292,6 +322,7 @@ func (self *Compiler) measureStructDefault(p *Program, sp int, fv defs.Field, st
         case defs.T_i64    : p.dyn(OP_if_eq_imm, 8, fv.Default.Int())
         case defs.T_string : p.str(OP_if_eq_str, fv.Default.String())
         case defs.T_enum   : p.dyn(OP_if_eq_imm, 4, fv.Default.Int())
+        case defs.T_fixed  : p.dyn(OP_if_eq_imm, 8, int64(math.Float64bits(fv.Default.Float())))
         case defs.T_binary : p.str(OP_if_eq_str, mem2str(fv.Default.Bytes()))
         default            : panic("unreachable")
     }
@@ -309,7 +340,7 @@ func (self *Compiler) measureStructPointer(p *Program, sp int, fv defs.Field, st
     p.add(OP_make_state)
     p.add(OP_deref)
     self.measure(p, sp + 1, fv.Type.V, startpc)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     j := p.pc()
     p.add(OP_goto)
     p.pin(i)
@@ -318,11 +349,21 @@ func (self *Compiler) measureStructPointer(p *Program, sp int, fv defs.Field, st
 }
 
 func (self *Compiler) measureStructIterable(p *Program, sp int, fv defs.Field, startpc int) {
-    i := p.pc()
-    p.add(OP_if_nil)
+    if !self.o.OmitEmpty && self.o.NilAsEmpty {
+        self.u |= opts.F_NilAsEmpty
+        self.measureStructRequired(p, sp, fv, startpc)
+        return
+    }
+
+    /* skip nil or empty containers */
+    pc := self.skipIterable(p, fv.Type)
     p.i64(OP_size_const, 3)
     self.measure(p, sp, fv.Type, startpc)
-    p.pin(i)
+
+    /* pin all the branches */
+    for _, i := range pc {
+        p.pin(i)
+    }
 }
 
 func (self *Compiler) measureStructOptional(p *Program, sp int, fv defs.Field, startpc int) {
@@ -332,7 +373,7 @@ func (self *Compiler) measureStructOptional(p *Program, sp int, fv defs.Field, s
     p.add(OP_make_state)
     p.add(OP_deref)
     self.measure(p, sp + 1, fv.Type.V, startpc)
-    p.add(OP_drop_state)
+    p.pop(self.f)
     p.pin(i)
 }
 
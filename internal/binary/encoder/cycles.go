@@ -0,0 +1,64 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package encoder
+
+import (
+    `fmt`
+    `reflect`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/iov`
+)
+
+// CycleError is returned by the encoder when cycle detection is enabled, and
+// the object graph refers back to an object that is still being encoded.
+type CycleError struct {
+    Type reflect.Type
+}
+
+func (self CycleError) Error() string {
+    return fmt.Sprintf("frugal: cyclic object graph detected at type %s", self.Type)
+}
+
+type _Visit struct {
+    vt *rt.GoType
+    vp unsafe.Pointer
+}
+
+/* a cycle in the object graph is also a cycle in the type graph, and recursive
+ * types are never inlined into themselves, so every cycle goes through encode */
+func encodeTracked(vt *rt.GoType, buf unsafe.Pointer, len int, mem iov.BufferWriter, p unsafe.Pointer, rs *RuntimeState, st int) (int, error) {
+    key := _Visit { vt, p }
+
+    /* create the path set on first use */
+    if rs.Vs == nil {
+        rs.Vs = make(map[_Visit]struct{})
+    }
+
+    /* check if the object is already on the path */
+    if _, ok := rs.Vs[key]; ok {
+        return -1, CycleError { vt.Pack() }
+    }
+
+    /* encode the object with it on the path */
+    rs.Vs[key] = struct{}{}
+    ret, err := invoke(vt, buf, len, mem, p, rs, st)
+    delete(rs.Vs, key)
+    return ret, err
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encoder
+
+import (
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/opts`
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
+    `github.com/cloudwego/frugal/iov`
+)
+
+var (
+    deoptTable = utils.CreateDeoptTable("encoder")
+)
+
+func (self *_Codec) call(vt *rt.GoType, buf unsafe.Pointer, len int, mem iov.BufferWriter, p unsafe.Pointer, rs *RuntimeState, st int) (int, error) {
+    if opts.DeoptThreshold == 0 {
+        return self.fn(buf, len, mem, p, rs, st)
+    } else {
+        return self.guard(vt, buf, len, mem, p, rs, st)
+    }
+}
+
+func (self *_Codec) guard(vt *rt.GoType, buf unsafe.Pointer, len int, mem iov.BufferWriter, p unsafe.Pointer, rs *RuntimeState, st int) (ret int, err error) {
+    defer self.rescue(vt, &ret, &err)
+    return self.fn(buf, len, mem, p, rs, st)
+}
+
+func (self *_Codec) rescue(vt *rt.GoType, rp *int, ep *error) {
+    if val := recover(); val != nil {
+        if !utils.IsFault(val) {
+            panic(val)
+        }
+
+        /* the output buffer is incomplete */
+        *rp = -1
+        *ep = utils.FaultError {
+            Kind  : "encoder",
+            Type  : vt.Pack(),
+            Value : val,
+        }
+
+        /* relink the type with the emulator the next time it is used */
+        if IsNative() && deoptTable.Fault(vt, codeOf(self.fn), val, opts.DeoptThreshold) {
+            programCache.Remove(vt)
+        }
+    }
+}
+
+func codeOf(fn Encoder) unsafe.Pointer {
+    return **(**unsafe.Pointer)(unsafe.Pointer(&fn))
+}
@@ -18,7 +18,9 @@ package encoder
 
 import (
     `fmt`
+    `runtime`
     `sync/atomic`
+    `time`
     `unsafe`
 
     `github.com/cloudwego/frugal/internal/opts`
@@ -36,32 +38,74 @@ type Encoder func (
     st  int,
 ) (int, error)
 
+type _Entry func (
+    vt  *rt.GoType,
+    buf unsafe.Pointer,
+    len int,
+    mem iov.BufferWriter,
+    p   unsafe.Pointer,
+    rs  *RuntimeState,
+    st  int,
+) (int, error)
+
 var (
-    HitCount  uint64 = 0
-    MissCount uint64 = 0
-    TypeCount uint64 = 0
+    HitCount    uint64 = 0
+    MissCount   uint64 = 0
+    TypeCount   uint64 = 0
+    ErrorCount  uint64 = 0
+    EmuCount    uint64 = 0
+    CompileTime uint64 = 0
 )
 
 var (
     programCache = utils.CreateProgramCache()
 )
 
+// _Codec is a linked program. The code is freed by the garbage collector once
+// the codec is unreachable, so callers must keep the codec alive with
+// runtime.KeepAlive until the program returns.
+type _Codec struct {
+    fn Encoder
+}
+
+func newCodec(fn Encoder, free func()) *_Codec {
+    ret := &_Codec { fn: fn }
+
+    /* free the code lazily, calling the program requires no synchronization this way */
+    if free != nil {
+        runtime.SetFinalizer(ret, func(*_Codec) { free() })
+    }
+
+    /* all done */
+    return ret
+}
+
 func encode(vt *rt.GoType, buf unsafe.Pointer, len int, mem iov.BufferWriter, p unsafe.Pointer, rs *RuntimeState, st int) (int, error) {
-    if enc, err := resolve(vt); err != nil {
+    if opts.DetectCycles {
+        return encodeTracked(vt, buf, len, mem, p, rs, st)
+    } else {
+        return invoke(vt, buf, len, mem, p, rs, st)
+    }
+}
+
+func invoke(vt *rt.GoType, buf unsafe.Pointer, len int, mem iov.BufferWriter, p unsafe.Pointer, rs *RuntimeState, st int) (int, error) {
+    if pp, err := resolve(vt); err != nil {
         return -1, err
     } else {
-        return enc(buf, len, mem, p, rs, st)
+        ret, err := pp.call(vt, buf, len, mem, p, rs, st)
+        runtime.KeepAlive(pp)
+        return ret, err
     }
 }
 
-func resolve(vt *rt.GoType) (Encoder, error) {
+func resolve(vt *rt.GoType) (*_Codec, error) {
     var err error
     var val interface{}
 
     /* fast-path: type is cached */
     if val = programCache.Get(vt); val != nil {
         atomic.AddUint64(&HitCount, 1)
-        return val.(Encoder), nil
+        return val.(*_Codec), nil
     }
 
     /* record the cache miss, and compile the type */
@@ -73,40 +117,65 @@ func resolve(vt *rt.GoType) (Encoder, error) {
         return nil, err
     }
 
-    /* record the successful compilation */
-    atomic.AddUint64(&TypeCount, 1)
-    return val.(Encoder), nil
+    /* the type is compiled, by this goroutine or another one */
+    return val.(*_Codec), nil
 }
 
 func compile(vt *rt.GoType) (interface{}, error) {
-    if pp, err := CreateCompiler().CompileAndFree(vt.Pack()); err != nil {
-        return nil, err
-    } else {
-        return Link(Translate(pp)), nil
-    }
+    return compileWith(CreateCompiler(), vt)
 }
 
 func mkcompile(opts opts.Options) func(*rt.GoType) (interface{}, error) {
     return func(vt *rt.GoType) (interface{}, error) {
-        if pp, err := CreateCompiler().Apply(opts).CompileAndFree(vt.Pack()); err != nil {
-            return nil, err
-        } else {
-            return Link(Translate(pp)), nil
-        }
+        return compileWith(CreateCompiler().Apply(opts), vt)
+    }
+}
+
+func compileWith(cc *Compiler, vt *rt.GoType) (interface{}, error) {
+    ts := time.Now()
+    pp, err := cc.CompileAndFree(vt.Pack())
+
+    /* check for compilation errors */
+    if err != nil {
+        return nil, err
     }
+
+    /* translate and link the program */
+    ret, nb := linkProgram(vt, pp)
+    emitCompileEvent(vt, nb, ts)
+    return ret, nil
+}
+
+func emitCompileEvent(vt *rt.GoType, nb int, ts time.Time) {
+    dt := time.Since(ts)
+    atomic.AddUint64(&TypeCount, 1)
+    atomic.AddUint64(&CompileTime, uint64(dt))
+    utils.EmitCompileEvent("encoder", vt, nb, dt)
+}
+
+func emitErrorEvent(err error) {
+    atomic.AddUint64(&ErrorCount, 1)
+    utils.EmitErrorEvent("encoder", err)
 }
 
 func Pretouch(vt *rt.GoType, opts opts.Options) error {
     if programCache.Get(vt) != nil {
         return nil
-    } else if _, err := programCache.Compute(vt, mkcompile(opts)); err != nil {
-        return err
     } else {
-        atomic.AddUint64(&TypeCount, 1)
-        return nil
+        _, err := programCache.Compute(vt, mkcompile(opts))
+        return err
     }
 }
 
+func Pin(vt *rt.GoType) {
+    programCache.Pin(vt)
+}
+
+func Release(vt *rt.GoType) {
+    programCache.Remove(vt)
+    canonicalCache.Remove(vt)
+}
+
 func EncodedSize(val interface{}) int {
     if ret, err := EncodeObject(nil, nil, val); err != nil {
         panic(fmt.Errorf("frugal: cannot measure encoded size: %w", err))
@@ -116,18 +185,31 @@ func EncodedSize(val interface{}) int {
 }
 
 func EncodeObject(buf []byte, mem iov.BufferWriter, val interface{}) (ret int, err error) {
+    if ret, err = encodeObject(buf, mem, val, encode); err != nil {
+        emitErrorEvent(err)
+    }
+    return
+}
+
+func encodeObject(buf []byte, mem iov.BufferWriter, val interface{}, fn _Entry) (ret int, err error) {
     rst := newRuntimeState()
     efv := rt.UnpackEface(val)
     out := (*rt.GoSlice)(unsafe.Pointer(&buf))
 
     /* check for indirect types */
     if efv.Type.IsIndirect() {
-        ret, err = encode(efv.Type, out.Ptr, out.Len, mem, efv.Value, rst, 0)
+        ret, err = fn(efv.Type, out.Ptr, out.Len, mem, efv.Value, rst, 0)
     } else {
-        ret, err = encode(efv.Type, out.Ptr, out.Len, mem, rt.NoEscape(unsafe.Pointer(&efv.Value)), rst, 0)
+        ret, err = fn(efv.Type, out.Ptr, out.Len, mem, rt.NoEscape(unsafe.Pointer(&efv.Value)), rst, 0)
+
+        /* the pooled state must not refer to this stack, which can be freed and
+         * reused as heap memory before the state is used again */
+        rst.St[0].Wp = nil
     }
 
     /* return the state into pool */
     freeRuntimeState(rst)
+
+    /* all done */
     return
 }
@@ -19,8 +19,20 @@ package encoder
 import (
     `bytes`
     `encoding/base64`
+    `math`
+    `reflect`
+    `runtime`
+    `sync`
+    `sync/atomic`
     `testing`
+    `time`
+    `unsafe`
 
+    `github.com/cloudwego/frugal/internal/loader`
+    `github.com/cloudwego/frugal/internal/opts`
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
+    `github.com/cloudwego/frugal/iov`
     `github.com/davecgh/go-spew/spew`
     `github.com/stretchr/testify/require`
 )
@@ -122,3 +134,534 @@ func TestEncoder_ContainerPointerElement(t *testing.T) {
         0x00,                                                   // end
     }, buf[:nx])
 }
+
+type FixedPoint struct {
+    A float64  `frugal:"1,default,double,scale=100"`
+    B *float64 `frugal:"2,optional,double,scale=10000"`
+}
+
+func TestEncoder_FixedPoint(t *testing.T) {
+    v := FixedPoint{A: 12.34, B: &(&struct{ x float64 }{-0.0002}).x}
+    buf := make([]byte, EncodedSize(v))
+    nb, err := EncodeObject(buf, nil, v)
+    require.NoError(t, err)
+    require.Equal(t, []byte {
+        0x0a, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0xd2,     // field 1: i64 1234
+        0x0a, 0x00, 0x02, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe,     // field 2: i64 -2
+        0x00,                                                                 // end
+    }, buf[:nb])
+    _, err = EncodeObject(buf, nil, FixedPoint{A: 1e300})
+    require.Error(t, err)
+}
+
+type UnionTest struct {
+    A *int64  `frugal:"1,optional,i64"`
+    B *string `frugal:"2,optional,string"`
+    C []int32 `frugal:"3,optional,list<i32>"`
+}
+
+func (self *UnionTest) CountSetFieldsUnionTest() int {
+    return 0
+}
+
+func TestEncoder_Union(t *testing.T) {
+    buf := make([]byte, 64)
+    nb, err := EncodeObject(buf, nil, UnionTest{C: []int32{}})
+    require.NoError(t, err)
+    require.Equal(t, []byte {
+        0x0f, 0x00, 0x03, 0x08, 0x00, 0x00, 0x00, 0x00,     // field 3: list<i32> []
+        0x00,                                               // end
+    }, buf[:nb])
+    _, err = EncodeObject(buf, nil, UnionTest{})
+    require.EqualError(t, err, "frugal: union encoder.UnionTest must have exactly one field set (0 set)")
+    _, err = EncodeObject(buf, nil, &UnionTest{A: new(int64), B: new(string)})
+    require.EqualError(t, err, "frugal: union encoder.UnionTest must have exactly one field set (2 set)")
+}
+
+type SortedMapKeys struct {
+    A map[int32]string `frugal:"1,default,map<i32:string>"`
+    B map[string]int64 `frugal:"2,default,map<string:i64>"`
+}
+
+func TestEncoder_SortMapKeys(t *testing.T) {
+    o := opts.GetDefaultOptions()
+    o.SortMapKeys = true
+    require.NoError(t, Pretouch(rt.UnpackType(reflect.TypeOf(SortedMapKeys{})), o))
+    v := SortedMapKeys {
+        A: map[int32]string{3: "c", -1: "a", 2: "b"},
+        B: map[string]int64{"zz": 1, "a": 2, "m": 3},
+    }
+    for i := 0; i < 16; i++ {
+        buf := make([]byte, EncodedSize(v))
+        nb, err := EncodeObject(buf, nil, v)
+        require.NoError(t, err)
+        require.Equal(t, []byte {
+            0x0d, 0x00, 0x01, 0x08, 0x0b, 0x00, 0x00, 0x00, 0x03,                          // field 1: map<i32:string>, len = 3
+            0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x01, 'a',                           //     -1 => "a"
+            0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 'b',                           //      2 => "b"
+            0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 'c',                           //      3 => "c"
+            0x0d, 0x00, 0x02, 0x0b, 0x0a, 0x00, 0x00, 0x00, 0x03,                          // field 2: map<string:i64>, len = 3
+            0x00, 0x00, 0x00, 0x01, 'a', 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 2,      //     "a"  => 2
+            0x00, 0x00, 0x00, 0x01, 'm', 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 3,      //     "m"  => 3
+            0x00, 0x00, 0x00, 0x02, 'z', 'z', 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 1, //     "zz" => 1
+            0x00,                                                                          // end
+        }, buf[:nb])
+    }
+}
+
+type SizeOverflow struct {
+    A []byte `frugal:"1,default,binary"`
+    B []byte `frugal:"2,default,binary"`
+}
+
+func TestEncoder_SizeOverflow(t *testing.T) {
+    var v SizeOverflow
+    var b byte
+    *(*rt.GoSlice)(unsafe.Pointer(&v.A)) = rt.GoSlice{Ptr: unsafe.Pointer(&b), Len: 1 << 62, Cap: 1 << 62}
+    v.B = v.A
+    require.PanicsWithError(t, "frugal: cannot measure encoded size: frugal: encoded size overflows", func() { EncodedSize(v) })
+}
+
+type LengthOverflow struct {
+    A []byte  `frugal:"1,default,binary"`
+    B []int32 `frugal:"2,default,list<i32>"`
+}
+
+func TestEncoder_LengthOverflow(t *testing.T) {
+    var v LengthOverflow
+    var b [4]byte
+    buf := make([]byte, 64)
+    *(*rt.GoSlice)(unsafe.Pointer(&v.A)) = rt.GoSlice{Ptr: unsafe.Pointer(&b), Len: 1 << 31, Cap: 1 << 31}
+    _, err := EncodeObject(buf, nil, v)
+    require.Equal(t, LengthError { 1 << 31 }, err)
+    v.A = nil
+    *(*rt.GoSlice)(unsafe.Pointer(&v.B)) = rt.GoSlice{Ptr: unsafe.Pointer(&b), Len: 1 << 32, Cap: 1 << 32}
+    _, err = EncodeObject(buf, nil, v)
+    require.EqualError(t, err, "frugal: length 4294967296 exceeds the maximum of 2147483647")
+}
+
+type EmptyContainers struct {
+    A []int32          `frugal:"1,optional,list<i32>"`
+    B map[string]int32 `frugal:"2,optional,map<string:i32>"`
+    C []string         `frugal:"3,optional,list<string>"`
+}
+
+func TestEncoder_EmptyContainers(t *testing.T) {
+    v := EmptyContainers {
+        A: []int32{},
+        B: map[string]int32{},
+        C: []string{"a"},
+    }
+    o := opts.GetDefaultOptions()
+    o.OmitEmpty = true
+    require.NoError(t, Pretouch(rt.UnpackType(reflect.TypeOf(v)), o))
+    buf := make([]byte, EncodedSize(v))
+    nb, err := EncodeObject(buf, nil, v)
+    require.NoError(t, err)
+    require.Equal(t, []byte {
+        0x0f, 0x00, 0x03, 0x0b, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 'a',  // field 3: list<string> ["a"]
+        0x00,                                                                        // end
+    }, buf[:nb])
+    o.OmitEmpty = false
+    o.NilAsEmpty = true
+    require.NoError(t, Pretouch(rt.UnpackType(reflect.TypeOf(&v)), o))
+    buf = make([]byte, EncodedSize(&EmptyContainers{}))
+    nb, err = EncodeObject(buf, nil, &EmptyContainers{})
+    require.NoError(t, err)
+    require.Equal(t, []byte {
+        0x0f, 0x00, 0x01, 0x08, 0x00, 0x00, 0x00, 0x00,         // field 1: list<i32> []
+        0x0d, 0x00, 0x02, 0x0b, 0x08, 0x00, 0x00, 0x00, 0x00,   // field 2: map<string:i32> {}
+        0x0f, 0x00, 0x03, 0x0b, 0x00, 0x00, 0x00, 0x00,         // field 3: list<string> []
+        0x00,                                                   // end
+    }, buf[:nb])
+}
+
+func waitFnCount(t *testing.T, n uint32) {
+    for i := 0; i < 100 && atomic.LoadUint32(&loader.FnCount) != n; i++ {
+        runtime.GC()
+        time.Sleep(time.Millisecond)
+    }
+    require.Equal(t, n, atomic.LoadUint32(&loader.FnCount))
+}
+
+type TestRelease struct {
+    A int64  `frugal:"1,default,i64"`
+    B string `frugal:"2,default,string"`
+}
+
+func TestEncoder_Release(t *testing.T) {
+    v := TestRelease{A: 1, B: "foo"}
+    vt := rt.UnpackType(reflect.TypeOf(v))
+    buf := make([]byte, EncodedSize(v))
+    require.NotNil(t, programCache.Get(vt))
+    nf := loader.FnCount
+    Release(vt)
+    require.Nil(t, programCache.Get(vt))
+    if IsNative() {
+        waitFnCount(t, nf - 1)
+    }
+    wg := sync.WaitGroup{}
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 100; j++ {
+                _, err := EncodeObject(buf, nil, v)
+                require.NoError(t, err)
+            }
+        }()
+    }
+    for i := 0; i < 20; i++ {
+        Release(vt)
+    }
+    wg.Wait()
+    require.Equal(t, []byte{0x0a, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 1, 0x0b, 0x00, 0x02, 0, 0, 0, 3, 'f', 'o', 'o', 0}, buf)
+}
+
+type IsSetMethods struct {
+    A int32  `frugal:"1,optional,i32"`
+    B string `frugal:"2,optional,string"`
+    C int32  `frugal:"3,default,i32"`
+    m uint8
+}
+
+func (self *IsSetMethods) IsSetA() bool { return self.m & 1 != 0 }
+func (self *IsSetMethods) IsSetB() bool { return self.m & 2 != 0 }
+func (self *IsSetMethods) IsSetC() bool { return false }
+
+func TestEncoder_IsSetMethods(t *testing.T) {
+    v := &IsSetMethods{A: 1, B: "b", C: 3, m: 2}
+    o := opts.GetDefaultOptions()
+    o.IsSetMethods = true
+    require.NoError(t, Pretouch(rt.UnpackType(reflect.TypeOf(v)), o))
+    buf := make([]byte, EncodedSize(v))
+    nb, err := EncodeObject(buf, nil, v)
+    require.NoError(t, err)
+    require.Equal(t, []byte {
+        0x0b, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 'b',  // field 2: string "b"
+        0x08, 0x00, 0x03, 0x00, 0x00, 0x00, 0x03,       // field 3: i32 3
+        0x00,                                           // end
+    }, buf[:nb])
+}
+
+type TestConcurrentCompile struct {
+    A int64  `frugal:"1,default,i64"`
+    B string `frugal:"2,default,string"`
+}
+
+func TestEncoder_ConcurrentCompile(t *testing.T) {
+    v := TestConcurrentCompile{A: 1, B: "foo"}
+    nt := TypeCount
+    wg := sync.WaitGroup{}
+    for i := 0; i < 32; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            require.Equal(t, 22, EncodedSize(v))
+        }()
+    }
+    wg.Wait()
+    require.Equal(t, nt + 1, TypeCount)
+}
+
+type TestTagDefault struct {
+    A int32  `frugal:"1,optional,i32,default=7"`
+    B string `frugal:"2,optional,string,default=hi"`
+}
+
+func TestEncoder_TagDefault(t *testing.T) {
+    buf := make([]byte, 64)
+    nb, err := EncodeObject(buf, nil, TestTagDefault { A: 7, B: "hi" })
+    require.NoError(t, err)
+    require.Equal(t, []byte { 0x00 }, buf[:nb])
+    nb, err = EncodeObject(buf, nil, TestTagDefault { A: 8, B: "hi" })
+    require.NoError(t, err)
+    require.Equal(t, []byte { 0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x08, 0x00 }, buf[:nb])
+}
+
+type TestCycleNode struct {
+    V    int64            `frugal:"1,default,i64"`
+    Next *TestCycleNode   `frugal:"2,optional,TestCycleNode"`
+    Kids []*TestCycleNode `frugal:"3,default,list<TestCycleNode>"`
+}
+
+func TestEncoder_CycleDetection(t *testing.T) {
+    dc := opts.DetectCycles
+    defer func() { opts.DetectCycles = dc }()
+    opts.DetectCycles = true
+    a := &TestCycleNode { V: 1 }
+    b := &TestCycleNode { V: 2, Next: a, Kids: []*TestCycleNode { a, a } }
+    buf := make([]byte, EncodedSize(b))
+    _, err := EncodeObject(buf, nil, b)
+    require.NoError(t, err)
+    a.Next = b
+    _, err = EncodeObject(buf, nil, b)
+    require.Equal(t, CycleError { reflect.TypeOf(TestCycleNode{}) }, err)
+    a.Next = nil
+    a.Kids = []*TestCycleNode { b }
+    _, err = EncodeObject(buf, nil, b)
+    require.Equal(t, CycleError { reflect.TypeOf(TestCycleNode{}) }, err)
+}
+
+type TestLiteralSeekInner struct {
+    B *string `frugal:"2,optional,string"`
+}
+
+type TestLiteralSeekUnion struct {
+    X *int32  `frugal:"1,optional,i32"`
+    Y *string `frugal:"2,optional,string"`
+}
+
+func (self *TestLiteralSeekUnion) CountSetFieldsTestLiteralSeekUnion() int {
+    n := 0
+    if self.X != nil { n++ }
+    if self.Y != nil { n++ }
+    return n
+}
+
+type TestLiteralSeek struct {
+    I TestLiteralSeekInner  `frugal:"6,required,TestLiteralSeekInner"`
+    L [][]string            `frugal:"7,default,list<list<string>>"`
+    U *TestLiteralSeekUnion `frugal:"8,optional,TestLiteralSeekUnion"`
+}
+
+func TestEncoder_LiteralMergingKeepsSeeks(t *testing.T) {
+    x, y := "x", ""
+    v := TestLiteralSeek {
+        I: TestLiteralSeekInner { B: &x },
+        L: [][]string { { "a" } },
+        U: &TestLiteralSeekUnion { Y: &y },
+    }
+    buf := make([]byte, EncodedSize(&v))
+    nb, err := EncodeObject(buf, nil, &v)
+    require.NoError(t, err)
+    require.Equal(t, []byte {
+        0x0c, 0x00, 0x06, 0x0b, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 'x', 0x00,
+        0x0f, 0x00, 0x07, 0x0f, 0x00, 0x00, 0x00, 0x01, 0x0b, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 'a',
+        0x0c, 0x00, 0x08, 0x0b, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
+        0x00,
+    }, buf[:nb])
+}
+
+type (
+    TestNamedID     int64
+    TestNamedIDList []TestNamedID
+    TestNamedEnum   int64
+)
+
+type TestNamedInner struct {
+    A TestNamedID `frugal:"1,default,i64"`
+}
+
+type TestNamedTypes struct {
+    A TestNamedIDList              `frugal:"1,default,list<i64>"`
+    B map[TestNamedID]TestNamedID  `frugal:"2,default,map<i64:i64>"`
+    C []TestNamedInner             `frugal:"3,default,list<TestNamedInner>"`
+    D []TestNamedEnum              `frugal:"4,default,list<TestNamedEnum>"`
+}
+
+func TestEncoder_NamedTypesSize(t *testing.T) {
+    v := TestNamedTypes {
+        A: TestNamedIDList { 1, 2 },
+        B: map[TestNamedID]TestNamedID { 3: 4 },
+        C: []TestNamedInner { { A: 5 } },
+        D: []TestNamedEnum { 6 },
+    }
+    nb := EncodedSize(&v)
+    buf := make([]byte, nb)
+    ret, err := EncodeObject(buf, nil, &v)
+    require.NoError(t, err)
+    require.Equal(t, nb, ret)
+    require.Equal(t, []byte {
+        0x0f, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x00, 0x02, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2,
+        0x0d, 0x00, 0x02, 0x0a, 0x0a, 0x00, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 4,
+        0x0f, 0x00, 0x03, 0x0c, 0x00, 0x00, 0x00, 0x01, 0x0a, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 5, 0x00,
+        0x0f, 0x00, 0x04, 0x08, 0x00, 0x00, 0x00, 0x01, 0, 0, 0, 6,
+        0x00,
+    }, buf[:ret])
+}
+
+type TestBlob struct {
+    A iov.Blob `frugal:"1,default,binary"`
+}
+
+func TestEncoder_Blob(t *testing.T) {
+    v := TestBlob { iov.Blob { Data: []byte("ab") } }
+    buf := make([]byte, EncodedSize(&v))
+    ret, err := EncodeObject(buf, nil, &v)
+    require.NoError(t, err)
+    require.Equal(t, []byte { 0x0b, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 'a', 'b', 0x00 }, buf[:ret])
+    hd, err := iov.TempFileSink("").Spill(v.A.Data)
+    require.NoError(t, err)
+    defer hd.Close()
+    v.A = iov.Blob { Spilled: hd }
+    _, err = EncodeObject(buf, nil, &v)
+    require.EqualError(t, err, "frugal: spilled iov.Blob can not be encoded, Load it first")
+}
+
+type FlagsTest struct {
+    A map[string]int32 `frugal:"1,default,map<string:i32>"`
+    B *int32           `frugal:"2,optional,i32"`
+}
+
+func getFlagStats(name string) opts.FlagStats {
+    for _, v := range opts.GetFlagStats() {
+        if v.Name == name {
+            return v
+        }
+    }
+    panic("no such flag: " + name)
+}
+
+func TestEncoder_FlagStats(t *testing.T) {
+    o := opts.GetDefaultOptions()
+    o.SortMapKeys = true
+    o.IsSetMethods = true
+    o.ValidateEnums = true
+    s0, i0, v0 := getFlagStats("SortMapKeys"), getFlagStats("IsSetMethods"), getFlagStats("ValidateEnums")
+    _, err := CreateCompiler().Apply(o).CompileAndFree(reflect.TypeOf(FlagsTest{}))
+    require.NoError(t, err)
+    s1, i1, v1 := getFlagStats("SortMapKeys"), getFlagStats("IsSetMethods"), getFlagStats("ValidateEnums")
+    require.Equal(t, opts.FlagStats { Name: "SortMapKeys", Used: s0.Used + 1, Enabled: s0.Enabled + 1 }, s1)
+    require.Equal(t, opts.FlagStats { Name: "IsSetMethods", Used: i0.Used, Enabled: i0.Enabled + 1 }, i1)
+    require.Equal(t, v0, v1)
+}
+
+type TestCanonical struct {
+    A map[string]int8 `frugal:"1,default,map<string:i8>"`
+    B []float64       `frugal:"2,default,list<double>"`
+    C []int16         `frugal:"3,optional,set<i16>"`
+    D int32           `frugal:"4,optional,i32,default=7"`
+    E *TestCanonical  `frugal:"5,optional,TestCanonical"`
+}
+
+type TestCanonicalBadKey struct {
+    A map[float64]int8 `frugal:"1,default,map<double:i8>"`
+}
+
+type TestCanonicalBadSet struct {
+    A []*TestRelease `frugal:"1,default,set<TestRelease>"`
+}
+
+func TestEncoder_Canonical(t *testing.T) {
+    v := &TestCanonical {
+        A: map[string]int8{"b": 2, "a": 1},
+        B: []float64{math.NaN(), math.Float64frombits(0xfff0000000000001), math.Copysign(0, -1)},
+        D: 7,
+        E: &TestCanonical { C: []int16{1, 3} },
+    }
+    buf := make([]byte, EncodedSizeCanonical(v))
+    nb, err := EncodeCanonical(buf, nil, v)
+    require.NoError(t, err)
+    require.Equal(t, []byte {
+        0x0d, 0x00, 0x01, 0x0b, 0x03, 0x00, 0x00, 0x00, 0x02,           // field 1: map<string:i8>, len = 2
+        0x00, 0x00, 0x00, 0x01, 'a', 0x01,                              //     "a" => 1
+        0x00, 0x00, 0x00, 0x01, 'b', 0x02,                              //     "b" => 2
+        0x0f, 0x00, 0x02, 0x04, 0x00, 0x00, 0x00, 0x03,                 // field 2: list<double>, len = 3
+        0x7f, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,                 //     NaN
+        0x7f, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,                 //     NaN
+        0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,                 //     -0.0
+        0x0e, 0x00, 0x03, 0x06, 0x00, 0x00, 0x00, 0x00,                 // field 3: set<i16> []
+        0x08, 0x00, 0x04, 0x00, 0x00, 0x00, 0x07,                       // field 4: i32 7
+        0x0c, 0x00, 0x05,                                               // field 5: struct
+        0x0d, 0x00, 0x01, 0x0b, 0x03, 0x00, 0x00, 0x00, 0x00,           //     field 1: map<string:i8> {}
+        0x0f, 0x00, 0x02, 0x04, 0x00, 0x00, 0x00, 0x00,                 //     field 2: list<double> []
+        0x0e, 0x00, 0x03, 0x06, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01, 0x00, 0x03, // field 3: set<i16> [1, 3]
+        0x08, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00,                       //     field 4: i32 0
+        0x00,                                                           //     end
+        0x00,                                                           // end
+    }, buf[:nb])
+    v.E.C = []int16{3, 1}
+    _, err = EncodeCanonical(buf, nil, v)
+    require.EqualError(t, err, "frugal: set elements are not in ascending order")
+    _, err = EncodeCanonical(nil, nil, TestCanonicalBadKey{})
+    require.EqualError(t, err, "frugal: keys of map[float64]int8 have no canonical order")
+    _, err = EncodeCanonical(nil, nil, TestCanonicalBadSet{})
+    require.EqualError(t, err, "frugal: elements of []*encoder.TestRelease have no canonical order")
+}
+
+type (
+    TestSharedA struct {
+        A int32  `frugal:"1,default,i32"`
+        B string `frugal:"2,default,string"`
+    }
+    TestSharedB TestSharedA
+)
+
+func TestEncoder_SharedCode(t *testing.T) {
+    a := TestSharedA{A: 1, B: "foo"}
+    b := TestSharedB{A: 2, B: "bar"}
+    nf := loader.FnCount
+    ns := SharedCount
+    buf := make([]byte, EncodedSize(a))
+    _, err := EncodeObject(buf, nil, a)
+    require.NoError(t, err)
+    require.Equal(t, []byte{0x08, 0x00, 0x01, 0, 0, 0, 1, 0x0b, 0x00, 0x02, 0, 0, 0, 3, 'f', 'o', 'o', 0}, buf)
+    require.Equal(t, len(buf), EncodedSize(b))
+    require.Equal(t, ns + 1, SharedCount)
+    if IsNative() {
+        require.Equal(t, nf + 1, loader.FnCount)
+    }
+    Release(rt.UnpackType(reflect.TypeOf(a)))
+    _, err = EncodeObject(buf, nil, b)
+    require.NoError(t, err)
+    require.Equal(t, []byte{0x08, 0x00, 0x01, 0, 0, 0, 2, 0x0b, 0x00, 0x02, 0, 0, 0, 3, 'b', 'a', 'r', 0}, buf)
+    Release(rt.UnpackType(reflect.TypeOf(b)))
+    if IsNative() {
+        waitFnCount(t, nf)
+    }
+}
+
+type TestDeopt struct {
+    A int32 `frugal:"1,default,i32"`
+}
+
+func TestEncoder_Deopt(t *testing.T) {
+    v := TestDeopt { A: 7 }
+    vt := rt.UnpackType(reflect.TypeOf(v))
+    nt := opts.DeoptThreshold
+    opts.DeoptThreshold = 3
+    defer func() { opts.DeoptThreshold = nt; Release(vt) }()
+    _, err := programCache.Compute(vt, func(*rt.GoType) (interface{}, error) {
+        return newCodec(func(unsafe.Pointer, int, iov.BufferWriter, unsafe.Pointer, *RuntimeState, int) (int, error) {
+            var p *int
+            return *p, nil
+        }, nil), nil
+    })
+    require.NoError(t, err)
+    buf := make([]byte, 8)
+    for i := 0; i < 3; i++ {
+        ret, err := EncodeObject(buf, nil, v)
+        require.Equal(t, -1, ret)
+        require.IsType(t, utils.FaultError{}, err)
+    }
+    if IsNative() {
+        require.Nil(t, programCache.Get(vt))
+        ret, err := EncodeObject(buf, nil, v)
+        require.NoError(t, err)
+        require.Equal(t, []byte { 0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0x07, 0x00 }, buf[:ret])
+    }
+}
+
+type TestDeoptUser struct {
+    A int32 `frugal:"1,default,i32"`
+}
+
+func TestEncoder_DeoptUserFault(t *testing.T) {
+    v := TestDeoptUser { A: 7 }
+    vt := rt.UnpackType(reflect.TypeOf(v))
+    nt := opts.DeoptThreshold
+    opts.DeoptThreshold = 1
+    defer func() { opts.DeoptThreshold = nt; Release(vt) }()
+    _, err := programCache.Compute(vt, func(*rt.GoType) (interface{}, error) {
+        return newCodec(func(unsafe.Pointer, int, iov.BufferWriter, unsafe.Pointer, *RuntimeState, int) (int, error) {
+            var b *bytes.Buffer
+            return b.Len(), nil
+        }, nil), nil
+    })
+    require.NoError(t, err)
+    require.PanicsWithError(t, "runtime error: invalid memory address or nil pointer dereference", func() {
+        _, _ = EncodeObject(make([]byte, 8), nil, v)
+    })
+    require.NotNil(t, programCache.Get(vt))
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encoder
+
+import (
+    `fmt`
+    `math`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+)
+
+func f64tofixed(v uint64, scale int64) (int64, error) {
+    fv := math.Float64frombits(v)
+    rv := math.Round(fv * float64(scale))
+
+    /* the scaled value must fit into an i64 */
+    if rv >= -math.MinInt64 || rv < math.MinInt64 || math.IsNaN(rv) {
+        return 0, fmt.Errorf("frugal: value %v cannot be represented as fixed-point with scale %d", fv, scale)
+    } else {
+        return int64(rv), nil
+    }
+}
+
+var (
+    F_f64tofixed = hir.RegisterGCall(f64tofixed, nil)
+)
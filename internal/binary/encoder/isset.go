@@ -0,0 +1,74 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package encoder
+
+import (
+    `fmt`
+    `sync`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+var (
+    isSetFnLock  = new(sync.RWMutex)
+    isSetFnCache = make(map[unsafe.Pointer]*hir.CallHandle)
+)
+
+func toIsSetFn(fp unsafe.Pointer) (fn func(unsafe.Pointer) bool) {
+    *(*unsafe.Pointer)(unsafe.Pointer(&fn)) = unsafe.Pointer(&fp)
+    return
+}
+
+func addIsSetFn(fp unsafe.Pointer) *hir.CallHandle {
+    var ok bool
+    var fn *hir.CallHandle
+
+    /* check function cache */
+    isSetFnLock.RLock()
+    fn, ok = isSetFnCache[fp]
+    isSetFnLock.RUnlock()
+
+    /* exists, use the cached value */
+    if ok {
+        return fn
+    }
+
+    /* lock in write mode */
+    isSetFnLock.Lock()
+    defer isSetFnLock.Unlock()
+
+    /* double check */
+    if fn, ok = isSetFnCache[fp]; ok {
+        return fn
+    }
+
+    /* still not exists, register a new function */
+    fn = hir.RegisterGCall(toIsSetFn(fp), func(ctx hir.CallContext) {
+        if !ctx.Verify("*", "i") {
+            panic(fmt.Sprintf("invalid %s call", rt.FuncName(fp)))
+        } else {
+            ctx.Ru(0, uint64(bool2i64(toIsSetFn(fp)(ctx.Ap(0)))))
+        }
+    })
+
+    /* update the cache */
+    isSetFnCache[fp] = fn
+    return fn
+}
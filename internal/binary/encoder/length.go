@@ -0,0 +1,44 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package encoder
+
+import (
+    `fmt`
+    `math`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+)
+
+// LengthError is returned when a string, binary, list, set or map has more
+// elements than a Thrift i32 length can represent.
+type LengthError struct {
+    Length int
+}
+
+func (self LengthError) Error() string {
+    return fmt.Sprintf("frugal: length %d exceeds the maximum of %d", self.Length, math.MaxInt32)
+}
+
+//go:nosplit
+func error_length(n int) error {
+    return LengthError { n }
+}
+
+var (
+    F_error_length = hir.RegisterGCall(error_length, nil)
+)
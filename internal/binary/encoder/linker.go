@@ -17,16 +17,22 @@
 package encoder
 
 import (
+    `runtime`
+    `sync`
+    `sync/atomic`
+
     `github.com/cloudwego/frugal/internal/atm/hir`
     `github.com/cloudwego/frugal/internal/utils`
 )
 
 type Linker interface {
-    Link(p hir.Program) Encoder
+    Link(p hir.Program) (Encoder, int)
+    Unlink(fn Encoder)
 }
 
 var (
     linker   Linker
+    emuOnce  sync.Once
     F_encode *hir.CallHandle
 )
 
@@ -34,14 +40,41 @@ func init() {
     F_encode = hir.RegisterGCall(encode, emu_gcall_encode)
 }
 
-func Link(p hir.Program) Encoder {
+func Link(p hir.Program) (Encoder, int) {
     if linker == nil || utils.ForceEmulator {
-        return link_emu(p)
+        emuOnce.Do(warnEmulator)
+        atomic.AddUint64(&EmuCount, 1)
+        return link_emu(p), 0
     } else {
         return linker.Link(p)
     }
 }
 
+func Unlink(fn Encoder) {
+    if IsNative() {
+        linker.Unlink(fn)
+    }
+}
+
+// IsNative reports whether the native linker is used instead of the emulator.
+func IsNative() bool {
+    return linker != nil && !utils.ForceEmulator
+}
+
+// ZeroCopy reports whether the codecs linked by the current backend pass large
+// strings and binaries to iov.BufferWriter.WriteDirect instead of copying them.
+func ZeroCopy() bool {
+    return IsNative() || utils.FnWrite.Emulated()
+}
+
+func warnEmulator() {
+    if utils.ForceEmulator {
+        utils.Log(utils.LevelInfo, "using the emulator backend as requested by FRUGAL_BACKEND", "codec", "encoder")
+    } else {
+        utils.Log(utils.LevelWarn, "native backend is not available, falling back to the emulator", "codec", "encoder", "goarch", runtime.GOARCH)
+    }
+}
+
 func SetLinker(v Linker) {
     linker = v
 }
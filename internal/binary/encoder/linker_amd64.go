@@ -32,8 +32,11 @@ func init() {
     SetLinker(new(LinkerAMD64))
 }
 
-func (LinkerAMD64) Link(p hir.Program) Encoder {
+func (LinkerAMD64) Link(p hir.Program) (Encoder, int) {
     fn := pgen.CreateCodeGen((Encoder)(nil)).Generate(p, 0)
     fp := loader.Loader(fn.Code).Load("encoder", fn.Frame)
-    return *(*Encoder)(unsafe.Pointer(&fp))
-}
\ No newline at end of file
+    return *(*Encoder)(unsafe.Pointer(&fp)), len(fn.Code)
+}
+func (LinkerAMD64) Unlink(fn Encoder) {
+    loader.Unload(*(*loader.Function)(unsafe.Pointer(&fn)))
+}
@@ -54,15 +54,13 @@ func emu_wbuf(ctx hir.CallContext, i int) (v iov.BufferWriter) {
 
 func emu_setret(ctx hir.CallContext) func(int, error) {
     return func(ret int, err error) {
-        vv := (*rt.GoIface)(unsafe.Pointer(&err))
         ctx.Ru(0, uint64(ret))
-        ctx.Rp(1, unsafe.Pointer(vv.Itab))
-        ctx.Rp(2, vv.Value)
+        ctx.Re(1, err)
     }
 }
 
-func emu_encode(ctx hir.CallContext) (int, error) {
-    return encode(
+func emu_encode(ctx hir.CallContext, fn _Entry) (int, error) {
+    return fn(
         (*rt.GoType)(ctx.Ap(0)),
         ctx.Ap(1),
         int(ctx.Au(2)),
@@ -77,6 +75,14 @@ func emu_gcall_encode(ctx hir.CallContext) {
     if !ctx.Verify("**i****i", "i**") {
         panic("invalid encode call")
     } else {
-        emu_setret(ctx)(emu_encode(ctx))
+        emu_setret(ctx)(emu_encode(ctx, encode))
+    }
+}
+
+func emu_gcall_encode_canon(ctx hir.CallContext) {
+    if !ctx.Verify("**i****i", "i**") {
+        panic("invalid encode_canon call")
+    } else {
+        emu_setret(ctx)(emu_encode(ctx, encode_canon))
     }
 }
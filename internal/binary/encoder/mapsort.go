@@ -0,0 +1,143 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encoder
+
+import (
+    `reflect`
+    `sort`
+    `sync`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/atm/hir`
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+type _MapPair struct {
+    k unsafe.Pointer
+    v unsafe.Pointer
+}
+
+type _MapSorter struct {
+    i  int
+    kv []_MapPair
+    fn func(unsafe.Pointer, unsafe.Pointer) bool
+}
+
+var (
+    mapSorterPool sync.Pool
+)
+
+func newMapSorter(fn func(unsafe.Pointer, unsafe.Pointer) bool) *_MapSorter {
+    if v := mapSorterPool.Get(); v == nil {
+        return &_MapSorter { fn: fn }
+    } else {
+        p := v.(*_MapSorter)
+        p.i, p.fn = 0, fn
+        return p
+    }
+}
+
+func freeMapSorter(p *_MapSorter) {
+    for i := range p.kv {
+        p.kv[i] = _MapPair{}
+    }
+
+    /* clear the references before returning to pool */
+    p.fn = nil
+    p.kv = p.kv[:0]
+    mapSorterPool.Put(p)
+}
+
+func (self *_MapSorter) Len() int               { return len(self.kv) }
+func (self *_MapSorter) Swap(i int, j int)      { self.kv[i], self.kv[j] = self.kv[j], self.kv[i] }
+func (self *_MapSorter) Less(i int, j int) bool { return self.fn(self.kv[i].k, self.kv[j].k) }
+
+func lessInt(p unsafe.Pointer, q unsafe.Pointer) bool    { return *(*int)(p) < *(*int)(q) }
+func lessInt8(p unsafe.Pointer, q unsafe.Pointer) bool   { return *(*int8)(p) < *(*int8)(q) }
+func lessInt16(p unsafe.Pointer, q unsafe.Pointer) bool  { return *(*int16)(p) < *(*int16)(q) }
+func lessInt32(p unsafe.Pointer, q unsafe.Pointer) bool  { return *(*int32)(p) < *(*int32)(q) }
+func lessInt64(p unsafe.Pointer, q unsafe.Pointer) bool  { return *(*int64)(p) < *(*int64)(q) }
+func lessString(p unsafe.Pointer, q unsafe.Pointer) bool { return *(*string)(p) < *(*string)(q) }
+
+func keyLessFunc(vt *rt.GoType) func(unsafe.Pointer, unsafe.Pointer) bool {
+    switch vt.Kind() {
+        case reflect.Int    : return lessInt
+        case reflect.Int8   : return lessInt8
+        case reflect.Int16  : return lessInt16
+        case reflect.Int32  : return lessInt32
+        case reflect.Int64  : return lessInt64
+        case reflect.String : return lessString
+        default             : panic("mapiterstartsorted: unsortable key type: " + vt.String())
+    }
+}
+
+func isSortableKey(vt reflect.Type) bool {
+    switch vt.Kind() {
+        case reflect.Int    : return true
+        case reflect.Int8   : return true
+        case reflect.Int16  : return true
+        case reflect.Int32  : return true
+        case reflect.Int64  : return true
+        case reflect.String : return true
+        default             : return false
+    }
+}
+
+func mapiterstartsorted(t *rt.GoMapType, h *rt.GoMap, it *rt.GoMapIterator) {
+    st := newMapSorter(keyLessFunc(t.Key))
+    *it = rt.GoMapIterator{}
+
+    /* collect all the key-value pairs */
+    for mapiterinit(t, h, it); it.K != nil; mapiternext(it) {
+        st.kv = append(st.kv, _MapPair { it.K, it.V })
+    }
+
+    /* sort by keys, the sorter is kept alive by the iterator */
+    sort.Sort(st)
+    *it = rt.GoMapIterator{}
+    it.Buckets = unsafe.Pointer(st)
+
+    /* move to the first pair */
+    if len(st.kv) != 0 {
+        it.K = st.kv[0].k
+        it.V = st.kv[0].v
+    } else {
+        it.Buckets = nil
+        freeMapSorter(st)
+    }
+}
+
+func mapiternextsorted(it *rt.GoMapIterator) {
+    st := (*_MapSorter)(it.Buckets)
+    st.i++
+
+    /* check for the end of iteration */
+    if st.i < len(st.kv) {
+        it.K = st.kv[st.i].k
+        it.V = st.kv[st.i].v
+    } else {
+        it.K = nil
+        it.V = nil
+        it.Buckets = nil
+        freeMapSorter(st)
+    }
+}
+
+var (
+    F_mapiternextsorted  = hir.RegisterGCall(mapiternextsorted, emu_gcall_mapiternextsorted)
+    F_mapiterstartsorted = hir.RegisterGCall(mapiterstartsorted, emu_gcall_mapiterstartsorted)
+)
@@ -28,21 +28,27 @@ const (
     OP_size_dyn
     OP_size_map
     OP_size_defer
+    OP_size_defer_canon
     OP_byte
     OP_word
     OP_long
     OP_quad
     OP_sint
+    OP_fixed
+    OP_double
     OP_length
     OP_memcpy_be
     OP_seek
     OP_deref
     OP_defer
+    OP_defer_canon
     OP_map_len
     OP_map_key
     OP_map_next
     OP_map_value
     OP_map_begin
+    OP_map_next_sorted
+    OP_map_begin_sorted
     OP_map_if_next
     OP_map_if_empty
     OP_list_decr
@@ -50,11 +56,15 @@ const (
     OP_list_if_next
     OP_list_if_empty
     OP_unique
+    OP_sorted
+    OP_union
+    OP_spill_check
     OP_goto
     OP_if_nil
     OP_if_hasbuf
     OP_if_eq_imm
     OP_if_eq_str
+    OP_if_unset
     OP_make_state
     OP_drop_state
     OP_halt
@@ -66,21 +76,27 @@ var _OpNames = [256]string {
     OP_size_dyn      : "size_dyn",
     OP_size_map      : "size_map",
     OP_size_defer    : "size_defer",
+    OP_size_defer_canon : "size_defer_canon",
     OP_byte          : "byte",
     OP_word          : "word",
     OP_long          : "long",
     OP_quad          : "quad",
     OP_sint          : "sint",
+    OP_fixed         : "fixed",
+    OP_double        : "double",
     OP_length        : "length",
     OP_memcpy_be     : "memcpy_be",
     OP_seek          : "seek",
     OP_deref         : "deref",
     OP_defer         : "defer",
+    OP_defer_canon   : "defer_canon",
     OP_map_len       : "map_len",
     OP_map_key       : "map_key",
     OP_map_next      : "map_next",
     OP_map_value     : "map_value",
     OP_map_begin     : "map_begin",
+    OP_map_next_sorted : "map_next_sorted",
+    OP_map_begin_sorted : "map_begin_sorted",
     OP_map_if_next   : "map_if_next",
     OP_map_if_empty  : "map_if_empty",
     OP_list_decr     : "list_decr",
@@ -88,11 +104,15 @@ var _OpNames = [256]string {
     OP_list_if_next  : "list_if_next",
     OP_list_if_empty : "list_if_empty",
     OP_unique        : "unique",
+    OP_sorted        : "sorted",
+    OP_union         : "union",
+    OP_spill_check   : "spill_check",
     OP_goto          : "goto",
     OP_if_nil        : "if_nil",
     OP_if_hasbuf     : "if_hasbuf",
     OP_if_eq_imm     : "if_eq_imm",
     OP_if_eq_str     : "if_eq_str",
+    OP_if_unset      : "if_unset",
     OP_make_state    : "make_state",
     OP_drop_state    : "drop_state",
     OP_halt          : "halt",
@@ -108,6 +128,7 @@ var _OpBranches = [256]bool {
     OP_if_hasbuf     : true,
     OP_if_eq_imm     : true,
     OP_if_eq_str     : true,
+    OP_if_unset      : true,
 }
 
 func (self OpCode) String() string {
@@ -360,6 +360,8 @@ func _PASS_SizeCheckMerging(bb *BasicBlock) {
                     case OP_long       : break
                     case OP_quad       : break
                     case OP_sint       : break
+                    case OP_fixed      : break
+                    case OP_double     : break
                     case OP_seek       : break
                     case OP_deref      : break
                     case OP_length     : break
@@ -372,6 +374,14 @@ func _PASS_SizeCheckMerging(bb *BasicBlock) {
     }
 }
 
+func commitLiteral(p Program, ip int, iv Instr) int {
+    for p[ip].Op != _NOP {
+        ip++
+    }
+    p[ip] = iv
+    return ip + 1
+}
+
 // Literal Merging Pass: merges all consectutive byte, word or long instructions.
 func _PASS_LiteralMerging(bb *BasicBlock) {
     p := bb.P
@@ -388,7 +398,7 @@ func _PASS_LiteralMerging(bb *BasicBlock) {
             continue
         }
 
-        /* byte merging buffer */
+        /* byte merging buffer, seeks and derefs in between must be kept in place */
         ip := i
         mm := [15]byte{}
         sl := mm[:0:cap(mm)]
@@ -416,9 +426,8 @@ func _PASS_LiteralMerging(bb *BasicBlock) {
 
             /* commit the buffer if needed */
             for len(sl) >= 8 {
-                p[ip] = Instr{Op: OP_quad, Iv: int64(binary.BigEndian.Uint64(sl))}
+                ip = commitLiteral(p, ip, Instr{Op: OP_quad, Iv: int64(binary.BigEndian.Uint64(sl))})
                 sl = sl[8:]
-                ip++
             }
 
             /* move the remaining bytes to the front */
@@ -427,9 +436,9 @@ func _PASS_LiteralMerging(bb *BasicBlock) {
         }
 
         /* add the remaining bytes */
-        if len(sl) >= 4 { p[ip] = Instr{Op: OP_long, Iv: int64(binary.BigEndian.Uint32(sl))} ; sl = sl[4:]; ip++ }
-        if len(sl) >= 2 { p[ip] = Instr{Op: OP_word, Iv: int64(binary.BigEndian.Uint16(sl))} ; sl = sl[2:]; ip++ }
-        if len(sl) >= 1 { p[ip] = Instr{Op: OP_byte, Iv: int64(sl[0])}                       ; sl = sl[1:]; ip++ }
+        if len(sl) >= 4 { ip = commitLiteral(p, ip, Instr{Op: OP_long, Iv: int64(binary.BigEndian.Uint32(sl))}); sl = sl[4:] }
+        if len(sl) >= 2 { ip = commitLiteral(p, ip, Instr{Op: OP_word, Iv: int64(binary.BigEndian.Uint16(sl))}); sl = sl[2:] }
+        if len(sl) >= 1 { ip = commitLiteral(p, ip, Instr{Op: OP_byte, Iv: int64(sl[0])})                      ; sl = sl[1:] }
     }
 }
 
@@ -65,7 +65,10 @@ func allocCompiler() *Compiler {
 }
 
 func resetCompiler(p *Compiler) *Compiler {
+    p.c = false
+    p.f = _Field{}
     p.o = opts.GetDefaultOptions()
+    p.u = 0
     rt.MapClear(p.t)
     return p
 }
@@ -116,6 +119,9 @@ func newRuntimeState() *RuntimeState {
 }
 
 func freeRuntimeState(p *RuntimeState) {
+    if len(p.Vs) != 0 {
+        rt.MapClear(p.Vs)
+    }
     runtimeStatePool.Put(p)
 }
 
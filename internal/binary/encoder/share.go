@@ -0,0 +1,97 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package encoder
+
+import (
+    `sync/atomic`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
+)
+
+var (
+    SharedCount uint64 = 0
+    sharedCode         = utils.CreateCodeTable()
+)
+
+func (self Program) digest(vt *rt.GoType) (utils.CodeKey, bool) {
+    h := utils.NewCodeHasher()
+
+    /* hash every instruction */
+    for _, v := range self {
+        pr := v.Pr
+
+        /* the type itself can only be referred to by the diagnostics, which
+         * will report the type that was linked first once the code is shared */
+        if pr == unsafe.Pointer(vt) {
+            if v.Op != OP_halt && v.Op != OP_drop_state {
+                return utils.CodeKey{}, false
+            } else {
+                pr = nil
+            }
+        }
+
+        /* add the instruction */
+        h.Int(uint64(v.Op))
+        h.Int(uint64(v.Uv))
+        h.Int(uint64(v.Iv))
+        h.Int(uint64(v.To))
+        h.Int(uint64(uintptr(pr)))
+    }
+
+    /* all done */
+    return h.Sum(), true
+}
+
+func unlinkCode(fn interface{}) {
+    Unlink(fn.(Encoder))
+}
+
+// linkProgram translates and links the program of vt, unless a type with the
+// same definition has already been linked, in which case the code is shared.
+func linkProgram(vt *rt.GoType, p Program) (*_Codec, int) {
+    key, ok := p.digest(vt)
+
+    /* the native code of this type has faulted too many times */
+    if deoptTable.Deoptimized(vt) {
+        atomic.AddUint64(&EmuCount, 1)
+        return newCodec(link_emu(Translate(p)), nil), 0
+    }
+
+    /* the program refers to the type itself, it can not be shared */
+    if !ok {
+        fn, nb := Link(Translate(p))
+        return newCodec(fn, func() { Unlink(fn) }), nb
+    }
+
+    /* find or link the code */
+    rv := true
+    fn, nb, free := sharedCode.Link(key, func() (interface{}, int) {
+        rv = false
+        return Link(Translate(p))
+    }, unlinkCode)
+
+    /* the code is reused */
+    if rv {
+        atomic.AddUint64(&SharedCount, 1)
+    }
+
+    /* all done */
+    return newCodec(fn.(Encoder), free), nb
+}
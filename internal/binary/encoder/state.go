@@ -55,4 +55,5 @@ type StateItem struct {
 type RuntimeState struct {
     St [defs.StackSize]StateItem    // Must be the first field.
     Bm [1024]uint64                 // Bitmap, used for uniqueness check of set<i8> and set<i16>.
+    Vs map[_Visit]struct{}          // Objects on the current encoding path, used for cycle detection.
 }
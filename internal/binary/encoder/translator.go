@@ -18,8 +18,10 @@ package encoder
 
 import (
     `fmt`
+    `math`
     `os`
     `reflect`
+    `strconv`
 
     `github.com/cloudwego/frugal/internal/atm/abi`
     `github.com/cloudwego/frugal/internal/atm/hir`
@@ -87,11 +89,16 @@ const (
 )
 
 const (
+    LB_abort      = "_abort_"
     LB_halt       = "_halt"
     LB_error      = "_error"
     LB_nomem      = "_nomem"
     LB_overflow   = "_overflow"
     LB_duplicated = "_duplicated"
+    LB_unsorted   = "_unsorted"
+    LB_toolarge   = "_toolarge"
+    LB_toolong    = "_toolong"
+    LB_spilled    = "_spilled"
 )
 
 var (
@@ -99,6 +106,9 @@ var (
     _E_nomem      = fmt.Errorf("frugal: buffer is too small")
     _E_overflow   = fmt.Errorf("frugal: encoder stack overflow")
     _E_duplicated = fmt.Errorf("frugal: duplicated element within sets")
+    _E_unsorted   = fmt.Errorf("frugal: set elements are not in ascending order")
+    _E_toolarge   = fmt.Errorf("frugal: encoded size overflows")
+    _E_spilled    = fmt.Errorf("frugal: spilled iov.Blob can not be encoded, Load it first")
 )
 
 func Translate(s Program) hir.Program {
@@ -107,6 +117,7 @@ func Translate(s Program) hir.Program {
     program  (p, s)
     epilogue (p)
     errors   (p)
+    aborts   (p, s)
     return p.Build()
 }
 
@@ -118,6 +129,21 @@ func errors(p *hir.Builder) {
     p.Label (LB_overflow)
     p.IP    (&_E_overflow, TP)
     p.JMP   ("_basic_error")
+    p.Label (LB_toolarge)
+    p.IP    (&_E_toolarge, TP)
+    p.JMP   ("_basic_error")
+    p.Label (LB_toolong)
+    p.GCALL (F_error_length).
+      A0    (TR).
+      R0    (ET).
+      R1    (EP)
+    p.JMP   (LB_error)
+    p.Label (LB_spilled)
+    p.IP    (&_E_spilled, TP)
+    p.JMP   ("_basic_error")
+    p.Label (LB_unsorted)
+    p.IP    (&_E_unsorted, TP)
+    p.JMP   ("_basic_error")
     p.Label (LB_duplicated)
     p.IP    (&_E_duplicated, TP)
     p.Label ("_basic_error")
@@ -126,6 +152,49 @@ func errors(p *hir.Builder) {
     p.JMP   (LB_error)
 }
 
+func aborts(p *hir.Builder, s Program) {
+    var vt *rt.GoType
+
+    /* find the type this program was compiled for */
+    for _, v := range s {
+        if v.Op == OP_halt {
+            vt = v.Vt()
+        }
+    }
+
+    /* one out-of-line abort stub for each checked instruction */
+    for i, v := range s {
+        ty := v.Vt()
+        id := int(v.Uv)
+        ec := utils.AbortUnderflow
+
+        /* only drop_state and halt are checked */
+        switch v.Op {
+            case OP_drop_state : break
+            case OP_halt       : id, ec = -1, utils.AbortUnbalanced
+            default            : continue
+        }
+
+        /* instructions outside of any field belong to the program type */
+        if ty == nil {
+            ty, id = vt, -1
+        }
+
+        /* abort never returns, the jump only terminates the block */
+        p.Label (LB_abort + strconv.Itoa(i))
+        p.IP    (ty, TP)
+        p.IQ    (int64(id), TR)
+        p.IQ    (int64(i), UR)
+        p.IQ    (int64(ec), RC)
+        p.GCALL (F_abort).
+          A0    (TP).
+          A1    (TR).
+          A2    (UR).
+          A3    (RC)
+        p.JMP   (LB_halt)
+    }
+}
+
 func program(p *hir.Builder, s Program) {
     for i, v := range s {
         p.Mark(i)
@@ -160,21 +229,27 @@ var translators = [256]func(*hir.Builder, Instr) {
     OP_size_dyn      : translate_OP_size_dyn,
     OP_size_map      : translate_OP_size_map,
     OP_size_defer    : translate_OP_size_defer,
+    OP_size_defer_canon : translate_OP_size_defer_canon,
     OP_byte          : translate_OP_byte,
     OP_word          : translate_OP_word,
     OP_long          : translate_OP_long,
     OP_quad          : translate_OP_quad,
     OP_sint          : translate_OP_sint,
+    OP_fixed         : translate_OP_fixed,
+    OP_double        : translate_OP_double,
     OP_length        : translate_OP_length,
     OP_memcpy_be     : translate_OP_memcpy_be,
     OP_seek          : translate_OP_seek,
     OP_deref         : translate_OP_deref,
     OP_defer         : translate_OP_defer,
+    OP_defer_canon   : translate_OP_defer_canon,
     OP_map_len       : translate_OP_map_len,
     OP_map_key       : translate_OP_map_key,
     OP_map_next      : translate_OP_map_next,
     OP_map_value     : translate_OP_map_value,
     OP_map_begin     : translate_OP_map_begin,
+    OP_map_next_sorted : translate_OP_map_next_sorted,
+    OP_map_begin_sorted : translate_OP_map_begin_sorted,
     OP_map_if_next   : translate_OP_map_if_next,
     OP_map_if_empty  : translate_OP_map_if_empty,
     OP_list_decr     : translate_OP_list_decr,
@@ -182,11 +257,15 @@ var translators = [256]func(*hir.Builder, Instr) {
     OP_list_if_next  : translate_OP_list_if_next,
     OP_list_if_empty : translate_OP_list_if_empty,
     OP_unique        : translate_OP_unique,
+    OP_sorted        : translate_OP_sorted,
+    OP_union         : translate_OP_union,
+    OP_spill_check   : translate_OP_spill_check,
     OP_goto          : translate_OP_goto,
     OP_if_nil        : translate_OP_if_nil,
     OP_if_hasbuf     : translate_OP_if_hasbuf,
     OP_if_eq_imm     : translate_OP_if_eq_imm,
     OP_if_eq_str     : translate_OP_if_eq_str,
+    OP_if_unset      : translate_OP_if_unset,
     OP_make_state    : translate_OP_make_state,
     OP_drop_state    : translate_OP_drop_state,
     OP_halt          : translate_OP_halt,
@@ -198,25 +277,41 @@ func translate_OP_size_check(p *hir.Builder, v Instr) {
 }
 
 func translate_OP_size_const(p *hir.Builder, v Instr) {
-    p.ADDI  (RL, v.Iv, RL)
+    p.ADDIO (RL, v.Iv, RL, LB_toolarge)
 }
 
 func translate_OP_size_dyn(p *hir.Builder, v Instr) {
     p.LQ    (WP, int64(v.Uv), TR)
-    p.MULI  (TR, v.Iv, TR)
-    p.ADD   (RL, TR, RL)
+    translate_size_mul(p, v.Iv)
+    p.ADDO  (RL, TR, RL, LB_toolarge)
 }
 
 func translate_OP_size_map(p *hir.Builder, v Instr) {
     p.LP    (WP, 0, TP)
     p.LQ    (TP, 0, TR)
-    p.MULI  (TR, v.Iv, TR)
-    p.ADD   (RL, TR, RL)
+    translate_size_mul(p, v.Iv)
+    p.ADDO  (RL, TR, RL, LB_toolarge)
+}
+
+func translate_size_mul(p *hir.Builder, n int64) {
+    if n > 1 {
+        p.ADDI  (hir.Rz, math.MaxInt64 / n, UR)
+        p.BLTU  (UR, TR, LB_toolarge)
+    }
+    p.MULI  (TR, n, TR)
 }
 
 func translate_OP_size_defer(p *hir.Builder, v Instr) {
+    translate_size_defer(p, v, F_encode)
+}
+
+func translate_OP_size_defer_canon(p *hir.Builder, v Instr) {
+    translate_size_defer(p, v, F_encode_canon)
+}
+
+func translate_size_defer(p *hir.Builder, v Instr, fn *hir.CallHandle) {
     p.IP    (v.Vt(), TP)
-    p.GCALL (F_encode).
+    p.GCALL (fn).
       A0    (TP).
       A1    (hir.Pn).
       A2    (hir.Rz).
@@ -229,7 +324,7 @@ func translate_OP_size_defer(p *hir.Builder, v Instr) {
       R1    (ET).
       R2    (EP)
     p.BNEP  (ET, hir.Pn, LB_error)
-    p.ADD   (RL, TR, RL)
+    p.ADDO  (RL, TR, RL, LB_toolarge)
 }
 
 func translate_OP_byte(p *hir.Builder, v Instr) {
@@ -274,14 +369,49 @@ func translate_OP_sint(p *hir.Builder, v Instr) {
     }
 }
 
+func translate_OP_double(p *hir.Builder, _ Instr) {
+    p.LQ    (WP, 0, TR)
+    p.ANDI  (TR, math.MaxInt64, UR)
+    p.ADDI  (UR, -_F64_NaN_min, UR)
+    p.BLT   (UR, hir.Rz, "_number_{n}")
+    p.IQ    (_F64_NaN, TR)
+    p.Label ("_number_{n}")
+    p.SWAPQ (TR, TR)
+    p.ADDP  (RP, RL, TP)
+    p.ADDI  (RL, 8, RL)
+    p.SQ    (TR, TP, 0)
+}
+
+func translate_OP_fixed(p *hir.Builder, v Instr) {
+    p.LQ    (WP, 0, TR)
+    p.IQ    (v.Iv, UR)
+    p.GCALL (F_f64tofixed).
+      A0    (TR).
+      A1    (UR).
+      R0    (TR).
+      R1    (ET).
+      R2    (EP)
+    p.BNEP  (ET, hir.Pn, LB_error)
+    p.SWAPQ (TR, TR)
+    p.ADDP  (RP, RL, TP)
+    p.ADDI  (RL, 8, RL)
+    p.SQ    (TR, TP, 0)
+}
+
 func translate_OP_length(p *hir.Builder, v Instr) {
-    p.LL    (WP, v.Iv, TR)
+    p.LQ    (WP, v.Iv, TR)
+    translate_length_check(p)
     p.SWAPL (TR, TR)
     p.ADDP  (RP, RL, TP)
     p.ADDI  (RL, 4, RL)
     p.SL    (TR, TP, 0)
 }
 
+func translate_length_check(p *hir.Builder) {
+    p.IQ    (math.MaxInt32, UR)
+    p.BLTU  (UR, TR, LB_toolong)
+}
+
 func translate_OP_memcpy_1(p *hir.Builder) {
     p.IQ    (_N_page, UR)
     p.BGEU  (UR, TR, "_do_copy_{n}")
@@ -352,12 +482,20 @@ func translate_OP_deref(p *hir.Builder, _ Instr) {
 }
 
 func translate_OP_defer(p *hir.Builder, v Instr) {
+    translate_defer(p, v, F_encode)
+}
+
+func translate_OP_defer_canon(p *hir.Builder, v Instr) {
+    translate_defer(p, v, F_encode_canon)
+}
+
+func translate_defer(p *hir.Builder, v Instr, fn *hir.CallHandle) {
     p.IP    (v.Vt(), TP)
     p.LDAP  (ARG_mem_itab, ET)
     p.LDAP  (ARG_mem_data, EP)
     p.SUB   (RC, RL, TR)
     p.ADDP  (RP, RL, RP)
-    p.GCALL (F_encode).
+    p.GCALL (fn).
       A0    (TP).
       A1    (RP).
       A2    (TR).
@@ -377,6 +515,7 @@ func translate_OP_defer(p *hir.Builder, v Instr) {
 func translate_OP_map_len(p *hir.Builder, _ Instr) {
     p.LP    (WP, 0, TP)
     p.LQ    (TP, 0, TR)
+    translate_length_check(p)
     p.SWAPL (TR, TR)
     p.ADDP  (RP, RL, TP)
     p.ADDI  (RL, 4, RL)
@@ -410,6 +549,23 @@ func translate_OP_map_begin(p *hir.Builder, v Instr) {
       A2    (TP)
 }
 
+func translate_OP_map_next_sorted(p *hir.Builder, _ Instr) {
+    p.ADDP  (RS, ST, TP)
+    p.ADDPI (TP, MiOffset, TP)
+    p.GCALL (F_mapiternextsorted).A0(TP)
+}
+
+func translate_OP_map_begin_sorted(p *hir.Builder, v Instr) {
+    p.IP    (v.Vt(), ET)
+    p.LP    (WP, 0, EP)
+    p.ADDP  (RS, ST, TP)
+    p.ADDPI (TP, MiOffset, TP)
+    p.GCALL (F_mapiterstartsorted).
+      A0    (ET).
+      A1    (EP).
+      A2    (TP)
+}
+
 func translate_OP_map_if_next(p *hir.Builder, v Instr) {
     p.ADDP  (RS, ST, TP)
     p.LP    (TP, MiOffset + MiKeyOffset, TP)
@@ -550,6 +706,67 @@ func translate_OP_unique_str(p *hir.Builder) {
     p.BNE   (TR, hir.Rz, LB_duplicated)
 }
 
+func translate_OP_sorted(p *hir.Builder, v Instr) {
+    p.IB    (2, UR)
+    p.LQ    (WP, abi.PtrSize, TR)
+    p.BLTU  (TR, UR, "_ok_{n}")
+    p.IP    (v.Vt(), ET)
+    p.LP    (WP, 0, TP)
+    p.GCALL (F_unsorted).
+      A0    (ET).
+      A1    (TP).
+      A2    (TR).
+      R0    (TR)
+    p.BNE   (TR, hir.Rz, LB_unsorted)
+    p.Label ("_ok_{n}")
+}
+
+func translate_OP_union(p *hir.Builder, v Instr) {
+    var nb int64
+    var err error
+    var fvs []defs.Field
+
+    /* resolve the fields, this never fails since the struct is already compiled */
+    if fvs, err = defs.ResolveFields(v.Vt().Pack()); err != nil {
+        panic(err)
+    }
+
+    /* non-nillable fields are always set */
+    for _, fv := range fvs {
+        if !fv.IsNillable() {
+            nb++
+        }
+    }
+
+    /* count all the non-nil fields */
+    p.IQ    (nb, TR)
+    for i, fv := range fvs {
+        if fv.IsNillable() {
+            p.LP    (WP, int64(fv.F), TP)
+            p.BEQP  (TP, hir.Pn, fmt.Sprintf("_nil_{n}_%d", i))
+            p.ADDI  (TR, 1, TR)
+            p.Label (fmt.Sprintf("_nil_{n}_%d", i))
+        }
+    }
+
+    /* exactly one field should be set */
+    p.IQ    (1, UR)
+    p.BEQ   (TR, UR, "_ok_{n}")
+    p.IP    (v.Vt(), TP)
+    p.GCALL (F_error_union).
+      A0    (TP).
+      A1    (TR).
+      R0    (ET).
+      R1    (EP)
+    p.JMP   (LB_error)
+    p.Label ("_ok_{n}")
+}
+
+func translate_OP_spill_check(p *hir.Builder, _ Instr) {
+    p.LP    (WP, defs.BlobHandleOffset, TP)
+    p.BNEP  (TP, hir.Pn, LB_spilled)
+}
+
 func translate_OP_goto(p *hir.Builder, v Instr) {
     p.JMP   (p.At(v.To))
 }
@@ -621,6 +838,14 @@ func translate_OP_if_eq_str(p *hir.Builder, v Instr) {
     p.Label ("_neq_{n}")
 }
 
+func translate_OP_if_unset(p *hir.Builder, v Instr) {
+    p.GCALL (addIsSetFn(v.Pr)).
+      A0    (WP).
+      R0    (TR)
+    p.ANDI  (TR, 0xff, TR)
+    p.BEQ   (TR, hir.Rz, p.At(v.To))
+}
+
 func translate_OP_make_state(p *hir.Builder, _ Instr) {
     p.IQ    (StateMax, TR)
     p.BGEU  (ST, TR, LB_overflow)
@@ -631,11 +856,15 @@ func translate_OP_make_state(p *hir.Builder, _ Instr) {
 
 func translate_OP_drop_state(p *hir.Builder, _ Instr) {
     p.SUBI  (ST, StateSize, ST)
+    p.LDAQ  (ARG_st, TR)
+    p.BLT   (ST, TR, LB_abort + strconv.Itoa(p.Pc()))
     p.ADDP  (RS, ST, TP)
     p.LP    (TP, WpOffset, WP)
     p.SP    (hir.Pn, TP, WpOffset)
 }
 
 func translate_OP_halt(p *hir.Builder, _ Instr) {
+    p.LDAQ  (ARG_st, TR)
+    p.BNE   (ST, TR, LB_abort + strconv.Itoa(p.Pc()))
     p.JMP   (LB_halt)
 }
@@ -19,7 +19,10 @@ package encoder
 import (
     `reflect`
     `testing`
+    `unsafe`
 
+    `github.com/cloudwego/frugal/internal/rt`
+    `github.com/cloudwego/frugal/internal/utils`
     `github.com/stretchr/testify/require`
 )
 
@@ -50,3 +53,23 @@ func TestTranslator_Translate(t *testing.T) {
     tr := Translate(p)
     println(tr.Disassemble())
 }
+
+func TestTranslator_Abort(t *testing.T) {
+    var ev interface{}
+    vt := rt.UnpackType(reflect.TypeOf(TranslatorTestStruct{}))
+    fn, _ := Link(Translate(Program {
+        { Op: OP_drop_state, Uv: 11, Pr: unsafe.Pointer(vt) },
+        { Op: OP_halt, Pr: unsafe.Pointer(vt) },
+    }))
+    func() {
+        defer func() { ev = recover() }()
+        _, _ = fn(nil, 0, nil, nil, new(RuntimeState), 0)
+    }()
+    require.Equal(t, utils.AbortError {
+        Type   : vt.Pack(),
+        Field  : 11,
+        PC     : 0,
+        Reason : "state stack underflow",
+    }, ev)
+    require.EqualError(t, ev.(error), "frugal: state stack underflow at pc 0 of encoder.TranslatorTestStruct, field 11")
+}
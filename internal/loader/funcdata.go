@@ -17,8 +17,11 @@
 package loader
 
 import (
+    `fmt`
     `sync`
     _ `unsafe`
+
+    `github.com/cloudwego/frugal/internal/rt`
 )
 
 const (
@@ -34,9 +37,19 @@ var lastmoduledatap *_ModuleData
 //go:linkname moduledataverify1 runtime.moduledataverify1
 func moduledataverify1(_ *_ModuleData)
 
+type _Module struct {
+    mod  *_ModuleData
+    ftab *_FindFuncBucket
+    args *rt.StackMap
+    ptrs *rt.StackMap
+    cnry *_Canary
+    grds uintptr
+    dead bool
+}
+
 var (
     modLock sync.Mutex
-    modList []*_ModuleData
+    modList = make(map[uintptr]_Module)
 )
 
 func toZigzag(v int) int {
@@ -72,10 +85,62 @@ func encodeVariant(v int) []byte {
     return r
 }
 
-func registerModule(mod *_ModuleData) {
+func encodeLines(pctab []byte, lines []rt.Line, size uintptr) []byte {
+    ln := 0
+    lt := lines
+
+    /* mark the entire function as a single line of code without line info */
+    if len(lt) == 0 {
+        lt = []rt.Line {{ Ln: 1, Nb: size }}
+    }
+
+    /* encode every line, the first one is relative to -1 */
+    for i, r := range lt {
+        if i == 0 {
+            pctab = append(pctab, encodeFirst(r.Ln)...)
+        } else {
+            pctab = append(pctab, encodeValue(r.Ln - ln)...)
+        }
+
+        /* encode the length */
+        ln = r.Ln
+        pctab = append(pctab, encodeVariant(int(r.Nb))...)
+    }
+
+    /* terminate the table */
+    return append(pctab, 0)
+}
+
+func registerModule(mod *_ModuleData, ftab *_FindFuncBucket, guard uintptr, frame rt.Frame) {
+    var cc *_Canary
+
+    /* surround the module data with canaries in hardened mode */
+    if guard != 0 {
+        cc = newCanary(mod)
+        mod = &cc.mod
+    }
+
+    /* add to the module list */
     modLock.Lock()
-    modList = append(modList, mod)
+    modList[mod.minpc] = _Module { mod, ftab, frame.ArgPtrs, frame.LocalPtrs, cc, guard, false }
     lastmoduledatap.next = mod
     lastmoduledatap = mod
     modLock.Unlock()
 }
+
+func unregisterModule(pc uintptr) (uintptr, uintptr) {
+    modLock.Lock()
+    defer modLock.Unlock()
+
+    /* find the module */
+    mm, ok := modList[pc]
+    if !ok || mm.dead {
+        panic(fmt.Sprintf("loader: no function was loaded at %#x", pc))
+    }
+
+    /* the module is never unlinked, the runtime walks the module list without
+     * any lock, so the metadata is kept and only marked as unloaded */
+    mm.dead = true
+    modList[pc] = mm
+    return mm.mod.maxpc - mm.mod.minpc, mm.grds
+}
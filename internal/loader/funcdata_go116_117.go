@@ -114,11 +114,10 @@ var modHeader = &_PCHeader {
 }
 
 var (
-    emptyByte  byte
-    bucketList []*_FindFuncBucket
+    emptyByte byte
 )
 
-func registerFunction(name string, pc uintptr, size uintptr, frame rt.Frame) {
+func registerFunction(name string, file string, pc uintptr, size uintptr, guard uintptr, frame rt.Frame) {
     var pbase uintptr
     var sbase uintptr
 
@@ -163,7 +162,6 @@ func registerFunction(name string, pc uintptr, size uintptr, frame rt.Frame) {
     /* pin the find function bucket */
     ftab := &ffunc[0]
     pctab = append(pctab, 0)
-    bucketList = append(bucketList, ftab)
 
     /* function entry */
     fn := _Func {
@@ -178,12 +176,13 @@ func registerFunction(name string, pc uintptr, size uintptr, frame rt.Frame) {
         localptrs : frame.LocalPtrs.Pin(),
     }
 
-    /* mark the entire function as a single line of code */
-    fn.pcln = uint32(len(pctab))
+    /* the entire function comes from a single file */
     fn.pcfile = uint32(len(pctab))
-    pctab = append(pctab, encodeFirst(1)...)
-    pctab = append(pctab, encodeVariant(int(size))...)
-    pctab = append(pctab, 0)
+    pctab = encodeLines(pctab, nil, size)
+
+    /* map the code back to the lines of the source, if any */
+    fn.pcln = uint32(len(pctab))
+    pctab = encodeLines(pctab, frame.LineTab, size)
 
     /* set the entire function to use stack map 0 */
     fn.pcdata[_PCDATA_StackMapIndex] = uint32(len(pctab))
@@ -209,7 +208,7 @@ func registerFunction(name string, pc uintptr, size uintptr, frame rt.Frame) {
         pcHeader    : modHeader,
         funcnametab : append(append([]byte{0}, name...), 0),
         cutab       : []uint32{0, 0, 1},
-        filetab     : []byte("\x00(jit-generated)\x00"),
+        filetab     : append(append([]byte{0}, file...), 0),
         pctab       : pctab,
         pclntable   : []_Func{fn},
         ftab        : tab,
@@ -223,5 +222,5 @@ func registerFunction(name string, pc uintptr, size uintptr, frame rt.Frame) {
 
     /* verify and register the new module */
     moduledataverify1(mod)
-    registerModule(mod)
+    registerModule(mod, ftab, guard, frame)
 }
\ No newline at end of file
@@ -27,6 +27,6 @@ const (
     _ = panic("Unsupported Go version. Supported versions are 1.16 ~ 1.20")
 )
 
-func registerFunction(_ string, _ uintptr, _ uintptr, _ rt.Frame) {
+func registerFunction(_ string, _ string, _ uintptr, _ uintptr, _ uintptr, _ rt.Frame) {
     panic("Unsupported Go version. Supported versions are 1.16 ~ 1.20")
 }
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package loader
+
+import (
+    `fmt`
+    `os`
+    `sync/atomic`
+    `unsafe`
+)
+
+const (
+    _CanaryMagic = 0x21216c6167757266   // "frugal!!"
+)
+
+var (
+    hardened = int32(bool2i32(os.Getenv("FRUGAL_HARDENED_LOADER") != ""))
+)
+
+func bool2i32(v bool) int32 {
+    if v {
+        return 1
+    } else {
+        return 0
+    }
+}
+
+// SetHardened turns on or off the hardened mode. Functions loaded in hardened
+// mode have an inaccessible guard page on each side of their code, and their
+// module data is surrounded by canary values that can be checked with Verify.
+func SetHardened(enable bool) {
+    atomic.StoreInt32(&hardened, bool2i32(enable))
+}
+
+func guardSize() uintptr {
+    if atomic.LoadInt32(&hardened) == 0 {
+        return 0
+    } else {
+        return uintptr(os.Getpagesize())
+    }
+}
+
+type _Canary struct {
+    head uint64
+    mod  _ModuleData
+    tail uint64
+}
+
+func canaryOf(p *uint64) uint64 {
+    return _CanaryMagic ^ uint64(uintptr(unsafe.Pointer(p)))
+}
+
+func newCanary(mod *_ModuleData) *_Canary {
+    cc := &_Canary { mod: *mod }
+    cc.head = canaryOf(&cc.head)
+    cc.tail = canaryOf(&cc.tail)
+    return cc
+}
+
+func (self *_Canary) intact() bool {
+    return self.head == canaryOf(&self.head) && self.tail == canaryOf(&self.tail)
+}
+
+// Verify checks the canaries of every function that was loaded in hardened
+// mode, and returns an error if any of them was overwritten.
+func Verify() error {
+    modLock.Lock()
+    defer modLock.Unlock()
+
+    /* check every module */
+    for pc, mm := range modList {
+        if mm.cnry != nil && !mm.cnry.intact() {
+            return fmt.Errorf("loader: canary of function at %#x was overwritten", pc)
+        } else if mm.mod.minpc != pc {
+            return fmt.Errorf("loader: module data of function at %#x was overwritten", pc)
+        }
+    }
+
+    /* all checked ok */
+    return nil
+}
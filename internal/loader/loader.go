@@ -20,7 +20,6 @@ import (
     `fmt`
     `os`
     `sync/atomic`
-    `syscall`
     `unsafe`
 
     `github.com/cloudwego/frugal/internal/rt`
@@ -30,12 +29,6 @@ const (
     MAP_BASE = 0x7ff00000000
 )
 
-const (
-    _AP = syscall.MAP_ANON  | syscall.MAP_PRIVATE
-    _RX = syscall.PROT_READ | syscall.PROT_EXEC
-    _RW = syscall.PROT_READ | syscall.PROT_WRITE
-)
-
 type (
     Loader   []byte
     Function unsafe.Pointer
@@ -57,29 +50,62 @@ func alignUp(n uintptr, a int) uintptr {
 
 func (self Loader) Load(fn string, frame rt.Frame) (f Function) {
     var mm uintptr
-    var er syscall.Errno
+    var er error
 
-    /* align the size to pages */
+    /* align the size to pages, plus the guard pages in hardened mode */
+    gs := guardSize()
     nf := uintptr(len(self))
     nb := alignUp(nf, os.Getpagesize())
-    fp := atomic.AddUintptr(&LoadBase, nb) - nb
+    fp := atomic.AddUintptr(&LoadBase, nb + gs * 2) - nb - gs * 2
 
     /* allocate a block of memory */
-    if mm, _, er = syscall.Syscall6(syscall.SYS_MMAP, fp, nb, _RW, _AP, 0, 0); er != 0 {
+    if mm, er = mmap(fp, nb + gs * 2); er != nil {
         panic(er)
     }
 
+    /* make the guard pages inaccessible */
+    if gs != 0 {
+        if er = mguard(mm, gs); er == nil {
+            er = mguard(mm + gs + nb, gs)
+        }
+        if mm += gs; er != nil {
+            panic(er)
+        }
+    }
+
     /* copy code into the memory, and register the function */
     copy(rt.BytesFrom(mkptr(mm), len(self), int(nb)), self)
-    registerFunction(fmt.Sprintf("(frugal).%s_%x", fn, mm), mm, nf, frame)
+    name := fmt.Sprintf("%s_%x", fn, mm)
+    registerFunction("(frugal)." + name, writeSource(name, frame.Source), mm, nf, gs, frame)
 
     /* make it executable */
-    if _, _, err := syscall.Syscall(syscall.SYS_MPROTECT, mm, nb, _RX); err != 0 {
-        panic(err)
+    if er = mprotect(mm, nb); er != nil {
+        panic(er)
     }
 
     /* record statistics */
     atomic.AddUint32(&FnCount, 1)
-    atomic.AddUintptr(&LoadSize, nb)
+    atomic.AddUintptr(&LoadSize, nb + gs * 2)
     return Function(&mm)
 }
+
+// Unload frees the code of the function loaded by Load. The metadata of the
+// function stays registered to the runtime, and the address range stays
+// reserved, so that it is never reused by some other code.
+//
+// The caller must make sure that no goroutine is executing, or is about to
+// execute the function.
+func Unload(fn Function) {
+    mm := *(*uintptr)(fn)
+    nf, gs := unregisterModule(mm)
+    nb := alignUp(nf, os.Getpagesize()) + gs * 2
+
+    /* release the memory, including the guard pages */
+    if err := mfree(mm - gs, nb); err != nil {
+        panic(err)
+    }
+
+    /* record statistics */
+    atomic.AddUint32(&FnCount, ^uint32(0))
+    atomic.AddUintptr(&LoadSize, -nb)
+}
@@ -18,6 +18,7 @@ package loader
 
 import (
     `fmt`
+    `os`
     `reflect`
     `runtime`
     `testing`
@@ -196,3 +197,78 @@ func dumpfunction(f interface{}) {
 func TestLoader_PCSPDelta(t *testing.T) {
     dumpfunction(moduledataverify1)
 }
+
+func TestLoader_Unload(t *testing.T) {
+    var asm x86_64.Assembler
+    require.NoError(t, asm.Assemble(`ret`))
+    fn := Loader(asm.Code()).Load("test_unload", rt.Frame{})
+    pc := *(*uintptr)(fn)
+    nf, sz := FnCount, LoadSize
+    require.NotNil(t, runtime.FuncForPC(pc))
+    Unload(fn)
+    assert.NotNil(t, runtime.FuncForPC(pc))
+    assert.Equal(t, nf - 1, FnCount)
+    assert.Equal(t, sz - uintptr(os.Getpagesize()), LoadSize)
+    assert.Panics(t, func() { Unload(fn) })
+}
+
+func TestLoader_Hardened(t *testing.T) {
+    var asm x86_64.Assembler
+    if runtime.Version() < "go1.17" {
+        require.NoError(t, asm.Assemble(`
+            movq 8(%rsp), %rax
+            movq $1234, (%rax)
+            ret`))
+    } else {
+        require.NoError(t, asm.Assemble(`
+            movq $1234, (%rax)
+            ret`))
+    }
+    SetHardened(true)
+    defer SetHardened(false)
+    v0 := 0
+    pg := uintptr(os.Getpagesize())
+    sz := LoadSize
+    fn := Loader(asm.Code()).Load("test_hardened", rt.Frame{})
+    pc := *(*uintptr)(fn)
+    (*(*func(*int))(unsafe.Pointer(&fn)))(&v0)
+    assert.Equal(t, 1234, v0)
+    assert.Equal(t, sz + pg * 3, LoadSize)
+    assert.Equal(t, fmt.Sprintf("(frugal).test_hardened_%x", pc), runtime.FuncForPC(pc).Name())
+    require.NoError(t, Verify())
+    cc := modList[pc].cnry
+    require.NotNil(t, cc)
+    cc.tail++
+    require.EqualError(t, Verify(), fmt.Sprintf("loader: canary of function at %#x was overwritten", pc))
+    cc.tail--
+    require.NoError(t, Verify())
+    Unload(fn)
+    assert.Equal(t, sz, LoadSize)
+}
+
+func TestLoader_LineTab(t *testing.T) {
+    var asm x86_64.Assembler
+    require.NoError(t, asm.Assemble(`
+        nop
+        nop
+        nop
+        ret`))
+    dir := t.TempDir()
+    SetSourceDir(dir)
+    defer SetSourceDir("")
+    fn := Loader(asm.Code()).Load("test_linetab", rt.Frame {
+        Source  : []string { "a", "b", "c" },
+        LineTab : []rt.Line { { Ln: 1, Nb: 1 }, { Ln: 3, Nb: 2 }, { Ln: 2, Nb: 1 } },
+    })
+    pc := *(*uintptr)(fn)
+    file := fmt.Sprintf("%s/test_linetab_%x.hir", dir, pc)
+    for i, ln := range []int { 1, 3, 3, 2 } {
+        fp, lp := runtime.FuncForPC(pc).FileLine(pc + uintptr(i))
+        assert.Equal(t, file, fp)
+        assert.Equal(t, ln, lp)
+    }
+    src, err := os.ReadFile(file)
+    require.NoError(t, err)
+    assert.Equal(t, "a\nb\nc\n", string(src))
+    Unload(fn)
+}
@@ -0,0 +1,62 @@
+// +build !windows
+
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package loader
+
+import (
+    `syscall`
+)
+
+const (
+    _AP = syscall.MAP_ANON  | syscall.MAP_PRIVATE
+    _RX = syscall.PROT_READ | syscall.PROT_EXEC
+    _RW = syscall.PROT_READ | syscall.PROT_WRITE
+)
+
+func mmap(addr uintptr, size uintptr) (uintptr, error) {
+    if mm, _, err := syscall.Syscall6(syscall.SYS_MMAP, addr, size, _RW, _AP, 0, 0); err != 0 {
+        return 0, err
+    } else {
+        return mm, nil
+    }
+}
+
+func mprotect(addr uintptr, size uintptr) error {
+    if _, _, err := syscall.Syscall(syscall.SYS_MPROTECT, addr, size, _RX); err != 0 {
+        return err
+    } else {
+        return nil
+    }
+}
+
+func mguard(addr uintptr, size uintptr) error {
+    if _, _, err := syscall.Syscall(syscall.SYS_MPROTECT, addr, size, syscall.PROT_NONE); err != 0 {
+        return err
+    } else {
+        return nil
+    }
+}
+
+func mfree(addr uintptr, size uintptr) error {
+    if _, _, err := syscall.Syscall6(syscall.SYS_MMAP, addr, size, syscall.PROT_NONE, _AP | syscall.MAP_FIXED, 0, 0); err != 0 {
+        return err
+    } else {
+        return nil
+    }
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package loader
+
+import (
+    `syscall`
+    `unsafe`
+)
+
+const (
+    _MEM_COMMIT        = 0x1000
+    _MEM_RESERVE       = 0x2000
+    _MEM_DECOMMIT      = 0x4000
+    _PAGE_NOACCESS     = 0x01
+    _PAGE_READWRITE    = 0x04
+    _PAGE_EXECUTE_READ = 0x20
+)
+
+var (
+    libKernel32        = syscall.NewLazyDLL("kernel32.dll")
+    procVirtualAlloc   = libKernel32.NewProc("VirtualAlloc")
+    procVirtualProtect = libKernel32.NewProc("VirtualProtect")
+    procVirtualFree    = libKernel32.NewProc("VirtualFree")
+    procFlushInstCache = libKernel32.NewProc("FlushInstructionCache")
+)
+
+func mmap(addr uintptr, size uintptr) (uintptr, error) {
+    mm, _, err := procVirtualAlloc.Call(addr, size, _MEM_COMMIT | _MEM_RESERVE, _PAGE_READWRITE)
+
+    /* addr is only a hint, it may not be aligned to the allocation granularity or already in use */
+    if mm == 0 {
+        mm, _, err = procVirtualAlloc.Call(0, size, _MEM_COMMIT | _MEM_RESERVE, _PAGE_READWRITE)
+    }
+
+    /* check for errors */
+    if mm == 0 {
+        return 0, err
+    } else {
+        return mm, nil
+    }
+}
+
+func mprotect(addr uintptr, size uintptr) error {
+    var old uint32
+    var ret uintptr
+    var err error
+
+    /* make the pages executable and read-only */
+    if ret, _, err = procVirtualProtect.Call(addr, size, _PAGE_EXECUTE_READ, uintptr(unsafe.Pointer(&old))); ret == 0 {
+        return err
+    }
+
+    /* the new code must be visible to the instruction fetcher */
+    if hp, err := syscall.GetCurrentProcess(); err != nil {
+        return err
+    } else if ret, _, err = procFlushInstCache.Call(uintptr(hp), addr, size); ret == 0 {
+        return err
+    } else {
+        return nil
+    }
+}
+
+func mguard(addr uintptr, size uintptr) error {
+    var old uint32
+    var ret uintptr
+    var err error
+
+    /* any access to the guard pages faults */
+    if ret, _, err = procVirtualProtect.Call(addr, size, _PAGE_NOACCESS, uintptr(unsafe.Pointer(&old))); ret == 0 {
+        return err
+    } else {
+        return nil
+    }
+}
+
+func mfree(addr uintptr, size uintptr) error {
+    if ret, _, err := procVirtualFree.Call(addr, size, _MEM_DECOMMIT); ret == 0 {
+        return err
+    } else {
+        return nil
+    }
+}
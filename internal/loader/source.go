@@ -0,0 +1,61 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loader
+
+import (
+    `os`
+    `path/filepath`
+    `strings`
+    `sync/atomic`
+)
+
+const (
+    _NoSource = "(jit-generated)"
+)
+
+var (
+    sourceDir atomic.Value
+)
+
+func init() {
+    SetSourceDir(os.Getenv("FRUGAL_DEBUG_SOURCE_DIR"))
+}
+
+// SetSourceDir sets the directory where the pseudo-source of every function is
+// written to when it is loaded, an empty string turns it off. The file names and
+// line numbers recorded in the runtime metadata refer to these files, so stack
+// traces and profiles can be mapped back to the generated code.
+func SetSourceDir(dir string) {
+    sourceDir.Store(dir)
+}
+
+func writeSource(name string, src []string) string {
+    dir, _ := sourceDir.Load().(string)
+    fn := filepath.Join(dir, name + ".hir")
+
+    /* nothing to write */
+    if dir == "" || len(src) == 0 {
+        return _NoSource
+    }
+
+    /* the source is only for debugging, failing to write it is not fatal */
+    if err := os.WriteFile(fn, []byte(strings.Join(src, "\n") + "\n"), 0644); err != nil {
+        return _NoSource
+    } else {
+        return fn
+    }
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package opts
+
+import (
+    `os`
+    `strconv`
+)
+
+var (
+    SortMapKeys    = parseBoolOrDefault("FRUGAL_SORT_MAP_KEYS", false)
+    ValidateEnums  = parseBoolOrDefault("FRUGAL_VALIDATE_ENUMS", false)
+    RejectUnknown  = parseBoolOrDefault("FRUGAL_REJECT_UNKNOWN_FIELDS", false)
+    ReuseMemory    = parseBoolOrDefault("FRUGAL_REUSE_MEMORY", false)
+    OmitEmpty      = parseBoolOrDefault("FRUGAL_OMIT_EMPTY_CONTAINERS", false)
+    NilAsEmpty     = parseBoolOrDefault("FRUGAL_NIL_AS_EMPTY", false)
+    NonNilEmpty    = parseBoolOrDefault("FRUGAL_NON_NIL_CONTAINERS", false)
+    IsSetMethods   = parseBoolOrDefault("FRUGAL_ISSET_METHODS", false)
+    DetectCycles   = parseBoolOrDefault("FRUGAL_DETECT_CYCLES", false)
+    LenientLengths = parseBoolOrDefault("FRUGAL_LENIENT_LENGTHS", false)
+)
+
+func parseBoolOrDefault(key string, def bool) bool {
+    if env := os.Getenv(key); env == "" {
+        return def
+    } else if val, err := strconv.ParseBool(env); err != nil {
+        panic("frugal: invalid value for " + key)
+    } else {
+        return val
+    }
+}
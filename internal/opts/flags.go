@@ -0,0 +1,141 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package opts
+
+import (
+    `strings`
+    `sync/atomic`
+)
+
+// Flag is a set of features that change the generated code.
+type Flag uint32
+
+const (
+    F_SortMapKeys Flag = 1 << iota
+    F_ValidateEnums
+    F_RejectUnknown
+    F_ReuseMemory
+    F_OmitEmpty
+    F_NilAsEmpty
+    F_NonNilEmpty
+    F_IsSetMethods
+    F_YieldInterval
+    F_ZeroCopy
+    F_Mask
+    F_Spill
+    F_Checked
+    F_LenientLengths
+)
+
+const (
+    EncoderFlags = F_SortMapKeys | F_OmitEmpty | F_NilAsEmpty | F_IsSetMethods
+    DecoderFlags = F_ValidateEnums | F_RejectUnknown | F_ReuseMemory | F_NonNilEmpty | F_YieldInterval | F_ZeroCopy | F_Mask | F_Spill | F_Checked | F_LenientLengths
+)
+
+var flagNames = [...]string {
+    "SortMapKeys",
+    "ValidateEnums",
+    "RejectUnknownFields",
+    "ReuseMemory",
+    "OmitEmptyContainers",
+    "NilAsEmpty",
+    "NonNilContainers",
+    "IsSetMethods",
+    "YieldInterval",
+    "ZeroCopy",
+    "Mask",
+    "Spill",
+    "Checked",
+    "LenientLengths",
+}
+
+var (
+    flagUsed    [len(flagNames)]uint64
+    flagEnabled [len(flagNames)]uint64
+)
+
+// FlagStats counts the programs compiled with a flag turned on, and those of
+// them whose code was actually changed by the flag.
+type FlagStats struct {
+    Name    string
+    Used    int
+    Enabled int
+}
+
+func (self Flag) String() string {
+    var sb strings.Builder
+    sb.Grow(64)
+
+    /* join the names of every bit */
+    for i, v := range flagNames {
+        if self & (1 << i) != 0 {
+            if sb.Len() != 0 {
+                sb.WriteByte('|')
+            }
+            sb.WriteString(v)
+        }
+    }
+
+    /* all done */
+    return sb.String()
+}
+
+// Flags returns the flags turned on by the options.
+func (self *Options) Flags() (ret Flag) {
+    if self.SortMapKeys   { ret |= F_SortMapKeys }
+    if self.ValidateEnums { ret |= F_ValidateEnums }
+    if self.RejectUnknown { ret |= F_RejectUnknown }
+    if self.ReuseMemory   { ret |= F_ReuseMemory }
+    if self.OmitEmpty     { ret |= F_OmitEmpty }
+    if self.NilAsEmpty    { ret |= F_NilAsEmpty }
+    if self.NonNilEmpty   { ret |= F_NonNilEmpty }
+    if self.IsSetMethods  { ret |= F_IsSetMethods }
+    if self.LenientLengths { ret |= F_LenientLengths }
+    if self.YieldInterval != 0 { ret |= F_YieldInterval }
+    return
+}
+
+// RecordFlags counts a program that was compiled with the enabled flags, of
+// which the used ones changed the generated code.
+func RecordFlags(enabled Flag, used Flag) {
+    for i := range flagNames {
+        if enabled & (1 << i) != 0 {
+            atomic.AddUint64(&flagEnabled[i], 1)
+        }
+        if used & enabled & (1 << i) != 0 {
+            atomic.AddUint64(&flagUsed[i], 1)
+        }
+    }
+}
+
+// GetFlagStats returns the counters of every flag, in the order they are defined.
+func GetFlagStats() []FlagStats {
+    ret := make([]FlagStats, 0, len(flagNames))
+
+    /* load every counter */
+    for i, v := range flagNames {
+        ret = append(ret, FlagStats {
+            Name    : v,
+            Used    : int(atomic.LoadUint64(&flagUsed[i])),
+            Enabled : int(atomic.LoadUint64(&flagEnabled[i])),
+        })
+    }
+
+    /* all done */
+    return ret
+}
@@ -24,11 +24,17 @@ import (
 const (
     _DefaultMaxInlineDepth  = 5     // cutoff at 5 levels of inlining
     _DefaultMaxInlineILSize = 50000 // cutoff at 50k of IL instructions
+    _DefaultMaxTransformed  = 64 << 20 // cutoff at 64MB of decoded THeader payloads
 )
 
 var (
     MaxInlineDepth  = parseOrDefault("FRUGAL_MAX_INLINE_DEPTH", _DefaultMaxInlineDepth, 1)
     MaxInlineILSize = parseOrDefault("FRUGAL_MAX_INLINE_IL_SIZE", _DefaultMaxInlineILSize, 256)
+    MaxCacheEntries = int64(parseOrDefault("FRUGAL_MAX_CACHE_ENTRIES", 0, 0))
+    YieldInterval   = parseOrDefault("FRUGAL_YIELD_INTERVAL", 0, 0)
+    MaxAllocBytes   = int64(parseOrDefault("FRUGAL_MAX_ALLOC_BYTES", 0, 0))
+    DeoptThreshold  = parseOrDefault("FRUGAL_DEOPT_THRESHOLD", 0, 0)
+    MaxTransformed  = int64(parseOrDefault("FRUGAL_MAX_TRANSFORMED_BYTES", _DefaultMaxTransformed, 0))
 )
 
 func parseOrDefault(key string, def int, min int) int {
@@ -16,12 +16,32 @@
 
 package opts
 
+import (
+    `sync/atomic`
+)
+
 type Options struct {
     MaxInlineDepth   int
     MaxInlineILSize  int
     MaxPretouchDepth int
+    SortMapKeys      bool
+    ValidateEnums    bool
+    RejectUnknown    bool
+    ReuseMemory      bool
+    OmitEmpty        bool
+    NilAsEmpty       bool
+    NonNilEmpty      bool
+    IsSetMethods     bool
+    LenientLengths   bool
+    AllocBudget      bool
+    SkipStats        bool
+    YieldInterval    int
 }
 
+// DecodeStats is non-zero while a stats hook that receives the decode events is
+// installed, only the types compiled meanwhile count the skipped bytes.
+var DecodeStats int32
+
 func (self *Options) CanInline(sp int, pc int) bool {
     return (self.MaxInlineDepth > sp || self.MaxInlineDepth == 0) && (self.MaxInlineILSize > pc || self.MaxInlineILSize == 0)
 }
@@ -35,5 +55,17 @@ func GetDefaultOptions() Options {
         MaxInlineDepth   : MaxInlineDepth,
         MaxInlineILSize  : MaxInlineILSize,
         MaxPretouchDepth : 0,
+        SortMapKeys      : SortMapKeys,
+        ValidateEnums    : ValidateEnums,
+        RejectUnknown    : RejectUnknown,
+        ReuseMemory      : ReuseMemory,
+        OmitEmpty        : OmitEmpty,
+        NilAsEmpty       : NilAsEmpty,
+        NonNilEmpty      : NonNilEmpty,
+        IsSetMethods     : IsSetMethods,
+        LenientLengths   : LenientLengths,
+        AllocBudget      : atomic.LoadInt64(&MaxAllocBytes) != 0,
+        SkipStats        : atomic.LoadInt32(&DecodeStats) != 0,
+        YieldInterval    : YieldInterval,
     }
 }
@@ -21,8 +21,15 @@ type Stack struct {
     Nb uintptr
 }
 
+type Line struct {
+    Ln int
+    Nb uintptr
+}
+
 type Frame struct {
     SpTab     []Stack
+    LineTab   []Line
+    Source    []string
     ArgSize   uintptr
     ArgPtrs   *StackMap
     LocalPtrs *StackMap
@@ -34,16 +34,10 @@ func emu_bytes(ctx hir.CallContext, i int) (v []byte) {
     return rt.BytesFrom(ctx.Ap(i), int(ctx.Au(i + 1)), int(ctx.Au(i + 2)))
 }
 
-func emu_seterr(ctx hir.CallContext, err error) {
-    vv := (*rt.GoIface)(unsafe.Pointer(&err))
-    ctx.Rp(0, unsafe.Pointer(vv.Itab))
-    ctx.Rp(1, vv.Value)
-}
-
 func emu_icall_ZeroCopyWriter_WriteDirect(ctx hir.CallContext) {
     if !ctx.Verify("*iii", "**") {
         panic("invalid ZeroCopyWriter.WriteDirect call")
     } else {
-        emu_seterr(ctx, emu_wbuf(ctx).WriteDirect(emu_bytes(ctx, 0), int(ctx.Au(3))))
+        ctx.Re(0, emu_wbuf(ctx).WriteDirect(emu_bytes(ctx, 0), int(ctx.Au(3))))
     }
 }
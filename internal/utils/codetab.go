@@ -0,0 +1,124 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package utils
+
+import (
+    `crypto/sha256`
+    `encoding/binary`
+    `hash`
+    `sync`
+)
+
+// CodeKey identifies the code of a program by the digest of its instructions.
+type CodeKey [sha256.Size]byte
+
+// CodeHasher computes the CodeKey of a program.
+type CodeHasher struct {
+    h hash.Hash
+    b [8]byte
+}
+
+func NewCodeHasher() *CodeHasher {
+    return &CodeHasher { h: sha256.New() }
+}
+
+func (self *CodeHasher) Int(v uint64) {
+    binary.LittleEndian.PutUint64(self.b[:], v)
+    self.h.Write(self.b[:])
+}
+
+func (self *CodeHasher) Sum() (ret CodeKey) {
+    self.h.Sum(ret[:0])
+    return
+}
+
+type _CodeEntry struct {
+    n  int
+    fn interface{}
+}
+
+// CodeTable shares the code of identical programs, which are compiled for
+// distinct named types with the same definition, such as `type B A`.
+type CodeTable struct {
+    m sync.Mutex
+    t map[CodeKey]*_CodeEntry
+}
+
+func CreateCodeTable() *CodeTable {
+    return &CodeTable {
+        t: make(map[CodeKey]*_CodeEntry),
+    }
+}
+
+// Link returns the code identified by key, which is linked with link only if
+// it is not loaded yet, in which case nb is the size of the code, otherwise
+// nb is 0. The code is freed with unlink once every returned release function
+// has been called.
+func (self *CodeTable) Link(key CodeKey, link func() (interface{}, int), unlink func(interface{})) (fn interface{}, nb int, release func()) {
+    if fn = self.acquire(key); fn != nil {
+        return fn, 0, self.releaser(key, unlink)
+    }
+
+    /* link the code without holding the lock, it can take a while */
+    fn, nb = link()
+    self.m.Lock()
+
+    /* another goroutine may have linked the same code in the meantime */
+    if e := self.t[key]; e != nil {
+        e.n++
+        self.m.Unlock()
+        unlink(fn)
+        return e.fn, 0, self.releaser(key, unlink)
+    }
+
+    /* add the code to the table */
+    self.t[key] = &_CodeEntry { n: 1, fn: fn }
+    self.m.Unlock()
+    return fn, nb, self.releaser(key, unlink)
+}
+
+func (self *CodeTable) acquire(key CodeKey) interface{} {
+    self.m.Lock()
+    defer self.m.Unlock()
+
+    /* add a reference if it already exists */
+    if e := self.t[key]; e == nil {
+        return nil
+    } else {
+        e.n++
+        return e.fn
+    }
+}
+
+func (self *CodeTable) releaser(key CodeKey, unlink func(interface{})) func() {
+    return func() {
+        self.m.Lock()
+        e := self.t[key]
+
+        /* still referenced by some other types */
+        if e.n--; e.n != 0 {
+            self.m.Unlock()
+            return
+        }
+
+        /* the last reference, free the code */
+        delete(self.t, key)
+        self.m.Unlock()
+        unlink(e.fn)
+    }
+}
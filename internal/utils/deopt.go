@@ -0,0 +1,194 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+    `fmt`
+    `reflect`
+    `runtime`
+    `strings`
+    `sync`
+    `sync/atomic`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+// FaultError is returned instead of the panic raised by the generated code of
+// Type when deoptimization is enabled. Value is the recovered panic value.
+type FaultError struct {
+    Kind  string
+    Type  reflect.Type
+    Value interface{}
+}
+
+func (self FaultError) Error() string {
+    return fmt.Sprintf("frugal: %s of %s faulted: %v", self.Kind, self.Type, self.Value)
+}
+
+func (self FaultError) Unwrap() error {
+    err, _ := self.Value.(error)
+    return err
+}
+
+type DeoptEvent struct {
+    Type   reflect.Type
+    Kind   string
+    Faults int
+    Fault  interface{}
+    Symbol string
+    Source string
+}
+
+type DeoptHook func(*DeoptEvent)
+
+var (
+    deoptHook unsafe.Pointer
+)
+
+func SetDeoptHook(fn DeoptHook) {
+    if fn == nil {
+        atomic.StorePointer(&deoptHook, nil)
+    } else {
+        atomic.StorePointer(&deoptHook, unsafe.Pointer(&fn))
+    }
+}
+
+// IsFault reports whether a recovered panic value is likely to be caused by the
+// generated code itself, rather than the user code called from it. It must be
+// called by the deferred function that recovered val, since a runtime.Error is
+// only a fault when it is raised by frugal itself, which is found on the stack.
+func IsFault(val interface{}) bool {
+    switch val.(type) {
+        case runtime.Error : return isFrugalFrame(panicFrame())
+        case AbortError    : return true
+        default            : return false
+    }
+}
+
+const (
+    _MaxPanicDepth = 64
+)
+
+const (
+    _LoadedPrefix  = "(frugal)."
+    _PackagePrefix = "github.com/cloudwego/frugal/internal/"
+)
+
+func isFrugalFrame(fn string) bool {
+    return strings.HasPrefix(fn, _LoadedPrefix) || strings.HasPrefix(fn, _PackagePrefix)
+}
+
+// panicFrame returns the name of the function that raised the current panic,
+// not counting the runtime functions that raised it on behalf of the caller.
+func panicFrame() string {
+    pcs := make([]uintptr, _MaxPanicDepth)
+    fns := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+    /* find the panic first */
+    for {
+        fr, more := fns.Next()
+        if fr.Function == "runtime.gopanic" {
+            break
+        } else if !more {
+            return ""
+        }
+    }
+
+    /* skip frames such as runtime.sigpanic or runtime.panicIndex */
+    for {
+        fr, more := fns.Next()
+        if !strings.HasPrefix(fr.Function, "runtime.") {
+            return fr.Function
+        } else if !more {
+            return ""
+        }
+    }
+}
+
+// DeoptTable counts the faults of the native code of every type, and remembers
+// the types that must be linked with the emulator from now on.
+type DeoptTable struct {
+    kind string
+    lock sync.Mutex
+    hits map[*rt.GoType]int
+    emus map[*rt.GoType]bool
+}
+
+func CreateDeoptTable(kind string) *DeoptTable {
+    return &DeoptTable {
+        kind: kind,
+        hits: make(map[*rt.GoType]int),
+        emus: make(map[*rt.GoType]bool),
+    }
+}
+
+// Deoptimized reports whether vt has been deoptimized.
+func (self *DeoptTable) Deoptimized(vt *rt.GoType) bool {
+    self.lock.Lock()
+    ret := self.emus[vt]
+    self.lock.Unlock()
+    return ret
+}
+
+// Fault records a fault of the native code at fp that was linked for vt, and
+// reports whether vt has just been deoptimized. The caller should then drop the
+// compiled code of vt, so that it is linked again with the emulator.
+func (self *DeoptTable) Fault(vt *rt.GoType, fp unsafe.Pointer, val interface{}, threshold int) bool {
+    self.lock.Lock()
+    nb := self.hits[vt] + 1
+    ok := !self.emus[vt] && nb >= threshold
+
+    /* the type is already deoptimized, or has not faulted enough times */
+    if !ok {
+        self.hits[vt] = nb
+        self.lock.Unlock()
+        return false
+    }
+
+    /* switch to the emulator */
+    self.emus[vt] = true
+    delete(self.hits, vt)
+    self.lock.Unlock()
+    emitDeoptEvent(self.kind, vt, nb, fp, val)
+    return true
+}
+
+func emitDeoptEvent(kind string, vt *rt.GoType, nb int, fp unsafe.Pointer, val interface{}) {
+    sym := rt.FuncName(fp)
+    src := "???"
+
+    /* the listing of the code, see loader.SetSourceDir */
+    if fn := runtime.FuncForPC(uintptr(fp)); fn != nil {
+        src, _ = fn.FileLine(uintptr(fp))
+    }
+
+    /* always log the event, since it is most likely a bug of the compiler */
+    Log(LevelWarn, "deoptimizing to the emulator after repeated faults", "codec", kind, "type", vt, "faults", nb, "symbol", sym, "source", src, "fault", val)
+
+    /* invoke the hook if any */
+    if hp := (*DeoptHook)(atomic.LoadPointer(&deoptHook)); hp != nil {
+        (*hp)(&DeoptEvent {
+            Type   : vt.Pack(),
+            Kind   : kind,
+            Faults : nb,
+            Fault  : val,
+            Symbol : sym,
+            Source : src,
+        })
+    }
+}
@@ -30,6 +30,35 @@ func (self TypeError) Error() string {
     return fmt.Sprintf("TypeError(%s): %s", self.Type, self.Note)
 }
 
+const (
+    AbortUnderflow = iota
+    AbortUnbalanced
+)
+
+var abortReasons = [...]string {
+    AbortUnderflow  : "state stack underflow",
+    AbortUnbalanced : "state stack not empty on return",
+}
+
+// AbortError is the panic value raised by generated code that reaches a state
+// which a correctly compiled program never gets into. PC is the index of the
+// faulting instruction in the disassembled program, and Field is -1 when the
+// instruction does not belong to any field of Type.
+type AbortError struct {
+    Type   reflect.Type
+    Field  int
+    PC     int
+    Reason string
+}
+
+func (self AbortError) Error() string {
+    if self.Field < 0 {
+        return fmt.Sprintf("frugal: %s at pc %d of %s", self.Reason, self.PC, self.Type)
+    } else {
+        return fmt.Sprintf("frugal: %s at pc %d of %s, field %d", self.Reason, self.PC, self.Type, self.Field)
+    }
+}
+
 type SyntaxError struct {
     Pos    int
     Src    string
@@ -47,6 +76,15 @@ func EType(vt reflect.Type, note string) TypeError {
     }
 }
 
+func EAbort(vt reflect.Type, id int, pc int, why int) AbortError {
+    return AbortError {
+        Type   : vt,
+        Field  : id,
+        PC     : pc,
+        Reason : abortReasons[why],
+    }
+}
+
 func ESyntax(pos int, src string, reason string) SyntaxError {
     return SyntaxError {
         Pos    : pos,
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+    `reflect`
+    `runtime`
+    `sync/atomic`
+    `time`
+    `unsafe`
+
+    `github.com/cloudwego/frugal/internal/opts`
+    `github.com/cloudwego/frugal/internal/rt`
+)
+
+type CompileEvent struct {
+    Type     reflect.Type
+    Kind     string
+    Size     int
+    Duration time.Duration
+    Stack    []byte
+}
+
+type CompileHook func(*CompileEvent)
+
+type StatsHook interface {
+    OnCompile(kind string, vt reflect.Type, size int, dt time.Duration)
+    OnError(kind string, err error)
+}
+
+type DecodeHook interface {
+    OnDecode(vt reflect.Type, size int, skipped int)
+}
+
+var (
+    statsHook   unsafe.Pointer
+    decodeHook  unsafe.Pointer
+    compileHook unsafe.Pointer
+)
+
+func SetStatsHook(hook StatsHook) {
+    if hook == nil {
+        atomic.StorePointer(&statsHook, nil)
+    } else {
+        atomic.StorePointer(&statsHook, unsafe.Pointer(&hook))
+    }
+
+    /* the decode hook is optional, keep it separately so decoding does not need a type assertion */
+    if dh, ok := hook.(DecodeHook); !ok {
+        atomic.StoreInt32(&opts.DecodeStats, 0)
+        atomic.StorePointer(&decodeHook, nil)
+    } else {
+        atomic.StoreInt32(&opts.DecodeStats, 1)
+        atomic.StorePointer(&decodeHook, unsafe.Pointer(&dh))
+    }
+}
+
+func SetCompileHook(fn CompileHook) {
+    if fn == nil {
+        atomic.StorePointer(&compileHook, nil)
+    } else {
+        atomic.StorePointer(&compileHook, unsafe.Pointer(&fn))
+    }
+}
+
+func EmitErrorEvent(kind string, err error) {
+    if hp := (*StatsHook)(atomic.LoadPointer(&statsHook)); hp != nil {
+        (*hp).OnError(kind, err)
+    }
+}
+
+func EmitDecodeEvent(vt *rt.GoType, size int, skipped int) {
+    if hp := (*DecodeHook)(atomic.LoadPointer(&decodeHook)); hp != nil {
+        (*hp).OnDecode(vt.Pack(), size, skipped)
+    }
+}
+
+func EmitCompileEvent(kind string, vt *rt.GoType, size int, dt time.Duration) {
+    var nb int
+    var fp *CompileHook
+    var hp *StatsHook
+
+    /* notify the stats hook if any */
+    if hp = (*StatsHook)(atomic.LoadPointer(&statsHook)); hp != nil {
+        (*hp).OnCompile(kind, vt.Pack(), size, dt)
+    }
+
+    /* check if the compile hook is installed */
+    if fp = (*CompileHook)(atomic.LoadPointer(&compileHook)); fp == nil {
+        return
+    }
+
+    /* capture the stack of the goroutine that triggered the compilation */
+    st := make([]byte, 4096)
+
+    /* grow the buffer until the entire stack fits */
+    for nb = runtime.Stack(st, false); nb == len(st); nb = runtime.Stack(st, false) {
+        st = make([]byte, len(st) * 2)
+    }
+
+    /* invoke the hook */
+    (*fp)(&CompileEvent {
+        Type     : vt.Pack(),
+        Kind     : kind,
+        Size     : size,
+        Duration : dt,
+        Stack    : st[:nb],
+    })
+}
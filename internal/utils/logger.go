@@ -0,0 +1,111 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package utils
+
+import (
+    `fmt`
+    `os`
+    `strings`
+    `sync/atomic`
+    `unsafe`
+)
+
+type LogLevel int
+
+const (
+    LevelDebug LogLevel = iota
+    LevelInfo
+    LevelWarn
+    LevelError
+)
+
+func (self LogLevel) String() string {
+    switch self {
+        case LevelDebug : return "DEBUG"
+        case LevelInfo  : return "INFO"
+        case LevelWarn  : return "WARN"
+        case LevelError : return "ERROR"
+        default         : return fmt.Sprintf("LogLevel(%d)", int(self))
+    }
+}
+
+type Logger interface {
+    Log(level LogLevel, msg string, kv ...interface{})
+}
+
+type _StderrLogger struct {
+    level LogLevel
+}
+
+func (self _StderrLogger) Log(level LogLevel, msg string, kv ...interface{}) {
+    var sb strings.Builder
+    var nb = len(kv) &^ 1
+
+    /* ignore messages below the threshold */
+    if level < self.level {
+        return
+    }
+
+    /* format the message */
+    sb.WriteString("frugal: [")
+    sb.WriteString(level.String())
+    sb.WriteString("] ")
+    sb.WriteString(msg)
+
+    /* append the key-value pairs */
+    for i := 0; i < nb; i += 2 {
+        fmt.Fprintf(&sb, " %v=%v", kv[i], kv[i + 1])
+    }
+
+    /* dangling keys are printed as is */
+    if nb != len(kv) {
+        fmt.Fprintf(&sb, " %v", kv[nb])
+    }
+
+    /* write with a single call to avoid interleaving */
+    sb.WriteByte('\n')
+    _, _ = os.Stderr.WriteString(sb.String())
+}
+
+var (
+    logger = unsafe.Pointer(newDefaultLogger())
+)
+
+func newDefaultLogger() *Logger {
+    var lg Logger = _StderrLogger { LevelWarn }
+    return &lg
+}
+
+func SetLogger(lg Logger) (old Logger) {
+    var p unsafe.Pointer
+    if lg != nil { p = unsafe.Pointer(&lg) }
+
+    /* swap the logger, nil means discarding everything */
+    if p = atomic.SwapPointer(&logger, p); p != nil {
+        old = *(*Logger)(p)
+    }
+
+    /* return the previous logger */
+    return
+}
+
+func Log(level LogLevel, msg string, kv ...interface{}) {
+    if lp := (*Logger)(atomic.LoadPointer(&logger)); lp != nil {
+        (*lp).Log(level, msg, kv...)
+    }
+}
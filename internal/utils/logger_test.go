@@ -0,0 +1,74 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+    `io/ioutil`
+    `os`
+    `testing`
+
+    `github.com/stretchr/testify/require`
+)
+
+type testLogger struct {
+    level LogLevel
+    msgs  []string
+}
+
+func (self *testLogger) Log(level LogLevel, msg string, kv ...interface{}) {
+    if level >= self.level {
+        self.msgs = append(self.msgs, level.String() + " " + msg)
+    }
+}
+
+func captureStderr(t *testing.T, fn func()) string {
+    fp, err := ioutil.TempFile(t.TempDir(), "stderr")
+    require.NoError(t, err)
+    defer fp.Close()
+    old := os.Stderr
+    os.Stderr = fp
+    fn()
+    os.Stderr = old
+    buf, err := ioutil.ReadFile(fp.Name())
+    require.NoError(t, err)
+    return string(buf)
+}
+
+func TestLogger_Default(t *testing.T) {
+    out := captureStderr(t, func() {
+        Log(LevelDebug, "debug message", "a", 1)
+        Log(LevelInfo, "info message")
+        Log(LevelWarn, "warn message", "a", 1, "b")
+        Log(LevelError, "error message")
+    })
+    require.Equal(t, "frugal: [WARN] warn message a=1 b\nfrugal: [ERROR] error message\n", out)
+}
+
+func TestLogger_Custom(t *testing.T) {
+    lg := &testLogger { level: LevelWarn }
+    old := SetLogger(lg)
+    defer SetLogger(old)
+    out := captureStderr(t, func() {
+        Log(LevelDebug, "debug message")
+        Log(LevelWarn, "warn message", "a", 1)
+    })
+    require.Empty(t, out)
+    require.Equal(t, []string { "WARN warn message" }, lg.msgs)
+    require.Equal(t, lg, SetLogger(nil))
+    Log(LevelError, "discarded")
+    require.Len(t, lg.msgs, 1)
+}
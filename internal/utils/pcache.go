@@ -17,10 +17,12 @@
 package utils
 
 import (
+    `sort`
     `sync`
     `sync/atomic`
     `unsafe`
 
+    `github.com/cloudwego/frugal/internal/opts`
     `github.com/cloudwego/frugal/internal/rt`
 )
 
@@ -40,6 +42,7 @@ type ProgramMap struct {
 type ProgramEntry struct {
     vt *rt.GoType
     fn interface{}
+    nr *uint64
 }
 
 func newProgramMap() *ProgramMap {
@@ -50,14 +53,14 @@ func newProgramMap() *ProgramMap {
     }
 }
 
-func (self *ProgramMap) get(vt *rt.GoType) interface{} {
+func (self *ProgramMap) get(vt *rt.GoType) *ProgramEntry {
     i := self.m + 1
     p := vt.Hash & self.m
 
     /* linear probing */
     for ; i > 0; i-- {
-        if b := self.b[p]; b.vt == vt {
-            return b.fn
+        if b := &self.b[p]; b.vt == vt {
+            return b
         } else if b.vt == nil {
             break
         } else {
@@ -81,10 +84,27 @@ func (self *ProgramMap) add(vt *rt.GoType, fn interface{}) *ProgramMap {
     }
 
     /* insert the value */
-    p.insert(vt, fn)
+    p.insert(ProgramEntry { vt, fn, new(uint64) })
     return p
 }
 
+func (self *ProgramMap) remove(rm map[*rt.GoType]struct{}) *ProgramMap {
+    r := &ProgramMap{m: self.m, b: make([]ProgramEntry, len(self.b))}
+
+    /* re-insert every entry except the removed ones, since linear
+     * probing does not allow punching holes into the probe sequence */
+    for i := uint32(0); i <= self.m; i++ {
+        if b := self.b[i]; b.vt != nil {
+            if _, ok := rm[b.vt]; !ok {
+                r.insert(b)
+            }
+        }
+    }
+
+    /* rebuild successful */
+    return r
+}
+
 func (self *ProgramMap) copy() *ProgramMap {
     p := new(ProgramMap)
     p.n = self.n
@@ -101,7 +121,7 @@ func (self *ProgramMap) rehash() *ProgramMap {
     /* rehash every entry */
     for i := uint32(0); i <= self.m; i++ {
         if b := self.b[i]; b.vt != nil {
-            r.insert(b.vt, b.fn)
+            r.insert(b)
         }
     }
 
@@ -109,8 +129,8 @@ func (self *ProgramMap) rehash() *ProgramMap {
     return r
 }
 
-func (self *ProgramMap) insert(vt *rt.GoType, fn interface{}) {
-    h := vt.Hash
+func (self *ProgramMap) insert(e ProgramEntry) {
+    h := e.vt.Hash
     p := h & self.m
 
     /* linear probing */
@@ -119,8 +139,7 @@ func (self *ProgramMap) insert(vt *rt.GoType, fn interface{}) {
             p += 1
             p &= self.m
         } else {
-            b.vt = vt
-            b.fn = fn
+            *b = e
             atomic.AddUint64(&self.n, 1)
             return
         }
@@ -132,41 +151,177 @@ func (self *ProgramMap) insert(vt *rt.GoType, fn interface{}) {
 
 /** RCU Program Cache **/
 
+type _Flight struct {
+    wg  sync.WaitGroup
+    val interface{}
+    err error
+}
+
 type ProgramCache struct {
     m sync.Mutex
     p unsafe.Pointer
+    s map[*rt.GoType]struct{}
+    f map[*rt.GoType]*_Flight
 }
 
 func CreateProgramCache() *ProgramCache {
     return &ProgramCache {
         m: sync.Mutex{},
         p: unsafe.Pointer(newProgramMap()),
+        s: make(map[*rt.GoType]struct{}),
+        f: make(map[*rt.GoType]*_Flight),
     }
 }
 
 func (self *ProgramCache) Get(vt *rt.GoType) interface{} {
-    return (*ProgramMap)(atomic.LoadPointer(&self.p)).get(vt)
+    if e := (*ProgramMap)(atomic.LoadPointer(&self.p)).get(vt); e == nil {
+        return nil
+    } else if atomic.LoadInt64(&opts.MaxCacheEntries) == 0 {
+        return e.fn
+    } else {
+        atomic.AddUint64(e.nr, 1)
+        return e.fn
+    }
+}
+
+func (self *ProgramCache) Pin(vt *rt.GoType) {
+    self.m.Lock()
+    self.s[vt] = struct{}{}
+    self.m.Unlock()
 }
 
 func (self *ProgramCache) Compute(vt *rt.GoType, compute func(*rt.GoType) (interface{}, error)) (interface{}, error) {
-    var err error
-    var val interface{}
+    var ok bool
+    var fl *_Flight
+
+    /* fast-path: already computed */
+    if val := self.Get(vt); val != nil {
+        return val, nil
+    }
 
-    /* use defer to prevent inlining of this function */
+    /* double check with lock held, and join the flight if someone else is computing it */
     self.m.Lock()
-    defer self.m.Unlock()
+    val := self.Get(vt)
 
-    /* double check with write lock held */
-    if val = self.Get(vt); val != nil {
+    /* check if it has been computed in the meantime */
+    if val != nil {
+        self.m.Unlock()
         return val, nil
     }
 
-    /* compute the value */
-    if val, err = compute(vt); err != nil {
-        return nil, err
+    /* wait for the other computation to complete */
+    if fl, ok = self.f[vt]; ok {
+        self.m.Unlock()
+        fl.wg.Wait()
+        return fl.val, fl.err
+    }
+
+    /* start a new flight, the computation itself runs without the lock,
+     * so that different types can be computed concurrently */
+    fl = new(_Flight)
+    fl.wg.Add(1)
+    self.f[vt] = fl
+    self.m.Unlock()
+
+    /* use defer to make sure the waiters are woken up even if compute panics */
+    defer self.land(vt, fl)
+    fl.val, fl.err = compute(vt)
+    return fl.val, fl.err
+}
+
+func (self *ProgramCache) land(vt *rt.GoType, fl *_Flight) {
+    var p *ProgramMap
+
+    /* compute panicked, the waiters must not see a nil value */
+    if fl.val == nil && fl.err == nil {
+        fl.err = EType(vt.Pack(), "compilation aborted by panic")
     }
 
-    /* update the RCU cache */
-    atomic.StorePointer(&self.p, unsafe.Pointer((*ProgramMap)(atomic.LoadPointer(&self.p)).add(vt, val)))
-    return val, nil
+    /* the flight is over */
+    self.m.Lock()
+    delete(self.f, vt)
+
+    /* only cache successful computations */
+    if fl.err == nil {
+        p = (*ProgramMap)(atomic.LoadPointer(&self.p))
+
+        /* evict the least frequently used entries to make room for the new entry */
+        if n := int(atomic.LoadInt64(&opts.MaxCacheEntries)); n > 0 {
+            p = self.evict(p, n - 1)
+        }
+
+        /* update the RCU cache, evicted programs are freed once they are unreachable */
+        atomic.StorePointer(&self.p, unsafe.Pointer(p.add(vt, fl.val)))
+    }
+
+    /* wake up all the waiters */
+    self.m.Unlock()
+    fl.wg.Done()
+}
+
+func (self *ProgramCache) Remove(vt *rt.GoType) {
+    self.m.Lock()
+    defer self.m.Unlock()
+
+    /* removed types are no longer pinned */
+    p := (*ProgramMap)(atomic.LoadPointer(&self.p))
+    delete(self.s, vt)
+
+    /* update the RCU cache, the program is freed once it is unreachable */
+    if e := p.get(vt); e != nil {
+        atomic.StorePointer(&self.p, unsafe.Pointer(p.remove(map[*rt.GoType]struct{} { vt: {} })))
+    }
+}
+
+type _Victim struct {
+    vt *rt.GoType
+    nr uint64
+}
+
+func (self *ProgramCache) evict(p *ProgramMap, n int) *ProgramMap {
+    var ev []_Victim
+    var nb = int(atomic.LoadUint64(&p.n)) - n
+
+    /* take a snapshot of the hit counters, pinned entries are never evicted */
+    for i := 0; nb > 0 && i < len(p.b); i++ {
+        if b := p.b[i]; b.vt != nil {
+            if _, pin := self.s[b.vt]; !pin {
+                ev = append(ev, _Victim { b.vt, atomic.LoadUint64(b.nr) })
+            }
+        }
+    }
+
+    /* there may not be enough unpinned entries */
+    if nb > len(ev) {
+        nb = len(ev)
+    }
+
+    /* nothing to evict */
+    if nb <= 0 {
+        return p
+    }
+
+    /* the least frequently used entries are the victims */
+    rm := make(map[*rt.GoType]struct{}, nb)
+    sort.SliceStable(ev, func(i int, j int) bool { return ev[i].nr < ev[j].nr })
+
+    /* mark the victims */
+    for _, v := range ev[:nb] {
+        rm[v.vt] = struct{}{}
+        Log(LevelDebug, "evicting type from the program cache", "type", v.vt, "limit", n + 1)
+    }
+
+    /* remove all the victims with a single copy */
+    p = p.remove(rm)
+
+    /* halve the counters after each round of eviction, so that types that
+     * were hot a long time ago do not stay in the cache forever */
+    for i := range p.b {
+        if nr := p.b[i].nr; nr != nil {
+            atomic.StoreUint64(nr, atomic.LoadUint64(nr) >> 1)
+        }
+    }
+
+    /* all done */
+    return p
 }
@@ -0,0 +1,127 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iov
+
+import (
+    `io`
+    `os`
+)
+
+// SpillSink stores binary values that are too large to be kept in memory, see
+// frugal.DecoderBuilder.WithSpill.
+type SpillSink interface {
+    // Spill stores buf and returns a handle to read it back. buf refers to the
+    // input buffer of the decoder, so it must not be retained after Spill returns.
+    Spill(buf []byte) (SpillHandle, error)
+}
+
+// SpillHandle refers to a binary value stored by a SpillSink. Close releases
+// the storage, the value can not be read afterwards.
+type SpillHandle interface {
+    io.ReaderAt
+    io.Closer
+    Size() int64
+}
+
+// Blob can be used in place of []byte for a binary field. It holds the value
+// in Data like a []byte would, unless the decoder spilled it to a SpillSink,
+// in which case Data is nil and the value is accessible from Spilled.
+//
+// A spilled Blob can not be encoded, it has to be loaded into Data first.
+type Blob struct {
+    Data    []byte          // must be the first field, the codecs treat it as a []byte
+    Spilled SpillHandle
+}
+
+// Len returns the length of the value, wherever it is stored.
+func (self *Blob) Len() int64 {
+    if self.Spilled == nil {
+        return int64(len(self.Data))
+    } else {
+        return self.Spilled.Size()
+    }
+}
+
+// Load reads a spilled value back into Data and closes the handle, it does
+// nothing if the value is not spilled.
+func (self *Blob) Load() error {
+    if self.Spilled == nil {
+        return nil
+    }
+
+    /* read the entire value */
+    buf := make([]byte, self.Spilled.Size())
+    _, err := self.Spilled.ReadAt(buf, 0)
+
+    /* a full read may report EOF */
+    if err != nil && err != io.EOF {
+        return err
+    }
+
+    /* close the handle, the value is now in memory */
+    if err = self.Spilled.Close(); err != nil {
+        return err
+    }
+
+    /* replace the handle with the value */
+    self.Data = buf
+    self.Spilled = nil
+    return nil
+}
+
+type _TempFile struct {
+    *os.File
+    nb int64
+}
+
+func (self _TempFile) Size() int64 {
+    return self.nb
+}
+
+func (self _TempFile) Close() error {
+    err := self.File.Close()
+    os.Remove(self.Name())
+    return err
+}
+
+type _TempFileSink struct {
+    dir string
+}
+
+// TempFileSink returns a SpillSink that writes every value to a new temporary
+// file in dir, or the default directory for temporary files if dir is empty.
+// The file is removed when the handle is closed.
+func TempFileSink(dir string) SpillSink {
+    return _TempFileSink { dir }
+}
+
+func (self _TempFileSink) Spill(buf []byte) (SpillHandle, error) {
+    fp, err := os.CreateTemp(self.dir, "frugal-spill-*")
+    if err != nil {
+        return nil, err
+    }
+
+    /* write the value, and remove the file on failure */
+    if _, err = fp.Write(buf); err != nil {
+        fp.Close()
+        os.Remove(fp.Name())
+        return nil, err
+    }
+
+    /* all done */
+    return _TempFile { fp, int64(len(buf)) }, nil
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package frugal
+
+import (
+    `github.com/cloudwego/frugal/internal/utils`
+)
+
+// LogLevel is the severity of a log message.
+type LogLevel = utils.LogLevel
+
+const (
+    // LevelDebug is for diagnostic messages, such as program cache evictions.
+    LevelDebug = utils.LevelDebug
+
+    // LevelInfo is for notable but expected events.
+    LevelInfo = utils.LevelInfo
+
+    // LevelWarn is for events that may affect performance, such as falling
+    // back to the emulator.
+    LevelWarn = utils.LevelWarn
+
+    // LevelError is for errors that frugal recovered from by itself.
+    LevelError = utils.LevelError
+)
+
+// Logger receives the log messages of frugal. kv is a list of alternating keys
+// and values that describe the message, keys are always strings.
+//
+// Log may be called concurrently from multiple goroutines, so it must be safe
+// for concurrent use.
+type Logger = utils.Logger
+
+// SetLogger routes all the log messages of frugal into lg, and returns the
+// previous logger. Passing nil discards all the messages.
+//
+// The default logger writes messages of LevelWarn and above to os.Stderr.
+func SetLogger(lg Logger) Logger {
+    return utils.SetLogger(lg)
+}
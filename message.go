@@ -0,0 +1,555 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package frugal
+
+import (
+    `encoding/binary`
+    `errors`
+    `fmt`
+    `sort`
+    `sync`
+    `sync/atomic`
+
+    `github.com/cloudwego/frugal/internal/opts`
+)
+
+// MessageType is the type of a Thrift message.
+type MessageType int8
+
+const (
+    Call      MessageType = 1
+    Reply     MessageType = 2
+    Exception MessageType = 3
+    Oneway    MessageType = 4
+)
+
+// Transport is the framing of a Thrift message on the wire.
+type Transport int
+
+const (
+    // Unframed means the message is written as is.
+    Unframed Transport = iota
+
+    // Framed means the message is prefixed with its size as a 4-byte big-endian integer.
+    Framed
+
+    // THeader means the message is wrapped in a THeader frame, with optional transforms.
+    THeader
+)
+
+// Message is the envelope of a Thrift message.
+type Message struct {
+    Name       string
+    Type       MessageType
+    SeqID      int32
+    Headers    map[string]string   // key-value headers, only used by THeader
+    Transforms []int               // payload transforms in the order of applying, only used by THeader
+}
+
+const (
+    _VersionMask    = 0xffff0000
+    _VersionStrict  = 0x80010000
+    _HeaderMagic    = 0x0fff
+    _HeaderSizeMax  = 0xffff * 4
+    _HeaderBinary   = 0x00
+    _HeaderInfoKV   = 0x01
+)
+
+var (
+    payloadPool = sync.Pool{}
+)
+
+var (
+    errMessageShort = errors.New("frugal: message is too short")
+    errMessageSpace = errors.New("frugal: buffer is too small for the message")
+)
+
+// EncodedMessageSize measures the size of val wrapped in the envelope msg with
+// transport t. When THeader transforms are used, it is an upper bound of the size.
+func EncodedMessageSize(t Transport, msg *Message, val interface{}) int {
+    if t != THeader || len(msg.Transforms) == 0 {
+        return envelopeSize(t, msg) + EncodedSize(val)
+    } else if tr, err := findTransforms(msg.Transforms); err != nil {
+        panic(err)
+    } else {
+        return 14 + theaderSize(msg) + transformBound(tr, headerSize(msg) + EncodedSize(val))
+    }
+}
+
+// EncodeMessage serializes val with Thrift Binary Protocol into buf, wrapped in
+// the envelope msg with transport t. buf must be large enough to contain the
+// entire message, which can be measured by EncodedMessageSize.
+func EncodeMessage(buf []byte, t Transport, msg *Message, val interface{}) (int, error) {
+    var err error
+    var nb, nh int
+
+    /* transformed payloads are encoded separately */
+    if t == THeader && len(msg.Transforms) != 0 {
+        return encodeTransformed(buf, msg, val)
+    }
+
+    /* the envelope must fit */
+    if nh = envelopeSize(t, msg); nh > len(buf) {
+        return 0, errMessageSpace
+    }
+
+    /* encode the message body first, the frame size depends on it */
+    if nb, err = EncodeObject(buf[nh:], nil, val); err != nil {
+        return 0, err
+    }
+
+    /* then prepend the envelope */
+    encodeEnvelope(buf[:nh], t, msg, nb)
+    return nh + nb, nil
+}
+
+// DecodeMessage deserializes a message with transport t from buf into msg and
+// val, and returns the number of bytes consumed.
+//
+// Both the strict and the old non-strict message headers are accepted. For
+// THeader, only the binary protocol is supported, the transforms found in the
+// frame are undone and recorded in msg.Transforms.
+func DecodeMessage(buf []byte, t Transport, msg *Message, val interface{}) (int, error) {
+    var err error
+    var nb, nh int
+
+    /* strip the frame if any */
+    switch t {
+        case Unframed : nh, err = 0, nil
+        case Framed   : nh, err = decodeFramed(buf)
+        case THeader  : nh, err = decodeTHeader(buf, msg)
+        default       : panic(fmt.Sprintf("frugal: invalid transport: %d", t))
+    }
+
+    /* check for frame errors */
+    if err != nil {
+        return 0, err
+    }
+
+    /* the message must not go beyond the frame */
+    if t != Unframed {
+        buf = buf[:frameEnd(buf)]
+    }
+
+    /* undo the transforms if any */
+    if t == THeader && len(msg.Transforms) != 0 {
+        return decodeTransformed(buf, nh, msg, val)
+    }
+
+    /* decode the message header and body */
+    if nb, err = decodeBody(buf[nh:], msg, val); err != nil {
+        return 0, err
+    }
+
+    /* check for extra bytes in the frame */
+    if nb += nh; t != Unframed && nb != len(buf) {
+        return 0, fmt.Errorf("frugal: %d bytes left in the frame", len(buf) - nb)
+    }
+
+    /* all done */
+    return nb, nil
+}
+
+func encodeTransformed(buf []byte, msg *Message, val interface{}) (int, error) {
+    var nb  int
+    var err error
+    var tr  []Transform
+
+    /* all the transforms must be registered */
+    if tr, err = findTransforms(msg.Transforms); err != nil {
+        return 0, err
+    }
+
+    /* the THeader frame must fit */
+    nh := 14 + theaderSize(msg)
+    nm := headerSize(msg)
+
+    /* check for buffer size */
+    if nh > len(buf) {
+        return 0, errMessageSpace
+    }
+
+    /* the payload is encoded into a temporary buffer, and transformed into buf */
+    mem := newPayload(nm + EncodedSize(val))
+    defer freePayload(mem)
+    encodeHeader(mem, msg)
+
+    /* encode the message body */
+    if nb, err = EncodeObject(mem[nm:], nil, val); err != nil {
+        return 0, err
+    }
+
+    /* apply the transforms, the last one writes into buf directly */
+    for i, src := 0, mem[:nm + nb]; i < len(tr); i++ {
+        dst := buf[nh:]
+
+        /* intermediate results need their own buffers */
+        if i != len(tr) - 1 {
+            dst = make([]byte, tr[i].Bound(len(src)))
+        }
+
+        /* transform the payload */
+        if nb, err = tr[i].Encode(dst, src); err != nil {
+            return 0, err
+        } else {
+            src = dst[:nb]
+        }
+    }
+
+    /* prepend the frame */
+    encodeFrame(buf[:nh], msg, nb)
+    return nh + nb, nil
+}
+
+func decodeTransformed(buf []byte, nh int, msg *Message, val interface{}) (int, error) {
+    var err error
+    var mem []byte
+    var tr  []Transform
+    var nl  = int(atomic.LoadInt64(&opts.MaxTransformed))
+
+    /* all the transforms must be registered */
+    if tr, err = findTransforms(msg.Transforms); err != nil {
+        return 0, err
+    }
+
+    /* undo the transforms in reverse order, the result is not pooled since
+     * "nocopy" fields may refer to it */
+    for mem = buf[nh:]; len(tr) != 0; tr = tr[:len(tr) - 1] {
+        if mem, err = tr[len(tr) - 1].Decode(nil, mem, nl); err != nil {
+            return 0, err
+        } else if nl > 0 && len(mem) > nl {
+            return 0, ErrTransformLimit
+        }
+    }
+
+    /* decode the message header and body */
+    if nb, err := decodeBody(mem, msg, val); err != nil {
+        return 0, err
+    } else if nb != len(mem) {
+        return 0, fmt.Errorf("frugal: %d bytes left in the transformed payload", len(mem) - nb)
+    } else {
+        return len(buf), nil
+    }
+}
+
+func decodeBody(buf []byte, msg *Message, val interface{}) (int, error) {
+    if nh, err := decodeHeader(buf, msg); err != nil {
+        return 0, err
+    } else if nb, err := DecodeObject(buf[nh:], val); err != nil {
+        return 0, err
+    } else {
+        return nh + nb, nil
+    }
+}
+
+func newPayload(nb int) []byte {
+    if v, ok := payloadPool.Get().([]byte); ok && cap(v) >= nb {
+        return v[:nb]
+    } else {
+        return make([]byte, nb)
+    }
+}
+
+func freePayload(buf []byte) {
+    payloadPool.Put(buf[:0])
+}
+
+func transformBound(tr []Transform, nb int) int {
+    for _, tf := range tr {
+        nb = tf.Bound(nb)
+    }
+    return nb
+}
+
+func headerSize(msg *Message) int {
+    return 4 + 4 + len(msg.Name) + 4
+}
+
+func theaderSize(msg *Message) int {
+    nb := 1 + uvarintSize(len(msg.Transforms))
+
+    /* transform IDs */
+    for _, id := range msg.Transforms {
+        nb += uvarintSize(id)
+    }
+
+    /* key-value headers */
+    if len(msg.Headers) != 0 {
+        nb += 1 + uvarintSize(len(msg.Headers))
+        for k, v := range msg.Headers {
+            nb += uvarintSize(len(k)) + len(k) + uvarintSize(len(v)) + len(v)
+        }
+    }
+
+    /* padded to multiple of 4 bytes */
+    return (nb + 3) &^ 3
+}
+
+func envelopeSize(t Transport, msg *Message) int {
+    switch t {
+        case Unframed : return headerSize(msg)
+        case Framed   : return headerSize(msg) + 4
+        case THeader  : return headerSize(msg) + 14 + theaderSize(msg)
+        default       : panic(fmt.Sprintf("frugal: invalid transport: %d", t))
+    }
+}
+
+func encodeHeader(buf []byte, msg *Message) {
+    binary.BigEndian.PutUint32(buf, _VersionStrict | uint32(uint8(msg.Type)))
+    binary.BigEndian.PutUint32(buf[4:], uint32(len(msg.Name)))
+    copy(buf[8:], msg.Name)
+    binary.BigEndian.PutUint32(buf[8 + len(msg.Name):], uint32(msg.SeqID))
+}
+
+func encodeTHeader(buf []byte, msg *Message) {
+    nb := len(buf)
+    buf[0] = _HeaderBinary
+    buf = buf[1 + binary.PutUvarint(buf[1:], uint64(len(msg.Transforms))):]
+
+    /* transform IDs */
+    for _, id := range msg.Transforms {
+        buf = buf[binary.PutUvarint(buf, uint64(id)):]
+    }
+
+    /* key-value headers */
+    if len(msg.Headers) != 0 {
+        buf = encodeInfoKV(buf, msg)
+    }
+
+    /* zero padding */
+    for i := range buf {
+        buf[i] = 0
+    }
+
+    /* should never happen */
+    if len(buf) > 3 || nb & 3 != 0 {
+        panic("frugal: invalid THeader size")
+    }
+}
+
+func encodeInfoKV(buf []byte, msg *Message) []byte {
+    /* sort the keys to make the output stable */
+    ks := make([]string, 0, len(msg.Headers))
+    for k := range msg.Headers {
+        ks = append(ks, k)
+    }
+
+    /* key-value info block */
+    sort.Strings(ks)
+    buf[0] = _HeaderInfoKV
+    buf = buf[1 + binary.PutUvarint(buf[1:], uint64(len(ks))):]
+
+    /* add every header */
+    for _, k := range ks {
+        buf = buf[putString(buf, k):]
+        buf = buf[putString(buf, msg.Headers[k]):]
+    }
+
+    /* all done */
+    return buf
+}
+
+func encodeEnvelope(buf []byte, t Transport, msg *Message, nb int) {
+    switch t {
+        case Unframed: {
+            encodeHeader(buf, msg)
+        }
+
+        /* 4-byte frame size */
+        case Framed: {
+            binary.BigEndian.PutUint32(buf, uint32(len(buf) - 4 + nb))
+            encodeHeader(buf[4:], msg)
+        }
+
+        /* THeader frame */
+        case THeader: {
+            nh := 14 + theaderSize(msg)
+            encodeFrame(buf[:nh], msg, len(buf) - nh + nb)
+            encodeHeader(buf[nh:], msg)
+        }
+    }
+}
+
+func encodeFrame(buf []byte, msg *Message, nb int) {
+    binary.BigEndian.PutUint32(buf, uint32(len(buf) - 4 + nb))
+    binary.BigEndian.PutUint16(buf[4:], _HeaderMagic)
+    binary.BigEndian.PutUint16(buf[6:], 0)
+    binary.BigEndian.PutUint32(buf[8:], uint32(msg.SeqID))
+    binary.BigEndian.PutUint16(buf[12:], uint16((len(buf) - 14) / 4))
+    encodeTHeader(buf[14:], msg)
+}
+
+func frameEnd(buf []byte) int {
+    return int(binary.BigEndian.Uint32(buf)) + 4
+}
+
+func decodeFramed(buf []byte) (int, error) {
+    if len(buf) < 4 {
+        return 0, errMessageShort
+    } else if frameEnd(buf) > len(buf) {
+        return 0, errMessageShort
+    } else {
+        return 4, nil
+    }
+}
+
+func decodeHeader(buf []byte, msg *Message) (int, error) {
+    var nb int
+    var vv uint32
+
+    /* version or name length, and the name length of strict headers */
+    if len(buf) < 8 {
+        return 0, errMessageShort
+    }
+
+    /* strict header: version, name, seqid */
+    if vv = binary.BigEndian.Uint32(buf); vv & 0x80000000 != 0 {
+        if vv & _VersionMask != _VersionStrict {
+            return 0, fmt.Errorf("frugal: invalid message version: %#x", vv & _VersionMask)
+        } else if nb = 8 + int(binary.BigEndian.Uint32(buf[4:])); len(buf) < nb + 4 {
+            return 0, errMessageShort
+        } else {
+            msg.Type = MessageType(vv)
+            msg.Name = string(buf[8:nb])
+            msg.SeqID = int32(binary.BigEndian.Uint32(buf[nb:]))
+            return nb + 4, nil
+        }
+    }
+
+    /* old header: name, type, seqid */
+    if nb = 4 + int(vv); len(buf) < nb + 5 {
+        return 0, errMessageShort
+    } else {
+        msg.Name = string(buf[4:nb])
+        msg.Type = MessageType(buf[nb])
+        msg.SeqID = int32(binary.BigEndian.Uint32(buf[nb + 1:]))
+        return nb + 5, nil
+    }
+}
+
+func decodeTHeader(buf []byte, msg *Message) (int, error) {
+    var nh int
+    var hdr []byte
+
+    /* fixed part of the frame */
+    if len(buf) < 14 || frameEnd(buf) > len(buf) {
+        return 0, errMessageShort
+    } else if binary.BigEndian.Uint16(buf[4:]) != _HeaderMagic {
+        return 0, errors.New("frugal: invalid THeader magic")
+    }
+
+    /* variable part of the header */
+    if nh = int(binary.BigEndian.Uint16(buf[12:])) * 4; frameEnd(buf) < nh + 14 {
+        return 0, errMessageShort
+    }
+
+    /* protocol ID, only binary is supported */
+    if hdr = buf[14:14 + nh]; len(hdr) == 0 {
+        return 0, errMessageShort
+    } else if hdr[0] != _HeaderBinary {
+        return 0, fmt.Errorf("frugal: unsupported THeader protocol: %d", hdr[0])
+    }
+
+    /* number of transforms */
+    nt, nb := binary.Uvarint(hdr[1:])
+    if nb <= 0 || nt > uint64(len(hdr)) {
+        return 0, errMessageShort
+    }
+
+    /* transform IDs */
+    hdr = hdr[1 + nb:]
+    msg.Transforms = msg.Transforms[:0]
+
+    /* parse every transform ID */
+    for i := uint64(0); i < nt; i++ {
+        if id, nb := binary.Uvarint(hdr); nb <= 0 {
+            return 0, errMessageShort
+        } else {
+            hdr = hdr[nb:]
+            msg.Transforms = append(msg.Transforms, int(id))
+        }
+    }
+
+    /* headers of a reused message must not leak into this one */
+    for k := range msg.Headers {
+        delete(msg.Headers, k)
+    }
+
+    /* parse the info blocks until the padding */
+    for len(hdr) != 0 && hdr[0] != 0 {
+        if hdr[0] != _HeaderInfoKV {
+            return 0, fmt.Errorf("frugal: unsupported THeader info type: %d", hdr[0])
+        } else if rem, err := decodeHeaders(hdr[1:], msg); err != nil {
+            return 0, err
+        } else {
+            hdr = rem
+        }
+    }
+
+    /* all done */
+    return 14 + nh, nil
+}
+
+func decodeHeaders(buf []byte, msg *Message) ([]byte, error) {
+    var err error
+    var key string
+    var val string
+
+    /* number of key-value pairs */
+    nb, n := binary.Uvarint(buf)
+    if n <= 0 {
+        return nil, errMessageShort
+    }
+
+    /* create the header map if needed */
+    if buf = buf[n:]; msg.Headers == nil {
+        msg.Headers = make(map[string]string, nb)
+    }
+
+    /* parse every pair */
+    for i := uint64(0); i < nb; i++ {
+        if key, buf, err = getString(buf); err != nil {
+            return nil, err
+        } else if val, buf, err = getString(buf); err != nil {
+            return nil, err
+        } else {
+            msg.Headers[key] = val
+        }
+    }
+
+    /* all done */
+    return buf, nil
+}
+
+func uvarintSize(v int) int {
+    var tmp [binary.MaxVarintLen64]byte
+    return binary.PutUvarint(tmp[:], uint64(v))
+}
+
+func putString(buf []byte, s string) int {
+    nb := binary.PutUvarint(buf, uint64(len(s)))
+    return nb + copy(buf[nb:], s)
+}
+
+func getString(buf []byte) (string, []byte, error) {
+    if nb, n := binary.Uvarint(buf); n <= 0 || uint64(len(buf) - n) < nb {
+        return "", nil, errMessageShort
+    } else {
+        return string(buf[n:n + int(nb)]), buf[n + int(nb):], nil
+    }
+}
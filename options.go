@@ -18,7 +18,9 @@ package frugal
 
 import (
     `fmt`
+    `sync/atomic`
 
+    `github.com/cloudwego/frugal/internal/binary/decoder`
     `github.com/cloudwego/frugal/internal/opts`
 )
 
@@ -112,3 +114,397 @@ func SetMaxInlineILSize(size int) int {
     size, opts.MaxInlineILSize = opts.MaxInlineILSize, size
     return size
 }
+
+// SetMaxCacheEntries sets the maximum number of compiled types kept in each of
+// the encoder and decoder program caches. When the limit is reached, the least
+// frequently used type that is not pinned by Pin is evicted, and will be compiled
+// again the next time it is used.
+//
+// The machine code of evicted types is freed once no goroutine is using it, so
+// this option also bounds the memory used by generated code. It works best when
+// the set of hot types is stable and most evicted types are rarely seen again.
+//
+// This value can also be configured with the `FRUGAL_MAX_CACHE_ENTRIES`
+// environment variable.
+//
+// The default value "0" means unlimited.
+//
+// Returns the old opts.MaxCacheEntries value.
+func SetMaxCacheEntries(n int) int {
+    if n < 0 {
+        panic(fmt.Sprintf("frugal: invalid cache entry limit: %d", n))
+    } else {
+        return int(atomic.SwapInt64(&opts.MaxCacheEntries, int64(n)))
+    }
+}
+
+// WithSortMapKeys makes the encoder emit map entries in ascending key order.
+//
+// Map iteration order in Go is randomized, so without this option encoding the
+// same map twice may produce different bytes. Turning this on makes the output
+// deterministic at the cost of sorting the keys on every encode.
+//
+// Only maps with integer or string keys are sorted, other maps are still
+// encoded in iteration order.
+//
+// The default value of this option is "false".
+func WithSortMapKeys(sort bool) Option {
+    return func(o *opts.Options) { o.SortMapKeys = sort }
+}
+
+// SetSortMapKeys sets the default map key sorting behavior for all types from
+// now on. Types that are already compiled are not affected.
+//
+// This value can also be configured with the `FRUGAL_SORT_MAP_KEYS`
+// environment variable.
+//
+// The default value of this option is "false".
+//
+// Returns the old opts.SortMapKeys value.
+func SetSortMapKeys(sort bool) bool {
+    sort, opts.SortMapKeys = opts.SortMapKeys, sort
+    return sort
+}
+
+// WithValidateEnums makes the decoder reject enum values that are not defined
+// by the enum type, with an EnumValueError.
+//
+// The valid values of an enum type are taken from RegisterEnumValues, or from
+// a `KnownValues()` method that returns a slice of integers, or an
+// `IsValid() bool` method defined on the type, in that order. Enum types that
+// define none of them are not checked.
+//
+// The default value of this option is "false".
+func WithValidateEnums(validate bool) Option {
+    return func(o *opts.Options) { o.ValidateEnums = validate }
+}
+
+// SetValidateEnums sets the default enum validation behavior for all types from
+// now on. Types that are already compiled are not affected.
+//
+// This value can also be configured with the `FRUGAL_VALIDATE_ENUMS`
+// environment variable.
+//
+// The default value of this option is "false".
+//
+// Returns the old opts.ValidateEnums value.
+func SetValidateEnums(validate bool) bool {
+    validate, opts.ValidateEnums = opts.ValidateEnums, validate
+    return validate
+}
+
+// WithRejectUnknownFields makes the decoder fail with an UnknownFieldError when
+// a field that is not defined by the struct is found, instead of skipping it.
+// Fields that are defined but come with a different wire type are still skipped.
+//
+// Partial decoders are not affected, since the fields they skip are unknown to
+// them by definition.
+//
+// The default value of this option is "false".
+func WithRejectUnknownFields(reject bool) Option {
+    return func(o *opts.Options) { o.RejectUnknown = reject }
+}
+
+// SetRejectUnknownFields sets the default unknown field handling for all types
+// from now on. Types that are already compiled are not affected.
+//
+// This value can also be configured with the `FRUGAL_REJECT_UNKNOWN_FIELDS`
+// environment variable.
+//
+// The default value of this option is "false".
+//
+// Returns the old opts.RejectUnknown value.
+func SetRejectUnknownFields(reject bool) bool {
+    reject, opts.RejectUnknown = opts.RejectUnknown, reject
+    return reject
+}
+
+// WithReuseMemory makes the decoder reuse the memory already held by the
+// destination object. Binary fields are copied into their existing buffer
+// when its capacity is sufficient, and maps are cleared and refilled instead
+// of being replaced. This is useful when decoding into objects taken from a
+// sync.Pool. Slices and nested pointers are always reused.
+//
+// Note that the previous contents of those buffers and maps are overwritten,
+// so the caller must make sure that nothing else still references them.
+//
+// The default value of this option is "false".
+func WithReuseMemory(reuse bool) Option {
+    return func(o *opts.Options) { o.ReuseMemory = reuse }
+}
+
+// SetReuseMemory sets the default memory reusing behavior of the decoder for
+// all types from now on. Types that are already compiled are not affected.
+//
+// This value can also be configured with the `FRUGAL_REUSE_MEMORY`
+// environment variable.
+//
+// The default value of this option is "false".
+//
+// Returns the old opts.ReuseMemory value.
+func SetReuseMemory(reuse bool) bool {
+    reuse, opts.ReuseMemory = opts.ReuseMemory, reuse
+    return reuse
+}
+
+// WithOmitEmptyContainers makes the encoder omit optional maps, sets and lists
+// that are empty, not only the nil ones.
+//
+// The default value of this option is "false".
+func WithOmitEmptyContainers(omit bool) Option {
+    return func(o *opts.Options) { o.OmitEmpty = omit }
+}
+
+// SetOmitEmptyContainers sets the default behavior of omitting empty optional
+// containers for all types from now on. Types that are already compiled are not
+// affected.
+//
+// This value can also be configured with the `FRUGAL_OMIT_EMPTY_CONTAINERS`
+// environment variable.
+//
+// The default value of this option is "false".
+//
+// Returns the old opts.OmitEmpty value.
+func SetOmitEmptyContainers(omit bool) bool {
+    omit, opts.OmitEmpty = opts.OmitEmpty, omit
+    return omit
+}
+
+// WithNilAsEmpty makes the encoder encode nil optional maps, sets and lists as
+// empty containers instead of omitting them. Non-optional nil containers are
+// always encoded as empty containers.
+//
+// This option has no effect if WithOmitEmptyContainers is also enabled.
+//
+// The default value of this option is "false".
+func WithNilAsEmpty(enable bool) Option {
+    return func(o *opts.Options) { o.NilAsEmpty = enable }
+}
+
+// SetNilAsEmpty sets the default behavior of encoding nil optional containers
+// for all types from now on. Types that are already compiled are not affected.
+//
+// This value can also be configured with the `FRUGAL_NIL_AS_EMPTY` environment
+// variable.
+//
+// The default value of this option is "false".
+//
+// Returns the old opts.NilAsEmpty value.
+func SetNilAsEmpty(enable bool) bool {
+    enable, opts.NilAsEmpty = opts.NilAsEmpty, enable
+    return enable
+}
+
+// WithNonNilContainers makes the decoder set the non-optional maps, sets and
+// lists that are not present in the input to empty containers, so that they
+// are never nil after decoding. Containers that are present are always decoded
+// as non-nil, even if they are empty.
+//
+// The default value of this option is "false".
+func WithNonNilContainers(enable bool) Option {
+    return func(o *opts.Options) { o.NonNilEmpty = enable }
+}
+
+// SetNonNilContainers sets the default behavior of the decoder for containers
+// that are not present in the input for all types from now on. Types that are
+// already compiled are not affected.
+//
+// This value can also be configured with the `FRUGAL_NON_NIL_CONTAINERS`
+// environment variable.
+//
+// The default value of this option is "false".
+//
+// Returns the old opts.NonNilEmpty value.
+func SetNonNilContainers(enable bool) bool {
+    enable, opts.NonNilEmpty = opts.NonNilEmpty, enable
+    return enable
+}
+
+// WithLenientLengths makes the decoder treat negative length prefixes of strings,
+// binaries and containers as zero, instead of failing with a NegativeLengthError.
+// The bytes following such a prefix are decoded as the next value, so this is
+// only meant for tools recovering what they can from broken messages.
+//
+// The default value of this option is "false".
+func WithLenientLengths(enable bool) Option {
+    return func(o *opts.Options) { o.LenientLengths = enable }
+}
+
+// SetLenientLengths sets the default behavior of the decoder for negative length
+// prefixes for all types from now on. Types that are already compiled are not
+// affected.
+//
+// This value can also be configured with the `FRUGAL_LENIENT_LENGTHS`
+// environment variable.
+//
+// The default value of this option is "false".
+//
+// Returns the old opts.LenientLengths value.
+func SetLenientLengths(enable bool) bool {
+    enable, opts.LenientLengths = opts.LenientLengths, enable
+    return enable
+}
+
+// WithIsSetMethods makes the encoder consult the `IsSet<Field>() bool` methods
+// generated by Apache Thrift for optional fields, and omit the fields that are
+// reported as unset. This is useful for types that are generated by Apache
+// Thrift but tagged for frugal, which may track presence of optional fields
+// differently from what frugal infers from the field values.
+//
+// Decoding is not affected, since the generated IsSet methods derive presence
+// from the field values, which are set by the decoder as usual.
+//
+// The default value of this option is "false".
+func WithIsSetMethods(enable bool) Option {
+    return func(o *opts.Options) { o.IsSetMethods = enable }
+}
+
+// SetIsSetMethods sets the default behavior of consulting IsSet methods of
+// optional fields for all types from now on. Types that are already compiled
+// are not affected.
+//
+// This value can also be configured with the `FRUGAL_ISSET_METHODS` environment
+// variable.
+//
+// The default value of this option is "false".
+//
+// Returns the old opts.IsSetMethods value.
+func SetIsSetMethods(enable bool) bool {
+    enable, opts.IsSetMethods = opts.IsSetMethods, enable
+    return enable
+}
+
+// SetDetectCycles enables or disables the cycle detection of the encoder for
+// all types from now on, including types that are already compiled.
+//
+// Recursive types are always compiled out-of-line, so a cyclic object graph
+// makes the encoder recurse until the buffer or the state stack runs out. With
+// cycle detection enabled, the encoder tracks the objects of recursive types on
+// the current path, and fails with a CycleError as soon as one of them is
+// visited again. Objects shared by different paths are not treated as cycles.
+//
+// This value can also be configured with the `FRUGAL_DETECT_CYCLES` environment
+// variable.
+//
+// The default value of this option is "false".
+//
+// Returns the old opts.DetectCycles value.
+func SetDetectCycles(enable bool) bool {
+    enable, opts.DetectCycles = opts.DetectCycles, enable
+    return enable
+}
+
+// SetMaxAllocBytes limits the total number of bytes the decoder may allocate
+// for a single message, including all the nested structs, containers, strings
+// and binaries, so that a malicious message cannot exhaust memory by spreading
+// the allocations over many fields that are each reasonably sized. Decoding
+// fails with a BudgetError once the budget is exhausted.
+//
+// The budget is shared by every nested type of the message. Only the types
+// compiled while a budget is set are charged, so it should be set before any
+// type is decoded. Types that are already compiled without a budget are not
+// affected, changing the value of the budget applies to the others immediately.
+//
+// This value can also be configured with the `FRUGAL_MAX_ALLOC_BYTES`
+// environment variable.
+//
+// The default value "0" means unlimited.
+//
+// Returns the old opts.MaxAllocBytes value.
+func SetMaxAllocBytes(n int) int {
+    if n < 0 {
+        panic(fmt.Sprintf("frugal: invalid allocation budget: %d", n))
+    } else {
+        return int(atomic.SwapInt64(&opts.MaxAllocBytes, int64(n)))
+    }
+}
+
+// SetMaxTransformedBytes limits the size of a THeader payload after its
+// transforms are undone by DecodeMessage, so that a small compressed frame
+// cannot inflate to an arbitrary amount of memory. Decoding fails with
+// ErrTransformLimit once the limit is exceeded.
+//
+// This value can also be configured with the `FRUGAL_MAX_TRANSFORMED_BYTES`
+// environment variable.
+//
+// The default value is 64MB, "0" means unlimited.
+//
+// Returns the old opts.MaxTransformed value.
+func SetMaxTransformedBytes(n int) int {
+    if n < 0 {
+        panic(fmt.Sprintf("frugal: invalid transformed size limit: %d", n))
+    } else {
+        return int(atomic.SwapInt64(&opts.MaxTransformed, int64(n)))
+    }
+}
+
+// SetDeoptThreshold makes the encoder and the decoder recover the faults of the
+// generated machine code, that is an AbortError or a runtime.Error raised by
+// frugal itself, and return them as a FaultError. Once the code of a type has
+// faulted n times, which most likely means it was miscompiled, the type is
+// linked again with the emulator, so that traffic can still be served while the
+// bug is being investigated. A warning naming the faulting code is logged, see
+// also debug.SetDeoptHook.
+//
+// Other panics, such as those raised by user code called from the generated
+// code, are never recovered. Only types encoded or decoded with the default
+// options are deoptimized.
+//
+// This value can also be configured with the `FRUGAL_DEOPT_THRESHOLD`
+// environment variable.
+//
+// The default value "0" disables recovering.
+//
+// Returns the old opts.DeoptThreshold value.
+func SetDeoptThreshold(n int) int {
+    if n < 0 {
+        panic(fmt.Sprintf("frugal: invalid deoptimization threshold: %d", n))
+    } else {
+        n, opts.DeoptThreshold = opts.DeoptThreshold, n
+        return n
+    }
+}
+
+// WithYieldInterval makes the decoder yield the processor about every n bytes
+// of input while decoding lists, sets and maps, so that decoding a very large
+// payload does not starve other goroutines on the same P. The decoder calls
+// runtime.Gosched when it yields, unless replaced by SetYieldFunc.
+//
+// Note that a single binary or string value is always decoded at once, no
+// matter how large it is.
+//
+// Set this option to "0" disables yielding.
+//
+// The default value of this option is "0".
+func WithYieldInterval(n int) Option {
+    if n < 0 {
+        panic(fmt.Sprintf("frugal: invalid yield interval: %d", n))
+    } else {
+        return func(o *opts.Options) { o.YieldInterval = n }
+    }
+}
+
+// SetYieldInterval sets the default yielding interval of the decoder in bytes
+// for all types from now on. Types that are already compiled are not affected.
+//
+// This value can also be configured with the `FRUGAL_YIELD_INTERVAL`
+// environment variable.
+//
+// The default value "0" means never yield.
+//
+// Returns the old opts.YieldInterval value.
+func SetYieldInterval(n int) int {
+    if n < 0 {
+        panic(fmt.Sprintf("frugal: invalid yield interval: %d", n))
+    } else {
+        n, opts.YieldInterval = opts.YieldInterval, n
+        return n
+    }
+}
+
+// SetYieldFunc replaces the function that the decoder calls when it yields,
+// which is runtime.Gosched by default, and returns the old one. Passing nil
+// restores the default.
+func SetYieldFunc(fn func()) func() {
+    return decoder.SetYieldFunc(fn)
+}
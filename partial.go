@@ -0,0 +1,49 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package frugal
+
+import (
+    `fmt`
+    `reflect`
+
+    `github.com/cloudwego/frugal/internal/binary/decoder`
+)
+
+// PartialDecoder decodes only a subset of the fields of a struct, see CompilePartialDecoder.
+type PartialDecoder = decoder.PartialDecoder
+
+// CompilePartialDecoder compiles a decoder for struct type vt which only decodes the fields
+// listed in fieldIDs. All the other fields are skipped without allocating, and are left
+// untouched in the destination struct. Required fields that are not selected are not checked.
+//
+// The returned decoder is not cached, call Release on it once it is no longer needed.
+func CompilePartialDecoder(vt reflect.Type, fieldIDs []int16) (*PartialDecoder, error) {
+    ids := make([]uint16, 0, len(fieldIDs))
+
+    /* convert the field IDs */
+    for _, id := range fieldIDs {
+        if id < 0 {
+            return nil, fmt.Errorf("frugal: invalid field ID %d", id)
+        } else {
+            ids = append(ids, uint16(id))
+        }
+    }
+
+    /* compile the decoder */
+    return decoder.CompilePartial(vt, ids)
+}
@@ -100,3 +100,34 @@ func Pretouch(vt reflect.Type, options ...Option) error {
     /* completed with no errors */
     return nil
 }
+
+// Pin protects the codecs of vt from being evicted from the program cache when
+// the cache is limited by SetMaxCacheEntries. It can be called before or after
+// vt is compiled.
+//
+// Only vt itself and the pointer to vt are pinned, types that are referenced by
+// vt but compiled separately are not affected.
+func Pin(vt reflect.Type) {
+    for _, t := range []reflect.Type { vt, reflect.PtrTo(vt) } {
+        decoder.Pin(rt.UnpackType(t))
+        encoder.Pin(rt.UnpackType(t))
+    }
+}
+
+// Release removes the codecs of vt and the pointer to vt from the program
+// cache, their machine code is freed by the garbage collector once no goroutine
+// is encoding or decoding with them anymore. The types are compiled again if
+// they are used after that.
+//
+// This is useful for long-running processes that compile codecs for transient
+// types. Release also unpins the types, and it is safe to release types that
+// have never been compiled.
+//
+// Note that codecs of other types may still contain inlined code of vt, such
+// codecs are not affected.
+func Release(vt reflect.Type) {
+    for _, t := range []reflect.Type { vt, reflect.PtrTo(vt) } {
+        decoder.Release(rt.UnpackType(t))
+        encoder.Release(rt.UnpackType(t))
+    }
+}
@@ -0,0 +1,275 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package frugal
+
+import (
+    `context`
+    `encoding/binary`
+    `errors`
+    `fmt`
+    `sort`
+    `sync`
+    `sync/atomic`
+
+    `github.com/cloudwego/frugal/internal/binary/defs`
+    `github.com/cloudwego/frugal/iov`
+)
+
+// Propagator moves request-scoped values, such as trace identifiers or baggage,
+// between a context.Context and the propagation field of a struct, see
+// EncodeObjectContext and DecodeObjectContext.
+type Propagator interface {
+    // Inject adds the values carried by ctx into kv.
+    Inject(ctx context.Context, kv map[string]string)
+
+    // Extract returns a context derived from ctx which carries the values in kv.
+    Extract(ctx context.Context, kv map[string]string) context.Context
+}
+
+const (
+    // DefaultPropagationFieldID is the field ID of the propagation field, unless
+    // changed with SetPropagationFieldID.
+    DefaultPropagationFieldID = 32767
+)
+
+var (
+    errPropagation = errors.New("frugal: invalid propagation field")
+)
+
+var (
+    propagationID   = int32(DefaultPropagationFieldID)
+    propagatorLock  = new(sync.RWMutex)
+    propagatorList  []Propagator
+)
+
+// RegisterPropagator adds p to the propagators used by EncodeObjectContext and
+// DecodeObjectContext. Propagators are invoked in the order they are registered.
+func RegisterPropagator(p Propagator) {
+    if p == nil {
+        panic("frugal: nil propagator")
+    }
+
+    /* update the propagator list */
+    propagatorLock.Lock()
+    propagatorList = append(propagatorList, p)
+    propagatorLock.Unlock()
+}
+
+// SetPropagationFieldID changes the field ID of the propagation field, and returns
+// the previous one. The struct being encoded or decoded must not have a field with
+// this ID. Both ends of the transport must agree on the same ID.
+func SetPropagationFieldID(id int16) int16 {
+    if id <= 0 {
+        panic(fmt.Sprintf("frugal: invalid propagation field ID: %d", id))
+    } else {
+        return int16(atomic.SwapInt32(&propagationID, int32(id)))
+    }
+}
+
+// EncodedSizeContext is like EncodedSize, but also counts the propagation field
+// injected from ctx. It returns a context carrying the injected values, which
+// should be passed to EncodeObjectContext, so the propagators are only invoked
+// once and the size matches what is written.
+func EncodedSizeContext(ctx context.Context, val interface{}) (context.Context, int) {
+    kv := injectValues(ctx)
+    return context.WithValue(ctx, _PropagationKey{}, kv), propagationSize(kv) + EncodedSize(val)
+}
+
+// EncodeObjectContext is like EncodeObject, but also asks every registered Propagator
+// to inject the values carried by ctx, and writes them as a map<string, string> field
+// with the propagation field ID in front of the other fields of val. This lets tracing
+// baggage ride in-band for transports without header support. The field is omitted
+// if nothing is injected.
+//
+// buf must be large enough to contain the result, see EncodedSizeContext. If ctx is
+// returned by EncodedSizeContext, the values injected there are written instead.
+func EncodeObjectContext(ctx context.Context, buf []byte, mem iov.BufferWriter, val interface{}) (int, error) {
+    kv := injectedValues(ctx)
+    nb := propagationSize(kv)
+
+    /* check for buffer space */
+    if nb > len(buf) {
+        return 0, errMessageSpace
+    }
+
+    /* the propagation field goes first, followed by the fields of val */
+    encodePropagation(buf, kv)
+    ret, err := EncodeObject(buf[nb:], mem, val)
+    return nb + ret, err
+}
+
+// DecodeObjectContext is like DecodeObject, but also extracts the propagation field
+// written by EncodeObjectContext, and returns the context derived from ctx by every
+// registered Propagator. The propagation field is only recognized as the first field
+// of the struct, anywhere else it is treated as an unknown field of val.
+func DecodeObjectContext(ctx context.Context, buf []byte, val interface{}) (context.Context, int, error) {
+    kv, nb, err := decodePropagation(buf)
+
+    /* check for errors */
+    if err != nil {
+        return ctx, 0, err
+    }
+
+    /* decode the rest of the struct */
+    ret, err := DecodeObject(buf[nb:], val)
+    ret += nb
+
+    /* only extract from a valid message */
+    if err != nil || kv == nil {
+        return ctx, ret, err
+    }
+
+    /* derive the context with every propagator */
+    propagatorLock.RLock()
+    defer propagatorLock.RUnlock()
+
+    /* extract the values */
+    for _, p := range propagatorList {
+        ctx = p.Extract(ctx, kv)
+    }
+
+    /* all done */
+    return ctx, ret, nil
+}
+
+type _PropagationKey struct{}
+
+func injectedValues(ctx context.Context) map[string]string {
+    if kv, ok := ctx.Value(_PropagationKey{}).(map[string]string); ok {
+        return kv
+    } else {
+        return injectValues(ctx)
+    }
+}
+
+func injectValues(ctx context.Context) map[string]string {
+    kv := make(map[string]string)
+    propagatorLock.RLock()
+    defer propagatorLock.RUnlock()
+
+    /* collect from every propagator */
+    for _, p := range propagatorList {
+        p.Inject(ctx, kv)
+    }
+
+    /* all done */
+    return kv
+}
+
+func propagationSize(kv map[string]string) int {
+    if len(kv) == 0 {
+        return 0
+    }
+
+    /* field header and map header */
+    nb := 9
+
+    /* every key and value has a length prefix */
+    for k, v := range kv {
+        nb += len(k) + len(v) + 8
+    }
+
+    /* all done */
+    return nb
+}
+
+func encodePropagation(buf []byte, kv map[string]string) {
+    if len(kv) == 0 {
+        return
+    }
+
+    /* sort the keys to keep the encoding stable */
+    p := 9
+    ks := make([]string, 0, len(kv))
+
+    /* collect all the keys */
+    for k := range kv {
+        ks = append(ks, k)
+    }
+
+    /* field header and map header */
+    sort.Strings(ks)
+    buf[0] = byte(defs.T_map)
+    buf[3] = byte(defs.T_string)
+    buf[4] = byte(defs.T_string)
+    binary.BigEndian.PutUint16(buf[1:], uint16(atomic.LoadInt32(&propagationID)))
+    binary.BigEndian.PutUint32(buf[5:], uint32(len(kv)))
+
+    /* encode every pair */
+    for _, k := range ks {
+        p += putBinaryString(buf[p:], k)
+        p += putBinaryString(buf[p:], kv[k])
+    }
+}
+
+func decodePropagation(buf []byte) (map[string]string, int, error) {
+    if len(buf) < 3 || defs.Tag(buf[0]) != defs.T_map {
+        return nil, 0, nil
+    } else if binary.BigEndian.Uint16(buf[1:]) != uint16(atomic.LoadInt32(&propagationID)) {
+        return nil, 0, nil
+    }
+
+    /* check the map header */
+    if len(buf) < 9 {
+        return nil, 0, errMessageShort
+    } else if defs.Tag(buf[3]) != defs.T_string || defs.Tag(buf[4]) != defs.T_string {
+        return nil, 0, errPropagation
+    }
+
+    /* every pair takes at least 8 bytes */
+    p := 9
+    n := binary.BigEndian.Uint32(buf[5:])
+
+    /* check the element count */
+    if uint64(n) * 8 > uint64(len(buf) - p) {
+        return nil, 0, errMessageShort
+    }
+
+    /* the decoded pairs */
+    var err error
+    var k, v string
+    var kv = make(map[string]string, n)
+
+    /* decode every pair */
+    for i := uint32(0); i < n; i++ {
+        if k, p, err = getBinaryString(buf, p); err != nil {
+            return nil, 0, err
+        } else if v, p, err = getBinaryString(buf, p); err != nil {
+            return nil, 0, err
+        } else {
+            kv[k] = v
+        }
+    }
+
+    /* all done */
+    return kv, p, nil
+}
+
+func putBinaryString(buf []byte, s string) int {
+    binary.BigEndian.PutUint32(buf, uint32(len(s)))
+    return copy(buf[4:], s) + 4
+}
+
+func getBinaryString(buf []byte, p int) (string, int, error) {
+    if len(buf) - p < 4 {
+        return "", 0, errMessageShort
+    } else if nb := binary.BigEndian.Uint32(buf[p:]); uint64(nb) > uint64(len(buf) - p - 4) {
+        return "", 0, errMessageShort
+    } else {
+        return string(buf[p + 4:p + 4 + int(nb)]), p + 4 + int(nb), nil
+    }
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package frugal
+
+import (
+    `fmt`
+    `reflect`
+
+    `github.com/cloudwego/frugal/internal/binary/defs`
+)
+
+// FieldDescriptor is the descriptor of a struct field, as seen by a Rewriter.
+type FieldDescriptor struct {
+    Name   string          // name of the struct field, read-only
+    Type   reflect.Type    // type of the struct field, read-only
+    ID     int16           // field ID on the wire
+    NoCopy bool            // decode without copying, only applicable to "string" and "binary" fields
+    Drop   bool            // leave the field out, it is skipped when decoding and never encoded
+}
+
+// Rewriter enforces policies on the fields of every struct type, without
+// changing the struct definitions, such as dropping fields that match a
+// pattern, decoding every string without copying, or remapping field IDs.
+type Rewriter interface {
+    // RewriteFields is called with the fields of struct type vt, as declared
+    // by their "frugal" tags, in ascending order of field IDs. It changes the
+    // descriptors in place, and returns an error to reject vt altogether.
+    RewriteFields(vt reflect.Type, fields []FieldDescriptor) error
+}
+
+// RegisterRewriter adds rw to the rewriters of field descriptors. Rewriters are
+// invoked in the order they are registered, before the struct types are
+// compiled, and at most once for each struct type.
+//
+// Struct types that have already been compiled are not affected, so rewriters
+// should be registered in an init function, before any encoding or decoding.
+// Both ends of the transport must agree on the rewritten field IDs.
+func RegisterRewriter(rw Rewriter) {
+    if rw == nil {
+        panic("frugal: nil rewriter")
+    } else {
+        defs.RegisterRewriter(rewriterOf(rw))
+    }
+}
+
+func rewriterOf(rw Rewriter) defs.Rewriter {
+    return func(vt reflect.Type, fv []defs.Field) ([]defs.Field, error) {
+        ret := make([]defs.Field, 0, len(fv))
+        desc := make([]FieldDescriptor, len(fv))
+
+        /* convert to descriptors */
+        for i, f := range fv {
+            sf, _ := vt.FieldByName(f.Name)
+            desc[i] = FieldDescriptor { Name: f.Name, Type: sf.Type, ID: int16(f.ID), NoCopy: f.Opts & defs.NoCopy != 0 }
+        }
+
+        /* invoke the rewriter */
+        if err := rw.RewriteFields(vt, desc); err != nil {
+            return nil, err
+        }
+
+        /* apply the changes */
+        for i, f := range fv {
+            d := desc[i]
+
+            /* dropped fields are removed entirely */
+            if d.Drop {
+                continue
+            }
+
+            /* "nocopy" must still be applicable */
+            if d.NoCopy && f.Type.Tag() != defs.T_string {
+                return nil, fmt.Errorf(`"nocopy" is only applicable to "string" and "binary" types, not %s: %s.%s`, f.Type, vt, f.Name)
+            }
+
+            /* update the field */
+            f.ID = uint16(d.ID)
+            f.Opts &^= defs.NoCopy
+
+            /* set the "nocopy" option if needed */
+            if d.NoCopy {
+                f.Opts |= defs.NoCopy
+            }
+
+            /* add to result */
+            ret = append(ret, f)
+        }
+
+        /* all done */
+        return ret, nil
+    }
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package frugal
+
+import (
+    `reflect`
+    `time`
+
+    `github.com/cloudwego/frugal/internal/binary/decoder`
+    `github.com/cloudwego/frugal/internal/binary/encoder`
+    `github.com/cloudwego/frugal/internal/loader`
+    `github.com/cloudwego/frugal/internal/opts`
+    `github.com/cloudwego/frugal/internal/utils`
+)
+
+// A Snapshot is a point-in-time view of the frugal runtime counters. All the
+// counters are cumulative since the process started, except CodeSize and
+// Functions, which go down again when compiled types are released.
+type Snapshot struct {
+    CodeSize  int           // bytes of machine code currently loaded, including guard pages
+    Functions int           // number of machine code functions currently loaded
+    Encoder   CodecStats    // statistics of the encoder
+    Decoder   CodecStats    // statistics of the decoder
+    Flags     []FlagStats   // usage of every feature flag
+}
+
+// A CodecStats records the statistics of either the encoder or the decoder.
+type CodecStats struct {
+    Types       int             // number of compiled types
+    Hits        int             // number of type cache hits
+    Misses      int             // number of type cache misses
+    Emulated    int             // number of types that were linked to the emulator instead of machine code
+    Shared      int             // number of types that reused the code of another type with the same definition
+    Errors      int             // number of calls that returned an error
+    CompileTime time.Duration   // total time spent on compiling and linking types
+}
+
+// A FlagStats records how often a feature flag took effect. Enabled is the number
+// of programs compiled with the flag turned on, and Used is the number of those
+// whose generated code was actually changed by it. A flag with Enabled > 0 but
+// Used == 0 is most likely misconfigured, for example ValidateEnums without any
+// registered enum values, or IsSetMethods for types without IsSet methods.
+//
+// The names are those of the options without the "With" prefix, plus ZeroCopy,
+// Mask, Spill and Checked from DecoderBuilder and DecodeObjectChecked.
+type FlagStats = opts.FlagStats
+
+// Stats returns a snapshot of the frugal runtime counters. It is cheap enough
+// to be called on every scrape of a metrics endpoint, and the result can be
+// published as is with expvar.Func.
+func Stats() Snapshot {
+    return Snapshot {
+        CodeSize  : int(loader.LoadSize),
+        Functions : int(loader.FnCount),
+        Encoder   : CodecStats {
+            Types       : int(encoder.TypeCount),
+            Hits        : int(encoder.HitCount),
+            Misses      : int(encoder.MissCount),
+            Emulated    : int(encoder.EmuCount),
+            Shared      : int(encoder.SharedCount),
+            Errors      : int(encoder.ErrorCount),
+            CompileTime : time.Duration(encoder.CompileTime),
+        },
+        Decoder: CodecStats {
+            Types       : int(decoder.TypeCount),
+            Hits        : int(decoder.HitCount),
+            Misses      : int(decoder.MissCount),
+            Emulated    : int(decoder.EmuCount),
+            Shared      : int(decoder.SharedCount),
+            Errors      : int(decoder.ErrorCount),
+            CompileTime : time.Duration(decoder.CompileTime),
+        },
+        Flags: opts.GetFlagStats(),
+    }
+}
+
+// A StatsHook receives frugal runtime events as they happen, which can be
+// used to feed histograms or labelled counters that a Snapshot cannot
+// express, such as the compile time of each type.
+//
+// The codec argument is either "encoder" or "decoder". The methods are
+// called synchronously on the goroutine that triggered the event, and may be
+// called concurrently, so they must be safe for concurrent use and return
+// quickly.
+type StatsHook interface {
+    // OnCompile is called after vt is compiled and linked. size is the size
+    // of the generated machine code, which is 0 when using the emulator or
+    // when the code of another type with the same definition is reused.
+    OnCompile(codec string, vt reflect.Type, size int, duration time.Duration)
+
+    // OnError is called when EncodeObject or DecodeObject returns an error.
+    OnError(codec string, err error)
+}
+
+// A DecodeStatsHook is a StatsHook which also receives an event for every value
+// that is successfully decoded. Installing it with SetStatsHook is the only way
+// to enable these events. The skipped bytes are counted by the generated code,
+// so only the types compiled while such a hook is installed count them, and
+// their decoding pays for it even after the hook is removed. The other types
+// always report zero skipped bytes, install the hook before any type is decoded.
+type DecodeStatsHook interface {
+    StatsHook
+
+    // OnDecode is called after a value of type vt is decoded from size bytes,
+    // skipped of which belong to unknown fields, headers included, at any
+    // nesting level. A type with a high ratio of skipped bytes is carrying
+    // fields that none of its consumers reads.
+    OnDecode(vt reflect.Type, size int, skipped int)
+}
+
+// SetStatsHook installs hook to receive frugal runtime events, replacing the
+// previous one if any. Passing nil removes the hook. If hook also implements
+// DecodeStatsHook, it receives the decode events as well.
+func SetStatsHook(hook StatsHook) {
+    utils.SetStatsHook(hook)
+}
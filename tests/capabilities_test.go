@@ -0,0 +1,56 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+    `os`
+    `runtime`
+    `testing`
+
+    `github.com/cloudwego/frugal`
+    `github.com/stretchr/testify/require`
+)
+
+type directWriter struct {
+    n int
+}
+
+func (self *directWriter) WriteDirect(buf []byte, _ int) error {
+    self.n += len(buf)
+    return nil
+}
+
+type ZeroCopyTest struct {
+    A []byte `frugal:"1,default,binary"`
+}
+
+func TestCapabilities(t *testing.T) {
+    caps := frugal.Capabilities()
+    require.Equal(t, []string { "binary" }, caps.Protocols)
+    require.Equal(t, runtime.GOOS, caps.GOOS)
+    require.Equal(t, runtime.GOARCH, caps.GOARCH)
+    require.Equal(t, runtime.Version(), caps.GoVersion)
+    if os.Getenv("FRUGAL_BACKEND") == "emu" || runtime.GOARCH != "amd64" {
+        require.Equal(t, frugal.Emulated, caps.Backend)
+    }
+    wr := new(directWriter)
+    val := ZeroCopyTest { A: make([]byte, os.Getpagesize() * 2) }
+    buf := make([]byte, frugal.EncodedSize(val))
+    _, err := frugal.EncodeObject(buf, wr, val)
+    require.NoError(t, err)
+    require.Equal(t, caps.ZeroCopy, wr.n == len(val.A))
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+    `encoding/binary`
+    `reflect`
+    `testing`
+
+    `github.com/cloudwego/frugal`
+    `github.com/stretchr/testify/require`
+)
+
+func TestFingerprint_Mismatch(t *testing.T) {
+    var rv MyNode
+    val := MyNode { Name: "hello", ID: 12345 }
+    fp, err := frugal.Fingerprint(reflect.TypeOf(val))
+    require.NoError(t, err)
+    buf := make([]byte, frugal.EncodedSizeWithFingerprint(val))
+    _, err = frugal.EncodeObjectWithFingerprint(buf, nil, val)
+    require.NoError(t, err)
+    binary.BigEndian.PutUint32(buf, fp + 1)
+    for _, v := range []interface{} { &rv, rv } {
+        _, err = frugal.DecodeObjectWithFingerprint(buf, v)
+        require.Equal(t, frugal.FingerprintError { Type: reflect.TypeOf(rv), Want: fp, Got: fp + 1 }, err)
+    }
+    require.Equal(t, MyNode{}, rv)
+}
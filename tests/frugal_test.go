@@ -178,3 +178,50 @@ func TestSSACompile(t *testing.T) {
     var v baseline.Nesting2
     println(frugal.EncodedSize(v))
 }
+
+type CompileHookTest struct {
+    X int64 `frugal:"0,default,i64"`
+}
+
+func TestCompileHook(t *testing.T) {
+    var ev []debug.CompileEvent
+    debug.SetCompileHook(func(e debug.CompileEvent) { ev = append(ev, e) })
+    defer debug.SetCompileHook(nil)
+    v := CompileHookTest{X: 1}
+    m := make([]byte, frugal.EncodedSize(v))
+    _, err := frugal.EncodeObject(m, nil, v)
+    require.NoError(t, err)
+    _, err = frugal.DecodeObject(m, &v)
+    require.NoError(t, err)
+    require.Len(t, ev, 2)
+    require.Equal(t, reflect.TypeOf(v), ev[0].Type)
+    require.Equal(t, "encoder", ev[0].Codec)
+    require.Equal(t, "decoder", ev[1].Codec)
+    require.Contains(t, string(ev[0].Stack), "TestCompileHook")
+    spew.Dump(ev[0].CodeSize, ev[0].Duration, ev[1].CodeSize, ev[1].Duration)
+}
+
+type (
+    CacheLimitTestA struct { X int64 `frugal:"0,default,i64"` }
+    CacheLimitTestB struct { X int32 `frugal:"0,default,i32"` }
+    CacheLimitTestC struct { X int16 `frugal:"0,default,i16"` }
+)
+
+func TestCacheLimit(t *testing.T) {
+    var ev []reflect.Type
+    debug.SetCompileHook(func(e debug.CompileEvent) { ev = append(ev, e.Type) })
+    defer debug.SetCompileHook(nil)
+    defer frugal.SetMaxCacheEntries(frugal.SetMaxCacheEntries(2))
+    frugal.Pin(reflect.TypeOf(CacheLimitTestA{}))
+    frugal.EncodedSize(CacheLimitTestA{})
+    frugal.EncodedSize(CacheLimitTestB{})
+    frugal.EncodedSize(CacheLimitTestC{})
+    frugal.EncodedSize(CacheLimitTestA{})
+    frugal.EncodedSize(CacheLimitTestB{})
+    require.Equal(t, []reflect.Type {
+        reflect.TypeOf(CacheLimitTestA{}),
+        reflect.TypeOf(CacheLimitTestB{}),
+        reflect.TypeOf(CacheLimitTestC{}),
+        reflect.TypeOf(CacheLimitTestB{}),
+    }, ev)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+    `testing`
+
+    `github.com/cloudwego/frugal`
+    `github.com/stretchr/testify/require`
+)
+
+var messageTransports = map[string]frugal.Transport {
+    "Unframed" : frugal.Unframed,
+    "Framed"   : frugal.Framed,
+    "THeader"  : frugal.THeader,
+}
+
+func encodeMessage(t *testing.T, tr frugal.Transport, msg *frugal.Message, val interface{}) []byte {
+    buf := make([]byte, frugal.EncodedMessageSize(tr, msg, val))
+    nb, err := frugal.EncodeMessage(buf, tr, msg, val)
+    require.NoError(t, err)
+    return buf[:nb]
+}
+
+func TestMessage_RoundTrip(t *testing.T) {
+    for name, tr := range messageTransports {
+        t.Run(name, func(t *testing.T) {
+            var rm frugal.Message
+            var rv MyNode
+            val := MyNode { Name: "hello", ID: 12345 }
+            msg := frugal.Message { Name: "Echo", Type: frugal.Call, SeqID: 42 }
+            if tr == frugal.THeader {
+                msg.Headers = map[string]string { "a": "b", "trace": "xyz" }
+            }
+            buf := encodeMessage(t, tr, &msg, val)
+            require.Len(t, buf, frugal.EncodedMessageSize(tr, &msg, val))
+            nb, err := frugal.DecodeMessage(buf, tr, &rm, &rv)
+            require.NoError(t, err)
+            require.Equal(t, len(buf), nb)
+            require.Equal(t, val, rv)
+            require.Equal(t, msg.Name, rm.Name)
+            require.Equal(t, msg.Type, rm.Type)
+            require.Equal(t, msg.SeqID, rm.SeqID)
+            require.Equal(t, msg.Headers, rm.Headers)
+        })
+    }
+}
+
+func TestMessage_ReuseHeaders(t *testing.T) {
+    var rm frugal.Message
+    var rv MyNode
+    val := MyNode { Name: "hello", ID: 12345 }
+    for _, hdr := range []map[string]string {
+        { "a": "b", "trace": "xyz" },
+        { "c": "d" },
+        nil,
+    } {
+        buf := encodeMessage(t, frugal.THeader, &frugal.Message { Name: "Echo", Headers: hdr }, val)
+        _, err := frugal.DecodeMessage(buf, frugal.THeader, &rm, &rv)
+        require.NoError(t, err)
+        require.Len(t, rm.Headers, len(hdr))
+        for k, v := range hdr {
+            require.Equal(t, v, rm.Headers[k])
+        }
+    }
+}
+
+func TestMessage_OldHeader(t *testing.T) {
+    var rm frugal.Message
+    var rv MyNode
+    val := MyNode { Name: "hello", ID: 12345 }
+    buf := []byte { 0x00, 0x00, 0x00, 0x04, 'E', 'c', 'h', 'o', byte(frugal.Reply), 0x00, 0x00, 0x00, 0x2a }
+    buf = append(buf, encodeMessage(t, frugal.Unframed, &frugal.Message { Name: "x" }, val)[13:]...)
+    nb, err := frugal.DecodeMessage(buf, frugal.Unframed, &rm, &rv)
+    require.NoError(t, err)
+    require.Equal(t, len(buf), nb)
+    require.Equal(t, val, rv)
+    require.Equal(t, frugal.Message { Name: "Echo", Type: frugal.Reply, SeqID: 42 }, rm)
+}
+
+func TestMessage_Truncated(t *testing.T) {
+    for name, tr := range messageTransports {
+        t.Run(name, func(t *testing.T) {
+            val := MyNode { Name: "hello", ID: 12345 }
+            msg := frugal.Message { Name: "Echo", Type: frugal.Call, SeqID: 42, Headers: map[string]string { "a": "b" } }
+            buf := encodeMessage(t, tr, &msg, val)
+            end := len(buf)
+            /* without a frame, a truncated body can only be detected by
+             * the checked decoder, so only the header is truncated */
+            if tr == frugal.Unframed {
+                end = 4 + 4 + len(msg.Name) + 4
+            }
+            for i := 0; i < end; i++ {
+                var rm frugal.Message
+                var rv MyNode
+                _, err := frugal.DecodeMessage(append([]byte(nil), buf[:i]...), tr, &rm, &rv)
+                require.Error(t, err, "truncated to %d bytes", i)
+            }
+        })
+    }
+}
+
+func TestMessage_ExtraBytes(t *testing.T) {
+    var rm frugal.Message
+    var rv MyNode
+    msg := frugal.Message { Name: "Echo", Type: frugal.Call, SeqID: 42 }
+    buf := encodeMessage(t, frugal.Framed, &msg, MyNode { Name: "hello" })
+    buf = append(buf, 0)
+    buf[3]++
+    _, err := frugal.DecodeMessage(buf, frugal.Framed, &rm, &rv)
+    require.EqualError(t, err, "frugal: 1 bytes left in the frame")
+}
+
+func TestMessage_BufferTooSmall(t *testing.T) {
+    msg := frugal.Message { Name: "Echo", Type: frugal.Call, SeqID: 42 }
+    for name, tr := range messageTransports {
+        t.Run(name, func(t *testing.T) {
+            _, err := frugal.EncodeMessage(make([]byte, 8), tr, &msg, MyNode { Name: "hello" })
+            require.Error(t, err)
+        })
+    }
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+    `context`
+    `encoding/binary`
+    `strconv`
+    `sync/atomic`
+    `testing`
+
+    `github.com/cloudwego/frugal`
+    `github.com/stretchr/testify/require`
+)
+
+type traceKey struct{}
+
+type tracePropagator struct {
+    n int32
+}
+
+func (self *tracePropagator) Inject(ctx context.Context, kv map[string]string) {
+    if id, ok := ctx.Value(traceKey{}).(string); ok {
+        kv["trace-id"] = id
+        kv["inject-seq"] = strconv.Itoa(int(atomic.AddInt32(&self.n, 1)))
+    }
+}
+
+func (self *tracePropagator) Extract(ctx context.Context, kv map[string]string) context.Context {
+    if id, ok := kv["trace-id"]; ok {
+        ctx = context.WithValue(ctx, traceKey{}, id)
+    }
+    return ctx
+}
+
+var tracer = new(tracePropagator)
+
+func init() {
+    frugal.RegisterPropagator(tracer)
+}
+
+func TestPropagation_RoundTrip(t *testing.T) {
+    var rv MyNode
+    val := MyNode { Name: "hello", ID: 12345 }
+    ctx, nb := frugal.EncodedSizeContext(context.WithValue(context.Background(), traceKey{}, "abc"), val)
+    n0 := atomic.LoadInt32(&tracer.n)
+    buf := make([]byte, nb)
+    ret, err := frugal.EncodeObjectContext(ctx, buf, nil, val)
+    require.NoError(t, err)
+    require.Equal(t, nb, ret)
+    require.Equal(t, n0, atomic.LoadInt32(&tracer.n))
+    out, ret, err := frugal.DecodeObjectContext(context.Background(), buf, &rv)
+    require.NoError(t, err)
+    require.Equal(t, nb, ret)
+    require.Equal(t, val, rv)
+    require.Equal(t, "abc", out.Value(traceKey{}))
+}
+
+func TestPropagation_Absent(t *testing.T) {
+    var rv MyNode
+    val := MyNode { Name: "hello", ID: 12345 }
+    ctx, nb := frugal.EncodedSizeContext(context.Background(), val)
+    require.Equal(t, frugal.EncodedSize(val), nb)
+    buf := make([]byte, nb)
+    ret, err := frugal.EncodeObjectContext(ctx, buf, nil, val)
+    require.NoError(t, err)
+    require.Equal(t, nb, ret)
+    out, ret, err := frugal.DecodeObjectContext(context.Background(), buf, &rv)
+    require.NoError(t, err)
+    require.Equal(t, nb, ret)
+    require.Equal(t, val, rv)
+    require.Nil(t, out.Value(traceKey{}))
+}
+
+func TestPropagation_Malformed(t *testing.T) {
+    var rv MyNode
+    val := MyNode { Name: "hello", ID: 12345 }
+    ctx, nb := frugal.EncodedSizeContext(context.WithValue(context.Background(), traceKey{}, "abc"), val)
+    buf := make([]byte, nb)
+    _, err := frugal.EncodeObjectContext(ctx, buf, nil, val)
+    require.NoError(t, err)
+    mem := append([]byte(nil), buf...)
+    mem[4] = 0x08
+    _, _, err = frugal.DecodeObjectContext(context.Background(), mem, &rv)
+    require.EqualError(t, err, "frugal: invalid propagation field")
+    mem = append([]byte(nil), buf...)
+    binary.BigEndian.PutUint32(mem[5:], 1000)
+    _, _, err = frugal.DecodeObjectContext(context.Background(), mem, &rv)
+    require.EqualError(t, err, "frugal: message is too short")
+    mem = append([]byte(nil), buf...)
+    binary.BigEndian.PutUint32(mem[9:], 1000)
+    _, _, err = frugal.DecodeObjectContext(context.Background(), mem, &rv)
+    require.EqualError(t, err, "frugal: message is too short")
+    for i := 3; i < 9; i++ {
+        _, _, err = frugal.DecodeObjectContext(context.Background(), append([]byte(nil), buf[:i]...), &rv)
+        require.Error(t, err, "truncated to %d bytes", i)
+    }
+}
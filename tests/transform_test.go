@@ -0,0 +1,150 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+    `bytes`
+    `compress/flate`
+    `encoding/binary`
+    `io`
+    `io/ioutil`
+    `strings`
+    `testing`
+
+    `github.com/cloudwego/frugal`
+    `github.com/stretchr/testify/require`
+)
+
+/* the THeader ID of zstd, zstd itself needs a third-party library, so a
+ * raw deflate transform is registered in its place */
+const transformZstd = 5
+
+type deflateTransform struct{}
+
+func (deflateTransform) Bound(n int) int {
+    return n + (n >> 11) + 64
+}
+
+func (deflateTransform) Encode(dst []byte, src []byte) (int, error) {
+    buf := bytes.NewBuffer(dst[:0])
+    fw, _ := flate.NewWriter(buf, flate.BestSpeed)
+    if _, err := fw.Write(src); err != nil {
+        return 0, err
+    } else if err = fw.Close(); err != nil {
+        return 0, err
+    } else {
+        return copy(dst, buf.Bytes()), nil
+    }
+}
+
+func (deflateTransform) Decode(dst []byte, src []byte, limit int) ([]byte, error) {
+    if buf, err := ioutil.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(src)), int64(limit) + 1)); err != nil {
+        return nil, err
+    } else if limit > 0 && len(buf) > limit {
+        return nil, frugal.ErrTransformLimit
+    } else {
+        return append(dst, buf...), nil
+    }
+}
+
+func init() {
+    frugal.RegisterTransform(transformZstd, deflateTransform{})
+}
+
+func transformedMessage(t *testing.T, tr ...int) (*frugal.Message, MyNode, []byte) {
+    val := MyNode { Name: strings.Repeat("hello", 100), ID: 12345 }
+    msg := &frugal.Message { Name: "Echo", Type: frugal.Call, SeqID: 42, Headers: map[string]string { "a": "b" }, Transforms: tr }
+    return msg, val, encodeMessage(t, frugal.THeader, msg, val)
+}
+
+func TestTransform_RoundTrip(t *testing.T) {
+    for name, tr := range map[string][]int {
+        "zlib"      : { frugal.TransformZlib },
+        "zstd"      : { transformZstd },
+        "zlib+zstd" : { frugal.TransformZlib, transformZstd },
+    } {
+        t.Run(name, func(t *testing.T) {
+            var rm frugal.Message
+            var rv MyNode
+            msg, val, buf := transformedMessage(t, tr...)
+            require.Less(t, len(buf), len(val.Name))
+            require.LessOrEqual(t, len(buf), frugal.EncodedMessageSize(frugal.THeader, msg, val))
+            nb, err := frugal.DecodeMessage(buf, frugal.THeader, &rm, &rv)
+            require.NoError(t, err)
+            require.Equal(t, len(buf), nb)
+            require.Equal(t, val, rv)
+            require.Equal(t, tr, rm.Transforms)
+            require.Equal(t, msg.Headers, rm.Headers)
+            require.Equal(t, msg.SeqID, rm.SeqID)
+        })
+    }
+}
+
+func TestTransform_Corrupted(t *testing.T) {
+    var rm frugal.Message
+    var rv MyNode
+    _, _, buf := transformedMessage(t, frugal.TransformZlib)
+    nh := 14 + int(binary.BigEndian.Uint16(buf[12:])) * 4
+    mem := append([]byte(nil), buf...)
+    mem[nh] ^= 0xff
+    _, err := frugal.DecodeMessage(mem, frugal.THeader, &rm, &rv)
+    require.Error(t, err)
+    require.Contains(t, err.Error(), "frugal: invalid zlib payload: ")
+    mem = append([]byte(nil), buf...)
+    mem[len(mem) - 1] ^= 0xff
+    _, err = frugal.DecodeMessage(mem, frugal.THeader, &rm, &rv)
+    require.Error(t, err)
+    require.Contains(t, err.Error(), "frugal: invalid zlib payload: ")
+    mem = append([]byte(nil), buf[:len(buf) - 8]...)
+    binary.BigEndian.PutUint32(mem, uint32(len(mem) - 4))
+    _, err = frugal.DecodeMessage(mem, frugal.THeader, &rm, &rv)
+    require.Error(t, err)
+    require.Contains(t, err.Error(), "frugal: invalid zlib payload: ")
+}
+
+func TestTransform_Unsupported(t *testing.T) {
+    var rm frugal.Message
+    var rv MyNode
+    msg := &frugal.Message { Name: "Echo", Transforms: []int { 99 } }
+    _, err := frugal.EncodeMessage(make([]byte, 256), frugal.THeader, msg, MyNode{})
+    require.EqualError(t, err, "frugal: unsupported THeader transform: 99")
+    _, _, buf := transformedMessage(t, frugal.TransformZlib)
+    buf[16] = 99
+    _, err = frugal.DecodeMessage(buf, frugal.THeader, &rm, &rv)
+    require.EqualError(t, err, "frugal: unsupported THeader transform: 99")
+}
+
+func TestTransform_Limit(t *testing.T) {
+    for name, tr := range map[string][]int {
+        "zlib"      : { frugal.TransformZlib },
+        "zstd"      : { transformZstd },
+        "zlib+zstd" : { frugal.TransformZlib, transformZstd },
+    } {
+        t.Run(name, func(t *testing.T) {
+            var rm frugal.Message
+            var rv MyNode
+            _, _, buf := transformedMessage(t, tr...)
+            old := frugal.SetMaxTransformedBytes(256)
+            defer frugal.SetMaxTransformedBytes(old)
+            _, err := frugal.DecodeMessage(buf, frugal.THeader, &rm, &rv)
+            require.Equal(t, frugal.ErrTransformLimit, err)
+            frugal.SetMaxTransformedBytes(1024)
+            _, err = frugal.DecodeMessage(buf, frugal.THeader, &rm, &rv)
+            require.NoError(t, err)
+        })
+    }
+}
@@ -0,0 +1,262 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+// Package thttp wraps frugal payloads for HTTP transports.
+//
+// Only the Thrift Binary Protocol is supported by frugal, the Compact and JSON
+// media types are recognized during content negotiation but always rejected.
+package thttp
+
+import (
+    `bytes`
+    `compress/flate`
+    `errors`
+    `fmt`
+    `io`
+    `io/ioutil`
+    `mime`
+    `net/http`
+    `strconv`
+    `strings`
+
+    `github.com/cloudwego/frugal`
+)
+
+const (
+    ContentTypeBinary  = "application/x-thrift"
+    ContentTypeCompact = "application/vnd.apache.thrift.compact"
+    ContentTypeJSON    = "application/vnd.apache.thrift.json"
+)
+
+const (
+    EncodingDeflate = "deflate"
+)
+
+var (
+    ErrNotAcceptable        = errors.New("thttp: no acceptable content type")
+    ErrUnsupportedMediaType = errors.New("thttp: unsupported content type")
+    ErrUnsupportedEncoding  = errors.New("thttp: unsupported content encoding")
+)
+
+// Negotiate selects the media type of the response from the Accept header. An
+// empty header accepts anything. ContentTypeBinary is the only media type that
+// can be selected, ErrNotAcceptable is returned if it's not accepted.
+func Negotiate(accept string) (string, error) {
+    if accept == "" || qualityOf(accept, ContentTypeBinary) > 0 {
+        return ContentTypeBinary, nil
+    } else {
+        return "", ErrNotAcceptable
+    }
+}
+
+// AcceptsDeflate reports whether the Accept-Encoding header allows deflate.
+func AcceptsDeflate(h http.Header) bool {
+    return qualityOf(h.Get("Accept-Encoding"), EncodingDeflate) > 0
+}
+
+// Marshal serializes val with the Thrift Binary Protocol, and compresses the
+// result with deflate if required.
+func Marshal(val interface{}, deflate bool) ([]byte, error) {
+    buf := make([]byte, frugal.EncodedSize(val))
+    nb, err := frugal.EncodeObject(buf, nil, val)
+
+    /* check for encoding errors */
+    if err != nil {
+        return nil, err
+    }
+
+    /* no compression required */
+    if !deflate {
+        return buf[:nb], nil
+    }
+
+    /* compress the payload */
+    out := new(bytes.Buffer)
+    enc, _ := flate.NewWriter(out, flate.DefaultCompression)
+
+    /* write the payload */
+    if _, err = enc.Write(buf[:nb]); err != nil {
+        return nil, err
+    }
+
+    /* flush the compressor */
+    if err = enc.Close(); err != nil {
+        return nil, err
+    } else {
+        return out.Bytes(), nil
+    }
+}
+
+// NewRequest creates a request with val as the body, and sets the Content-Type
+// and Content-Encoding headers accordingly.
+func NewRequest(method string, url string, val interface{}, deflate bool) (*http.Request, error) {
+    var err error
+    var buf []byte
+    var req *http.Request
+
+    /* serialize the body */
+    if buf, err = Marshal(val, deflate); err != nil {
+        return nil, err
+    }
+
+    /* create the request */
+    if req, err = http.NewRequest(method, url, bytes.NewReader(buf)); err != nil {
+        return nil, err
+    }
+
+    /* set the headers */
+    setHeaders(req.Header, deflate)
+    req.Header.Set("Accept", ContentTypeBinary)
+    return req, nil
+}
+
+// ReadBody reads and deserializes the body described by header h into val,
+// decompressing it if necessary.
+func ReadBody(h http.Header, body io.Reader, val interface{}) error {
+    var err error
+    var buf []byte
+
+    /* check the content type */
+    if ct := h.Get("Content-Type"); ct != "" {
+        if mt, _, err := mime.ParseMediaType(ct); err != nil || mt != ContentTypeBinary {
+            return ErrUnsupportedMediaType
+        }
+    }
+
+    /* check the content encoding */
+    switch ce := strings.ToLower(h.Get("Content-Encoding")); ce {
+        case ""              : break
+        case "identity"      : break
+        case EncodingDeflate : body = flate.NewReader(body)
+        default              : return ErrUnsupportedEncoding
+    }
+
+    /* read the entire body */
+    if buf, err = ioutil.ReadAll(body); err != nil {
+        return err
+    }
+
+    /* deserialize the body */
+    if nb, err := frugal.DecodeObject(buf, val); err != nil {
+        return err
+    } else if nb != len(buf) {
+        return fmt.Errorf("thttp: %d trailing bytes after the payload", len(buf) - nb)
+    } else {
+        return nil
+    }
+}
+
+// ReadRequest deserializes the body of r into val. The returned status code
+// is suitable for replying to a request that cannot be decoded.
+func ReadRequest(r *http.Request, val interface{}) (int, error) {
+    switch err := ReadBody(r.Header, r.Body, val); err {
+        case nil                     : return http.StatusOK, nil
+        case ErrUnsupportedMediaType : return http.StatusUnsupportedMediaType, err
+        case ErrUnsupportedEncoding  : return http.StatusUnsupportedMediaType, err
+        default                      : return http.StatusBadRequest, err
+    }
+}
+
+// WriteResponse negotiates with the headers of r, and writes val as the body
+// of the response. The body is compressed with deflate if r accepts it.
+//
+// If the content negotiation failed, "406 Not Acceptable" is sent, and
+// ErrNotAcceptable is returned.
+func WriteResponse(w http.ResponseWriter, r *http.Request, val interface{}) error {
+    var err error
+    var buf []byte
+
+    /* negotiate the content type */
+    if _, err = Negotiate(r.Header.Get("Accept")); err != nil {
+        http.Error(w, err.Error(), http.StatusNotAcceptable)
+        return err
+    }
+
+    /* serialize the body */
+    deflate := AcceptsDeflate(r.Header)
+    buf, err = Marshal(val, deflate)
+
+    /* check for errors */
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return err
+    }
+
+    /* set the headers, and write the body */
+    setHeaders(w.Header(), deflate)
+    w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+    w.Header().Add("Vary", "Accept, Accept-Encoding")
+    _, err = w.Write(buf)
+    return err
+}
+
+func setHeaders(h http.Header, deflate bool) {
+    h.Set("Content-Type", ContentTypeBinary)
+    if deflate {
+        h.Set("Content-Encoding", EncodingDeflate)
+    }
+}
+
+func qualityOf(header string, value string) float64 {
+    q := 0.0
+    n := 0
+
+    /* the most specific entry takes precedence */
+    for _, v := range strings.Split(header, ",") {
+        if qv, nv := matchEntry(v, value); nv > n {
+            q, n = qv, nv
+        }
+    }
+
+    /* not listed if nothing matches */
+    return q
+}
+
+func matchEntry(entry string, value string) (float64, int) {
+    q := 1.0
+    vv := strings.Split(entry, ";")
+    nv := matchValue(strings.ToLower(strings.TrimSpace(vv[0])), value)
+
+    /* check for the value */
+    if nv == 0 {
+        return 0, 0
+    }
+
+    /* parse the quality factor, if any */
+    for _, p := range vv[1:] {
+        if p = strings.TrimSpace(p); strings.HasPrefix(p, "q=") {
+            if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+                q = f
+            }
+        }
+    }
+
+    /* all done */
+    return q, nv
+}
+
+func matchValue(pattern string, value string) int {
+    if pattern == value {
+        return 3
+    } else if i := strings.IndexByte(value, '/'); i >= 0 && pattern == value[:i] + "/*" {
+        return 2
+    } else if pattern == "*" || pattern == "*/*" {
+        return 1
+    } else {
+        return 0
+    }
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package thttp
+
+import (
+    `bytes`
+    `net/http`
+    `net/http/httptest`
+    `strings`
+    `testing`
+
+    `github.com/stretchr/testify/require`
+)
+
+type TestEcho struct {
+    A string `frugal:"1,default,string"`
+    B int64  `frugal:"2,default,i64"`
+}
+
+func newEchoServer() *httptest.Server {
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var v TestEcho
+        if code, err := ReadRequest(r, &v); err != nil {
+            http.Error(w, err.Error(), code)
+        } else {
+            v.B++
+            _ = WriteResponse(w, r, &v)
+        }
+    }))
+}
+
+func TestThttp_RoundTrip(t *testing.T) {
+    srv := newEchoServer()
+    defer srv.Close()
+    for _, deflate := range []bool { false, true } {
+        var v TestEcho
+        req, err := NewRequest(http.MethodPost, srv.URL, &TestEcho { A: strings.Repeat("x", 1000), B: 7 }, deflate)
+        require.NoError(t, err)
+        if deflate {
+            req.Header.Set("Accept-Encoding", "gzip;q=0.5, deflate")
+        } else {
+            req.Header.Set("Accept-Encoding", "identity")
+        }
+        resp, err := srv.Client().Do(req)
+        require.NoError(t, err)
+        require.Equal(t, http.StatusOK, resp.StatusCode)
+        require.Equal(t, ContentTypeBinary, resp.Header.Get("Content-Type"))
+        if deflate {
+            require.Equal(t, EncodingDeflate, resp.Header.Get("Content-Encoding"))
+            require.Less(t, resp.ContentLength, int64(1000))
+        } else {
+            require.Empty(t, resp.Header.Get("Content-Encoding"))
+        }
+        require.NoError(t, ReadBody(resp.Header, resp.Body, &v))
+        require.NoError(t, resp.Body.Close())
+        require.Equal(t, TestEcho { A: strings.Repeat("x", 1000), B: 8 }, v)
+    }
+}
+
+func TestThttp_Errors(t *testing.T) {
+    srv := newEchoServer()
+    defer srv.Close()
+    body, err := Marshal(&TestEcho { A: "a" }, false)
+    require.NoError(t, err)
+    for _, tc := range []struct {
+        header string
+        value  string
+        code   int
+    } {
+        { "Accept"           , ContentTypeCompact , http.StatusNotAcceptable        },
+        { "Accept"           , "*/*;q=0"          , http.StatusNotAcceptable        },
+        { "Content-Type"     , ContentTypeJSON    , http.StatusUnsupportedMediaType },
+        { "Content-Encoding" , "br"               , http.StatusUnsupportedMediaType },
+        { "Content-Encoding" , EncodingDeflate    , http.StatusBadRequest           },
+    } {
+        req := httptest.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(body))
+        req.RequestURI = ""
+        req.Header.Set(tc.header, tc.value)
+        resp, err := srv.Client().Do(req)
+        require.NoError(t, err)
+        require.NoError(t, resp.Body.Close())
+        require.Equal(t, tc.code, resp.StatusCode, "%s: %s", tc.header, tc.value)
+    }
+}
+
+func TestThttp_TrailingBytes(t *testing.T) {
+    var v TestEcho
+    body, err := Marshal(&TestEcho { A: "a" }, false)
+    require.NoError(t, err)
+    req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(append(body, 0)))
+    code, err := ReadRequest(req, &v)
+    require.Equal(t, http.StatusBadRequest, code)
+    require.EqualError(t, err, "thttp: 1 trailing bytes after the payload")
+}
+
+func TestThttp_Negotiate(t *testing.T) {
+    for accept, ok := range map[string]bool {
+        ""                                          : true,
+        "*/*"                                       : true,
+        "application/*"                             : true,
+        ContentTypeBinary                           : true,
+        ContentTypeCompact                          : false,
+        "application/*;q=0, " + ContentTypeBinary   : true,
+        "*/*, " + ContentTypeBinary + ";q=0"        : false,
+        ContentTypeJSON + ", text/plain;q=0.5"      : false,
+    } {
+        ct, err := Negotiate(accept)
+        if ok {
+            require.NoError(t, err, accept)
+            require.Equal(t, ContentTypeBinary, ct)
+        } else {
+            require.Equal(t, ErrNotAcceptable, err, accept)
+        }
+    }
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2022 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package frugal
+
+import (
+    `bytes`
+    `compress/zlib`
+    `errors`
+    `fmt`
+    `io`
+    `sync`
+)
+
+// Transform is a THeader payload transform, such as compression. The transform
+// is applied to the whole payload after the THeader headers, which includes the
+// message header and the encoded struct.
+type Transform interface {
+    // Bound returns the maximum size of n bytes after being transformed.
+    Bound(n int) int
+
+    // Encode transforms src into dst and returns the number of bytes written. dst
+    // has at least Bound(len(src)) bytes.
+    Encode(dst []byte, src []byte) (int, error)
+
+    // Decode reverses the transform, and appends the result to dst. It must fail
+    // with ErrTransformLimit without producing the rest of the result as soon as
+    // the result exceeds limit bytes, a limit of 0 means unlimited.
+    Decode(dst []byte, src []byte, limit int) ([]byte, error)
+}
+
+const (
+    // TransformZlib is the THeader zlib transform, it is always available.
+    TransformZlib = 1
+)
+
+// ErrTransformLimit is returned by DecodeMessage when a THeader payload exceeds
+// the limit set by SetMaxTransformedBytes after its transforms are undone.
+var ErrTransformLimit = errors.New("frugal: transformed payload is too large")
+
+var (
+    transformLock = new(sync.RWMutex)
+    transformTab  = map[int]Transform { TransformZlib: _ZlibTransform{} }
+)
+
+// RegisterTransform registers tf as the THeader transform with ID id, so it can
+// be used in Message.Transforms. This is how transforms that require third-party
+// libraries, such as zstd or snappy, can be plugged in. Registering an ID again
+// replaces the previous transform.
+func RegisterTransform(id int, tf Transform) {
+    if id <= 0 {
+        panic(fmt.Sprintf("frugal: invalid transform ID: %d", id))
+    } else if tf == nil {
+        panic("frugal: nil transform")
+    }
+
+    /* update the transform table */
+    transformLock.Lock()
+    transformTab[id] = tf
+    transformLock.Unlock()
+}
+
+func findTransforms(ids []int) ([]Transform, error) {
+    ret := make([]Transform, 0, len(ids))
+    transformLock.RLock()
+    defer transformLock.RUnlock()
+
+    /* every transform must be registered */
+    for _, id := range ids {
+        if tf, ok := transformTab[id]; ok {
+            ret = append(ret, tf)
+        } else {
+            return nil, fmt.Errorf("frugal: unsupported THeader transform: %d", id)
+        }
+    }
+
+    /* all done */
+    return ret, nil
+}
+
+type _FixedWriter struct {
+    n   int
+    buf []byte
+}
+
+func (self *_FixedWriter) Write(p []byte) (int, error) {
+    if len(p) > len(self.buf) - self.n {
+        return 0, errMessageSpace
+    } else {
+        self.n += copy(self.buf[self.n:], p)
+        return len(p), nil
+    }
+}
+
+var (
+    zlibReaders = sync.Pool{}
+    zlibWriters = sync.Pool{}
+)
+
+type _ZlibTransform struct{}
+
+func (_ZlibTransform) Bound(n int) int {
+    return n + (n >> 11) + 32
+}
+
+func (_ZlibTransform) Encode(dst []byte, src []byte) (int, error) {
+    var zw *zlib.Writer
+    var wr = &_FixedWriter { buf: dst }
+
+    /* reuse the compressor state if possible */
+    if v := zlibWriters.Get(); v == nil {
+        zw = zlib.NewWriter(wr)
+    } else {
+        zw = v.(*zlib.Writer)
+        zw.Reset(wr)
+    }
+
+    /* compress the payload */
+    _, err := zw.Write(src)
+    if err == nil {
+        err = zw.Close()
+    }
+
+    /* return the compressor into pool */
+    zw.Reset(nil)
+    zlibWriters.Put(zw)
+    return wr.n, err
+}
+
+func (_ZlibTransform) Decode(dst []byte, src []byte, limit int) ([]byte, error) {
+    var err error
+    var ir io.Reader
+    var zr io.ReadCloser
+    var rd = bytes.NewReader(src)
+
+    /* reuse the decompressor state if possible */
+    if v := zlibReaders.Get(); v == nil {
+        zr, err = zlib.NewReader(rd)
+    } else {
+        zr, err = v.(io.ReadCloser), v.(zlib.Resetter).Reset(rd, nil)
+    }
+
+    /* check for header errors */
+    if err != nil {
+        return nil, fmt.Errorf("frugal: invalid zlib payload: %w", err)
+    }
+
+    /* read one more byte than the limit to tell if it is exceeded */
+    if ir = zr; limit > 0 {
+        ir = io.LimitReader(zr, int64(limit) + 1)
+    }
+
+    /* decompress the payload */
+    buf := bytes.NewBuffer(dst)
+    _, err = buf.ReadFrom(ir)
+
+    /* the rest of the payload is not inflated */
+    if err == nil && limit > 0 && buf.Len() - len(dst) > limit {
+        return nil, ErrTransformLimit
+    }
+
+    /* the decompressor can only be reused if it is properly closed */
+    if err == nil {
+        if err = zr.Close(); err == nil {
+            zlibReaders.Put(zr)
+        }
+    }
+
+    /* check for decompression errors */
+    if err != nil {
+        return nil, fmt.Errorf("frugal: invalid zlib payload: %w", err)
+    } else {
+        return buf.Bytes(), nil
+    }
+}